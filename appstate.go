@@ -20,11 +20,18 @@ import (
 	"github.com/shiestapoi/whatsmeow/store"
 	"github.com/shiestapoi/whatsmeow/types"
 	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
 )
 
 // FetchAppState fetches updates to the given type of app state. If fullSync is true, the current
 // cached state will be removed and all app state patches will be re-fetched from the server.
 func (cli *Client) FetchAppState(name appstate.WAPatchName, fullSync, onlyIfNotSynced bool) error {
+	return cli.FetchAppStateContext(context.TODO(), name, fullSync, onlyIfNotSynced)
+}
+
+// FetchAppStateContext is like FetchAppState, but takes a context for cancellation and deadlines.
+func (cli *Client) FetchAppStateContext(ctx context.Context, name appstate.WAPatchName, fullSync, onlyIfNotSynced bool) error {
+	log := waLog.With(cli.Log, waLog.FieldAppState, name)
 	if cli == nil {
 		return ErrClientIsNil
 	}
@@ -51,7 +58,7 @@ func (cli *Client) FetchAppState(name appstate.WAPatchName, fullSync, onlyIfNotS
 	hasMore := true
 	wantSnapshot := fullSync
 	for hasMore {
-		patches, err := cli.fetchAppStatePatches(name, state.Version, wantSnapshot)
+		patches, err := cli.fetchAppStatePatches(ctx, name, state.Version, wantSnapshot)
 		wantSnapshot = false
 		if err != nil {
 			return fmt.Errorf("failed to fetch app state %s patches: %w", name, err)
@@ -70,7 +77,7 @@ func (cli *Client) FetchAppState(name appstate.WAPatchName, fullSync, onlyIfNotS
 		if name == appstate.WAPatchCriticalUnblockLow && wasFullSync && !cli.EmitAppStateEventsOnFullSync {
 			var contacts []store.ContactEntry
 			mutations, contacts = cli.filterContacts(mutations)
-			cli.Log.Debugf("Mass inserting app state snapshot with %d contacts into the store", len(contacts))
+			log.Debugf("Mass inserting app state snapshot with %d contacts into the store", len(contacts))
 			err = cli.Store.Contacts.PutAllContactNames(contacts)
 			if err != nil {
 				// This is a fairly serious failure, so just abort the whole thing
@@ -82,10 +89,10 @@ func (cli *Client) FetchAppState(name appstate.WAPatchName, fullSync, onlyIfNotS
 		}
 	}
 	if fullSync {
-		cli.Log.Debugf("Full sync of app state %s completed. Current version: %d", name, state.Version)
+		log.Debugf("Full sync of app state %s completed. Current version: %d", name, state.Version)
 		cli.dispatchEvent(&events.AppStateSyncComplete{Name: name})
 	} else {
-		cli.Log.Debugf("Synced app state %s from version %d to %d", name, version, state.Version)
+		log.Debugf("Synced app state %s from version %d to %d", name, version, state.Version)
 	}
 	return nil
 }
@@ -124,6 +131,7 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, fullSync bool, e
 	if len(mutation.Index) > 1 {
 		jid, _ = types.ParseJID(mutation.Index[1])
 	}
+	log := waLog.With(cli.Log, waLog.FieldChat, jid)
 	ts := time.UnixMilli(mutation.Action.GetTimestamp())
 
 	var storeUpdateError error
@@ -160,9 +168,15 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, fullSync bool, e
 	case appstate.IndexClearChat:
 		act := mutation.Action.GetClearChatAction()
 		eventToDispatch = &events.ClearChat{JID: jid, Timestamp: ts, Action: act, FromFullSync: fullSync}
+		if cli.Store.ChatSettings != nil {
+			storeUpdateError = cli.Store.ChatSettings.PutLastCleared(jid, ts)
+		}
 	case appstate.IndexDeleteChat:
 		act := mutation.Action.GetDeleteChatAction()
 		eventToDispatch = &events.DeleteChat{JID: jid, Timestamp: ts, Action: act, FromFullSync: fullSync}
+		if cli.Store.ChatSettings != nil {
+			storeUpdateError = cli.Store.ChatSettings.PutLastCleared(jid, ts)
+		}
 	case appstate.IndexStar:
 		if len(mutation.Index) < 5 {
 			return
@@ -196,12 +210,16 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, fullSync bool, e
 		}
 		eventToDispatch = &evt
 	case appstate.IndexMarkChatAsRead:
+		act := mutation.Action.GetMarkChatAsReadAction()
 		eventToDispatch = &events.MarkChatAsRead{
 			JID:          jid,
 			Timestamp:    ts,
-			Action:       mutation.Action.GetMarkChatAsReadAction(),
+			Action:       act,
 			FromFullSync: fullSync,
 		}
+		if cli.Store.ChatSettings != nil {
+			storeUpdateError = cli.Store.ChatSettings.PutMarkedAsUnread(jid, !act.GetRead())
+		}
 	case appstate.IndexSettingPushName:
 		eventToDispatch = &events.PushNameSetting{
 			Timestamp:    ts,
@@ -211,7 +229,7 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, fullSync bool, e
 		cli.Store.PushName = mutation.Action.GetPushNameSetting().GetName()
 		err := cli.Store.Save()
 		if err != nil {
-			cli.Log.Errorf("Failed to save device store after updating push name: %v", err)
+			log.Errorf("Failed to save device store after updating push name: %v", err)
 		}
 	case appstate.IndexSettingUnarchiveChats:
 		eventToDispatch = &events.UnarchiveChatsSetting{
@@ -247,6 +265,9 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, fullSync bool, e
 			Action:       act,
 			FromFullSync: fullSync,
 		}
+		if cli.Store.ChatSettings != nil {
+			storeUpdateError = cli.Store.ChatSettings.PutChatLabel(jid, mutation.Index[1], act.GetLabeled())
+		}
 	case appstate.IndexLabelAssociationMessage:
 		if len(mutation.Index) < 6 {
 			return
@@ -261,20 +282,25 @@ func (cli *Client) dispatchAppState(mutation appstate.Mutation, fullSync bool, e
 			Action:       act,
 			FromFullSync: fullSync,
 		}
+	default:
+		// Chat locks don't have a known index name, so they're detected by the action type instead
+		if act := mutation.Action.GetLockChatAction(); act != nil && !jid.IsEmpty() && cli.Store.ChatSettings != nil {
+			storeUpdateError = cli.Store.ChatSettings.PutLocked(jid, act.GetLocked())
+		}
 	}
 	if storeUpdateError != nil {
-		cli.Log.Errorf("Failed to update device store after app state mutation: %v", storeUpdateError)
+		log.Errorf("Failed to update device store after app state mutation: %v", storeUpdateError)
 	}
 	if dispatchEvts && eventToDispatch != nil {
 		cli.dispatchEvent(eventToDispatch)
 	}
 }
 
-func (cli *Client) downloadExternalAppStateBlob(ref *waServerSync.ExternalBlobReference) ([]byte, error) {
-	return cli.Download(ref)
+func (cli *Client) downloadExternalAppStateBlob(ctx context.Context, ref *waServerSync.ExternalBlobReference) ([]byte, error) {
+	return cli.DownloadContext(ctx, ref)
 }
 
-func (cli *Client) fetchAppStatePatches(name appstate.WAPatchName, fromVersion uint64, snapshot bool) (*appstate.PatchList, error) {
+func (cli *Client) fetchAppStatePatches(ctx context.Context, name appstate.WAPatchName, fromVersion uint64, snapshot bool) (*appstate.PatchList, error) {
 	attrs := waBinary.Attrs{
 		"name":            string(name),
 		"return_snapshot": snapshot,
@@ -283,6 +309,7 @@ func (cli *Client) fetchAppStatePatches(name appstate.WAPatchName, fromVersion u
 		attrs["version"] = fromVersion
 	}
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "w:sync:app:state",
 		Type:      "set",
 		To:        types.ServerJID,
@@ -297,7 +324,9 @@ func (cli *Client) fetchAppStatePatches(name appstate.WAPatchName, fromVersion u
 	if err != nil {
 		return nil, err
 	}
-	return appstate.ParsePatchList(resp, cli.downloadExternalAppStateBlob)
+	return appstate.ParsePatchList(resp, func(ref *waServerSync.ExternalBlobReference) ([]byte, error) {
+		return cli.downloadExternalAppStateBlob(ctx, ref)
+	})
 }
 
 func (cli *Client) requestMissingAppStateKeys(ctx context.Context, patches *appstate.PatchList) {
@@ -350,6 +379,11 @@ func (cli *Client) requestAppStateKeys(ctx context.Context, rawKeyIDs [][]byte)
 //
 //	cli.SendAppState(appstate.BuildMute(targetJID, true, 24 * time.Hour))
 func (cli *Client) SendAppState(patch appstate.PatchInfo) error {
+	return cli.SendAppStateContext(context.TODO(), patch)
+}
+
+// SendAppStateContext is like SendAppState, but takes a context for cancellation and deadlines.
+func (cli *Client) SendAppStateContext(ctx context.Context, patch appstate.PatchInfo) error {
 	if cli == nil {
 		return ErrClientIsNil
 	}
@@ -373,6 +407,7 @@ func (cli *Client) SendAppState(patch appstate.PatchInfo) error {
 	}
 
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "w:sync:app:state",
 		Type:      iqSet,
 		To:        types.ServerJID,
@@ -403,5 +438,5 @@ func (cli *Client) SendAppState(patch appstate.PatchInfo) error {
 		return fmt.Errorf("%w: %s", ErrAppStateUpdate, respCollection.XMLString())
 	}
 
-	return cli.FetchAppState(patch.Type, false, false)
+	return cli.FetchAppStateContext(ctx, patch.Type, false, false)
 }
@@ -114,7 +114,9 @@ func ParsePatchList(node *waBinary.Node, downloadExternal DownloadExternalFunc)
 type patchOutput struct {
 	RemovedMACs [][]byte
 	AddedMACs   []store.AppStateMutationMAC
-	Mutations   []Mutation
+	// Values contains the latest value of each index changed in the patch. Removed indexes have a nil Value.
+	Values    map[string]*store.AppStateValue
+	Mutations []Mutation
 }
 
 func (proc *Processor) decodeMutations(mutations []*waServerSync.SyncdMutation, out *patchOutput, validateMACs bool) error {
@@ -154,13 +156,18 @@ func (proc *Processor) decodeMutations(mutations []*waServerSync.SyncdMutation,
 		if err != nil {
 			return fmt.Errorf("failed to unmarshal index of mutation #%d: %w", i+1, err)
 		}
+		if out.Values == nil {
+			out.Values = make(map[string]*store.AppStateValue)
+		}
 		if mutation.GetOperation() == waServerSync.SyncdMutation_REMOVE {
 			out.RemovedMACs = append(out.RemovedMACs, indexMAC)
+			out.Values[string(syncAction.GetIndex())] = &store.AppStateValue{Index: index}
 		} else if mutation.GetOperation() == waServerSync.SyncdMutation_SET {
 			out.AddedMACs = append(out.AddedMACs, store.AppStateMutationMAC{
 				IndexMAC: indexMAC,
 				ValueMAC: valueMAC,
 			})
+			out.Values[string(syncAction.GetIndex())] = &store.AppStateValue{Index: index, Value: syncAction.GetValue()}
 		}
 		out.Mutations = append(out.Mutations, Mutation{
 			Operation: mutation.GetOperation(),
@@ -188,6 +195,37 @@ func (proc *Processor) storeMACs(name WAPatchName, currentState HashState, out *
 	}
 }
 
+// storeValues updates the stored current values of the indexes changed in the patch.
+// If replaceAll is true, all previously stored values of the state are removed first.
+func (proc *Processor) storeValues(name WAPatchName, out *patchOutput, replaceAll bool) {
+	if proc.Store.AppStateValues == nil {
+		return
+	}
+	if replaceAll {
+		err := proc.Store.AppStateValues.DeleteAllAppStateValues(string(name))
+		if err != nil {
+			proc.Log.Errorf("Failed to remove old app state values from the database: %v", err)
+		}
+	}
+	var removed [][]string
+	added := make([]store.AppStateValue, 0, len(out.Values))
+	for _, value := range out.Values {
+		if value.Value == nil {
+			removed = append(removed, value.Index)
+		} else {
+			added = append(added, *value)
+		}
+	}
+	err := proc.Store.AppStateValues.DeleteAppStateValues(string(name), removed)
+	if err != nil {
+		proc.Log.Errorf("Failed to remove deleted app state values from the database: %v", err)
+	}
+	err = proc.Store.AppStateValues.PutAppStateValues(string(name), added)
+	if err != nil {
+		proc.Log.Errorf("Failed to insert updated app state values to the database: %v", err)
+	}
+}
+
 func (proc *Processor) validateSnapshotMAC(name WAPatchName, currentState HashState, keyID, expectedSnapshotMAC []byte) (keys ExpandedAppStateKeys, err error) {
 	keys, err = proc.getAppStateKey(keyID)
 	if err != nil {
@@ -240,6 +278,8 @@ func (proc *Processor) decodeSnapshot(name WAPatchName, ss *waServerSync.SyncdSn
 		return
 	}
 	proc.storeMACs(name, currentState, &out)
+	// Snapshots contain the full state, so anything not included in it doesn't exist anymore
+	proc.storeValues(name, &out, true)
 	newMutations = out.Mutations
 	return
 }
@@ -305,6 +345,7 @@ func (proc *Processor) DecodePatches(list *PatchList, initialState HashState, va
 			return
 		}
 		proc.storeMACs(list.Name, currentState, &out)
+		proc.storeValues(list.Name, &out, false)
 		newMutations = out.Mutations
 	}
 	return
@@ -16,4 +16,5 @@ var (
 	ErrMismatchingContentMAC            = errors.New("mismatching content MAC")
 	ErrMismatchingIndexMAC              = errors.New("mismatching index MAC")
 	ErrKeyNotFound                      = errors.New("didn't find app state key")
+	ErrValueStoreNotAvailable           = errors.New("app state value store not available")
 )
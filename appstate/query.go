@@ -0,0 +1,52 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package appstate
+
+import (
+	"fmt"
+
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/store"
+)
+
+// GetValue returns the current value of the given index in the given app state, or nil if the index isn't set.
+//
+// Values are stored as patches are decoded, so indexes that were last changed before the value store
+// was available will only be found after a full resync of the state.
+func (proc *Processor) GetValue(name WAPatchName, index ...string) (*waSyncAction.SyncActionValue, error) {
+	if proc.Store.AppStateValues == nil {
+		return nil, ErrValueStoreNotAvailable
+	} else if len(index) == 0 {
+		return nil, fmt.Errorf("index must not be empty")
+	}
+	return proc.Store.AppStateValues.GetAppStateValue(string(name), index)
+}
+
+// ListValues returns the current values of all indexes in the given app state that start with the given parts.
+// The prefix must contain at least the action name, e.g. IndexPin.
+func (proc *Processor) ListValues(name WAPatchName, prefix ...string) ([]store.AppStateValue, error) {
+	if proc.Store.AppStateValues == nil {
+		return nil, ErrValueStoreNotAvailable
+	} else if len(prefix) == 0 {
+		return nil, fmt.Errorf("index prefix must not be empty")
+	}
+	return proc.Store.AppStateValues.GetAppStateValuesByPrefix(string(name), prefix)
+}
+
+// ListValuesInAllStates is like ListValues, but searches every known app state.
+// This is useful for indexes whose state isn't fixed, like labels.
+func (proc *Processor) ListValuesInAllStates(prefix ...string) ([]store.AppStateValue, error) {
+	var output []store.AppStateValue
+	for _, name := range AllPatchNames {
+		values, err := proc.ListValues(name, prefix...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list values in %s: %w", name, err)
+		}
+		output = append(output, values...)
+	}
+	return output, nil
+}
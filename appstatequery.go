@@ -0,0 +1,143 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/appstate"
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// GetAppStateValue returns the current value of the given app state index, or nil if the index isn't set.
+//
+// Values are stored as app state patches are received. If the device was logged in before the values were
+// stored, use FetchAppState with fullSync set to true to populate them.
+func (cli *Client) GetAppStateValue(name appstate.WAPatchName, index ...string) (*waSyncAction.SyncActionValue, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	}
+	return cli.appStateProc.GetValue(name, index...)
+}
+
+// ListAppStateValues returns the current values of all indexes in the given app state that start with the given parts.
+// The prefix must contain at least the action name, e.g. appstate.IndexPin.
+func (cli *Client) ListAppStateValues(name appstate.WAPatchName, prefix ...string) ([]store.AppStateValue, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	}
+	return cli.appStateProc.ListValues(name, prefix...)
+}
+
+// GetLabels returns all labels that currently exist, based on the stored app state.
+func (cli *Client) GetLabels() ([]*events.LabelEdit, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	}
+	values, err := cli.appStateProc.ListValuesInAllStates(appstate.IndexLabelEdit)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]*events.LabelEdit, 0, len(values))
+	for _, value := range values {
+		act := value.Value.GetLabelEditAction()
+		if len(value.Index) < 2 || act == nil || act.GetDeleted() {
+			continue
+		}
+		labels = append(labels, &events.LabelEdit{
+			Timestamp: time.UnixMilli(value.Value.GetTimestamp()),
+			LabelID:   value.Index[1],
+			Action:    act,
+		})
+	}
+	return labels, nil
+}
+
+// GetPinnedChats returns all currently pinned chats, based on the stored app state.
+func (cli *Client) GetPinnedChats() ([]*events.Pin, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	}
+	values, err := cli.appStateProc.ListValuesInAllStates(appstate.IndexPin)
+	if err != nil {
+		return nil, err
+	}
+	pins := make([]*events.Pin, 0, len(values))
+	for _, value := range values {
+		if len(value.Index) < 2 || !value.Value.GetPinAction().GetPinned() {
+			continue
+		}
+		jid, _ := types.ParseJID(value.Index[1])
+		pins = append(pins, &events.Pin{
+			JID:       jid,
+			Timestamp: time.UnixMilli(value.Value.GetTimestamp()),
+			Action:    value.Value.GetPinAction(),
+		})
+	}
+	return pins, nil
+}
+
+// GetMutedChats returns all chats that are currently muted, based on the stored app state.
+//
+// The mute end time is in Action.MuteEndTimestamp. Mutes that have already expired are not included.
+func (cli *Client) GetMutedChats() ([]*events.Mute, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	}
+	values, err := cli.appStateProc.ListValuesInAllStates(appstate.IndexMute)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	mutes := make([]*events.Mute, 0, len(values))
+	for _, value := range values {
+		act := value.Value.GetMuteAction()
+		// A negative end timestamp means the chat is muted forever
+		if len(value.Index) < 2 || !act.GetMuted() || (act.GetMuteEndTimestamp() > 0 && act.GetMuteEndTimestamp() < now) {
+			continue
+		}
+		jid, _ := types.ParseJID(value.Index[1])
+		mutes = append(mutes, &events.Mute{
+			JID:       jid,
+			Timestamp: time.UnixMilli(value.Value.GetTimestamp()),
+			Action:    act,
+		})
+	}
+	return mutes, nil
+}
+
+// GetStarredMessages returns all currently starred messages, based on the stored app state.
+func (cli *Client) GetStarredMessages() ([]*events.Star, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	}
+	values, err := cli.appStateProc.ListValuesInAllStates(appstate.IndexStar)
+	if err != nil {
+		return nil, err
+	}
+	stars := make([]*events.Star, 0, len(values))
+	for _, value := range values {
+		if len(value.Index) < 5 || !value.Value.GetStarAction().GetStarred() {
+			continue
+		}
+		evt := &events.Star{
+			MessageID: value.Index[2],
+			IsFromMe:  value.Index[3] == "1",
+			Timestamp: time.UnixMilli(value.Value.GetTimestamp()),
+			Action:    value.Value.GetStarAction(),
+		}
+		evt.ChatJID, _ = types.ParseJID(value.Index[1])
+		if value.Index[4] != "0" {
+			evt.SenderJID, _ = types.ParseJID(value.Index[4])
+		}
+		stars = append(stars, evt)
+	}
+	return stars, nil
+}
@@ -40,7 +40,7 @@ func (n *Node) UnmarshalJSON(data []byte) error {
 		switch typedVal := val.(type) {
 		case string:
 			parsed, err := types.ParseJID(typedVal)
-			if err == nil && parsed.Server == types.DefaultUserServer || parsed.Server == types.NewsletterServer || parsed.Server == types.GroupServer || parsed.Server == types.BroadcastServer {
+			if err == nil && (parsed.Server == types.DefaultUserServer || parsed.Server == types.HiddenUserServer || parsed.Server == types.NewsletterServer || parsed.Server == types.GroupServer || parsed.Server == types.BroadcastServer) {
 				mn.Attrs[key] = parsed
 			}
 		case float64:
@@ -49,7 +49,7 @@ func (n *Node) UnmarshalJSON(data []byte) error {
 	}
 	n.Tag = mn.Tag
 	n.Attrs = mn.Attrs
-	if len(mn.Content) > 0 {
+	if len(mn.Content) > 0 && string(mn.Content) != "null" {
 		if mn.Content[0] == '[' {
 			var nodes []Node
 			err = json.Unmarshal(mn.Content, &nodes)
@@ -13,34 +13,50 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/redact"
 )
 
 // Options to control how Node.XMLString behaves.
 var (
 	IndentXML            = false
 	MaxBytesToPrintAsHex = 128
+	// Redaction, if set, is used to mask JIDs and hide message plaintext and key material in XMLString output.
+	Redaction *redact.Config
 )
 
 // XMLString converts the Node to its XML representation
 func (n *Node) XMLString() string {
-	content := n.contentString()
+	return n.RedactedXMLString(Redaction)
+}
+
+// RedactedXMLString converts the Node to its XML representation, redacting sensitive data with the given config.
+func (n *Node) RedactedXMLString(cfg *redact.Config) string {
+	content := n.contentString(cfg)
 	if len(content) == 0 {
-		return fmt.Sprintf("<%[1]s%[2]s/>", n.Tag, n.attributeString())
+		return fmt.Sprintf("<%[1]s%[2]s/>", n.Tag, n.attributeString(cfg))
 	}
 	newline := "\n"
 	if len(content) == 1 || !IndentXML {
 		newline = ""
 	}
-	return fmt.Sprintf("<%[1]s%[2]s>%[4]s%[3]s%[4]s</%[1]s>", n.Tag, n.attributeString(), strings.Join(content, newline), newline)
+	return fmt.Sprintf("<%[1]s%[2]s>%[4]s%[3]s%[4]s</%[1]s>", n.Tag, n.attributeString(cfg), strings.Join(content, newline), newline)
 }
 
-func (n *Node) attributeString() string {
+func (n *Node) attributeString(cfg *redact.Config) string {
 	if len(n.Attrs) == 0 {
 		return ""
 	}
 	stringAttrs := make([]string, len(n.Attrs)+1)
 	i := 1
 	for key, value := range n.Attrs {
+		switch typedValue := value.(type) {
+		case types.JID:
+			value = cfg.JID(typedValue)
+		case string:
+			value = cfg.Text(typedValue)
+		}
 		stringAttrs[i] = fmt.Sprintf(`%s="%v"`, key, value)
 		i++
 	}
@@ -61,19 +77,22 @@ func printable(data []byte) string {
 	return str
 }
 
-func (n *Node) contentString() []string {
+func (n *Node) contentString(cfg *redact.Config) []string {
 	split := make([]string, 0)
 	switch content := n.Content.(type) {
 	case []Node:
 		for _, item := range content {
-			split = append(split, strings.Split(item.XMLString(), "\n")...)
+			split = append(split, strings.Split(item.RedactedXMLString(cfg), "\n")...)
 		}
 	case []byte:
-		if strContent := printable(content); len(strContent) > 0 {
+		if placeholder := cfg.NodeContent(n.Tag, len(content)); len(placeholder) > 0 {
+			split = append(split, placeholder)
+		} else if strContent := printable(content); len(strContent) > 0 {
+			strContent = cfg.Text(strContent)
 			if IndentXML {
-				split = append(split, strings.Split(string(content), "\n")...)
+				split = append(split, strings.Split(strContent, "\n")...)
 			} else {
-				split = append(split, strings.ReplaceAll(string(content), "\n", "\\n"))
+				split = append(split, strings.ReplaceAll(strContent, "\n", "\\n"))
 			}
 		} else if len(content) > MaxBytesToPrintAsHex {
 			split = append(split, fmt.Sprintf("<!-- %d bytes -->", len(content)))
@@ -93,6 +112,11 @@ func (n *Node) contentString() []string {
 		// don't append anything
 	default:
 		strContent := fmt.Sprintf("%s", content)
+		if placeholder := cfg.NodeContent(n.Tag, len(strContent)); len(placeholder) > 0 {
+			strContent = placeholder
+		} else {
+			strContent = cfg.Text(strContent)
+		}
 		if IndentXML {
 			split = append(split, strings.Split(strContent, "\n")...)
 		} else {
@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -14,11 +15,11 @@ import (
 	"github.com/shiestapoi/whatsmeow/types"
 )
 
-func (cli *Client) getBroadcastListParticipants(jid types.JID) ([]types.JID, error) {
+func (cli *Client) getBroadcastListParticipants(ctx context.Context, jid types.JID) ([]types.JID, error) {
 	var list []types.JID
 	var err error
 	if jid == types.StatusBroadcastJID {
-		list, err = cli.getStatusBroadcastRecipients()
+		list, err = cli.getStatusBroadcastRecipients(ctx)
 	} else {
 		return nil, ErrBroadcastListUnsupported
 	}
@@ -43,8 +44,8 @@ func (cli *Client) getBroadcastListParticipants(jid types.JID) ([]types.JID, err
 	return list, nil
 }
 
-func (cli *Client) getStatusBroadcastRecipients() ([]types.JID, error) {
-	statusPrivacyOptions, err := cli.GetStatusPrivacy()
+func (cli *Client) getStatusBroadcastRecipients(ctx context.Context) ([]types.JID, error) {
+	statusPrivacyOptions, err := cli.GetStatusPrivacyContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get status privacy: %w", err)
 	}
@@ -90,7 +91,13 @@ var DefaultStatusPrivacy = []types.StatusPrivacy{{
 //
 // There can be multiple different stored settings, the first one is always the default.
 func (cli *Client) GetStatusPrivacy() ([]types.StatusPrivacy, error) {
+	return cli.GetStatusPrivacyContext(context.TODO())
+}
+
+// GetStatusPrivacyContext is like GetStatusPrivacy, but takes a context for cancellation and deadlines.
+func (cli *Client) GetStatusPrivacyContext(ctx context.Context) ([]types.StatusPrivacy, error) {
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "status",
 		Type:      iqGet,
 		To:        types.ServerJID,
@@ -59,10 +59,34 @@ type Client struct {
 	recvLog waLog.Logger
 	sendLog waLog.Logger
 
+	// Metrics receives measurements of the connection and message pipelines. If nil, measurements are discarded.
+	Metrics Metrics
+	// Tracer creates spans for sending and handling messages. If nil, spans are only created when a tracer is
+	// passed in the context with ContextWithTracer.
+	Tracer Tracer
+
+	recorder atomic.Pointer[NodeRecorder]
+	replayer atomic.Pointer[replayer]
+
 	socket     *socket.NoiseSocket
 	socketLock sync.RWMutex
 	socketWait chan struct{}
 	wsDialer   *websocket.Dialer
+	transport  socket.Transport
+
+	connState            events.ConnectionState
+	connStateWait        chan struct{}
+	connStateEvents      []*events.ConnectionStateChanged
+	connStateDispatching bool
+	connStateLock        sync.Mutex
+
+	// ServerURL overrides the URL that Connect connects to. If empty, socket.URL is used.
+	ServerURL string
+	// ServerOrigin overrides the Origin header sent when connecting. If empty, socket.Origin is used.
+	ServerOrigin string
+	// ServerCertRootKey overrides the root key that the server's noise certificate chain must be signed with.
+	// If nil, WACertPubKey is used. This is only useful for connecting to mock servers in tests.
+	ServerCertRootKey *[32]byte
 
 	isLoggedIn            atomic.Bool
 	expectedDisconnect    atomic.Bool
@@ -72,8 +96,17 @@ type Client struct {
 	// AutoReconnectHook is called when auto-reconnection fails. If the function returns false,
 	// the client will not attempt to reconnect. The number of retries can be read from AutoReconnectErrors.
 	AutoReconnectHook func(error) bool
+	// ReconnectPolicy decides the delay before each automatic reconnect attempt and when to give up.
+	// If nil, the delay starts at zero and grows by 2 seconds after each failed attempt without a limit.
+	ReconnectPolicy  ReconnectPolicy
+	disconnectReason atomic.Pointer[DisconnectInfo]
 	// If SynchronousAck is set, acks for messages will only be sent after all event handlers return.
 	SynchronousAck bool
+	// ParallelMessageHandlers is the number of workers that decrypt and handle incoming messages in parallel.
+	// Messages are assigned to workers by chat, so messages in the same chat are still handled in order.
+	// Other nodes, like receipts and notifications, are only handled after all previously received messages.
+	// Values below 2 handle everything on a single goroutine. Changes take effect on the next connect.
+	ParallelMessageHandlers int
 
 	DisableLoginAutoReconnect bool
 
@@ -83,6 +116,14 @@ type Client struct {
 	// even when re-syncing the whole state.
 	EmitAppStateEventsOnFullSync bool
 
+	// NormalizeEventJIDs can be set to convert the sender and chat JIDs in message, receipt and chat presence
+	// events into a consistent form using the stored LID mappings. When a sender is converted, the original
+	// JID is moved to SenderAlt. JIDs whose mapping isn't known are left as-is.
+	NormalizeEventJIDs JIDForm
+
+	ownLID     types.JID
+	ownLIDLock sync.RWMutex
+
 	AutomaticMessageRerequestFromPhone bool
 	pendingPhoneRerequests             map[types.MessageID]context.CancelFunc
 	pendingPhoneRerequestsLock         sync.RWMutex
@@ -95,6 +136,8 @@ type Client struct {
 
 	uploadPreKeysLock sync.Mutex
 	lastPreKeyUpload  time.Time
+	// signedPreKeyUploadPending is set when a rotated signed prekey couldn't be uploaded.
+	signedPreKeyUploadPending bool
 
 	mediaConnCache *MediaConn
 	mediaConnLock  sync.Mutex
@@ -104,8 +147,12 @@ type Client struct {
 
 	nodeHandlers      map[string]nodeHandler
 	handlerQueue      chan *waBinary.Node
+	handlerLoopLock   sync.Mutex
+	decryptLocks      keyedLocks
 	eventHandlers     []wrappedEventHandler
 	eventHandlersLock sync.RWMutex
+	subscriptions     []*Subscription
+	subscriptionsLock sync.RWMutex
 
 	messageRetries     map[string]int
 	messageRetriesLock sync.Mutex
@@ -117,6 +164,19 @@ type Client struct {
 	appStateKeyRequestsLock sync.RWMutex
 
 	messageSendLock sync.Mutex
+	rateLimit       rateLimiter
+
+	// OutboxBackoff returns how long to wait before retrying to send a message from the outbox after the given
+	// number of failed attempts. If nil, DefaultOutboxBackoff is used.
+	OutboxBackoff func(attempts int) time.Duration
+	// OutboxMaxAttempts is the number of failed attempts after which a message is removed from the outbox.
+	// If zero, messages are retried until they're sent or fail with a permanent error.
+	OutboxMaxAttempts int
+
+	outboxRunning    atomic.Bool
+	outboxWakeup     chan struct{}
+	outboxLastQueued time.Time
+	outboxLock       sync.Mutex
 
 	privacySettingsCache atomic.Value
 
@@ -134,6 +194,7 @@ type Client struct {
 	sessionRecreateHistoryLock sync.Mutex
 	// GetMessageForRetry is used to find the source message for handling retry receipts
 	// when the message is not found in the recently sent message cache.
+	// If this returns nil, the message store (Store.Messages) will be checked as a last resort.
 	GetMessageForRetry func(requester, to types.JID, id types.MessageID) *waE2E.Message
 	// PreRetryCallback is called before a retry receipt is accepted.
 	// If it returns false, the accepting will be cancelled and the retry receipt will be ignored.
@@ -212,6 +273,7 @@ func NewClient(deviceStore *store.Device, log waLog.Logger) *Client {
 		proxy:           http.ProxyFromEnvironment,
 		Store:           deviceStore,
 		Log:             log,
+		Metrics:         NoopMetrics{},
 		recvLog:         log.Sub("Recv"),
 		sendLog:         log.Sub("Send"),
 		uniqueID:        fmt.Sprintf("%d.%d-", uniqueIDPrefix[0], uniqueIDPrefix[1]),
@@ -221,6 +283,8 @@ func NewClient(deviceStore *store.Device, log waLog.Logger) *Client {
 		handlerQueue:    make(chan *waBinary.Node, handlerQueueSize),
 		appStateProc:    appstate.NewProcessor(deviceStore, log.Sub("AppState")),
 		socketWait:      make(chan struct{}),
+		connState:       events.ConnectionDisconnected,
+		connStateWait:   make(chan struct{}),
 
 		incomingRetryRequestCounter: make(map[incomingRetryKey]int),
 
@@ -236,6 +300,8 @@ func NewClient(deviceStore *store.Device, log waLog.Logger) *Client {
 
 		pendingPhoneRerequests: make(map[types.MessageID]context.CancelFunc),
 
+		outboxWakeup: make(chan struct{}, 1),
+
 		EnableAutoReconnect: true,
 		AutoTrustIdentity:   true,
 	}
@@ -354,6 +420,15 @@ func (cli *Client) SetSOCKSProxy(px proxy.Dialer, opts ...SetProxyOptions) {
 	}
 }
 
+// SetMediaHTTPClient sets the HTTP client used for media uploads and downloads.
+//
+// The same HTTP client can be shared by multiple Clients to reuse connections to the media servers. However,
+// SetProxy and SetSOCKSProxy modify the transport of the HTTP client, so clients sharing one must use the same
+// proxy settings, and the transport must be an *http.Transport if those methods are called.
+func (cli *Client) SetMediaHTTPClient(client *http.Client) {
+	cli.http = client
+}
+
 // ToggleProxyOnlyForLogin changes whether the proxy set with SetProxy or related methods
 // is only used for the pre-login websocket and not authenticated websockets.
 func (cli *Client) ToggleProxyOnlyForLogin(only bool) {
@@ -385,30 +460,28 @@ func (cli *Client) getOwnID() types.JID {
 	return *id
 }
 
+// WaitForConnection waits until the client is connected and logged in, or until the timeout.
+// It's equivalent to waiting for the syncing offline or online states with WaitForState.
 func (cli *Client) WaitForConnection(timeout time.Duration) bool {
 	if cli == nil {
 		return false
 	}
-	timeoutChan := time.After(timeout)
-	cli.socketLock.RLock()
-	for cli.socket == nil || !cli.socket.IsConnected() || !cli.IsLoggedIn() {
-		ch := cli.socketWait
-		cli.socketLock.RUnlock()
-		select {
-		case <-ch:
-		case <-timeoutChan:
-			return false
-		}
-		cli.socketLock.RLock()
-	}
-	cli.socketLock.RUnlock()
-	return true
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := cli.WaitForState(ctx, events.ConnectionSyncingOffline, events.ConnectionOnline)
+	return err == nil
 }
 
 func (cli *Client) SetWSDialer(dialer *websocket.Dialer) {
 	cli.wsDialer = dialer
 }
 
+// SetTransport sets the transport used to connect to the server, e.g. socket.TCPTransport or socket.PipeTransport.
+// If the transport is nil (the default), a websocket transport using the configured proxy and websocket dialer is used.
+func (cli *Client) SetTransport(transport socket.Transport) {
+	cli.transport = transport
+}
+
 // Connect connects the client to the WhatsApp web websocket. After connection, it will either
 // authenticate if there's data in the device store, or emit a QREvent to set up a new link.
 func (cli *Client) Connect() error {
@@ -426,21 +499,26 @@ func (cli *Client) Connect() error {
 	}
 
 	cli.resetExpectedDisconnect()
-	var wsDialer websocket.Dialer
-	if cli.wsDialer != nil {
-		wsDialer = *cli.wsDialer
-	} else if !cli.proxyOnlyLogin || cli.Store.ID == nil {
-		if cli.proxy != nil {
-			wsDialer.Proxy = cli.proxy
-		} else if cli.socksProxy != nil {
-			wsDialer.NetDial = cli.socksProxy.Dial
-			contextDialer, ok := cli.socksProxy.(proxy.ContextDialer)
-			if ok {
-				wsDialer.NetDialContext = contextDialer.DialContext
+	cli.setConnectionState(events.ConnectionConnecting, "connect called")
+	transport := cli.transport
+	if transport == nil {
+		var wsDialer websocket.Dialer
+		if cli.wsDialer != nil {
+			wsDialer = *cli.wsDialer
+		} else if !cli.proxyOnlyLogin || cli.Store.ID == nil {
+			if cli.proxy != nil {
+				wsDialer.Proxy = cli.proxy
+			} else if cli.socksProxy != nil {
+				wsDialer.NetDial = cli.socksProxy.Dial
+				contextDialer, ok := cli.socksProxy.(proxy.ContextDialer)
+				if ok {
+					wsDialer.NetDialContext = contextDialer.DialContext
+				}
 			}
 		}
+		transport = socket.NewWebsocketTransport(wsDialer)
 	}
-	fs := socket.NewFrameSocket(cli.Log.Sub("Socket"), wsDialer)
+	fs := socket.NewFrameSocketWithTransport(cli.Log.Sub("Socket"), transport)
 	if cli.MessengerConfig != nil {
 		fs.URL = cli.MessengerConfig.WebsocketURL
 		fs.HTTPHeaders.Set("Origin", cli.MessengerConfig.BaseURL)
@@ -451,13 +529,24 @@ func (cli *Client) Connect() error {
 		//fs.HTTPHeaders.Set("Sec-Fetch-Mode", "websocket")
 		//fs.HTTPHeaders.Set("Sec-Fetch-Site", "cross-site")
 	}
+	if cli.ServerURL != "" {
+		fs.URL = cli.ServerURL
+	}
+	if cli.ServerOrigin != "" {
+		fs.HTTPHeaders.Set("Origin", cli.ServerOrigin)
+	}
 	if err := fs.Connect(); err != nil {
 		fs.Close(0)
+		cli.setDisconnectedState("failed to connect")
 		return err
-	} else if err = cli.doHandshake(fs, *keys.NewKeyPair()); err != nil {
+	}
+	cli.setConnectionState(events.ConnectionHandshaking, "socket connected")
+	if err := cli.doHandshake(fs, *keys.NewKeyPair()); err != nil {
 		fs.Close(0)
+		cli.setDisconnectedState("handshake failed")
 		return fmt.Errorf("noise handshake failed: %w", err)
 	}
+	cli.setConnectionState(events.ConnectionAuthenticating, "handshake complete")
 	go cli.keepAliveLoop(cli.socket.Context())
 	go cli.handlerQueueLoop(cli.socket.Context())
 	return nil
@@ -476,10 +565,18 @@ func (cli *Client) onDisconnect(ns *socket.NoiseSocket, remote bool) {
 		cli.socket = nil
 		cli.clearResponseWaiters(xmlStreamEndNode)
 		if !cli.isExpectedDisconnect() && remote {
+			if code := cli.getDisconnectReason().StreamErrorCode; code != "" {
+				cli.setDisconnectedState(fmt.Sprintf("stream error %s", code))
+			} else {
+				cli.setDisconnectedState("connection lost")
+			}
+			cli.getMetrics().Disconnected(DisconnectRemote)
 			cli.Log.Debugf("Emitting Disconnected event")
 			go cli.dispatchEvent(&events.Disconnected{})
 			go cli.autoReconnect()
 		} else if remote {
+			cli.setDisconnectedState("server closed connection")
+			cli.getMetrics().Disconnected(DisconnectExpected)
 			cli.Log.Debugf("OnDisconnect() called, but it was expected, so not emitting event")
 		} else {
 			cli.Log.Debugf("OnDisconnect() called after manual disconnection")
@@ -505,12 +602,25 @@ func (cli *Client) autoReconnect() {
 	if !cli.EnableAutoReconnect || cli.Store.ID == nil {
 		return
 	}
+	policy := cli.getReconnectPolicy()
+	reason := cli.getDisconnectReason()
+	var err error
 	for {
-		autoReconnectDelay := time.Duration(cli.AutoReconnectErrors) * 2 * time.Second
-		cli.Log.Debugf("Automatically reconnecting after %v", autoReconnectDelay)
 		cli.AutoReconnectErrors++
+		autoReconnectDelay, stop := policy.NextDelay(ReconnectAttempt{
+			Attempt: cli.AutoReconnectErrors,
+			Error:   err,
+			Reason:  reason,
+		})
+		if stop {
+			cli.Log.Warnf("Reconnect policy gave up after %d attempts", cli.AutoReconnectErrors-1)
+			cli.dispatchEvent(&events.ReconnectGaveUp{Attempts: cli.AutoReconnectErrors - 1, Error: err})
+			return
+		}
+		cli.Log.Debugf("Automatically reconnecting after %v", autoReconnectDelay)
+		cli.dispatchEvent(&events.ReconnectScheduled{Attempt: cli.AutoReconnectErrors, Delay: autoReconnectDelay, Error: err})
 		time.Sleep(autoReconnectDelay)
-		err := cli.Connect()
+		err = cli.Connect()
 		if errors.Is(err, ErrAlreadyConnected) {
 			cli.Log.Debugf("Connect() said we're already connected after autoreconnect sleep")
 			return
@@ -558,6 +668,8 @@ func (cli *Client) unlockedDisconnect() {
 		cli.socket.Stop(true)
 		cli.socket = nil
 		cli.clearResponseWaiters(xmlStreamEndNode)
+		cli.getMetrics().Disconnected(DisconnectLocal)
+		cli.setDisconnectedState("disconnect called")
 	}
 }
 
@@ -569,6 +681,11 @@ func (cli *Client) unlockedDisconnect() {
 // Note that this will not emit any events. The LoggedOut event is only used for external logouts
 // (triggered by the user from the main device or by WhatsApp servers).
 func (cli *Client) Logout() error {
+	return cli.LogoutContext(context.TODO())
+}
+
+// LogoutContext is like Logout, but takes a context for cancellation and deadlines.
+func (cli *Client) LogoutContext(ctx context.Context) error {
 	if cli == nil {
 		return ErrClientIsNil
 	} else if cli.MessengerConfig != nil {
@@ -579,6 +696,7 @@ func (cli *Client) Logout() error {
 		return ErrNotLoggedIn
 	}
 	_, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "md",
 		Type:      "set",
 		To:        types.ServerJID,
@@ -594,6 +712,7 @@ func (cli *Client) Logout() error {
 		return fmt.Errorf("error sending logout request: %w", err)
 	}
 	cli.Disconnect()
+	cli.setConnectionState(events.ConnectionLoggedOut, "logout called")
 	err = cli.Store.Delete()
 	if err != nil {
 		return fmt.Errorf("error deleting data from store: %w", err)
@@ -693,6 +812,8 @@ func (cli *Client) handleFrame(data []byte) {
 		return
 	}
 	cli.recvLog.Debugf("%s", node.XMLString())
+	cli.recordNode(NodeReceived, node)
+	cli.updateDisconnectReason(node)
 	if node.Tag == "xmlstreamend" {
 		if !cli.isExpectedDisconnect() {
 			cli.Log.Warnf("Received stream end frame")
@@ -703,6 +824,7 @@ func (cli *Client) handleFrame(data []byte) {
 	} else if _, ok := cli.nodeHandlers[node.Tag]; ok {
 		select {
 		case cli.handlerQueue <- node:
+			cli.getMetrics().HandlerQueueDepth(len(cli.handlerQueue))
 		default:
 			cli.Log.Warnf("Handler queue is full, message ordering is no longer guaranteed")
 			go func() {
@@ -724,29 +846,20 @@ func stopAndDrainTimer(timer *time.Timer) {
 }
 
 func (cli *Client) handlerQueueLoop(ctx context.Context) {
+	// The loop of the previous connection may still be finishing queued messages
+	cli.handlerLoopLock.Lock()
+	defer cli.handlerLoopLock.Unlock()
+	if workers := cli.ParallelMessageHandlers; workers > 1 {
+		cli.shardedHandlerQueueLoop(ctx, workers)
+		return
+	}
 	timer := time.NewTimer(5 * time.Minute)
 	stopAndDrainTimer(timer)
 	cli.Log.Debugf("Starting handler queue loop")
 	for {
 		select {
 		case node := <-cli.handlerQueue:
-			doneChan := make(chan struct{}, 1)
-			go func() {
-				start := time.Now()
-				cli.nodeHandlers[node.Tag](node)
-				duration := time.Since(start)
-				doneChan <- struct{}{}
-				if duration > 5*time.Second {
-					cli.Log.Warnf("Node handling took %s for %s", duration, node.XMLString())
-				}
-			}()
-			timer.Reset(5 * time.Minute)
-			select {
-			case <-doneChan:
-				stopAndDrainTimer(timer)
-			case <-timer.C:
-				cli.Log.Warnf("Node handling is taking long for %s - continuing in background", node.XMLString())
-			}
+			cli.handleQueuedNode(node, timer)
 		case <-ctx.Done():
 			cli.Log.Debugf("Closing handler queue loop")
 			return
@@ -754,6 +867,28 @@ func (cli *Client) handlerQueueLoop(ctx context.Context) {
 	}
 }
 
+// handleQueuedNode runs the handler for the given node and waits until it returns.
+// If handling takes more than 5 minutes, the handler is left running in the background.
+func (cli *Client) handleQueuedNode(node *waBinary.Node, timer *time.Timer) {
+	doneChan := make(chan struct{}, 1)
+	go func() {
+		start := time.Now()
+		cli.nodeHandlers[node.Tag](node)
+		duration := time.Since(start)
+		doneChan <- struct{}{}
+		if duration > 5*time.Second {
+			cli.Log.Warnf("Node handling took %s for %s", duration, node.XMLString())
+		}
+	}()
+	timer.Reset(5 * time.Minute)
+	select {
+	case <-doneChan:
+		stopAndDrainTimer(timer)
+	case <-timer.C:
+		cli.Log.Warnf("Node handling is taking long for %s - continuing in background", node.XMLString())
+	}
+}
+
 func (cli *Client) sendNodeAndGetData(node waBinary.Node) ([]byte, error) {
 	if cli == nil {
 		return nil, ErrClientIsNil
@@ -761,7 +896,8 @@ func (cli *Client) sendNodeAndGetData(node waBinary.Node) ([]byte, error) {
 	cli.socketLock.RLock()
 	sock := cli.socket
 	cli.socketLock.RUnlock()
-	if sock == nil {
+	rp := cli.replayer.Load()
+	if sock == nil && rp == nil {
 		return nil, ErrNotConnected
 	}
 
@@ -771,6 +907,11 @@ func (cli *Client) sendNodeAndGetData(node waBinary.Node) ([]byte, error) {
 	}
 
 	cli.sendLog.Debugf("%s", node.XMLString())
+	cli.recordNode(NodeSent, &node)
+	if rp != nil {
+		rp.respond(&node)
+		return payload, nil
+	}
 	return payload, sock.SendFrame(payload)
 }
 
@@ -780,6 +921,8 @@ func (cli *Client) sendNode(node waBinary.Node) error {
 }
 
 func (cli *Client) dispatchEvent(evt any) {
+	evt = cli.normalizeEventJIDs(evt)
+	cli.dispatchToSubscriptions(evt)
 	cli.eventHandlersLock.RLock()
 	defer func() {
 		cli.eventHandlersLock.RUnlock()
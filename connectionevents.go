@@ -7,6 +7,8 @@
 package whatsmeow
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	waBinary "github.com/shiestapoi/whatsmeow/binary"
@@ -19,6 +21,7 @@ func (cli *Client) handleStreamError(node *waBinary.Node) {
 	cli.isLoggedIn.Store(false)
 	cli.clearResponseWaiters(node)
 	code, _ := node.Attrs["code"].(string)
+	cli.getMetrics().StreamError(code)
 	conflict, _ := node.GetOptionalChildByTag("conflict")
 	conflictType := conflict.AttrGetter().OptionalString("type")
 	switch {
@@ -39,6 +42,7 @@ func (cli *Client) handleStreamError(node *waBinary.Node) {
 	case code == "401" && conflictType == "device_removed":
 		cli.expectDisconnect()
 		cli.Log.Infof("Got device removed stream error, sending LoggedOut event and deleting session")
+		cli.setConnectionState(events.ConnectionLoggedOut, "device removed")
 		go cli.dispatchEvent(&events.LoggedOut{OnConnect: false, Reason: events.ConnectFailureLoggedOut})
 		err := cli.Store.Delete()
 		if err != nil {
@@ -47,6 +51,7 @@ func (cli *Client) handleStreamError(node *waBinary.Node) {
 	case conflictType == "replaced":
 		cli.expectDisconnect()
 		cli.Log.Infof("Got replaced stream error, sending StreamReplaced event")
+		cli.setDisconnectedState("stream replaced")
 		go cli.dispatchEvent(&events.StreamReplaced{})
 	case code == "503":
 		// This seems to happen when the server wants to restart or something.
@@ -84,6 +89,7 @@ func (cli *Client) handleIB(node *waBinary.Node) {
 				Receipts:       ag.Int("receipt"),
 			})
 		case "offline":
+			cli.setConnectionState(events.ConnectionOnline, "offline sync completed", events.ConnectionSyncingOffline)
 			cli.dispatchEvent(&events.OfflineSyncCompleted{
 				Count: ag.Int("count"),
 			})
@@ -95,6 +101,7 @@ func (cli *Client) handleConnectFailure(node *waBinary.Node) {
 	ag := node.AttrGetter()
 	reason := events.ConnectFailureReason(ag.Int("reason"))
 	message := ag.OptionalString("message")
+	cli.getMetrics().ConnectFailed(reason)
 	willAutoReconnect := true
 	switch {
 	default:
@@ -117,6 +124,7 @@ func (cli *Client) handleConnectFailure(node *waBinary.Node) {
 	}
 	if reason.IsLoggedOut() {
 		cli.Log.Infof("Got %s connect failure, sending LoggedOut event and deleting session", reason)
+		cli.setConnectionState(events.ConnectionLoggedOut, fmt.Sprintf("connect failure: %s", reason))
 		go cli.dispatchEvent(&events.LoggedOut{OnConnect: true, Reason: reason})
 		err := cli.Store.Delete()
 		if err != nil {
@@ -124,9 +132,14 @@ func (cli *Client) handleConnectFailure(node *waBinary.Node) {
 		}
 	} else if reason == events.ConnectFailureTempBanned {
 		cli.Log.Warnf("Temporary ban connect failure: %s", node.XMLString())
+		cli.setConnectionState(events.ConnectionBanned, "temporary ban")
+		expire := time.Duration(ag.Int("expire")) * time.Second
+		if expire > 0 {
+			cli.pauseRateLimit(time.Now().Add(expire))
+		}
 		go cli.dispatchEvent(&events.TemporaryBan{
 			Code:   events.TempBanReason(ag.Int("code")),
-			Expire: time.Duration(ag.Int("expire")) * time.Second,
+			Expire: expire,
 		})
 	} else if reason == events.ConnectFailureClientOutdated {
 		cli.Log.Errorf("Client outdated (405) connect failure (client version: %s)", store.GetWAVersion().String())
@@ -151,8 +164,13 @@ func (cli *Client) handleConnectSuccess(node *waBinary.Node) {
 	cli.Log.Infof("Successfully authenticated")
 	cli.LastSuccessfulConnect = time.Now()
 	cli.AutoReconnectErrors = 0
+	cli.disconnectReason.Store(nil)
 	cli.isLoggedIn.Store(true)
+	cli.setConnectionState(events.ConnectionSyncingOffline, "connect success")
+	ownLID := node.AttrGetter().OptionalJIDOrEmpty("lid")
+	cli.setOwnLID(ownLID)
 	go func() {
+		cli.storeLIDMapping("connect success", ownLID, cli.getOwnID().ToNonAD())
 		if dbCount, err := cli.Store.PreKeys.UploadedPreKeyCount(); err != nil {
 			cli.Log.Errorf("Failed to get number of prekeys in database: %v", err)
 		} else if serverCount, err := cli.getServerPreKeyCount(); err != nil {
@@ -169,8 +187,16 @@ func (cli *Client) handleConnectSuccess(node *waBinary.Node) {
 		if err != nil {
 			cli.Log.Warnf("Failed to send post-connect passive IQ: %v", err)
 		}
+		cli.getMetrics().Connected()
 		cli.dispatchEvent(&events.Connected{})
 		cli.closeSocketWaitChan()
+		cli.wakeOutbox()
+		cli.socketLock.RLock()
+		sock := cli.socket
+		cli.socketLock.RUnlock()
+		if sock != nil {
+			go cli.signedPreKeyRotationLoop(sock.Context())
+		}
 	}()
 }
 
@@ -179,11 +205,17 @@ func (cli *Client) handleConnectSuccess(node *waBinary.Node) {
 // This seems to mostly affect whether the device receives certain events.
 // By default, whatsmeow will automatically do SetPassive(false) after connecting.
 func (cli *Client) SetPassive(passive bool) error {
+	return cli.SetPassiveContext(context.TODO(), passive)
+}
+
+// SetPassiveContext is like SetPassive, but takes a context for cancellation and deadlines.
+func (cli *Client) SetPassiveContext(ctx context.Context, passive bool) error {
 	tag := "active"
 	if passive {
 		tag = "passive"
 	}
 	_, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "passive",
 		Type:      "set",
 		To:        types.ServerJID,
@@ -0,0 +1,96 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"slices"
+
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// State returns the current state of the connection.
+//
+// Changes are also emitted as events.ConnectionStateChanged, so there's no need to poll this.
+func (cli *Client) State() events.ConnectionState {
+	if cli == nil {
+		return events.ConnectionDisconnected
+	}
+	cli.connStateLock.Lock()
+	defer cli.connStateLock.Unlock()
+	return cli.connState
+}
+
+// WaitForState waits until the connection is in one of the given states and returns the state.
+// If the connection is already in one of the states, it returns immediately.
+//
+// An error is only returned if the context is canceled before any of the states are reached.
+func (cli *Client) WaitForState(ctx context.Context, states ...events.ConnectionState) (events.ConnectionState, error) {
+	if cli == nil {
+		return "", ErrClientIsNil
+	}
+	for {
+		cli.connStateLock.Lock()
+		state, ch := cli.connState, cli.connStateWait
+		cli.connStateLock.Unlock()
+		if slices.Contains(states, state) {
+			return state, nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return state, ctx.Err()
+		}
+	}
+}
+
+// setConnectionState changes the connection state and emits an event about it.
+// If onlyFrom is non-empty, the state is only changed if the current state is one of the given states.
+func (cli *Client) setConnectionState(state events.ConnectionState, cause string, onlyFrom ...events.ConnectionState) {
+	cli.connStateLock.Lock()
+	defer cli.connStateLock.Unlock()
+	old := cli.connState
+	if old == state || (len(onlyFrom) > 0 && !slices.Contains(onlyFrom, old)) {
+		return
+	}
+	cli.connState = state
+	close(cli.connStateWait)
+	cli.connStateWait = make(chan struct{})
+	cli.Log.Debugf("Connection state changed from %s to %s (%s)", old, state, cause)
+	cli.connStateEvents = append(cli.connStateEvents, &events.ConnectionStateChanged{Old: old, New: state, Cause: cause})
+	if !cli.connStateDispatching {
+		cli.connStateDispatching = true
+		// State changes happen while holding various locks, so the events are dispatched in the background,
+		// but on a single goroutine to keep them in order.
+		go cli.dispatchConnectionStateEvents()
+	}
+}
+
+// setDisconnectedState changes the state to disconnected, unless the client was logged out or banned,
+// as those states already imply that the client is disconnected.
+func (cli *Client) setDisconnectedState(cause string) {
+	cli.setConnectionState(
+		events.ConnectionDisconnected, cause,
+		events.ConnectionConnecting, events.ConnectionHandshaking, events.ConnectionAuthenticating,
+		events.ConnectionSyncingOffline, events.ConnectionOnline,
+	)
+}
+
+func (cli *Client) dispatchConnectionStateEvents() {
+	for {
+		cli.connStateLock.Lock()
+		if len(cli.connStateEvents) == 0 {
+			cli.connStateDispatching = false
+			cli.connStateLock.Unlock()
+			return
+		}
+		evt := cli.connStateEvents[0]
+		cli.connStateEvents = cli.connStateEvents[1:]
+		cli.connStateLock.Unlock()
+		cli.dispatchEvent(evt)
+	}
+}
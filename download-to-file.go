@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -38,6 +39,11 @@ type File interface {
 //
 // This is otherwise identical to [Download], but writes the attachment to a file instead of returning it as a byte slice.
 func (cli *Client) DownloadToFile(msg DownloadableMessage, file File) error {
+	return cli.DownloadToFileContext(context.TODO(), msg, file)
+}
+
+// DownloadToFileContext is like DownloadToFile, but takes a context for cancellation and deadlines.
+func (cli *Client) DownloadToFileContext(ctx context.Context, msg DownloadableMessage, file File) error {
 	if cli == nil {
 		return ErrClientIsNil
 	}
@@ -53,9 +59,9 @@ func (cli *Client) DownloadToFile(msg DownloadableMessage, file File) error {
 		isWebWhatsappNetURL = strings.HasPrefix(url, "https://web.whatsapp.net")
 	}
 	if len(url) > 0 && !isWebWhatsappNetURL {
-		return cli.downloadAndDecryptToFile(url, msg.GetMediaKey(), mediaType, getSize(msg), msg.GetFileEncSHA256(), msg.GetFileSHA256(), file)
+		return cli.downloadAndDecryptToFile(ctx, url, msg.GetMediaKey(), mediaType, getSize(msg), msg.GetFileEncSHA256(), msg.GetFileSHA256(), file)
 	} else if len(msg.GetDirectPath()) > 0 {
-		return cli.DownloadMediaWithPathToFile(msg.GetDirectPath(), msg.GetFileEncSHA256(), msg.GetFileSHA256(), msg.GetMediaKey(), getSize(msg), mediaType, mediaTypeToMMSType[mediaType], file)
+		return cli.DownloadMediaWithPathToFileContext(ctx, msg.GetDirectPath(), msg.GetFileEncSHA256(), msg.GetFileSHA256(), msg.GetMediaKey(), getSize(msg), mediaType, mediaTypeToMMSType[mediaType], file)
 	} else {
 		if isWebWhatsappNetURL {
 			cli.Log.Warnf("Got a media message with a web.whatsapp.net URL (%s) and no direct path", url)
@@ -65,11 +71,21 @@ func (cli *Client) DownloadToFile(msg DownloadableMessage, file File) error {
 }
 
 func (cli *Client) DownloadFBToFile(transport *waMediaTransport.WAMediaTransport_Integral, mediaType MediaType, file File) error {
-	return cli.DownloadMediaWithPathToFile(transport.GetDirectPath(), transport.GetFileEncSHA256(), transport.GetFileSHA256(), transport.GetMediaKey(), -1, mediaType, mediaTypeToMMSType[mediaType], file)
+	return cli.DownloadFBToFileContext(context.TODO(), transport, mediaType, file)
+}
+
+// DownloadFBToFileContext is like DownloadFBToFile, but takes a context for cancellation and deadlines.
+func (cli *Client) DownloadFBToFileContext(ctx context.Context, transport *waMediaTransport.WAMediaTransport_Integral, mediaType MediaType, file File) error {
+	return cli.DownloadMediaWithPathToFileContext(ctx, transport.GetDirectPath(), transport.GetFileEncSHA256(), transport.GetFileSHA256(), transport.GetMediaKey(), -1, mediaType, mediaTypeToMMSType[mediaType], file)
 }
 
 func (cli *Client) DownloadMediaWithPathToFile(directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType MediaType, mmsType string, file File) error {
-	mediaConn, err := cli.refreshMediaConn(false)
+	return cli.DownloadMediaWithPathToFileContext(context.TODO(), directPath, encFileHash, fileHash, mediaKey, fileLength, mediaType, mmsType, file)
+}
+
+// DownloadMediaWithPathToFileContext is like DownloadMediaWithPathToFile, but takes a context for cancellation and deadlines.
+func (cli *Client) DownloadMediaWithPathToFileContext(ctx context.Context, directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType MediaType, mmsType string, file File) error {
+	mediaConn, err := cli.refreshMediaConn(ctx, false)
 	if err != nil {
 		return fmt.Errorf("failed to refresh media connections: %w", err)
 	}
@@ -79,8 +95,8 @@ func (cli *Client) DownloadMediaWithPathToFile(directPath string, encFileHash, f
 	for i, host := range mediaConn.Hosts {
 		// TODO omit hash for unencrypted media?
 		mediaURL := fmt.Sprintf("https://%s%s&hash=%s&mms-type=%s&__wa-mms=", host.Hostname, directPath, base64.URLEncoding.EncodeToString(encFileHash), mmsType)
-		err = cli.downloadAndDecryptToFile(mediaURL, mediaKey, mediaType, fileLength, encFileHash, fileHash, file)
-		if err == nil || errors.Is(err, ErrFileLengthMismatch) || errors.Is(err, ErrInvalidMediaSHA256) ||
+		err = cli.downloadAndDecryptToFile(ctx, mediaURL, mediaKey, mediaType, fileLength, encFileHash, fileHash, file)
+		if err == nil || ctx.Err() != nil || errors.Is(err, ErrFileLengthMismatch) || errors.Is(err, ErrInvalidMediaSHA256) ||
 			errors.Is(err, ErrMediaDownloadFailedWith403) || errors.Is(err, ErrMediaDownloadFailedWith404) || errors.Is(err, ErrMediaDownloadFailedWith410) {
 			return err
 		} else if i >= len(mediaConn.Hosts)-1 {
@@ -91,10 +107,10 @@ func (cli *Client) DownloadMediaWithPathToFile(directPath string, encFileHash, f
 	return err
 }
 
-func (cli *Client) downloadAndDecryptToFile(url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte, file File) error {
+func (cli *Client) downloadAndDecryptToFile(ctx context.Context, url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte, file File) error {
 	iv, cipherKey, macKey, _ := getMediaKeys(mediaKey, appInfo)
 	hasher := sha256.New()
-	if mac, err := cli.downloadPossiblyEncryptedMediaWithRetriesToFile(url, fileEncSHA256, file); err != nil {
+	if mac, err := cli.downloadPossiblyEncryptedMediaWithRetriesToFile(ctx, url, fileEncSHA256, file); err != nil {
 		return err
 	} else if mediaKey == nil && fileEncSHA256 == nil && mac == nil {
 		// Unencrypted media, just return the downloaded data
@@ -119,12 +135,12 @@ func (cli *Client) downloadAndDecryptToFile(url string, mediaKey []byte, appInfo
 	return nil
 }
 
-func (cli *Client) downloadPossiblyEncryptedMediaWithRetriesToFile(url string, checksum []byte, file File) (mac []byte, err error) {
+func (cli *Client) downloadPossiblyEncryptedMediaWithRetriesToFile(ctx context.Context, url string, checksum []byte, file File) (mac []byte, err error) {
 	for retryNum := 0; retryNum < 5; retryNum++ {
 		if checksum == nil {
-			_, _, err = cli.downloadMediaToFile(url, file)
+			_, _, err = cli.downloadMediaToFile(ctx, url, file)
 		} else {
-			mac, err = cli.downloadEncryptedMediaToFile(url, checksum, file)
+			mac, err = cli.downloadEncryptedMediaToFile(ctx, url, checksum, file)
 		}
 		if err == nil || !shouldRetryMediaDownload(err) {
 			return
@@ -139,13 +155,17 @@ func (cli *Client) downloadPossiblyEncryptedMediaWithRetriesToFile(url string, c
 		if err != nil {
 			return nil, fmt.Errorf("failed to seek to start of file to retry download: %w", err)
 		}
-		time.Sleep(retryDuration)
+		select {
+		case <-time.After(retryDuration):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 	return
 }
 
-func (cli *Client) downloadMediaToFile(url string, file io.Writer) (int64, []byte, error) {
-	resp, err := cli.doMediaDownloadRequest(url)
+func (cli *Client) downloadMediaToFile(ctx context.Context, url string, file io.Writer) (int64, []byte, error) {
+	resp, err := cli.doMediaDownloadRequest(ctx, url)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -159,11 +179,12 @@ func (cli *Client) downloadMediaToFile(url string, file io.Writer) (int64, []byt
 	}
 	hasher := sha256.New()
 	n, err := io.Copy(file, io.TeeReader(resp.Body, hasher))
+	cli.getMetrics().MediaDownloaded(n)
 	return n, hasher.Sum(nil), err
 }
 
-func (cli *Client) downloadEncryptedMediaToFile(url string, checksum []byte, file File) ([]byte, error) {
-	size, hash, err := cli.downloadMediaToFile(url, file)
+func (cli *Client) downloadEncryptedMediaToFile(ctx context.Context, url string, checksum []byte, file File) ([]byte, error) {
+	size, hash, err := cli.downloadMediaToFile(ctx, url, file)
 	if err != nil {
 		return nil, err
 	} else if size <= mediaHMACLength {
@@ -22,6 +22,7 @@ var (
 	ErrNotConnected    = errors.New("websocket not connected")
 	ErrNotLoggedIn     = errors.New("the store doesn't contain a device JID")
 	ErrMessageTimedOut = errors.New("timed out waiting for message send response")
+	ErrNoOutboxStore   = errors.New("the device store doesn't have an outbox store")
 
 	ErrAlreadyConnected = errors.New("websocket is already connected")
 
@@ -144,6 +145,19 @@ var (
 	ErrNotPollUpdateMessage          = errors.New("given message isn't a poll update message")
 )
 
+// serverReturnedError is returned by SendMessage if the server responds to the message with an error code.
+type serverReturnedError struct {
+	Code int
+}
+
+func (err *serverReturnedError) Error() string {
+	return fmt.Sprintf("%s %d", ErrServerReturnedError.Error(), err.Code)
+}
+
+func (err *serverReturnedError) Unwrap() error {
+	return ErrServerReturnedError
+}
+
 type wrappedIQError struct {
 	HumanError error
 	IQError    error
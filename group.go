@@ -49,6 +49,11 @@ type ReqCreateGroup struct {
 //
 // See ReqCreateGroup for parameters.
 func (cli *Client) CreateGroup(req ReqCreateGroup) (*types.GroupInfo, error) {
+	return cli.CreateGroupContext(context.TODO(), req)
+}
+
+// CreateGroupContext is like CreateGroup, but takes a context for cancellation and deadlines.
+func (cli *Client) CreateGroupContext(ctx context.Context, req ReqCreateGroup) (*types.GroupInfo, error) {
 	participantNodes := make([]waBinary.Node, len(req.Participants), len(req.Participants)+1)
 	for i, participant := range req.Participants {
 		participantNodes[i] = waBinary.Node{
@@ -77,7 +82,7 @@ func (cli *Client) CreateGroup(req ReqCreateGroup) (*types.GroupInfo, error) {
 	}
 	// WhatsApp web doesn't seem to include the static prefix for these
 	key := strings.TrimPrefix(req.CreateKey, "3EB0")
-	resp, err := cli.sendGroupIQ(context.TODO(), iqSet, types.GroupServerJID, waBinary.Node{
+	resp, err := cli.sendGroupIQ(ctx, iqSet, types.GroupServerJID, waBinary.Node{
 		Tag: "create",
 		Attrs: waBinary.Attrs{
 			"subject": req.Name,
@@ -97,7 +102,12 @@ func (cli *Client) CreateGroup(req ReqCreateGroup) (*types.GroupInfo, error) {
 
 // UnlinkGroup removes a child group from a parent community.
 func (cli *Client) UnlinkGroup(parent, child types.JID) error {
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, parent, waBinary.Node{
+	return cli.UnlinkGroupContext(context.TODO(), parent, child)
+}
+
+// UnlinkGroupContext is like UnlinkGroup, but takes a context for cancellation and deadlines.
+func (cli *Client) UnlinkGroupContext(ctx context.Context, parent, child types.JID) error {
+	_, err := cli.sendGroupIQ(ctx, iqSet, parent, waBinary.Node{
 		Tag:   "unlink",
 		Attrs: waBinary.Attrs{"unlink_type": string(types.GroupLinkChangeTypeSub)},
 		Content: []waBinary.Node{{
@@ -112,7 +122,12 @@ func (cli *Client) UnlinkGroup(parent, child types.JID) error {
 //
 // To create a new group within a community, set LinkedParentJID in the CreateGroup request.
 func (cli *Client) LinkGroup(parent, child types.JID) error {
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, parent, waBinary.Node{
+	return cli.LinkGroupContext(context.TODO(), parent, child)
+}
+
+// LinkGroupContext is like LinkGroup, but takes a context for cancellation and deadlines.
+func (cli *Client) LinkGroupContext(ctx context.Context, parent, child types.JID) error {
+	_, err := cli.sendGroupIQ(ctx, iqSet, parent, waBinary.Node{
 		Tag: "links",
 		Content: []waBinary.Node{{
 			Tag:   "link",
@@ -128,7 +143,12 @@ func (cli *Client) LinkGroup(parent, child types.JID) error {
 
 // LeaveGroup leaves the specified group on WhatsApp.
 func (cli *Client) LeaveGroup(jid types.JID) error {
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, types.GroupServerJID, waBinary.Node{
+	return cli.LeaveGroupContext(context.TODO(), jid)
+}
+
+// LeaveGroupContext is like LeaveGroup, but takes a context for cancellation and deadlines.
+func (cli *Client) LeaveGroupContext(ctx context.Context, jid types.JID) error {
+	_, err := cli.sendGroupIQ(ctx, iqSet, types.GroupServerJID, waBinary.Node{
 		Tag: "leave",
 		Content: []waBinary.Node{{
 			Tag:   "group",
@@ -149,6 +169,11 @@ const (
 
 // UpdateGroupParticipants can be used to add, remove, promote and demote members in a WhatsApp group.
 func (cli *Client) UpdateGroupParticipants(jid types.JID, participantChanges []types.JID, action ParticipantChange) ([]types.GroupParticipant, error) {
+	return cli.UpdateGroupParticipantsContext(context.TODO(), jid, participantChanges, action)
+}
+
+// UpdateGroupParticipantsContext is like UpdateGroupParticipants, but takes a context for cancellation and deadlines.
+func (cli *Client) UpdateGroupParticipantsContext(ctx context.Context, jid types.JID, participantChanges []types.JID, action ParticipantChange) ([]types.GroupParticipant, error) {
 	content := make([]waBinary.Node, len(participantChanges))
 	for i, participantJID := range participantChanges {
 		content[i] = waBinary.Node{
@@ -156,7 +181,7 @@ func (cli *Client) UpdateGroupParticipants(jid types.JID, participantChanges []t
 			Attrs: waBinary.Attrs{"jid": participantJID},
 		}
 	}
-	resp, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+	resp, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
 		Tag:     string(action),
 		Content: content,
 	})
@@ -177,7 +202,12 @@ func (cli *Client) UpdateGroupParticipants(jid types.JID, participantChanges []t
 
 // GetGroupRequestParticipants gets the list of participants that have requested to join the group.
 func (cli *Client) GetGroupRequestParticipants(jid types.JID) ([]types.GroupParticipantRequest, error) {
-	resp, err := cli.sendGroupIQ(context.TODO(), iqGet, jid, waBinary.Node{
+	return cli.GetGroupRequestParticipantsContext(context.TODO(), jid)
+}
+
+// GetGroupRequestParticipantsContext is like GetGroupRequestParticipants, but takes a context for cancellation and deadlines.
+func (cli *Client) GetGroupRequestParticipantsContext(ctx context.Context, jid types.JID) ([]types.GroupParticipantRequest, error) {
+	resp, err := cli.sendGroupIQ(ctx, iqGet, jid, waBinary.Node{
 		Tag: "membership_approval_requests",
 	})
 	if err != nil {
@@ -207,6 +237,11 @@ const (
 
 // UpdateGroupRequestParticipants can be used to approve or reject requests to join the group.
 func (cli *Client) UpdateGroupRequestParticipants(jid types.JID, participantChanges []types.JID, action ParticipantRequestChange) ([]types.GroupParticipant, error) {
+	return cli.UpdateGroupRequestParticipantsContext(context.TODO(), jid, participantChanges, action)
+}
+
+// UpdateGroupRequestParticipantsContext is like UpdateGroupRequestParticipants, but takes a context for cancellation and deadlines.
+func (cli *Client) UpdateGroupRequestParticipantsContext(ctx context.Context, jid types.JID, participantChanges []types.JID, action ParticipantRequestChange) ([]types.GroupParticipant, error) {
 	content := make([]waBinary.Node, len(participantChanges))
 	for i, participantJID := range participantChanges {
 		content[i] = waBinary.Node{
@@ -214,7 +249,7 @@ func (cli *Client) UpdateGroupRequestParticipants(jid types.JID, participantChan
 			Attrs: waBinary.Attrs{"jid": participantJID},
 		}
 	}
-	resp, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+	resp, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
 		Tag: "membership_requests_action",
 		Content: []waBinary.Node{{
 			Tag:     string(action),
@@ -244,6 +279,11 @@ func (cli *Client) UpdateGroupRequestParticipants(jid types.JID, participantChan
 // The avatar should be a JPEG photo, other formats may be rejected with ErrInvalidImageFormat.
 // The bytes can be nil to remove the photo. Returns the new picture ID.
 func (cli *Client) SetGroupPhoto(jid types.JID, avatar []byte) (string, error) {
+	return cli.SetGroupPhotoContext(context.TODO(), jid, avatar)
+}
+
+// SetGroupPhotoContext is like SetGroupPhoto, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupPhotoContext(ctx context.Context, jid types.JID, avatar []byte) (string, error) {
 	var content interface{}
 	if avatar != nil {
 		content = []waBinary.Node{{
@@ -253,6 +293,7 @@ func (cli *Client) SetGroupPhoto(jid types.JID, avatar []byte) (string, error) {
 		}}
 	}
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "w:profile:picture",
 		Type:      iqSet,
 		To:        types.ServerJID,
@@ -276,7 +317,12 @@ func (cli *Client) SetGroupPhoto(jid types.JID, avatar []byte) (string, error) {
 
 // SetGroupName updates the name (subject) of the given group on WhatsApp.
 func (cli *Client) SetGroupName(jid types.JID, name string) error {
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+	return cli.SetGroupNameContext(context.TODO(), jid, name)
+}
+
+// SetGroupNameContext is like SetGroupName, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupNameContext(ctx context.Context, jid types.JID, name string) error {
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
 		Tag:     "subject",
 		Content: []byte(name),
 	})
@@ -289,8 +335,13 @@ func (cli *Client) SetGroupName(jid types.JID, name string) error {
 // automatically fetch the current group info to find the previous topic ID. If the new ID is not
 // specified, one will be generated with Client.GenerateMessageID().
 func (cli *Client) SetGroupTopic(jid types.JID, previousID, newID, topic string) error {
+	return cli.SetGroupTopicContext(context.TODO(), jid, previousID, newID, topic)
+}
+
+// SetGroupTopicContext is like SetGroupTopic, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupTopicContext(ctx context.Context, jid types.JID, previousID, newID, topic string) error {
 	if previousID == "" {
-		oldInfo, err := cli.GetGroupInfo(jid)
+		oldInfo, err := cli.GetGroupInfoContext(ctx, jid)
 		if err != nil {
 			return fmt.Errorf("failed to get old group info to update topic: %v", err)
 		}
@@ -313,7 +364,7 @@ func (cli *Client) SetGroupTopic(jid types.JID, previousID, newID, topic string)
 		attrs["delete"] = "true"
 		content = nil
 	}
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
 		Tag:     "description",
 		Attrs:   attrs,
 		Content: content,
@@ -323,21 +374,31 @@ func (cli *Client) SetGroupTopic(jid types.JID, previousID, newID, topic string)
 
 // SetGroupLocked changes whether the group is locked (i.e. whether only admins can modify group info).
 func (cli *Client) SetGroupLocked(jid types.JID, locked bool) error {
+	return cli.SetGroupLockedContext(context.TODO(), jid, locked)
+}
+
+// SetGroupLockedContext is like SetGroupLocked, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupLockedContext(ctx context.Context, jid types.JID, locked bool) error {
 	tag := "locked"
 	if !locked {
 		tag = "unlocked"
 	}
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{Tag: tag})
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{Tag: tag})
 	return err
 }
 
 // SetGroupAnnounce changes whether the group is in announce mode (i.e. whether only admins can send messages).
 func (cli *Client) SetGroupAnnounce(jid types.JID, announce bool) error {
+	return cli.SetGroupAnnounceContext(context.TODO(), jid, announce)
+}
+
+// SetGroupAnnounceContext is like SetGroupAnnounce, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupAnnounceContext(ctx context.Context, jid types.JID, announce bool) error {
 	tag := "announcement"
 	if !announce {
 		tag = "not_announcement"
 	}
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{Tag: tag})
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{Tag: tag})
 	return err
 }
 
@@ -345,11 +406,16 @@ func (cli *Client) SetGroupAnnounce(jid types.JID, announce bool) error {
 //
 // If reset is true, then the old invite link will be revoked and a new one generated.
 func (cli *Client) GetGroupInviteLink(jid types.JID, reset bool) (string, error) {
+	return cli.GetGroupInviteLinkContext(context.TODO(), jid, reset)
+}
+
+// GetGroupInviteLinkContext is like GetGroupInviteLink, but takes a context for cancellation and deadlines.
+func (cli *Client) GetGroupInviteLinkContext(ctx context.Context, jid types.JID, reset bool) (string, error) {
 	iqType := iqGet
 	if reset {
 		iqType = iqSet
 	}
-	resp, err := cli.sendGroupIQ(context.TODO(), iqType, jid, waBinary.Node{Tag: "invite"})
+	resp, err := cli.sendGroupIQ(ctx, iqType, jid, waBinary.Node{Tag: "invite"})
 	if errors.Is(err, ErrIQNotAuthorized) {
 		return "", wrapIQError(ErrGroupInviteLinkUnauthorized, err)
 	} else if errors.Is(err, ErrIQNotFound) {
@@ -370,7 +436,12 @@ func (cli *Client) GetGroupInviteLink(jid types.JID, reset bool) (string, error)
 //
 // Note that this is specifically for invite messages, not invite links. Use GetGroupInfoFromLink for resolving chat.whatsapp.com links.
 func (cli *Client) GetGroupInfoFromInvite(jid, inviter types.JID, code string, expiration int64) (*types.GroupInfo, error) {
-	resp, err := cli.sendGroupIQ(context.TODO(), iqGet, jid, waBinary.Node{
+	return cli.GetGroupInfoFromInviteContext(context.TODO(), jid, inviter, code, expiration)
+}
+
+// GetGroupInfoFromInviteContext is like GetGroupInfoFromInvite, but takes a context for cancellation and deadlines.
+func (cli *Client) GetGroupInfoFromInviteContext(ctx context.Context, jid, inviter types.JID, code string, expiration int64) (*types.GroupInfo, error) {
+	resp, err := cli.sendGroupIQ(ctx, iqGet, jid, waBinary.Node{
 		Tag: "query",
 		Content: []waBinary.Node{{
 			Tag: "add_request",
@@ -395,7 +466,12 @@ func (cli *Client) GetGroupInfoFromInvite(jid, inviter types.JID, code string, e
 //
 // Note that this is specifically for invite messages, not invite links. Use JoinGroupWithLink for joining with chat.whatsapp.com links.
 func (cli *Client) JoinGroupWithInvite(jid, inviter types.JID, code string, expiration int64) error {
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, waBinary.Node{
+	return cli.JoinGroupWithInviteContext(context.TODO(), jid, inviter, code, expiration)
+}
+
+// JoinGroupWithInviteContext is like JoinGroupWithInvite, but takes a context for cancellation and deadlines.
+func (cli *Client) JoinGroupWithInviteContext(ctx context.Context, jid, inviter types.JID, code string, expiration int64) error {
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, waBinary.Node{
 		Tag: "accept",
 		Attrs: waBinary.Attrs{
 			"code":       code,
@@ -409,8 +485,13 @@ func (cli *Client) JoinGroupWithInvite(jid, inviter types.JID, code string, expi
 // GetGroupInfoFromLink resolves the given invite link and asks the WhatsApp servers for info about the group.
 // This will not cause the user to join the group.
 func (cli *Client) GetGroupInfoFromLink(code string) (*types.GroupInfo, error) {
+	return cli.GetGroupInfoFromLinkContext(context.TODO(), code)
+}
+
+// GetGroupInfoFromLinkContext is like GetGroupInfoFromLink, but takes a context for cancellation and deadlines.
+func (cli *Client) GetGroupInfoFromLinkContext(ctx context.Context, code string) (*types.GroupInfo, error) {
 	code = strings.TrimPrefix(code, InviteLinkPrefix)
-	resp, err := cli.sendGroupIQ(context.TODO(), iqGet, types.GroupServerJID, waBinary.Node{
+	resp, err := cli.sendGroupIQ(ctx, iqGet, types.GroupServerJID, waBinary.Node{
 		Tag:   "invite",
 		Attrs: waBinary.Attrs{"code": code},
 	})
@@ -430,8 +511,13 @@ func (cli *Client) GetGroupInfoFromLink(code string) (*types.GroupInfo, error) {
 
 // JoinGroupWithLink joins the group using the given invite link.
 func (cli *Client) JoinGroupWithLink(code string) (types.JID, error) {
+	return cli.JoinGroupWithLinkContext(context.TODO(), code)
+}
+
+// JoinGroupWithLinkContext is like JoinGroupWithLink, but takes a context for cancellation and deadlines.
+func (cli *Client) JoinGroupWithLinkContext(ctx context.Context, code string) (types.JID, error) {
 	code = strings.TrimPrefix(code, InviteLinkPrefix)
-	resp, err := cli.sendGroupIQ(context.TODO(), iqSet, types.GroupServerJID, waBinary.Node{
+	resp, err := cli.sendGroupIQ(ctx, iqSet, types.GroupServerJID, waBinary.Node{
 		Tag:   "invite",
 		Attrs: waBinary.Attrs{"code": code},
 	})
@@ -455,7 +541,12 @@ func (cli *Client) JoinGroupWithLink(code string) (types.JID, error) {
 
 // GetJoinedGroups returns the list of groups the user is participating in.
 func (cli *Client) GetJoinedGroups() ([]*types.GroupInfo, error) {
-	resp, err := cli.sendGroupIQ(context.TODO(), iqGet, types.GroupServerJID, waBinary.Node{
+	return cli.GetJoinedGroupsContext(context.TODO())
+}
+
+// GetJoinedGroupsContext is like GetJoinedGroups, but takes a context for cancellation and deadlines.
+func (cli *Client) GetJoinedGroupsContext(ctx context.Context) ([]*types.GroupInfo, error) {
+	resp, err := cli.sendGroupIQ(ctx, iqGet, types.GroupServerJID, waBinary.Node{
 		Tag: "participating",
 		Content: []waBinary.Node{
 			{Tag: "participants"},
@@ -487,7 +578,12 @@ func (cli *Client) GetJoinedGroups() ([]*types.GroupInfo, error) {
 
 // GetSubGroups gets the subgroups of the given community.
 func (cli *Client) GetSubGroups(community types.JID) ([]*types.GroupLinkTarget, error) {
-	res, err := cli.sendGroupIQ(context.TODO(), iqGet, community, waBinary.Node{Tag: "sub_groups"})
+	return cli.GetSubGroupsContext(context.TODO(), community)
+}
+
+// GetSubGroupsContext is like GetSubGroups, but takes a context for cancellation and deadlines.
+func (cli *Client) GetSubGroupsContext(ctx context.Context, community types.JID) ([]*types.GroupLinkTarget, error) {
+	res, err := cli.sendGroupIQ(ctx, iqGet, community, waBinary.Node{Tag: "sub_groups"})
 	if err != nil {
 		return nil, err
 	}
@@ -510,7 +606,12 @@ func (cli *Client) GetSubGroups(community types.JID) ([]*types.GroupLinkTarget,
 
 // GetLinkedGroupsParticipants gets all the participants in the groups of the given community.
 func (cli *Client) GetLinkedGroupsParticipants(community types.JID) ([]types.JID, error) {
-	res, err := cli.sendGroupIQ(context.TODO(), iqGet, community, waBinary.Node{Tag: "linked_groups_participants"})
+	return cli.GetLinkedGroupsParticipantsContext(context.TODO(), community)
+}
+
+// GetLinkedGroupsParticipantsContext is like GetLinkedGroupsParticipants, but takes a context for cancellation and deadlines.
+func (cli *Client) GetLinkedGroupsParticipantsContext(ctx context.Context, community types.JID) ([]types.JID, error) {
+	res, err := cli.sendGroupIQ(ctx, iqGet, community, waBinary.Node{Tag: "linked_groups_participants"})
 	if err != nil {
 		return nil, err
 	}
@@ -523,7 +624,12 @@ func (cli *Client) GetLinkedGroupsParticipants(community types.JID) ([]types.JID
 
 // GetGroupInfo requests basic info about a group chat from the WhatsApp servers.
 func (cli *Client) GetGroupInfo(jid types.JID) (*types.GroupInfo, error) {
-	return cli.getGroupInfo(context.TODO(), jid, true)
+	return cli.GetGroupInfoContext(context.TODO(), jid)
+}
+
+// GetGroupInfoContext is like GetGroupInfo, but takes a context for cancellation and deadlines.
+func (cli *Client) GetGroupInfoContext(ctx context.Context, jid types.JID) (*types.GroupInfo, error) {
+	return cli.getGroupInfo(ctx, jid, true)
 }
 
 func (cli *Client) getGroupInfo(ctx context.Context, jid types.JID, lockParticipantCache bool) (*types.GroupInfo, error) {
@@ -555,14 +661,14 @@ func (cli *Client) getGroupInfo(ctx context.Context, jid types.JID, lockParticip
 	for i, part := range groupInfo.Participants {
 		participants[i] = part.JID
 	}
-	cli.groupParticipantsCache[jid] = participants
+	cli.putCachedGroupParticipants(jid, participants)
 	return groupInfo, nil
 }
 
 func (cli *Client) getGroupMembers(ctx context.Context, jid types.JID) ([]types.JID, error) {
 	cli.groupParticipantsCacheLock.Lock()
 	defer cli.groupParticipantsCacheLock.Unlock()
-	if _, ok := cli.groupParticipantsCache[jid]; !ok {
+	if _, ok := cli.getCachedGroupParticipants(jid); !ok {
 		_, err := cli.getGroupInfo(ctx, jid, false)
 		if err != nil {
 			return nil, err
@@ -571,6 +677,48 @@ func (cli *Client) getGroupMembers(ctx context.Context, jid types.JID) ([]types.
 	return cli.groupParticipantsCache[jid], nil
 }
 
+// getCachedGroupParticipants returns the cached participant list of the given group, reading it from
+// the store if it's not cached in memory. The caller must hold groupParticipantsCacheLock.
+func (cli *Client) getCachedGroupParticipants(jid types.JID) ([]types.JID, bool) {
+	cached, ok := cli.groupParticipantsCache[jid]
+	if ok || cli.Store.Groups == nil {
+		return cached, ok
+	}
+	cached, err := cli.Store.Groups.GetGroupParticipants(jid)
+	if err != nil {
+		cli.Log.Warnf("Failed to get participants of %s from store: %v", jid, err)
+		return nil, false
+	} else if cached == nil {
+		return nil, false
+	}
+	cli.groupParticipantsCache[jid] = cached
+	return cached, true
+}
+
+// putCachedGroupParticipants caches the participant list of the given group in memory and in the store.
+// The caller must hold groupParticipantsCacheLock.
+func (cli *Client) putCachedGroupParticipants(jid types.JID, participants []types.JID) {
+	cli.groupParticipantsCache[jid] = participants
+	if cli.Store.Groups != nil {
+		err := cli.Store.Groups.PutGroupParticipants(jid, participants)
+		if err != nil {
+			cli.Log.Warnf("Failed to store participants of %s: %v", jid, err)
+		}
+	}
+}
+
+// deleteCachedGroupParticipants removes the participant list of the given group from the memory and store caches.
+// The caller must hold groupParticipantsCacheLock.
+func (cli *Client) deleteCachedGroupParticipants(jid types.JID) {
+	delete(cli.groupParticipantsCache, jid)
+	if cli.Store.Groups != nil {
+		err := cli.Store.Groups.DeleteGroupParticipants(jid)
+		if err != nil {
+			cli.Log.Warnf("Failed to delete participants of %s from store: %v", jid, err)
+		}
+	}
+}
+
 func parseParticipant(childAG *waBinary.AttrUtility, child *waBinary.Node) types.GroupParticipant {
 	pcpType := childAG.OptionalString("type")
 	participant := types.GroupParticipant{
@@ -833,12 +981,17 @@ func (cli *Client) parseGroupChange(node *waBinary.Node) (*events.GroupInfo, err
 }
 
 func (cli *Client) updateGroupParticipantCache(evt *events.GroupInfo) {
-	if len(evt.Join) == 0 && len(evt.Leave) == 0 {
+	if evt.Delete != nil {
+		cli.groupParticipantsCacheLock.Lock()
+		cli.deleteCachedGroupParticipants(evt.JID)
+		cli.groupParticipantsCacheLock.Unlock()
+		return
+	} else if len(evt.Join) == 0 && len(evt.Leave) == 0 {
 		return
 	}
 	cli.groupParticipantsCacheLock.Lock()
 	defer cli.groupParticipantsCacheLock.Unlock()
-	cached, ok := cli.groupParticipantsCache[evt.JID]
+	cached, ok := cli.getCachedGroupParticipants(evt.JID)
 	if !ok {
 		return
 	}
@@ -860,7 +1013,21 @@ Outer:
 			}
 		}
 	}
-	cli.groupParticipantsCache[evt.JID] = cached
+	cli.putCachedGroupParticipants(evt.JID, cached)
+}
+
+func (cli *Client) updateGroupEphemeralSetting(evt *events.GroupInfo) {
+	if evt.Ephemeral == nil || cli.Store.ChatSettings == nil {
+		return
+	}
+	var expiration uint32
+	if evt.Ephemeral.IsEphemeral {
+		expiration = evt.Ephemeral.DisappearingTimer
+	}
+	err := cli.Store.ChatSettings.PutEphemeralExpiration(evt.JID, expiration)
+	if err != nil {
+		cli.Log.Errorf("Failed to store disappearing timer of %s: %v", evt.JID, err)
+	}
 }
 
 func (cli *Client) parseGroupNotification(node *waBinary.Node) (any, error) {
@@ -873,12 +1040,18 @@ func (cli *Client) parseGroupNotification(node *waBinary.Node) (any, error) {
 			return nil, err
 		}
 		cli.updateGroupParticipantCache(groupChange)
+		cli.updateGroupEphemeralSetting(groupChange)
 		return groupChange, nil
 	}
 }
 
 // SetGroupJoinApprovalMode sets the group join approval mode to 'on' or 'off'.
 func (cli *Client) SetGroupJoinApprovalMode(jid types.JID, mode bool) error {
+	return cli.SetGroupJoinApprovalModeContext(context.TODO(), jid, mode)
+}
+
+// SetGroupJoinApprovalModeContext is like SetGroupJoinApprovalMode, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupJoinApprovalModeContext(ctx context.Context, jid types.JID, mode bool) error {
 	modeStr := "off"
 	if mode {
 		modeStr = "on"
@@ -894,12 +1067,17 @@ func (cli *Client) SetGroupJoinApprovalMode(jid types.JID, mode bool) error {
 		},
 	}
 
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, content)
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, content)
 	return err
 }
 
 // SetGroupMemberAddMode sets the group member add mode to 'admin_add' or 'all_member_add'.
 func (cli *Client) SetGroupMemberAddMode(jid types.JID, mode types.GroupMemberAddMode) error {
+	return cli.SetGroupMemberAddModeContext(context.TODO(), jid, mode)
+}
+
+// SetGroupMemberAddModeContext is like SetGroupMemberAddMode, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupMemberAddModeContext(ctx context.Context, jid types.JID, mode types.GroupMemberAddMode) error {
 	if mode != types.GroupMemberAddModeAdmin && mode != types.GroupMemberAddModeAllMember {
 		return errors.New("invalid mode, must be 'admin_add' or 'all_member_add'")
 	}
@@ -909,12 +1087,17 @@ func (cli *Client) SetGroupMemberAddMode(jid types.JID, mode types.GroupMemberAd
 		Content: []byte(mode),
 	}
 
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, content)
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, content)
 	return err
 }
 
 // SetGroupDescription updates the group description.
 func (cli *Client) SetGroupDescription(jid types.JID, description string) error {
+	return cli.SetGroupDescriptionContext(context.TODO(), jid, description)
+}
+
+// SetGroupDescriptionContext is like SetGroupDescription, but takes a context for cancellation and deadlines.
+func (cli *Client) SetGroupDescriptionContext(ctx context.Context, jid types.JID, description string) error {
 	content := waBinary.Node{
 		Tag: "description",
 		Content: []waBinary.Node{
@@ -925,6 +1108,6 @@ func (cli *Client) SetGroupDescription(jid types.JID, description string) error
 		},
 	}
 
-	_, err := cli.sendGroupIQ(context.TODO(), iqSet, jid, content)
+	_, err := cli.sendGroupIQ(ctx, iqSet, jid, content)
 	return err
 }
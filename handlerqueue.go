@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+// shardedHandlerQueueLoop is the handler queue loop used when ParallelMessageHandlers is set.
+//
+// Message nodes are handled by a fixed set of workers, one per shard, and each chat always maps to the same shard.
+// Sender key sessions belong to a single group, so they stay ordered too. Signal sessions with a single device
+// can be used from multiple chats, so decryptDM locks them separately. All other nodes are handled on this
+// goroutine after the queued messages are done, so e.g. the offline sync completed event still comes after
+// all offline messages.
+func (cli *Client) shardedHandlerQueueLoop(ctx context.Context, workers int) {
+	shards := make([]chan *waBinary.Node, workers)
+	var pending, running sync.WaitGroup
+	for i := range shards {
+		shard := make(chan *waBinary.Node, handlerQueueSize)
+		shards[i] = shard
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			timer := time.NewTimer(5 * time.Minute)
+			stopAndDrainTimer(timer)
+			for node := range shard {
+				cli.handleQueuedNode(node, timer)
+				pending.Done()
+			}
+		}()
+	}
+	timer := time.NewTimer(5 * time.Minute)
+	stopAndDrainTimer(timer)
+	cli.Log.Debugf("Starting handler queue loop with %d message workers", workers)
+	for {
+		select {
+		case node := <-cli.handlerQueue:
+			if node.Tag == "message" {
+				pending.Add(1)
+				shards[cli.messageShard(node, workers)] <- node
+			} else {
+				pending.Wait()
+				cli.handleQueuedNode(node, timer)
+			}
+		case <-ctx.Done():
+			cli.Log.Debugf("Closing handler queue loop, waiting for message workers to finish")
+			// Messages that were already dispatched to a shard are handled before returning. With SynchronousAck,
+			// they're not acked if the connection is gone, so the server will send them again.
+			for _, shard := range shards {
+				close(shard)
+			}
+			running.Wait()
+			cli.Log.Debugf("Closed handler queue loop")
+			return
+		}
+	}
+}
+
+// messageShard returns the index of the worker that should handle the given message node.
+// The chat is determined from the node attributes in the same way as parseMessageSource,
+// but without any store lookups, as this is called on the handler queue loop.
+func (cli *Client) messageShard(node *waBinary.Node, workers int) int {
+	ag := node.AttrGetter()
+	chat := ag.OptionalJIDOrEmpty("from").ToNonAD()
+	switch chat.Server {
+	case types.GroupServer, types.BroadcastServer, types.NewsletterServer:
+	default:
+		ownID, ownLID := cli.getOwnID(), cli.getOwnLID()
+		if chat.User == ownID.User || (!ownLID.IsEmpty() && chat.User == ownLID.User) {
+			if recipient := ag.OptionalJID("recipient"); recipient != nil {
+				chat = recipient.ToNonAD()
+			}
+		} else if chat.Server == types.DefaultUserServer {
+			// DMs can come from either the phone number or the LID, so prefer the LID if it's included
+			if senderLID := ag.OptionalJIDOrEmpty("sender_lid"); !senderLID.IsEmpty() {
+				chat = senderLID.ToNonAD()
+			}
+		}
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(chat.String()))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// keyedLocks is a set of mutexes identified by string keys. Mutexes are removed when they're not in use.
+type keyedLocks struct {
+	locks map[string]*keyedLock
+	lock  sync.Mutex
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks the mutex with the given key and returns a function that unlocks it.
+func (kl *keyedLocks) Lock(key string) (unlock func()) {
+	kl.lock.Lock()
+	if kl.locks == nil {
+		kl.locks = make(map[string]*keyedLock)
+	}
+	l, ok := kl.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		kl.locks[key] = l
+	}
+	l.refs++
+	kl.lock.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		kl.lock.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(kl.locks, key)
+		}
+		kl.lock.Unlock()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func TestMessageShard(t *testing.T) {
+	ownID := types.NewADJID("1111111111", 0, 5)
+	cli := &Client{Store: &store.Device{ID: &ownID}}
+	cli.setOwnLID(types.NewJID("100", types.HiddenUserServer))
+	group := types.NewJID("123456789", types.GroupServer)
+	peer := types.NewJID("2222222222", types.DefaultUserServer)
+	peerLID := types.NewJID("200", types.HiddenUserServer)
+	tests := []struct {
+		name     string
+		attrs    waBinary.Attrs
+		expected types.JID
+	}{
+		{"Group", waBinary.Attrs{"from": group, "participant": types.NewADJID(peer.User, 0, 3)}, group},
+		{"DMDevice", waBinary.Attrs{"from": types.NewADJID(peer.User, 0, 3)}, peer},
+		{"DMSenderLID", waBinary.Attrs{"from": peer, "sender_lid": types.JID{User: peerLID.User, Device: 3, Server: types.HiddenUserServer}}, peerLID},
+		{"LIDSenderPN", waBinary.Attrs{"from": peerLID, "sender_pn": peer}, peerLID},
+		{"OwnDevice", waBinary.Attrs{"from": types.NewADJID(ownID.User, 0, 7), "recipient": peer}, peer},
+		{"OwnLID", waBinary.Attrs{"from": types.JID{User: "100", Device: 7, Server: types.HiddenUserServer}, "recipient": peerLID}, peerLID},
+		{"OwnWithoutRecipient", waBinary.Attrs{"from": ownID}, ownID.ToNonAD()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := &waBinary.Node{Tag: "message", Attrs: test.attrs}
+			expectedNode := &waBinary.Node{Tag: "message", Attrs: waBinary.Attrs{"from": test.expected}}
+			// With enough workers, different chats practically never share a shard
+			if shard, expected := cli.messageShard(node, math.MaxInt32), cli.messageShard(expectedNode, math.MaxInt32); shard != expected {
+				t.Errorf("Node was sharded to %d, expected %d (the shard of %s)", shard, expected, test.expected)
+			}
+			if shard := cli.messageShard(node, 4); shard < 0 || shard >= 4 {
+				t.Errorf("Shard %d is out of range", shard)
+			}
+		})
+	}
+}
+
+func TestKeyedLocks(t *testing.T) {
+	var kl keyedLocks
+	unlockA := kl.Lock("a")
+	// Other keys aren't blocked
+	kl.Lock("b")()
+
+	locked := make(chan func())
+	go func() {
+		locked <- kl.Lock("a")
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("Locking the same key twice didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	kl.lock.Lock()
+	if refs := kl.locks["a"].refs; refs != 2 {
+		t.Errorf("Expected 2 references to lock, got %d", refs)
+	}
+	kl.lock.Unlock()
+	unlockA()
+	select {
+	case unlock := <-locked:
+		unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Unlocking didn't unblock the other locker")
+	}
+	if len(kl.locks) != 0 {
+		t.Errorf("Expected unused locks to be removed, got %d", len(kl.locks))
+	}
+}
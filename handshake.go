@@ -81,7 +81,7 @@ func (cli *Client) doHandshake(fs *socket.FrameSocket, ephemeralKP keys.KeyPair)
 	certDecrypted, err := nh.Decrypt(certificateCiphertext)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt noise certificate ciphertext: %w", err)
-	} else if err = verifyServerCert(certDecrypted, staticDecrypted); err != nil {
+	} else if err = verifyServerCert(cli.getServerCertRootKey(), certDecrypted, staticDecrypted); err != nil {
 		return fmt.Errorf("failed to verify server cert: %w", err)
 	}
 
@@ -127,7 +127,14 @@ func (cli *Client) doHandshake(fs *socket.FrameSocket, ephemeralKP keys.KeyPair)
 	return nil
 }
 
-func verifyServerCert(certDecrypted, staticDecrypted []byte) error {
+func (cli *Client) getServerCertRootKey() [32]byte {
+	if cli.ServerCertRootKey != nil {
+		return *cli.ServerCertRootKey
+	}
+	return WACertPubKey
+}
+
+func verifyServerCert(rootKey [32]byte, certDecrypted, staticDecrypted []byte) error {
 	var certChain waCert.CertChain
 	err := proto.Unmarshal(certDecrypted, &certChain)
 	if err != nil {
@@ -144,7 +151,7 @@ func verifyServerCert(certDecrypted, staticDecrypted []byte) error {
 		return fmt.Errorf("unexpected length of intermediate cert signature %d (expected 64)", len(intermediateCertSignature))
 	} else if len(leafCertSignature) != 64 {
 		return fmt.Errorf("unexpected length of leaf cert signature %d (expected 64)", len(leafCertSignature))
-	} else if !ecc.VerifySignature(ecc.NewDjbECPublicKey(WACertPubKey), intermediateCertDetailsRaw, [64]byte(intermediateCertSignature)) {
+	} else if !ecc.VerifySignature(ecc.NewDjbECPublicKey(rootKey), intermediateCertDetailsRaw, [64]byte(intermediateCertSignature)) {
 		return fmt.Errorf("failed to verify intermediate cert signature")
 	} else if err = proto.Unmarshal(intermediateCertDetailsRaw, &intermediateCertDetails); err != nil {
 		return fmt.Errorf("failed to unmarshal noise certificate details: %w", err)
@@ -51,12 +51,12 @@ func (int *DangerousInternalClient) DispatchAppState(mutation appstate.Mutation,
 	int.c.dispatchAppState(mutation, fullSync, emitOnFullSync)
 }
 
-func (int *DangerousInternalClient) DownloadExternalAppStateBlob(ref *waServerSync.ExternalBlobReference) ([]byte, error) {
-	return int.c.downloadExternalAppStateBlob(ref)
+func (int *DangerousInternalClient) DownloadExternalAppStateBlob(ctx context.Context, ref *waServerSync.ExternalBlobReference) ([]byte, error) {
+	return int.c.downloadExternalAppStateBlob(ctx, ref)
 }
 
-func (int *DangerousInternalClient) FetchAppStatePatches(name appstate.WAPatchName, fromVersion uint64, snapshot bool) (*appstate.PatchList, error) {
-	return int.c.fetchAppStatePatches(name, fromVersion, snapshot)
+func (int *DangerousInternalClient) FetchAppStatePatches(ctx context.Context, name appstate.WAPatchName, fromVersion uint64, snapshot bool) (*appstate.PatchList, error) {
+	return int.c.fetchAppStatePatches(ctx, name, fromVersion, snapshot)
 }
 
 func (int *DangerousInternalClient) RequestMissingAppStateKeys(ctx context.Context, patches *appstate.PatchList) {
@@ -71,12 +71,12 @@ func (int *DangerousInternalClient) HandleDecryptedArmadillo(info *types.Message
 	return int.c.handleDecryptedArmadillo(info, decrypted, retryCount)
 }
 
-func (int *DangerousInternalClient) GetBroadcastListParticipants(jid types.JID) ([]types.JID, error) {
-	return int.c.getBroadcastListParticipants(jid)
+func (int *DangerousInternalClient) GetBroadcastListParticipants(ctx context.Context, jid types.JID) ([]types.JID, error) {
+	return int.c.getBroadcastListParticipants(ctx, jid)
 }
 
-func (int *DangerousInternalClient) GetStatusBroadcastRecipients() ([]types.JID, error) {
-	return int.c.getStatusBroadcastRecipients()
+func (int *DangerousInternalClient) GetStatusBroadcastRecipients(ctx context.Context) ([]types.JID, error) {
+	return int.c.getStatusBroadcastRecipients(ctx)
 }
 
 func (int *DangerousInternalClient) HandleCallEvent(node *waBinary.Node) {
@@ -127,6 +127,10 @@ func (int *DangerousInternalClient) HandlerQueueLoop(ctx context.Context) {
 	int.c.handlerQueueLoop(ctx)
 }
 
+func (int *DangerousInternalClient) HandleQueuedNode(node *waBinary.Node, timer *time.Timer) {
+	int.c.handleQueuedNode(node, timer)
+}
+
 func (int *DangerousInternalClient) SendNodeAndGetData(node waBinary.Node) ([]byte, error) {
 	return int.c.sendNodeAndGetData(node)
 }
@@ -155,40 +159,40 @@ func (int *DangerousInternalClient) HandleConnectSuccess(node *waBinary.Node) {
 	int.c.handleConnectSuccess(node)
 }
 
-func (int *DangerousInternalClient) DownloadAndDecrypt(url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte) (data []byte, err error) {
-	return int.c.downloadAndDecrypt(url, mediaKey, appInfo, fileLength, fileEncSHA256, fileSHA256)
+func (int *DangerousInternalClient) DownloadAndDecrypt(ctx context.Context, url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte) (data []byte, err error) {
+	return int.c.downloadAndDecrypt(ctx, url, mediaKey, appInfo, fileLength, fileEncSHA256, fileSHA256)
 }
 
-func (int *DangerousInternalClient) DownloadPossiblyEncryptedMediaWithRetries(url string, checksum []byte) (file, mac []byte, err error) {
-	return int.c.downloadPossiblyEncryptedMediaWithRetries(url, checksum)
+func (int *DangerousInternalClient) DownloadPossiblyEncryptedMediaWithRetries(ctx context.Context, url string, checksum []byte) (file, mac []byte, err error) {
+	return int.c.downloadPossiblyEncryptedMediaWithRetries(ctx, url, checksum)
 }
 
-func (int *DangerousInternalClient) DoMediaDownloadRequest(url string) (*http.Response, error) {
-	return int.c.doMediaDownloadRequest(url)
+func (int *DangerousInternalClient) DoMediaDownloadRequest(ctx context.Context, url string) (*http.Response, error) {
+	return int.c.doMediaDownloadRequest(ctx, url)
 }
 
-func (int *DangerousInternalClient) DownloadMedia(url string) ([]byte, error) {
-	return int.c.downloadMedia(url)
+func (int *DangerousInternalClient) DownloadMedia(ctx context.Context, url string) ([]byte, error) {
+	return int.c.downloadMedia(ctx, url)
 }
 
-func (int *DangerousInternalClient) DownloadEncryptedMedia(url string, checksum []byte) (file, mac []byte, err error) {
-	return int.c.downloadEncryptedMedia(url, checksum)
+func (int *DangerousInternalClient) DownloadEncryptedMedia(ctx context.Context, url string, checksum []byte) (file, mac []byte, err error) {
+	return int.c.downloadEncryptedMedia(ctx, url, checksum)
 }
 
-func (int *DangerousInternalClient) DownloadAndDecryptToFile(url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte, file File) error {
-	return int.c.downloadAndDecryptToFile(url, mediaKey, appInfo, fileLength, fileEncSHA256, fileSHA256, file)
+func (int *DangerousInternalClient) DownloadAndDecryptToFile(ctx context.Context, url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte, file File) error {
+	return int.c.downloadAndDecryptToFile(ctx, url, mediaKey, appInfo, fileLength, fileEncSHA256, fileSHA256, file)
 }
 
-func (int *DangerousInternalClient) DownloadPossiblyEncryptedMediaWithRetriesToFile(url string, checksum []byte, file File) (mac []byte, err error) {
-	return int.c.downloadPossiblyEncryptedMediaWithRetriesToFile(url, checksum, file)
+func (int *DangerousInternalClient) DownloadPossiblyEncryptedMediaWithRetriesToFile(ctx context.Context, url string, checksum []byte, file File) (mac []byte, err error) {
+	return int.c.downloadPossiblyEncryptedMediaWithRetriesToFile(ctx, url, checksum, file)
 }
 
-func (int *DangerousInternalClient) DownloadMediaToFile(url string, file io.Writer) (int64, []byte, error) {
-	return int.c.downloadMediaToFile(url, file)
+func (int *DangerousInternalClient) DownloadMediaToFile(ctx context.Context, url string, file io.Writer) (int64, []byte, error) {
+	return int.c.downloadMediaToFile(ctx, url, file)
 }
 
-func (int *DangerousInternalClient) DownloadEncryptedMediaToFile(url string, checksum []byte, file File) ([]byte, error) {
-	return int.c.downloadEncryptedMediaToFile(url, checksum, file)
+func (int *DangerousInternalClient) DownloadEncryptedMediaToFile(ctx context.Context, url string, checksum []byte, file File) ([]byte, error) {
+	return int.c.downloadEncryptedMediaToFile(ctx, url, checksum, file)
 }
 
 func (int *DangerousInternalClient) SendGroupIQ(ctx context.Context, iqType infoQueryType, jid types.JID, content waBinary.Node) (*waBinary.Node, error) {
@@ -203,6 +207,18 @@ func (int *DangerousInternalClient) GetGroupMembers(ctx context.Context, jid typ
 	return int.c.getGroupMembers(ctx, jid)
 }
 
+func (int *DangerousInternalClient) GetCachedGroupParticipants(jid types.JID) ([]types.JID, bool) {
+	return int.c.getCachedGroupParticipants(jid)
+}
+
+func (int *DangerousInternalClient) PutCachedGroupParticipants(jid types.JID, participants []types.JID) {
+	int.c.putCachedGroupParticipants(jid, participants)
+}
+
+func (int *DangerousInternalClient) DeleteCachedGroupParticipants(jid types.JID) {
+	int.c.deleteCachedGroupParticipants(jid)
+}
+
 func (int *DangerousInternalClient) ParseGroupNode(groupNode *waBinary.Node) (*types.GroupInfo, error) {
 	return int.c.parseGroupNode(groupNode)
 }
@@ -219,6 +235,10 @@ func (int *DangerousInternalClient) UpdateGroupParticipantCache(evt *events.Grou
 	int.c.updateGroupParticipantCache(evt)
 }
 
+func (int *DangerousInternalClient) UpdateGroupEphemeralSetting(evt *events.GroupInfo) {
+	int.c.updateGroupEphemeralSetting(evt)
+}
+
 func (int *DangerousInternalClient) ParseGroupNotification(node *waBinary.Node) (any, error) {
 	return int.c.parseGroupNotification(node)
 }
@@ -227,6 +247,10 @@ func (int *DangerousInternalClient) DoHandshake(fs *socket.FrameSocket, ephemera
 	return int.c.doHandshake(fs, ephemeralKP)
 }
 
+func (int *DangerousInternalClient) GetServerCertRootKey() [32]byte {
+	return int.c.getServerCertRootKey()
+}
+
 func (int *DangerousInternalClient) KeepAliveLoop(ctx context.Context) {
 	int.c.keepAliveLoop(ctx)
 }
@@ -235,12 +259,12 @@ func (int *DangerousInternalClient) SendKeepAlive(ctx context.Context) (isSucces
 	return int.c.sendKeepAlive(ctx)
 }
 
-func (int *DangerousInternalClient) RefreshMediaConn(force bool) (*MediaConn, error) {
-	return int.c.refreshMediaConn(force)
+func (int *DangerousInternalClient) RefreshMediaConn(ctx context.Context, force bool) (*MediaConn, error) {
+	return int.c.refreshMediaConn(ctx, force)
 }
 
-func (int *DangerousInternalClient) QueryMediaConn() (*MediaConn, error) {
-	return int.c.queryMediaConn()
+func (int *DangerousInternalClient) QueryMediaConn(ctx context.Context) (*MediaConn, error) {
+	return int.c.queryMediaConn(ctx)
 }
 
 func (int *DangerousInternalClient) HandleMediaRetryNotification(node *waBinary.Node) {
@@ -271,8 +295,8 @@ func (int *DangerousInternalClient) HandlePlaintextMessage(info *types.MessageIn
 	int.c.handlePlaintextMessage(info, node)
 }
 
-func (int *DangerousInternalClient) DecryptMessages(info *types.MessageInfo, node *waBinary.Node) {
-	int.c.decryptMessages(info, node)
+func (int *DangerousInternalClient) DecryptMessages(ctx context.Context, info *types.MessageInfo, node *waBinary.Node) {
+	int.c.decryptMessages(ctx, info, node)
 }
 
 func (int *DangerousInternalClient) ClearUntrustedIdentity(target types.JID) {
@@ -323,8 +347,8 @@ func (int *DangerousInternalClient) StoreHistoricalMessageSecrets(conversations
 	int.c.storeHistoricalMessageSecrets(conversations)
 }
 
-func (int *DangerousInternalClient) HandleDecryptedMessage(info *types.MessageInfo, msg *waE2E.Message, retryCount int) {
-	int.c.handleDecryptedMessage(info, msg, retryCount)
+func (int *DangerousInternalClient) HandleDecryptedMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.Message, retryCount int) {
+	int.c.handleDecryptedMessage(ctx, info, msg, retryCount)
 }
 
 func (int *DangerousInternalClient) SendProtocolMessageReceipt(id types.MessageID, msgType types.ReceiptType) {
@@ -347,8 +371,8 @@ func (int *DangerousInternalClient) SendMexIQ(ctx context.Context, queryID strin
 	return int.c.sendMexIQ(ctx, queryID, variables)
 }
 
-func (int *DangerousInternalClient) GetNewsletterInfo(input map[string]any, fetchViewerMeta bool) (*types.NewsletterMetadata, error) {
-	return int.c.getNewsletterInfo(input, fetchViewerMeta)
+func (int *DangerousInternalClient) GetNewsletterInfo(ctx context.Context, input map[string]any, fetchViewerMeta bool) (*types.NewsletterMetadata, error) {
+	return int.c.getNewsletterInfo(ctx, input, fetchViewerMeta)
 }
 
 func (int *DangerousInternalClient) HandleEncryptNotification(node *waBinary.Node) {
@@ -447,6 +471,26 @@ func (int *DangerousInternalClient) UploadPreKeys() {
 	int.c.uploadPreKeys()
 }
 
+func (int *DangerousInternalClient) UploadPreKeysWithSignedPreKey() error {
+	return int.c.uploadPreKeysWithSignedPreKey()
+}
+
+func (int *DangerousInternalClient) SignedPreKeyRotationLoop(ctx context.Context) {
+	int.c.signedPreKeyRotationLoop(ctx)
+}
+
+func (int *DangerousInternalClient) RotateSignedPreKeyIfNeeded() {
+	int.c.rotateSignedPreKeyIfNeeded()
+}
+
+func (int *DangerousInternalClient) RotateSignedPreKey() *events.SignedPreKeyRotated {
+	return int.c.rotateSignedPreKey()
+}
+
+func (int *DangerousInternalClient) RetrySignedPreKeyUpload() *events.SignedPreKeyRotated {
+	return int.c.retrySignedPreKeyUpload()
+}
+
 func (int *DangerousInternalClient) FetchPreKeys(ctx context.Context, users []types.JID) (map[types.JID]preKeyResp, error) {
 	return int.c.fetchPreKeys(ctx, users)
 }
@@ -507,6 +551,10 @@ func (int *DangerousInternalClient) CancelResponse(reqID string, ch chan *waBina
 	int.c.cancelResponse(reqID, ch)
 }
 
+func (int *DangerousInternalClient) ForgetResponse(reqID string) {
+	int.c.forgetResponse(reqID)
+}
+
 func (int *DangerousInternalClient) ReceiveResponse(data *waBinary.Node) bool {
 	return int.c.receiveResponse(data)
 }
@@ -519,7 +567,7 @@ func (int *DangerousInternalClient) SendIQAsync(query infoQuery) (<-chan *waBina
 	return int.c.sendIQAsync(query)
 }
 
-func (int *DangerousInternalClient) SendIQ(query infoQuery) (*waBinary.Node, error) {
+func (int *DangerousInternalClient) SendIQ(query infoQuery) (resp *waBinary.Node, err error) {
 	return int.c.sendIQ(query)
 }
 
@@ -555,11 +603,15 @@ func (int *DangerousInternalClient) DelayedRequestMessageFromPhone(info *types.M
 	int.c.delayedRequestMessageFromPhone(info)
 }
 
+func (int *DangerousInternalClient) ClearDelayedMessageRequests() {
+	int.c.clearDelayedMessageRequests()
+}
+
 func (int *DangerousInternalClient) SendRetryReceipt(node *waBinary.Node, info *types.MessageInfo, forceIncludeIdentity bool) {
 	int.c.sendRetryReceipt(node, info, forceIncludeIdentity)
 }
 
-func (int *DangerousInternalClient) SendGroupV3(ctx context.Context, to, ownID types.JID, id types.MessageID, messageApp []byte, msgAttrs messageAttrs, frankingTag []byte, timings *MessageDebugTimings) (string, []byte, error) {
+func (int *DangerousInternalClient) SendGroupV3(ctx context.Context, to, ownID types.JID, id types.MessageID, messageApp []byte, msgAttrs messageAttrs, frankingTag []byte, timings *MessageDebugTimings) (string, []types.JID, []byte, error) {
 	return int.c.sendGroupV3(ctx, to, ownID, id, messageApp, msgAttrs, frankingTag, timings)
 }
 
@@ -587,7 +639,7 @@ func (int *DangerousInternalClient) SendNewsletter(to types.JID, id types.Messag
 	return int.c.sendNewsletter(to, id, message, mediaID, timings)
 }
 
-func (int *DangerousInternalClient) SendGroup(ctx context.Context, to, ownID types.JID, id types.MessageID, message *waE2E.Message, timings *MessageDebugTimings, botNode *waBinary.Node) (string, []byte, error) {
+func (int *DangerousInternalClient) SendGroup(ctx context.Context, to, ownID types.JID, id types.MessageID, message *waE2E.Message, timings *MessageDebugTimings, botNode *waBinary.Node) (string, []types.JID, []byte, error) {
 	return int.c.sendGroup(ctx, to, ownID, id, message, timings, botNode)
 }
 
@@ -635,6 +687,22 @@ func (int *DangerousInternalClient) ParseBusinessProfile(node *waBinary.Node) (*
 	return int.c.parseBusinessProfile(node)
 }
 
+func (int *DangerousInternalClient) GetCachedDevices(jid types.JID) (deviceCache, bool) {
+	return int.c.getCachedDevices(jid)
+}
+
+func (int *DangerousInternalClient) PutCachedDevices(jid types.JID, cache deviceCache) {
+	int.c.putCachedDevices(jid, cache)
+}
+
+func (int *DangerousInternalClient) DeleteCachedDevices(jid types.JID) {
+	int.c.deleteCachedDevices(jid)
+}
+
+func (int *DangerousInternalClient) InvalidateParticipantCaches(chat types.JID, participants []types.JID) {
+	int.c.invalidateParticipantCaches(chat, participants)
+}
+
 func (int *DangerousInternalClient) HandleHistoricalPushNames(names []*waHistorySync.Pushname) {
 	int.c.handleHistoricalPushNames(names)
 }
@@ -51,7 +51,12 @@ func getTypeName(expr ast.Expr) string {
 	case *ast.StarExpr:
 		return "*" + getTypeName(e.X)
 	case *ast.ArrayType:
+		if e.Len != nil {
+			return fmt.Sprintf("[%s]%s", getTypeName(e.Len), getTypeName(e.Elt))
+		}
 		return "[]" + getTypeName(e.Elt)
+	case *ast.BasicLit:
+		return e.Value
 	case *ast.MapType:
 		return fmt.Sprintf("map[%s]%s", getTypeName(e.Key), getTypeName(e.Value))
 	case *ast.ChanType:
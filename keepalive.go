@@ -45,6 +45,8 @@ func (cli *Client) keepAliveLoop(ctx context.Context) {
 				})
 				if cli.EnableAutoReconnect && time.Since(lastSuccess) > KeepAliveMaxFailTime {
 					cli.Log.Debugf("Forcing reconnect due to keepalive failure")
+					cli.setDisconnectReason(DisconnectInfo{KeepAliveTimeout: true})
+					cli.setDisconnectedState("keepalive timeout")
 					cli.Disconnect()
 					go cli.autoReconnect()
 				}
@@ -62,6 +64,7 @@ func (cli *Client) keepAliveLoop(ctx context.Context) {
 }
 
 func (cli *Client) sendKeepAlive(ctx context.Context) (isSuccess, shouldContinue bool) {
+	start := time.Now()
 	respCh, err := cli.sendIQAsync(infoQuery{
 		Namespace: "w:p",
 		Type:      "get",
@@ -69,14 +72,17 @@ func (cli *Client) sendKeepAlive(ctx context.Context) (isSuccess, shouldContinue
 	})
 	if err != nil {
 		cli.Log.Warnf("Failed to send keepalive: %v", err)
+		cli.getMetrics().KeepAlive(0, err)
 		return false, true
 	}
 	select {
 	case <-respCh:
 		// All good
+		cli.getMetrics().KeepAlive(time.Since(start), nil)
 		return true, true
 	case <-time.After(KeepAliveResponseDeadline):
 		cli.Log.Warnf("Keepalive timed out")
+		cli.getMetrics().KeepAlive(time.Since(start), ErrIQTimedOut)
 		return false, true
 	case <-ctx.Done():
 		return false, false
@@ -0,0 +1,264 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"fmt"
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/proto/waHistorySync"
+	"github.com/shiestapoi/whatsmeow/proto/waLidMigrationSyncPayload"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// JIDForm specifies which form of user JIDs should be used in the message sources of dispatched events.
+type JIDForm int
+
+const (
+	// JIDFormAsReceived leaves JIDs in events exactly as they were received from the server.
+	JIDFormAsReceived JIDForm = iota
+	// JIDFormPN converts hidden user IDs (`@lid` JIDs) to phone number JIDs when the mapping is known.
+	JIDFormPN
+	// JIDFormLID converts phone number JIDs to hidden user IDs when the mapping is known.
+	JIDFormLID
+)
+
+// GetPNForLID returns the phone number JID that the given hidden user ID (`@lid` JID) belongs to.
+// The device part of the input JID is preserved in the output.
+//
+// If the mapping isn't known, this returns an empty JID and no error.
+func (cli *Client) GetPNForLID(lid types.JID) (types.JID, error) {
+	if cli == nil {
+		return types.EmptyJID, ErrClientIsNil
+	} else if lid.Server != types.HiddenUserServer {
+		return types.EmptyJID, fmt.Errorf("%s is not a LID", lid)
+	} else if cli.Store.LIDs == nil {
+		return types.EmptyJID, nil
+	}
+	pn, err := cli.Store.LIDs.GetPNForLID(lid)
+	if err != nil || pn.IsEmpty() {
+		return types.EmptyJID, err
+	}
+	pn.Device = lid.Device
+	return pn, nil
+}
+
+// GetLIDForPN returns the hidden user ID (`@lid` JID) of the given phone number JID.
+// The device part of the input JID is preserved in the output.
+//
+// If the mapping isn't known, this returns an empty JID and no error.
+func (cli *Client) GetLIDForPN(pn types.JID) (types.JID, error) {
+	if cli == nil {
+		return types.EmptyJID, ErrClientIsNil
+	} else if pn.Server != types.DefaultUserServer {
+		return types.EmptyJID, fmt.Errorf("%s is not a phone number JID", pn)
+	} else if cli.Store.LIDs == nil {
+		return types.EmptyJID, nil
+	}
+	lid, err := cli.Store.LIDs.GetLIDForPN(pn)
+	if err != nil || lid.IsEmpty() {
+		return types.EmptyJID, err
+	}
+	lid.Device = pn.Device
+	return lid, nil
+}
+
+// getAltJID returns the other form of the given user JID, or an empty JID if it's not known.
+func (cli *Client) getAltJID(jid types.JID) types.JID {
+	var alt types.JID
+	var err error
+	switch jid.Server {
+	case types.HiddenUserServer:
+		alt, err = cli.GetPNForLID(jid)
+	case types.DefaultUserServer:
+		alt, err = cli.GetLIDForPN(jid)
+	default:
+		return types.EmptyJID
+	}
+	if err != nil {
+		cli.Log.Warnf("Failed to get alternate JID for %s: %v", jid, err)
+	}
+	return alt
+}
+
+func (cli *Client) storeLIDMappings(source string, mappings ...store.LIDMapping) {
+	if cli.Store.LIDs == nil || len(mappings) == 0 {
+		return
+	}
+	err := cli.Store.LIDs.PutLIDMappings(mappings...)
+	if err != nil {
+		cli.Log.Errorf("Failed to store %d LID mappings from %s: %v", len(mappings), source, err)
+	}
+}
+
+func (cli *Client) storeLIDMapping(source string, a, b types.JID) {
+	if a.IsEmpty() || b.IsEmpty() {
+		return
+	} else if a.Server == types.DefaultUserServer && b.Server == types.HiddenUserServer {
+		a, b = b, a
+	} else if a.Server != types.HiddenUserServer || b.Server != types.DefaultUserServer {
+		return
+	}
+	cli.storeLIDMappings(source, store.LIDMapping{LID: a, PN: b})
+}
+
+// parseSenderAlt finds the alternative address of the message sender from the node attributes
+// and stores the mapping between the two addresses.
+func (cli *Client) parseSenderAlt(node *waBinary.Node, source *types.MessageSource) {
+	ag := node.AttrGetter()
+	switch source.Sender.Server {
+	case types.HiddenUserServer:
+		source.SenderAlt = ag.OptionalJIDOrEmpty("participant_pn")
+		if source.SenderAlt.IsEmpty() {
+			source.SenderAlt = ag.OptionalJIDOrEmpty("sender_pn")
+		}
+	case types.DefaultUserServer:
+		source.SenderAlt = ag.OptionalJIDOrEmpty("participant_lid")
+		if source.SenderAlt.IsEmpty() {
+			source.SenderAlt = ag.OptionalJIDOrEmpty("sender_lid")
+		}
+	default:
+		return
+	}
+	if !source.SenderAlt.IsEmpty() {
+		source.SenderAlt.Device = source.Sender.Device
+		cli.storeLIDMapping("message attributes", source.Sender, source.SenderAlt)
+	}
+}
+
+func (cli *Client) storeLIDMappingsFromUsync(list *waBinary.Node) {
+	var mappings []store.LIDMapping
+	for _, child := range list.GetChildren() {
+		jid, jidOK := child.Attrs["jid"].(types.JID)
+		if child.Tag != "user" || !jidOK || jid.Server != types.DefaultUserServer {
+			continue
+		}
+		lid, lidOK := child.GetChildByTag("lid").Attrs["val"].(types.JID)
+		if lidOK && lid.Server == types.HiddenUserServer {
+			mappings = append(mappings, store.LIDMapping{LID: lid, PN: jid})
+		}
+	}
+	cli.storeLIDMappings("usync response", mappings...)
+}
+
+func (cli *Client) handleLIDMigrationSync(encodedPayload []byte) {
+	var payload waLidMigrationSyncPayload.LIDMigrationMappingSyncPayload
+	err := proto.Unmarshal(encodedPayload, &payload)
+	if err != nil {
+		cli.Log.Errorf("Failed to unmarshal LID migration mapping sync payload: %v", err)
+		return
+	}
+	mappings := make([]store.LIDMapping, 0, len(payload.GetPnToLidMappings()))
+	for _, mapping := range payload.GetPnToLidMappings() {
+		lid := mapping.GetLatestLid()
+		if lid == 0 {
+			lid = mapping.GetAssignedLid()
+		}
+		if lid == 0 || mapping.GetPn() == 0 {
+			continue
+		}
+		mappings = append(mappings, store.LIDMapping{
+			LID: types.NewJID(strconv.FormatUint(lid, 10), types.HiddenUserServer),
+			PN:  types.NewJID(strconv.FormatUint(mapping.GetPn(), 10), types.DefaultUserServer),
+		})
+	}
+	cli.Log.Debugf("Got %d LID mappings in LID migration sync", len(mappings))
+	ownID := cli.getOwnID()
+	for _, mapping := range mappings {
+		if mapping.PN.User == ownID.User {
+			cli.setOwnLID(mapping.LID)
+		}
+	}
+	cli.storeLIDMappings("LID migration sync", mappings...)
+}
+
+func (cli *Client) storeHistoricalLIDMappings(mappings []*waHistorySync.PhoneNumberToLIDMapping) {
+	parsed := make([]store.LIDMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		lid, err := types.ParseJID(mapping.GetLidJID())
+		if err != nil || lid.Server != types.HiddenUserServer {
+			continue
+		}
+		pn, err := types.ParseJID(mapping.GetPnJID())
+		if err != nil || pn.Server != types.DefaultUserServer {
+			continue
+		}
+		parsed = append(parsed, store.LIDMapping{LID: lid, PN: pn})
+	}
+	cli.storeLIDMappings("history sync", parsed...)
+}
+
+func (cli *Client) normalizeJID(jid types.JID) types.JID {
+	if (cli.NormalizeEventJIDs == JIDFormPN && jid.Server == types.HiddenUserServer) ||
+		(cli.NormalizeEventJIDs == JIDFormLID && jid.Server == types.DefaultUserServer) {
+		if alt := cli.getAltJID(jid); !alt.IsEmpty() {
+			return alt
+		}
+	}
+	return jid
+}
+
+func (cli *Client) normalizeMessageSource(source *types.MessageSource) {
+	if newSender := cli.normalizeJID(source.Sender); newSender != source.Sender {
+		source.SenderAlt = source.Sender
+		source.Sender = newSender
+	}
+	source.Chat = cli.normalizeJID(source.Chat)
+}
+
+// normalizeEventJIDs returns a copy of the given event with the message source JIDs
+// converted into the form specified in Client.NormalizeEventJIDs.
+func (cli *Client) normalizeEventJIDs(evt any) any {
+	if cli.NormalizeEventJIDs == JIDFormAsReceived {
+		return evt
+	}
+	switch typedEvt := evt.(type) {
+	case *events.Message:
+		evtCopy := *typedEvt
+		cli.normalizeMessageSource(&evtCopy.Info.MessageSource)
+		return &evtCopy
+	case *events.UndecryptableMessage:
+		evtCopy := *typedEvt
+		cli.normalizeMessageSource(&evtCopy.Info.MessageSource)
+		return &evtCopy
+	case *events.Receipt:
+		evtCopy := *typedEvt
+		cli.normalizeMessageSource(&evtCopy.MessageSource)
+		return &evtCopy
+	case *events.ChatPresence:
+		evtCopy := *typedEvt
+		cli.normalizeMessageSource(&evtCopy.MessageSource)
+		return &evtCopy
+	default:
+		return evt
+	}
+}
+
+// getOwnLID returns the hidden user ID of the current user, or an empty JID if it's not known.
+// It's called for every incoming message, so it only reads the value cached on the client.
+func (cli *Client) getOwnLID() types.JID {
+	if cli == nil {
+		return types.EmptyJID
+	}
+	cli.ownLIDLock.RLock()
+	defer cli.ownLIDLock.RUnlock()
+	return cli.ownLID
+}
+
+func (cli *Client) setOwnLID(lid types.JID) {
+	if lid.Server != types.HiddenUserServer {
+		lid = types.EmptyJID
+	}
+	cli.ownLIDLock.Lock()
+	cli.ownLID = lid.ToNonAD()
+	cli.ownLIDLock.Unlock()
+}
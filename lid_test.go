@@ -0,0 +1,48 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waLidMigrationSyncPayload"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+func TestOwnLIDFromMigrationSync(t *testing.T) {
+	ownID := types.NewADJID("1234567890", 0, 5)
+	cli := &Client{Store: &store.Device{ID: &ownID}, Log: waLog.Noop}
+	if lid := cli.getOwnLID(); !lid.IsEmpty() {
+		t.Fatalf("Expected own LID to be unknown, got %s", lid)
+	}
+	cli.setOwnLID(types.JID{User: "100", Device: 5, Server: types.HiddenUserServer})
+	if lid, expected := cli.getOwnLID(), types.NewJID("100", types.HiddenUserServer); lid != expected {
+		t.Errorf("Expected own LID to be %s, got %s", expected, lid)
+	}
+
+	payload, err := proto.Marshal(&waLidMigrationSyncPayload.LIDMigrationMappingSyncPayload{
+		PnToLidMappings: []*waLidMigrationSyncPayload.LIDMigrationMapping{{
+			Pn:          proto.Uint64(1111111111),
+			AssignedLid: proto.Uint64(111),
+		}, {
+			Pn:          proto.Uint64(1234567890),
+			AssignedLid: proto.Uint64(100),
+			LatestLid:   proto.Uint64(200),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal payload: %v", err)
+	}
+	cli.handleLIDMigrationSync(payload)
+	if lid, expected := cli.getOwnLID(), types.NewJID("200", types.HiddenUserServer); lid != expected {
+		t.Errorf("Expected own LID to be updated to %s, got %s", expected, lid)
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+// ManagerContainer is the part of a device container that Manager needs.
+// Both sqlstore.Container and memstore.Container implement it.
+type ManagerContainer interface {
+	store.DeviceContainer
+	GetAllDevices() ([]*store.Device, error)
+	NewDevice() *store.Device
+}
+
+// ManagedEvent is an event emitted by one of the clients of a Manager.
+type ManagedEvent struct {
+	// JID is the device JID of the account. It's empty for events from clients that are still pairing.
+	JID    types.JID
+	Client *Client
+	Event  any
+}
+
+// ManagedEventHandler is a function that receives events from all clients of a Manager.
+type ManagedEventHandler func(evt *ManagedEvent)
+
+type wrappedManagedEventHandler struct {
+	fn ManagedEventHandler
+	id uint32
+}
+
+// AccountHealth is a snapshot of the connection health of an account in a Manager.
+type AccountHealth struct {
+	JID   types.JID
+	State events.ConnectionState
+	// StateChanged is when State last changed.
+	StateChanged time.Time
+	// LastConnected is when the client last connected successfully.
+	LastConnected time.Time
+	// ReconnectAttempts is the number of automatic reconnect attempts since the last successful connection.
+	ReconnectAttempts int
+	// KeepAliveFailing is true if keepalive pings have failed since the last successful one.
+	KeepAliveFailing bool
+	// LastError is the most recent connection error, like a failed reconnect attempt.
+	LastError error
+}
+
+// Healthy returns true if the account is connected and keepalive pings are working.
+func (ah *AccountHealth) Healthy() bool {
+	return (ah.State == events.ConnectionOnline || ah.State == events.ConnectionSyncingOffline) && !ah.KeepAliveFailing
+}
+
+type managedAccount struct {
+	client *Client
+	health AccountHealth
+	lock   sync.Mutex
+}
+
+// Manager runs clients for all devices in a container.
+//
+// It creates and connects a client for each stored device, replaces the client after a new device is paired,
+// removes accounts when they're logged out and passes events from all clients to the handlers registered with
+// AddEventHandler. Clients are configured with Setup, so most fields of Client can be set there.
+type Manager struct {
+	Container ManagerContainer
+	Log       waLog.Logger
+
+	// Setup is called for every client created by the manager before it's connected.
+	// This is the place to register per-client event handlers and change client settings.
+	Setup func(cli *Client)
+	// HTTPClient is shared by all clients for media uploads and downloads. See Client.SetMediaHTTPClient
+	// for the caveats. If nil, each client has its own HTTP client.
+	HTTPClient *http.Client
+	// ConnectConcurrency is the number of clients that Start connects at the same time. Defaults to 8.
+	ConnectConcurrency int
+
+	accounts     map[types.JID]*managedAccount
+	pairing      map[*Client]*managedAccount
+	accountsLock sync.RWMutex
+
+	eventHandlers     []wrappedManagedEventHandler
+	eventHandlersLock sync.RWMutex
+	nextHandlerID     atomic.Uint32
+}
+
+// NewManager creates a new Manager for the devices in the given container. Call Start to connect the clients.
+func NewManager(container ManagerContainer, log waLog.Logger) *Manager {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Manager{
+		Container: container,
+		Log:       log,
+		accounts:  make(map[types.JID]*managedAccount),
+		pairing:   make(map[*Client]*managedAccount),
+	}
+}
+
+// AddEventHandler registers a function to receive events from all clients of the manager.
+// Handlers are called synchronously in the client's event dispatch, like handlers registered on a Client directly.
+func (m *Manager) AddEventHandler(handler ManagedEventHandler) uint32 {
+	id := m.nextHandlerID.Add(1)
+	m.eventHandlersLock.Lock()
+	m.eventHandlers = append(m.eventHandlers, wrappedManagedEventHandler{fn: handler, id: id})
+	m.eventHandlersLock.Unlock()
+	return id
+}
+
+// RemoveEventHandler removes a handler registered with AddEventHandler. If the handler is found, this returns true.
+//
+// Like Client.RemoveEventHandler, this must not be called directly from an event handler.
+func (m *Manager) RemoveEventHandler(id uint32) bool {
+	m.eventHandlersLock.Lock()
+	defer m.eventHandlersLock.Unlock()
+	for i, handler := range m.eventHandlers {
+		if handler.id == id {
+			m.eventHandlers = slices.Delete(m.eventHandlers, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// Start creates clients for all devices in the container that don't have a client yet,
+// and connects all clients that aren't connected.
+//
+// Connection errors are returned joined together, but the clients are kept in the manager,
+// so they can be reconnected with Client.Connect.
+func (m *Manager) Start() error {
+	devices, err := m.Container.GetAllDevices()
+	if err != nil {
+		return fmt.Errorf("failed to get devices: %w", err)
+	}
+	concurrency := m.ConnectConcurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var errs []error
+	var errsLock sync.Mutex
+	for _, device := range devices {
+		acc, _ := m.addAccount(device)
+		if acc.client.IsConnected() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := m.connect(acc); err != nil {
+				errsLock.Lock()
+				errs = append(errs, fmt.Errorf("failed to connect %s: %w", device.ID, err))
+				errsLock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Stop disconnects all clients, including ones that are still pairing. The accounts stay in the manager,
+// so calling Start again will reconnect the existing clients.
+func (m *Manager) Stop() {
+	m.accountsLock.RLock()
+	clients := make([]*Client, 0, len(m.accounts)+len(m.pairing))
+	for _, acc := range m.accounts {
+		clients = append(clients, acc.client)
+	}
+	for cli := range m.pairing {
+		clients = append(clients, cli)
+	}
+	m.accountsLock.RUnlock()
+	for _, cli := range clients {
+		cli.Disconnect()
+	}
+}
+
+// NewAccount creates a client for a new device. The client isn't connected automatically: get a QR channel
+// or call PairPhone as usual. After pairing succeeds, the manager replaces it with a new client for the
+// paired device, so the returned client shouldn't be used after events.PairSuccess.
+func (m *Manager) NewAccount() *Client {
+	acc := &managedAccount{}
+	acc.client = m.newClient(m.Container.NewDevice(), acc)
+	// Reconnect manually after pairing, so that the client can be replaced
+	acc.client.DisableLoginAutoReconnect = true
+	m.accountsLock.Lock()
+	m.pairing[acc.client] = acc
+	m.accountsLock.Unlock()
+	return acc.client
+}
+
+// Get returns the client for the given device JID, or nil if the manager doesn't have one.
+func (m *Manager) Get(jid types.JID) *Client {
+	m.accountsLock.RLock()
+	defer m.accountsLock.RUnlock()
+	if acc, ok := m.accounts[jid]; ok {
+		return acc.client
+	}
+	return nil
+}
+
+// Accounts returns the device JIDs of all accounts in the manager.
+func (m *Manager) Accounts() []types.JID {
+	m.accountsLock.RLock()
+	jids := make([]types.JID, 0, len(m.accounts))
+	for jid := range m.accounts {
+		jids = append(jids, jid)
+	}
+	m.accountsLock.RUnlock()
+	slices.SortFunc(jids, func(a, b types.JID) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return jids
+}
+
+// Health returns the connection health of the given account.
+func (m *Manager) Health(jid types.JID) (AccountHealth, bool) {
+	m.accountsLock.RLock()
+	acc, ok := m.accounts[jid]
+	m.accountsLock.RUnlock()
+	if !ok {
+		return AccountHealth{}, false
+	}
+	return acc.getHealth(), true
+}
+
+// AllHealth returns the connection health of all accounts in the manager.
+func (m *Manager) AllHealth() []AccountHealth {
+	m.accountsLock.RLock()
+	health := make([]AccountHealth, 0, len(m.accounts))
+	for _, acc := range m.accounts {
+		health = append(health, acc.getHealth())
+	}
+	m.accountsLock.RUnlock()
+	slices.SortFunc(health, func(a, b AccountHealth) int {
+		return strings.Compare(a.JID.String(), b.JID.String())
+	})
+	return health
+}
+
+// Remove disconnects the client of the given account and removes it from the manager without deleting the device.
+func (m *Manager) Remove(jid types.JID) bool {
+	m.accountsLock.Lock()
+	acc, ok := m.accounts[jid]
+	delete(m.accounts, jid)
+	m.accountsLock.Unlock()
+	if ok {
+		acc.client.Disconnect()
+	}
+	return ok
+}
+
+// Logout unlinks the given account using Client.LogoutContext, which also deletes the device from the container,
+// and then removes the account from the manager.
+func (m *Manager) Logout(ctx context.Context, jid types.JID) error {
+	cli := m.Get(jid)
+	if cli == nil {
+		return fmt.Errorf("%w: no client for %s", ErrNotLoggedIn, jid)
+	} else if err := cli.LogoutContext(ctx); err != nil {
+		return err
+	}
+	m.Remove(jid)
+	return nil
+}
+
+func (m *Manager) addAccount(device *store.Device) (*managedAccount, bool) {
+	m.accountsLock.Lock()
+	defer m.accountsLock.Unlock()
+	if acc, ok := m.accounts[*device.ID]; ok {
+		return acc, false
+	}
+	acc := &managedAccount{health: AccountHealth{JID: *device.ID}}
+	acc.client = m.newClient(device, acc)
+	m.accounts[*device.ID] = acc
+	return acc, true
+}
+
+func (m *Manager) newClient(device *store.Device, acc *managedAccount) *Client {
+	log := m.Log
+	if device.ID != nil {
+		log = log.Sub(device.ID.String())
+	}
+	cli := NewClient(device, log)
+	if m.HTTPClient != nil {
+		cli.SetMediaHTTPClient(m.HTTPClient)
+	}
+	cli.AddEventHandler(func(evt any) {
+		m.handleEvent(acc, cli, evt)
+	})
+	if m.Setup != nil {
+		m.Setup(cli)
+	}
+	return cli
+}
+
+func (m *Manager) connect(acc *managedAccount) error {
+	err := acc.client.Connect()
+	if err != nil {
+		acc.lock.Lock()
+		acc.health.LastError = err
+		acc.lock.Unlock()
+	}
+	return err
+}
+
+func (acc *managedAccount) getHealth() AccountHealth {
+	acc.lock.Lock()
+	health := acc.health
+	acc.lock.Unlock()
+	// State change events are dispatched asynchronously, so get the current state directly from the client
+	health.State = acc.client.State()
+	return health
+}
+
+func (acc *managedAccount) updateHealth(rawEvt any) {
+	acc.lock.Lock()
+	defer acc.lock.Unlock()
+	switch evt := rawEvt.(type) {
+	case *events.ConnectionStateChanged:
+		acc.health.StateChanged = time.Now()
+	case *events.Connected:
+		acc.health.LastConnected = time.Now()
+		acc.health.ReconnectAttempts = 0
+		acc.health.KeepAliveFailing = false
+		acc.health.LastError = nil
+	case *events.ReconnectScheduled:
+		acc.health.ReconnectAttempts = evt.Attempt
+		if evt.Error != nil {
+			acc.health.LastError = evt.Error
+		}
+	case *events.ReconnectGaveUp:
+		if evt.Error != nil {
+			acc.health.LastError = evt.Error
+		}
+	case *events.KeepAliveTimeout:
+		acc.health.KeepAliveFailing = true
+	case *events.KeepAliveRestored:
+		acc.health.KeepAliveFailing = false
+	case events.PermanentDisconnect:
+		acc.health.LastError = errors.New(evt.PermanentDisconnectDescription())
+	}
+}
+
+func (m *Manager) handleEvent(acc *managedAccount, cli *Client, rawEvt any) {
+	acc.updateHealth(rawEvt)
+	// The device ID is cleared when the store is deleted after a logout, so prefer the JID saved in the account
+	jid := acc.health.JID
+	if jid.IsEmpty() && cli.Store.ID != nil {
+		jid = *cli.Store.ID
+	}
+	m.eventHandlersLock.RLock()
+	for _, handler := range m.eventHandlers {
+		handler.fn(&ManagedEvent{JID: jid, Client: cli, Event: rawEvt})
+	}
+	m.eventHandlersLock.RUnlock()
+
+	switch rawEvt.(type) {
+	case *events.LoggedOut:
+		// The client already deleted the device from the store
+		m.Log.Infof("Account %s was logged out, removing client", jid)
+		go m.removeClient(jid, cli)
+	case *events.ManualLoginReconnect:
+		m.accountsLock.RLock()
+		_, isPairing := m.pairing[cli]
+		m.accountsLock.RUnlock()
+		if isPairing {
+			go m.finishPairing(cli)
+		}
+	}
+}
+
+// removeClient removes the account if it still uses the given client and disconnects the client.
+func (m *Manager) removeClient(jid types.JID, cli *Client) {
+	m.accountsLock.Lock()
+	if acc, ok := m.accounts[jid]; ok && acc.client == cli {
+		delete(m.accounts, jid)
+	}
+	delete(m.pairing, cli)
+	m.accountsLock.Unlock()
+	cli.Disconnect()
+}
+
+// finishPairing replaces the client that was used for pairing with a new client for the paired device.
+func (m *Manager) finishPairing(cli *Client) {
+	m.accountsLock.Lock()
+	delete(m.pairing, cli)
+	m.accountsLock.Unlock()
+	cli.Disconnect()
+	if cli.Store.ID == nil {
+		m.Log.Warnf("Pairing client asked to reconnect without a device ID")
+		return
+	}
+	m.Log.Infof("Paired new account %s, starting new client", cli.Store.ID)
+	acc, isNew := m.addAccount(cli.Store)
+	if !isNew {
+		m.Log.Warnf("Manager already had a client for newly paired account %s", cli.Store.ID)
+	}
+	if err := m.connect(acc); err != nil {
+		m.Log.Errorf("Failed to connect newly paired account %s: %v", cli.Store.ID, err)
+	}
+}
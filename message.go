@@ -9,6 +9,7 @@ package whatsmeow
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -31,15 +32,22 @@ import (
 	"github.com/shiestapoi/whatsmeow/store"
 	"github.com/shiestapoi/whatsmeow/types"
 	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
 )
 
 var pbSerializer = store.SignalProtobufSerializer
 
 func (cli *Client) handleEncryptedMessage(node *waBinary.Node) {
+	ctx, span := cli.startSpan(context.Background(), "handle_encrypted_message")
 	info, err := cli.parseMessageInfo(node)
+	defer func() {
+		span.End(time.Now(), err)
+	}()
 	if err != nil {
 		cli.Log.Warnf("Failed to parse message: %v", err)
 	} else {
+		span.SetAttribute("chat", info.Chat.String())
+		span.SetAttribute("message_id", info.ID)
 		if info.VerifiedName != nil && len(info.VerifiedName.Details.GetVerifiedName()) > 0 {
 			go cli.updateBusinessName(info.Sender, info, info.VerifiedName.Details.GetVerifiedName())
 		}
@@ -50,7 +58,7 @@ func (cli *Client) handleEncryptedMessage(node *waBinary.Node) {
 		if info.Sender.Server == types.NewsletterServer {
 			cli.handlePlaintextMessage(info, node)
 		} else {
-			cli.decryptMessages(info, node)
+			cli.decryptMessages(ctx, info, node)
 		}
 	}
 }
@@ -61,6 +69,11 @@ func (cli *Client) parseMessageSource(node *waBinary.Node, requireParticipant bo
 		err = ErrNotLoggedIn
 		return
 	}
+	ownLID := cli.getOwnLID()
+	isOwnUser := func(jid types.JID) bool {
+		return (jid.Server != types.HiddenUserServer && jid.User == clientID.User) ||
+			(jid.Server == types.HiddenUserServer && !ownLID.IsEmpty() && jid.User == ownLID.User)
+	}
 	ag := node.AttrGetter()
 	from := ag.JID("from")
 	if from.Server == types.GroupServer || from.Server == types.BroadcastServer {
@@ -71,7 +84,7 @@ func (cli *Client) parseMessageSource(node *waBinary.Node, requireParticipant bo
 		} else {
 			source.Sender = ag.OptionalJIDOrEmpty("participant")
 		}
-		if source.Sender.User == clientID.User {
+		if isOwnUser(source.Sender) {
 			source.IsFromMe = true
 		}
 		if from.Server == types.BroadcastServer {
@@ -81,7 +94,7 @@ func (cli *Client) parseMessageSource(node *waBinary.Node, requireParticipant bo
 		source.Chat = from
 		source.Sender = from
 		// TODO IsFromMe?
-	} else if from.User == clientID.User {
+	} else if isOwnUser(from) {
 		source.IsFromMe = true
 		source.Sender = from
 		recipient := ag.OptionalJID("recipient")
@@ -105,6 +118,9 @@ func (cli *Client) parseMessageSource(node *waBinary.Node, requireParticipant bo
 		source.Sender = from
 	}
 	err = ag.Error()
+	if err == nil && !source.Sender.IsEmpty() {
+		cli.parseSenderAlt(node, &source)
+	}
 	return
 }
 
@@ -185,6 +201,7 @@ func (cli *Client) parseMessageInfo(node *waBinary.Node) (*types.MessageInfo, er
 }
 
 func (cli *Client) handlePlaintextMessage(info *types.MessageInfo, node *waBinary.Node) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
 	// TODO edits have an additional <meta msg_edit_t="1696321271735" original_msg_t="1696321248"/> node
 	plaintext, ok := node.GetOptionalChildByTag("plaintext")
 	if !ok {
@@ -193,17 +210,18 @@ func (cli *Client) handlePlaintextMessage(info *types.MessageInfo, node *waBinar
 	}
 	plaintextBody, ok := plaintext.Content.([]byte)
 	if !ok {
-		cli.Log.Warnf("Plaintext message from %s doesn't have byte content", info.SourceString())
+		log.Warnf("Plaintext message from %s doesn't have byte content", info.SourceString())
 		return
 	}
 
 	var msg waE2E.Message
 	err := proto.Unmarshal(plaintextBody, &msg)
 	if err != nil {
-		cli.Log.Warnf("Error unmarshaling plaintext message from %s: %v", info.SourceString(), err)
+		log.Warnf("Error unmarshaling plaintext message from %s: %v", info.SourceString(), err)
 		return
 	}
 	cli.storeMessageSecret(info, &msg)
+	cli.storeMessage(info, &msg)
 	evt := &events.Message{
 		Info:       *info,
 		RawMessage: &msg,
@@ -219,18 +237,23 @@ func (cli *Client) handlePlaintextMessage(info *types.MessageInfo, node *waBinar
 	return
 }
 
-func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node) {
+func (cli *Client) decryptMessages(ctx context.Context, info *types.MessageInfo, node *waBinary.Node) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
+	ctx, span := cli.startSpan(ctx, "decrypt_messages")
+	defer func() {
+		span.End(time.Now(), nil)
+	}()
 	unavailableNode, ok := node.GetOptionalChildByTag("unavailable")
 	if ok && len(node.GetChildrenByTag("enc")) == 0 {
 		uType := events.UnavailableType(unavailableNode.AttrGetter().String("type"))
-		cli.Log.Warnf("Unavailable message %s from %s (type: %q)", info.ID, info.SourceString(), uType)
+		log.Warnf("Unavailable message %s from %s (type: %q)", info.ID, info.SourceString(), uType)
 		go cli.delayedRequestMessageFromPhone(info)
 		cli.dispatchEvent(&events.UndecryptableMessage{Info: *info, IsUnavailable: true, UnavailableType: uType})
 		return
 	}
 
 	children := node.GetChildren()
-	cli.Log.Debugf("Decrypting message from %s", info.SourceString())
+	log.Debugf("Decrypting message from %s", info.SourceString())
 	handled := false
 	containsDirectMsg := false
 	for _, child := range children {
@@ -244,6 +267,8 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 		}
 		var decrypted []byte
 		var err error
+		_, decryptSpan := cli.startSpan(ctx, "decrypt")
+		decryptSpan.SetAttribute("enc_type", encType)
 		if encType == "pkmsg" || encType == "msg" {
 			decrypted, err = cli.decryptDM(&child, info.Sender, encType == "pkmsg")
 			containsDirectMsg = true
@@ -261,7 +286,7 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 
 			messageSecret, err := cli.Store.MsgSecrets.GetMessageSecret(info.Chat, targetSenderJID, info.MsgMetaInfo.TargetID)
 			if err != nil || messageSecret == nil {
-				cli.Log.Warnf("Error getting message secret for bot msg with id %s", node.AttrGetter().String("id"))
+				log.Warnf("Error getting message secret for bot msg with id %s", node.AttrGetter().String("id"))
 				continue
 			}
 
@@ -271,7 +296,7 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 
 			err = proto.Unmarshal(byteContents, &msMsg)
 			if err != nil {
-				cli.Log.Warnf("Error decoding MessageSecretMesage protobuf %v", err)
+				log.Warnf("Error decoding MessageSecretMesage protobuf %v", err)
 				continue
 			}
 
@@ -286,12 +311,15 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 			// step 4: decrypt and voila
 			decrypted, err = cli.decryptBotMessage(messageSecret, &msMsg, messageID, targetSenderJID, info)
 		} else {
-			cli.Log.Warnf("Unhandled encrypted message (type %s) from %s", encType, info.SourceString())
+			log.Warnf("Unhandled encrypted message (type %s) from %s", encType, info.SourceString())
+			decryptSpan.End(time.Now(), nil)
 			continue
 		}
+		decryptSpan.End(time.Now(), err)
 
+		cli.getMetrics().MessageDecrypted(encType, classifyDecryptError(err))
 		if err != nil {
-			cli.Log.Warnf("Error decrypting message from %s: %v", info.SourceString(), err)
+			log.Warnf("Error decrypting message from %s: %v", info.SourceString(), err)
 			isUnavailable := encType == "skmsg" && !containsDirectMsg && errors.Is(err, signalerror.ErrNoSenderKeyForUser)
 			// TODO figure out why @bot messages fail to decrypt
 			if info.Chat.Server != types.BotServer {
@@ -312,15 +340,15 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 		case 2:
 			err = proto.Unmarshal(decrypted, &msg)
 			if err != nil {
-				cli.Log.Warnf("Error unmarshaling decrypted message from %s: %v", info.SourceString(), err)
+				log.Warnf("Error unmarshaling decrypted message from %s: %v", info.SourceString(), err)
 				continue
 			}
-			cli.handleDecryptedMessage(info, &msg, retryCount)
+			cli.handleDecryptedMessage(ctx, info, &msg, retryCount)
 			handled = true
 		case 3:
 			handled = cli.handleDecryptedArmadillo(info, decrypted, retryCount)
 		default:
-			cli.Log.Warnf("Unknown version %d in decrypted message from %s", ag.Int("v"), info.SourceString())
+			log.Warnf("Unknown version %d in decrypted message from %s", ag.Int("v"), info.SourceString())
 		}
 	}
 	if handled {
@@ -329,20 +357,24 @@ func (cli *Client) decryptMessages(info *types.MessageInfo, node *waBinary.Node)
 }
 
 func (cli *Client) clearUntrustedIdentity(target types.JID) {
+	log := waLog.With(cli.Log, waLog.FieldDevice, target)
 	err := cli.Store.Identities.DeleteIdentity(target.SignalAddress().String())
 	if err != nil {
-		cli.Log.Warnf("Failed to delete untrusted identity of %s from store: %v", target, err)
+		log.Warnf("Failed to delete untrusted identity of %s from store: %v", target, err)
 	}
 	err = cli.Store.Sessions.DeleteSession(target.SignalAddress().String())
 	if err != nil {
-		cli.Log.Warnf("Failed to delete session with %s (untrusted identity) from store: %v", target, err)
+		log.Warnf("Failed to delete session with %s (untrusted identity) from store: %v", target, err)
 	}
 	cli.dispatchEvent(&events.IdentityChange{JID: target, Timestamp: time.Now(), Implicit: true})
 }
 
 func (cli *Client) decryptDM(child *waBinary.Node, from types.JID, isPreKey bool) ([]byte, error) {
+	log := waLog.With(cli.Log, waLog.FieldSender, from)
 	content, _ := child.Content.([]byte)
 
+	// The same session can be used in multiple chats, which may be handled in parallel
+	defer cli.decryptLocks.Lock(from.SignalAddress().String())()
 	builder := session.NewBuilderFromSignal(cli.Store, from.SignalAddress(), pbSerializer)
 	cipher := session.NewCipher(builder, from.SignalAddress())
 	var plaintext []byte
@@ -353,7 +385,7 @@ func (cli *Client) decryptDM(child *waBinary.Node, from types.JID, isPreKey bool
 		}
 		plaintext, _, err = cipher.DecryptMessageReturnKey(preKeyMsg)
 		if cli.AutoTrustIdentity && errors.Is(err, signalerror.ErrUntrustedIdentity) {
-			cli.Log.Warnf("Got %v error while trying to decrypt prekey message from %s, clearing stored identity and retrying", err, from)
+			log.Warnf("Got %v error while trying to decrypt prekey message from %s, clearing stored identity and retrying", err, from)
 			cli.clearUntrustedIdentity(from)
 			plaintext, _, err = cipher.DecryptMessageReturnKey(preKeyMsg)
 		}
@@ -425,15 +457,16 @@ func padMessage(plaintext []byte) []byte {
 }
 
 func (cli *Client) handleSenderKeyDistributionMessage(chat, from types.JID, axolotlSKDM []byte) {
+	log := waLog.With(cli.Log, waLog.FieldChat, chat, waLog.FieldSender, from)
 	builder := groups.NewGroupSessionBuilder(cli.Store, pbSerializer)
 	senderKeyName := protocol.NewSenderKeyName(chat.String(), from.SignalAddress())
 	sdkMsg, err := protocol.NewSenderKeyDistributionMessageFromBytes(axolotlSKDM, pbSerializer.SenderKeyDistributionMessage)
 	if err != nil {
-		cli.Log.Errorf("Failed to parse sender key distribution message from %s for %s: %v", from, chat, err)
+		log.Errorf("Failed to parse sender key distribution message from %s for %s: %v", from, chat, err)
 		return
 	}
 	builder.Process(senderKeyName, sdkMsg)
-	cli.Log.Debugf("Processed sender key distribution message from %s in %s", senderKeyName.Sender().String(), senderKeyName.GroupID())
+	log.Debugf("Processed sender key distribution message from %s in %s", senderKeyName.Sender().String(), senderKeyName.GroupID())
 }
 
 func (cli *Client) handleHistorySyncNotificationLoop() {
@@ -468,10 +501,14 @@ func (cli *Client) handleHistorySyncNotification(notif *waE2E.HistorySyncNotific
 		cli.Log.Errorf("Failed to unmarshal history sync data: %v", err)
 	} else {
 		cli.Log.Debugf("Received history sync (type %s, chunk %d)", historySync.GetSyncType(), historySync.GetChunkOrder())
+		if len(historySync.GetPhoneNumberToLidMappings()) > 0 {
+			go cli.storeHistoricalLIDMappings(historySync.GetPhoneNumberToLidMappings())
+		}
 		if historySync.GetSyncType() == waHistorySync.HistorySync_PUSH_NAME {
 			go cli.handleHistoricalPushNames(historySync.GetPushnames())
 		} else if len(historySync.GetConversations()) > 0 {
 			go cli.storeHistoricalMessageSecrets(historySync.GetConversations())
+			go cli.storeHistoricalMessages(historySync.GetConversations())
 		}
 		cli.dispatchEvent(&events.HistorySync{
 			Data: &historySync,
@@ -535,6 +572,7 @@ func (cli *Client) handlePlaceholderResendResponse(msg *waE2E.PeerDataOperationR
 }
 
 func (cli *Client) handleProtocolMessage(info *types.MessageInfo, msg *waE2E.Message) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
 	protoMsg := msg.GetProtocolMessage()
 
 	if protoMsg.GetHistorySyncNotification() != nil && info.IsFromMe {
@@ -553,19 +591,31 @@ func (cli *Client) handleProtocolMessage(info *types.MessageInfo, msg *waE2E.Mes
 		go cli.handleAppStateSyncKeyShare(protoMsg.AppStateSyncKeyShare)
 	}
 
+	if protoMsg.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING && cli.Store.ChatSettings != nil {
+		err := cli.Store.ChatSettings.PutEphemeralExpiration(info.Chat, protoMsg.GetEphemeralExpiration())
+		if err != nil {
+			log.Errorf("Failed to store disappearing timer of %s: %v", info.Chat, err)
+		}
+	}
+
+	if protoMsg.GetLidMigrationMappingSyncMessage() != nil && info.IsFromMe {
+		go cli.handleLIDMigrationSync(protoMsg.GetLidMigrationMappingSyncMessage().GetEncodedMappingPayload())
+	}
+
 	if info.Category == "peer" {
 		go cli.sendProtocolMessageReceipt(info.ID, types.ReceiptTypePeerMsg)
 	}
 }
 
 func (cli *Client) processProtocolParts(info *types.MessageInfo, msg *waE2E.Message) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
 	// Hopefully sender key distribution messages and protocol messages can't be inside ephemeral messages
 	if msg.GetDeviceSentMessage().GetMessage() != nil {
 		msg = msg.GetDeviceSentMessage().GetMessage()
 	}
 	if msg.GetSenderKeyDistributionMessage() != nil {
 		if !info.IsGroup {
-			cli.Log.Warnf("Got sender key distribution message in non-group chat from %s", info.Sender)
+			log.Warnf("Got sender key distribution message in non-group chat from %s", info.Sender)
 		} else {
 			cli.handleSenderKeyDistributionMessage(info.Chat, info.Sender, msg.SenderKeyDistributionMessage.AxolotlSenderKeyDistributionMessage)
 		}
@@ -579,12 +629,13 @@ func (cli *Client) processProtocolParts(info *types.MessageInfo, msg *waE2E.Mess
 }
 
 func (cli *Client) storeMessageSecret(info *types.MessageInfo, msg *waE2E.Message) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
 	if msgSecret := msg.GetMessageContextInfo().GetMessageSecret(); len(msgSecret) > 0 {
 		err := cli.Store.MsgSecrets.PutMessageSecret(info.Chat, info.Sender, info.ID, msgSecret)
 		if err != nil {
-			cli.Log.Errorf("Failed to store message secret key for %s: %v", info.ID, err)
+			log.Errorf("Failed to store message secret key for %s: %v", info.ID, err)
 		} else {
-			cli.Log.Debugf("Stored message secret key for %s", info.ID)
+			log.Debugf("Stored message secret key for %s", info.ID)
 		}
 	}
 }
@@ -657,13 +708,17 @@ func (cli *Client) storeHistoricalMessageSecrets(conversations []*waHistorySync.
 	}
 }
 
-func (cli *Client) handleDecryptedMessage(info *types.MessageInfo, msg *waE2E.Message, retryCount int) {
+func (cli *Client) handleDecryptedMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.Message, retryCount int) {
 	cli.processProtocolParts(info, msg)
+	cli.storeMessage(info, msg)
 	evt := &events.Message{Info: *info, RawMessage: msg, RetryCount: retryCount}
+	_, span := cli.startSpan(ctx, "dispatch_event")
 	cli.dispatchEvent(evt.UnwrapRaw())
+	span.End(time.Now(), nil)
 }
 
 func (cli *Client) sendProtocolMessageReceipt(id types.MessageID, msgType types.ReceiptType) {
+	log := waLog.With(cli.Log, waLog.FieldMessageID, id)
 	clientID := cli.Store.ID
 	if len(id) == 0 || clientID == nil {
 		return
@@ -678,6 +733,6 @@ func (cli *Client) sendProtocolMessageReceipt(id types.MessageID, msgType types.
 		Content: nil,
 	})
 	if err != nil {
-		cli.Log.Warnf("Failed to send acknowledgement for protocol message %s: %v", id, err)
+		log.Warnf("Failed to send acknowledgement for protocol message %s: %v", id, err)
 	}
 }
@@ -0,0 +1,278 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"errors"
+	"expvar"
+	"time"
+
+	"go.mau.fi/libsignal/signalerror"
+
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// DisconnectReason describes why the websocket connection was closed.
+type DisconnectReason string
+
+const (
+	// DisconnectLocal means the connection was closed by calling Client.Disconnect or Client.Logout.
+	DisconnectLocal DisconnectReason = "local"
+	// DisconnectRemote means the connection was closed by the server or a network error without warning.
+	DisconnectRemote DisconnectReason = "remote"
+	// DisconnectExpected means the server closed the connection after a stream error or connect failure.
+	DisconnectExpected DisconnectReason = "expected"
+)
+
+// Decrypt error classes passed to Metrics.MessageDecrypted.
+const (
+	DecryptErrorNone              = ""
+	DecryptErrorNoSession         = "no_session"
+	DecryptErrorNoSenderKey       = "no_sender_key"
+	DecryptErrorUntrustedIdentity = "untrusted_identity"
+	DecryptErrorOldCounter        = "old_counter"
+	DecryptErrorBadMAC            = "bad_mac"
+	DecryptErrorOther             = "other"
+)
+
+func classifyDecryptError(err error) string {
+	switch {
+	case err == nil:
+		return DecryptErrorNone
+	case errors.Is(err, signalerror.ErrNoSessionForUser), errors.Is(err, signalerror.ErrNoValidSessions),
+		errors.Is(err, signalerror.ErrUninitializedSession):
+		return DecryptErrorNoSession
+	case errors.Is(err, signalerror.ErrNoSenderKeyForUser), errors.Is(err, signalerror.ErrNoSenderKeyStatesInRecord),
+		errors.Is(err, signalerror.ErrNoSenderKeyStateForID):
+		return DecryptErrorNoSenderKey
+	case errors.Is(err, signalerror.ErrUntrustedIdentity):
+		return DecryptErrorUntrustedIdentity
+	case errors.Is(err, signalerror.ErrOldCounter):
+		return DecryptErrorOldCounter
+	case errors.Is(err, signalerror.ErrBadMAC):
+		return DecryptErrorBadMAC
+	default:
+		return DecryptErrorOther
+	}
+}
+
+// Metrics receives measurements from a Client. Set Client.Metrics to monitor clients without parsing logs.
+//
+// Methods are called synchronously from the client's goroutines, so implementations must be fast and safe for
+// concurrent use. NoopMetrics can be embedded to only implement some methods.
+type Metrics interface {
+	// Connected is called after the client has successfully authenticated.
+	Connected()
+	// ConnectFailed is called when the server rejects the connection.
+	ConnectFailed(reason events.ConnectFailureReason)
+	// StreamError is called when the server sends a stream error, which is usually followed by a disconnection.
+	StreamError(code string)
+	// Disconnected is called when the websocket connection is closed.
+	Disconnected(reason DisconnectReason)
+
+	// KeepAlive is called after each keepalive ping. err is non-nil if the ping failed or timed out.
+	KeepAlive(rtt time.Duration, err error)
+	// IQ is called when an info query gets a response or fails.
+	IQ(namespace string, latency time.Duration, err error)
+
+	// MessageSent is called when SendMessage returns. The message type is the same as in the type attribute
+	// of the message node, e.g. text, media or reaction.
+	MessageSent(messageType string, timings MessageDebugTimings, err error)
+	// MessageDecrypted is called for each encrypted part of an incoming message.
+	// errorClass is one of the DecryptError constants, which is DecryptErrorNone on success.
+	MessageDecrypted(encType string, errorClass string)
+	// RetryReceiptSent is called when the client asks the sender to resend a message it couldn't decrypt.
+	RetryReceiptSent()
+	// RetryReceiptReceived is called when another device asks the client to resend a message.
+	RetryReceiptReceived()
+
+	// HandlerQueueDepth is called with the number of nodes waiting to be handled whenever a node is queued.
+	HandlerQueueDepth(depth int)
+	// MediaDownloaded is called with the number of bytes downloaded after each media download request.
+	MediaDownloaded(bytes int64)
+	// MediaUploaded is called with the number of bytes uploaded after each successful media upload.
+	MediaUploaded(bytes int64)
+}
+
+func (cli *Client) getMetrics() Metrics {
+	if cli.Metrics != nil {
+		return cli.Metrics
+	}
+	return NoopMetrics{}
+}
+
+// NoopMetrics is a Metrics implementation that discards all measurements. It's the default for new clients.
+type NoopMetrics struct{}
+
+var _ Metrics = NoopMetrics{}
+
+func (NoopMetrics) Connected()                                     {}
+func (NoopMetrics) ConnectFailed(events.ConnectFailureReason)      {}
+func (NoopMetrics) StreamError(string)                             {}
+func (NoopMetrics) Disconnected(DisconnectReason)                  {}
+func (NoopMetrics) KeepAlive(time.Duration, error)                 {}
+func (NoopMetrics) IQ(string, time.Duration, error)                {}
+func (NoopMetrics) MessageSent(string, MessageDebugTimings, error) {}
+func (NoopMetrics) MessageDecrypted(string, string)                {}
+func (NoopMetrics) RetryReceiptSent()                              {}
+func (NoopMetrics) RetryReceiptReceived()                          {}
+func (NoopMetrics) HandlerQueueDepth(int)                          {}
+func (NoopMetrics) MediaDownloaded(int64)                          {}
+func (NoopMetrics) MediaUploaded(int64)                            {}
+
+// ExpvarMetrics is a Metrics implementation that publishes counters with the expvar package.
+//
+// All counters are cumulative, except for the keepalive RTT and handler queue depth, which contain the latest value.
+// Durations are summed in seconds, so averages can be calculated by dividing by the matching counter.
+// The same instance can be shared by multiple clients to aggregate their measurements.
+type ExpvarMetrics struct {
+	// Root is the published map that contains all the counters.
+	Root *expvar.Map
+
+	connects          *expvar.Int
+	connectFailures   *expvar.Map
+	streamErrors      *expvar.Map
+	disconnects       *expvar.Map
+	keepAliveRTT      *expvar.Float
+	keepAliveFailures *expvar.Int
+	iqCount           *expvar.Map
+	iqErrors          *expvar.Map
+	iqLatency         *expvar.Map
+	messagesSent      *expvar.Map
+	messageErrors     *expvar.Map
+	sendStages        *expvar.Map
+	decryptSuccesses  *expvar.Map
+	decryptFailures   *expvar.Map
+	retriesSent       *expvar.Int
+	retriesReceived   *expvar.Int
+	handlerQueueDepth *expvar.Int
+	mediaBytes        *expvar.Map
+}
+
+var _ Metrics = (*ExpvarMetrics)(nil)
+
+// NewExpvarMetrics creates an ExpvarMetrics instance and publishes it under the given name.
+// Like expvar.Publish, this panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	em := &ExpvarMetrics{
+		Root:              expvar.NewMap(name),
+		connects:          new(expvar.Int),
+		connectFailures:   new(expvar.Map).Init(),
+		streamErrors:      new(expvar.Map).Init(),
+		disconnects:       new(expvar.Map).Init(),
+		keepAliveRTT:      new(expvar.Float),
+		keepAliveFailures: new(expvar.Int),
+		iqCount:           new(expvar.Map).Init(),
+		iqErrors:          new(expvar.Map).Init(),
+		iqLatency:         new(expvar.Map).Init(),
+		messagesSent:      new(expvar.Map).Init(),
+		messageErrors:     new(expvar.Map).Init(),
+		sendStages:        new(expvar.Map).Init(),
+		decryptSuccesses:  new(expvar.Map).Init(),
+		decryptFailures:   new(expvar.Map).Init(),
+		retriesSent:       new(expvar.Int),
+		retriesReceived:   new(expvar.Int),
+		handlerQueueDepth: new(expvar.Int),
+		mediaBytes:        new(expvar.Map).Init(),
+	}
+	em.Root.Set("connects", em.connects)
+	em.Root.Set("connect_failures", em.connectFailures)
+	em.Root.Set("stream_errors", em.streamErrors)
+	em.Root.Set("disconnects", em.disconnects)
+	em.Root.Set("keepalive_rtt_seconds", em.keepAliveRTT)
+	em.Root.Set("keepalive_failures", em.keepAliveFailures)
+	em.Root.Set("iq_count", em.iqCount)
+	em.Root.Set("iq_errors", em.iqErrors)
+	em.Root.Set("iq_latency_seconds", em.iqLatency)
+	em.Root.Set("messages_sent", em.messagesSent)
+	em.Root.Set("message_send_errors", em.messageErrors)
+	em.Root.Set("message_send_stage_seconds", em.sendStages)
+	em.Root.Set("decrypt_successes", em.decryptSuccesses)
+	em.Root.Set("decrypt_failures", em.decryptFailures)
+	em.Root.Set("retry_receipts_sent", em.retriesSent)
+	em.Root.Set("retry_receipts_received", em.retriesReceived)
+	em.Root.Set("handler_queue_depth", em.handlerQueueDepth)
+	em.Root.Set("media_bytes", em.mediaBytes)
+	return em
+}
+
+func (em *ExpvarMetrics) Connected() {
+	em.connects.Add(1)
+}
+
+func (em *ExpvarMetrics) ConnectFailed(reason events.ConnectFailureReason) {
+	em.connectFailures.Add(reason.NumberString(), 1)
+}
+
+func (em *ExpvarMetrics) StreamError(code string) {
+	em.streamErrors.Add(code, 1)
+}
+
+func (em *ExpvarMetrics) Disconnected(reason DisconnectReason) {
+	em.disconnects.Add(string(reason), 1)
+}
+
+func (em *ExpvarMetrics) KeepAlive(rtt time.Duration, err error) {
+	if err != nil {
+		em.keepAliveFailures.Add(1)
+	} else {
+		em.keepAliveRTT.Set(rtt.Seconds())
+	}
+}
+
+func (em *ExpvarMetrics) IQ(namespace string, latency time.Duration, err error) {
+	em.iqCount.Add(namespace, 1)
+	em.iqLatency.AddFloat(namespace, latency.Seconds())
+	if err != nil {
+		em.iqErrors.Add(namespace, 1)
+	}
+}
+
+func (em *ExpvarMetrics) MessageSent(messageType string, timings MessageDebugTimings, err error) {
+	if err != nil {
+		em.messageErrors.Add(messageType, 1)
+		return
+	}
+	em.messagesSent.Add(messageType, 1)
+	em.sendStages.AddFloat("queue", timings.Queue.Seconds())
+	em.sendStages.AddFloat("marshal", timings.Marshal.Seconds())
+	em.sendStages.AddFloat("get_participants", timings.GetParticipants.Seconds())
+	em.sendStages.AddFloat("get_devices", timings.GetDevices.Seconds())
+	em.sendStages.AddFloat("group_encrypt", timings.GroupEncrypt.Seconds())
+	em.sendStages.AddFloat("peer_encrypt", timings.PeerEncrypt.Seconds())
+	em.sendStages.AddFloat("send", timings.Send.Seconds())
+	em.sendStages.AddFloat("resp", timings.Resp.Seconds())
+	em.sendStages.AddFloat("retry", timings.Retry.Seconds())
+}
+
+func (em *ExpvarMetrics) MessageDecrypted(encType string, errorClass string) {
+	if errorClass == DecryptErrorNone {
+		em.decryptSuccesses.Add(encType, 1)
+	} else {
+		em.decryptFailures.Add(errorClass, 1)
+	}
+}
+
+func (em *ExpvarMetrics) RetryReceiptSent() {
+	em.retriesSent.Add(1)
+}
+
+func (em *ExpvarMetrics) RetryReceiptReceived() {
+	em.retriesReceived.Add(1)
+}
+
+func (em *ExpvarMetrics) HandlerQueueDepth(depth int) {
+	em.handlerQueueDepth.Set(int64(depth))
+}
+
+func (em *ExpvarMetrics) MediaDownloaded(bytes int64) {
+	em.mediaBytes.Add("download", bytes)
+}
+
+func (em *ExpvarMetrics) MediaUploaded(bytes int64) {
+	em.mediaBytes.Add("upload", bytes)
+}
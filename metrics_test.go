@@ -0,0 +1,130 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mau.fi/libsignal/signalerror"
+
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+func TestClassifyDecryptError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, DecryptErrorNone},
+		{signalerror.ErrNoSessionForUser, DecryptErrorNoSession},
+		{fmt.Errorf("failed to decrypt: %w", signalerror.ErrNoValidSessions), DecryptErrorNoSession},
+		{signalerror.ErrUninitializedSession, DecryptErrorNoSession},
+		{signalerror.ErrNoSenderKeyForUser, DecryptErrorNoSenderKey},
+		{fmt.Errorf("failed to decrypt group message: %w", signalerror.ErrNoSenderKeyStateForID), DecryptErrorNoSenderKey},
+		{signalerror.ErrUntrustedIdentity, DecryptErrorUntrustedIdentity},
+		{fmt.Errorf("failed to decrypt: %w", signalerror.ErrOldCounter), DecryptErrorOldCounter},
+		{signalerror.ErrBadMAC, DecryptErrorBadMAC},
+		{errors.New("something else"), DecryptErrorOther},
+	}
+	for _, test := range tests {
+		if class := classifyDecryptError(test.err); class != test.expected {
+			t.Errorf("classifyDecryptError(%v) = %q, expected %q", test.err, class, test.expected)
+		}
+	}
+}
+
+var testMetricsCounter atomic.Int64
+
+// testMetricsName returns a unique expvar name, as names can't be reused when tests are repeated.
+func testMetricsName() string {
+	return fmt.Sprintf("whatsmeow_test_metrics_%d", testMetricsCounter.Add(1))
+}
+
+func expectExpvar(t *testing.T, root *expvar.Map, expected string, keys ...string) {
+	t.Helper()
+	var val expvar.Var = root
+	for _, key := range keys {
+		m, ok := val.(*expvar.Map)
+		if !ok {
+			t.Errorf("%v: %T is not a map", keys, val)
+			return
+		}
+		val = m.Get(key)
+		if val == nil {
+			t.Errorf("%v: key %q not found", keys, key)
+			return
+		}
+	}
+	if str := val.String(); str != expected {
+		t.Errorf("%v = %s, expected %s", keys, str, expected)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	name := testMetricsName()
+	em := NewExpvarMetrics(name)
+	em.Connected()
+	em.Connected()
+	em.ConnectFailed(events.ConnectFailureLoggedOut)
+	em.StreamError("515")
+	em.Disconnected(DisconnectRemote)
+	em.KeepAlive(1500*time.Millisecond, nil)
+	em.KeepAlive(0, ErrIQTimedOut)
+	em.IQ("usync", 2*time.Second, nil)
+	em.IQ("usync", time.Second, errors.New("fail"))
+	em.MessageSent("text", MessageDebugTimings{Send: time.Second}, nil)
+	em.MessageSent("media", MessageDebugTimings{}, errors.New("fail"))
+	em.MessageDecrypted("pkmsg", DecryptErrorNone)
+	em.MessageDecrypted("msg", DecryptErrorBadMAC)
+	em.RetryReceiptSent()
+	em.RetryReceiptReceived()
+	em.HandlerQueueDepth(5)
+	em.HandlerQueueDepth(3)
+	em.MediaDownloaded(100)
+	em.MediaDownloaded(50)
+	em.MediaUploaded(10)
+
+	if expvar.Get(name) != em.Root {
+		t.Errorf("Metrics root wasn't published")
+	}
+	expectExpvar(t, em.Root, "2", "connects")
+	expectExpvar(t, em.Root, "1", "connect_failures", events.ConnectFailureLoggedOut.NumberString())
+	expectExpvar(t, em.Root, "1", "stream_errors", "515")
+	expectExpvar(t, em.Root, "1", "disconnects", string(DisconnectRemote))
+	expectExpvar(t, em.Root, "1.5", "keepalive_rtt_seconds")
+	expectExpvar(t, em.Root, "1", "keepalive_failures")
+	expectExpvar(t, em.Root, "2", "iq_count", "usync")
+	expectExpvar(t, em.Root, "1", "iq_errors", "usync")
+	expectExpvar(t, em.Root, "3", "iq_latency_seconds", "usync")
+	expectExpvar(t, em.Root, "1", "messages_sent", "text")
+	expectExpvar(t, em.Root, "1", "message_send_errors", "media")
+	expectExpvar(t, em.Root, "1", "message_send_stage_seconds", "send")
+	expectExpvar(t, em.Root, "1", "decrypt_successes", "pkmsg")
+	expectExpvar(t, em.Root, "1", "decrypt_failures", DecryptErrorBadMAC)
+	expectExpvar(t, em.Root, "1", "retry_receipts_sent")
+	expectExpvar(t, em.Root, "1", "retry_receipts_received")
+	expectExpvar(t, em.Root, "3", "handler_queue_depth")
+	expectExpvar(t, em.Root, "150", "media_bytes", "download")
+	expectExpvar(t, em.Root, "10", "media_bytes", "upload")
+}
+
+func TestNilMetrics(t *testing.T) {
+	cli := &Client{}
+	if _, ok := cli.getMetrics().(NoopMetrics); !ok {
+		t.Errorf("Expected nil metrics to fall back to NoopMetrics, got %T", cli.getMetrics())
+	}
+	em := NewExpvarMetrics(testMetricsName())
+	cli.Metrics = em
+	if cli.getMetrics() != em {
+		t.Errorf("Expected configured metrics to be used")
+	}
+}
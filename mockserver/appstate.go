@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/proto/waServerSync"
+)
+
+// handleAppStateIQ stores app state patches sent by clients and returns them to all devices of the same user.
+// Snapshots are not supported, so full syncs receive all patches since version 0.
+func (srv *Server) handleAppStateIQ(conn *Conn, iq *waBinary.Node) ([]waBinary.Node, error) {
+	sync, ok := iq.GetOptionalChildByTag("sync")
+	if !ok {
+		return nil, ErrIQBadRequest
+	}
+	var collections []waBinary.Node
+	for _, collection := range sync.GetChildren() {
+		if collection.Tag != "collection" {
+			continue
+		}
+		ag := collection.AttrGetter()
+		name := ag.String("name")
+		version := ag.OptionalInt("version")
+		if !ag.OK() {
+			return nil, ag.Error()
+		}
+		key := appStateKey{user: conn.JID.User, name: name}
+		resp, err := srv.handleAppStateCollection(key, version, collection.GetChildrenByTag("patch"))
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, resp)
+	}
+	return []waBinary.Node{{Tag: "sync", Content: collections}}, nil
+}
+
+func (srv *Server) handleAppStateCollection(key appStateKey, version int, patchNodes []waBinary.Node) (waBinary.Node, error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	patches := srv.appState[key]
+	resp := waBinary.Node{
+		Tag:   "collection",
+		Attrs: waBinary.Attrs{"name": key.name},
+	}
+	if len(patchNodes) > 0 {
+		if version != len(patches) {
+			resp.Attrs["type"] = "error"
+			resp.Content = []waBinary.Node{{Tag: "error", Attrs: waBinary.Attrs{"code": 409, "text": "conflict"}}}
+			return resp, nil
+		}
+		for _, patchNode := range patchNodes {
+			rawPatch, _ := patchNode.Content.([]byte)
+			var patch waServerSync.SyncdPatch
+			if err := proto.Unmarshal(rawPatch, &patch); err != nil {
+				return resp, fmt.Errorf("%w: failed to unmarshal patch: %v", ErrIQBadRequest, err)
+			}
+			patch.Version = &waServerSync.SyncdVersion{Version: proto.Uint64(uint64(len(patches) + 1))}
+			rawPatch, err := proto.Marshal(&patch)
+			if err != nil {
+				return resp, err
+			}
+			patches = append(patches, rawPatch)
+		}
+		srv.appState[key] = patches
+		resp.Attrs["version"] = len(patches)
+		return resp, nil
+	}
+	if version > len(patches) {
+		version = len(patches)
+	}
+	newPatches := make([]waBinary.Node, 0, len(patches)-version)
+	for _, patch := range patches[version:] {
+		newPatches = append(newPatches, waBinary.Node{Tag: "patch", Content: patch})
+	}
+	resp.Attrs["version"] = len(patches)
+	resp.Content = []waBinary.Node{{Tag: "patches", Content: newPatches}}
+	return resp, nil
+}
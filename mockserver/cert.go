@@ -0,0 +1,67 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/libsignal/ecc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waCert"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+const (
+	intermediateCertSerial = 1
+	leafCertSerial         = 2
+)
+
+func signCert(signer *keys.KeyPair, details *waCert.CertChain_NoiseCertificate_Details) (*waCert.CertChain_NoiseCertificate, error) {
+	detailsBytes, err := proto.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	signature := ecc.CalculateSignature(ecc.NewDjbECPrivateKey(*signer.Priv), detailsBytes)
+	return &waCert.CertChain_NoiseCertificate{
+		Details:   detailsBytes,
+		Signature: signature[:],
+	}, nil
+}
+
+// makeCertChain creates a noise certificate chain for the given static key, where the intermediate certificate
+// is signed by the root key in the same way as the real WhatsApp server's certificates.
+func makeCertChain(root, intermediate, static *keys.KeyPair) ([]byte, error) {
+	now := time.Now()
+	notBefore := uint64(now.Add(-24 * time.Hour).Unix())
+	notAfter := uint64(now.Add(365 * 24 * time.Hour).Unix())
+	intermediateCert, err := signCert(root, &waCert.CertChain_NoiseCertificate_Details{
+		Serial:       proto.Uint32(intermediateCertSerial),
+		IssuerSerial: proto.Uint32(0),
+		Key:          intermediate.Pub[:],
+		NotBefore:    proto.Uint64(notBefore),
+		NotAfter:     proto.Uint64(notAfter),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign intermediate certificate: %w", err)
+	}
+	leafCert, err := signCert(intermediate, &waCert.CertChain_NoiseCertificate_Details{
+		Serial:       proto.Uint32(leafCertSerial),
+		IssuerSerial: proto.Uint32(intermediateCertSerial),
+		Key:          static.Pub[:],
+		NotBefore:    proto.Uint64(notBefore),
+		NotAfter:     proto.Uint64(notAfter),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign leaf certificate: %w", err)
+	}
+	return proto.Marshal(&waCert.CertChain{
+		Intermediate: intermediateCert,
+		Leaf:         leafCert,
+	})
+}
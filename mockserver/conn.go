@@ -0,0 +1,279 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/proto/waWa6"
+	"github.com/shiestapoi/whatsmeow/socket"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+// ErrUnknownDevice is returned when a client tries to log in as a device that hasn't been added with Server.LoginDevice.
+var ErrUnknownDevice = errors.New("unknown device")
+
+// Conn is a client connection to the mock server.
+type Conn struct {
+	srv  *Server
+	conn socket.TransportConn
+	log  waLog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// JID is the device that logged in on this connection. It's only set after the handshake.
+	JID types.JID
+	// Payload is the client payload sent at the end of the handshake.
+	Payload *waWa6.ClientPayload
+
+	buf []byte
+
+	writeKey     cipher.AEAD
+	readKey      cipher.AEAD
+	writeCounter uint32
+	readCounter  uint32
+	writeLock    sync.Mutex
+}
+
+func generateIV(count uint32) []byte {
+	iv := make([]byte, 12)
+	binary.BigEndian.PutUint32(iv[8:], count)
+	return iv
+}
+
+// readRaw reads from the transport until the buffer has at least n bytes.
+func (conn *Conn) readRaw(n int) ([]byte, error) {
+	for len(conn.buf) < n {
+		data, err := conn.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		conn.buf = append(conn.buf, data...)
+	}
+	data := conn.buf[:n]
+	conn.buf = conn.buf[n:]
+	return data, nil
+}
+
+func (conn *Conn) readFrame() ([]byte, error) {
+	lengthBytes, err := conn.readRaw(socket.FrameLengthSize)
+	if err != nil {
+		return nil, err
+	}
+	length := (int(lengthBytes[0]) << 16) + (int(lengthBytes[1]) << 8) + int(lengthBytes[2])
+	return conn.readRaw(length)
+}
+
+func (conn *Conn) writeFrame(data []byte) error {
+	if len(data) >= socket.FrameMaxSize {
+		return fmt.Errorf("%w (got %d bytes, max %d bytes)", socket.ErrFrameTooLarge, len(data), socket.FrameMaxSize)
+	}
+	frame := make([]byte, socket.FrameLengthSize+len(data))
+	frame[0] = byte(len(data) >> 16)
+	frame[1] = byte(len(data) >> 8)
+	frame[2] = byte(len(data))
+	copy(frame[socket.FrameLengthSize:], data)
+	return conn.conn.WriteMessage(frame)
+}
+
+// doHandshake implements the server side of the Noise_XX_25519_AESGCM_SHA256 handshake in whatsmeow's handshake.go.
+func (conn *Conn) doHandshake() error {
+	header, err := conn.readRaw(len(socket.WAConnHeader))
+	if err != nil {
+		return fmt.Errorf("failed to read connection header: %w", err)
+	} else if !bytes.Equal(header[:2], socket.WAConnHeader[:2]) {
+		return fmt.Errorf("unexpected connection header %X", header)
+	}
+	header = bytes.Clone(header)
+
+	frame, err := conn.readFrame()
+	if err != nil {
+		return fmt.Errorf("failed to read client hello: %w", err)
+	}
+	var hello waWa6.HandshakeMessage
+	if err = proto.Unmarshal(frame, &hello); err != nil {
+		return fmt.Errorf("failed to unmarshal client hello: %w", err)
+	}
+	clientEphemeral := hello.GetClientHello().GetEphemeral()
+	if len(clientEphemeral) != 32 {
+		return fmt.Errorf("unexpected length of client ephemeral key %d", len(clientEphemeral))
+	}
+	clientEphemeralArr := *(*[32]byte)(clientEphemeral)
+
+	ephemeralKP := keys.NewKeyPair()
+	nh := socket.NewNoiseHandshake()
+	nh.Start(socket.NoiseStartPattern, header)
+	nh.Authenticate(clientEphemeral)
+	nh.Authenticate(ephemeralKP.Pub[:])
+	if err = nh.MixSharedSecretIntoKey(*ephemeralKP.Priv, clientEphemeralArr); err != nil {
+		return fmt.Errorf("failed to mix client ephemeral key in: %w", err)
+	}
+	encryptedStatic := nh.Encrypt(conn.srv.staticKey.Pub[:])
+	if err = nh.MixSharedSecretIntoKey(*conn.srv.staticKey.Priv, clientEphemeralArr); err != nil {
+		return fmt.Errorf("failed to mix static key in: %w", err)
+	}
+	encryptedCert := nh.Encrypt(conn.srv.certChain)
+	data, err := proto.Marshal(&waWa6.HandshakeMessage{
+		ServerHello: &waWa6.HandshakeMessage_ServerHello{
+			Ephemeral: ephemeralKP.Pub[:],
+			Static:    encryptedStatic,
+			Payload:   encryptedCert,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal server hello: %w", err)
+	} else if err = conn.writeFrame(data); err != nil {
+		return fmt.Errorf("failed to send server hello: %w", err)
+	}
+
+	frame, err = conn.readFrame()
+	if err != nil {
+		return fmt.Errorf("failed to read client finish: %w", err)
+	}
+	var finish waWa6.HandshakeMessage
+	if err = proto.Unmarshal(frame, &finish); err != nil {
+		return fmt.Errorf("failed to unmarshal client finish: %w", err)
+	}
+	clientStatic, err := nh.Decrypt(finish.GetClientFinish().GetStatic())
+	if err != nil {
+		return fmt.Errorf("failed to decrypt client static key: %w", err)
+	} else if len(clientStatic) != 32 {
+		return fmt.Errorf("unexpected length of client static key %d", len(clientStatic))
+	} else if err = nh.MixSharedSecretIntoKey(*ephemeralKP.Priv, *(*[32]byte)(clientStatic)); err != nil {
+		return fmt.Errorf("failed to mix client static key in: %w", err)
+	}
+	payloadBytes, err := nh.Decrypt(finish.GetClientFinish().GetPayload())
+	if err != nil {
+		return fmt.Errorf("failed to decrypt client payload: %w", err)
+	}
+	var payload waWa6.ClientPayload
+	if err = proto.Unmarshal(payloadBytes, &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal client payload: %w", err)
+	}
+	conn.Payload = &payload
+	// The final keys are from the point of view of the initiator, so they're swapped on the server side.
+	conn.readKey, conn.writeKey, err = nh.FinalKeys()
+	return err
+}
+
+// SendNode sends the given node to the client.
+func (conn *Conn) SendNode(node waBinary.Node) error {
+	payload, err := waBinary.Marshal(node)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node: %w", err)
+	}
+	conn.log.Debugf("Sending %s", node.XMLString())
+	conn.writeLock.Lock()
+	defer conn.writeLock.Unlock()
+	ciphertext := conn.writeKey.Seal(nil, generateIV(conn.writeCounter), payload, nil)
+	conn.writeCounter++
+	return conn.writeFrame(ciphertext)
+}
+
+func (conn *Conn) readNode() (*waBinary.Node, error) {
+	frame, err := conn.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := conn.readKey.Open(nil, generateIV(conn.readCounter), frame, nil)
+	conn.readCounter++
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt frame: %w", err)
+	}
+	unpacked, err := waBinary.Unpack(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress frame: %w", err)
+	}
+	return waBinary.Unmarshal(unpacked)
+}
+
+// Close disconnects the client.
+func (conn *Conn) Close() {
+	conn.cancel()
+	_ = conn.conn.Close(0)
+}
+
+// Context returns a context that is canceled when the connection is closed.
+func (conn *Conn) Context() context.Context {
+	return conn.ctx
+}
+
+func (conn *Conn) login() error {
+	if conn.Payload.Username == nil {
+		return fmt.Errorf("%w: pairing new devices is not supported", ErrUnknownDevice)
+	}
+	conn.JID = types.NewADJID(strconv.FormatUint(conn.Payload.GetUsername(), 10), 0, byte(conn.Payload.GetDevice()))
+	if !conn.srv.isKnownDevice(conn.JID) {
+		return fmt.Errorf("%w %s", ErrUnknownDevice, conn.JID)
+	}
+	conn.log = conn.log.Sub(conn.JID.String())
+	return nil
+}
+
+func (conn *Conn) serve() {
+	defer conn.Close()
+	err := conn.doHandshake()
+	if err != nil {
+		conn.log.Warnf("Handshake failed: %v", err)
+		return
+	}
+	if err = conn.login(); err != nil {
+		conn.log.Warnf("Rejecting login: %v", err)
+		_ = conn.SendNode(waBinary.Node{Tag: "failure", Attrs: waBinary.Attrs{"reason": 401}})
+		return
+	}
+	err = conn.SendNode(waBinary.Node{
+		Tag:   "success",
+		Attrs: waBinary.Attrs{"t": time.Now().Unix()},
+	})
+	if err != nil {
+		conn.log.Warnf("Failed to send success node: %v", err)
+		return
+	}
+	pending := conn.srv.addConn(conn)
+	defer conn.srv.removeConn(conn)
+	for _, node := range pending {
+		if err = conn.SendNode(node); err != nil {
+			conn.log.Warnf("Failed to send queued %s: %v", node.Tag, err)
+		}
+	}
+	err = conn.SendNode(waBinary.Node{
+		Tag: "ib",
+		Content: []waBinary.Node{{
+			Tag:   "offline",
+			Attrs: waBinary.Attrs{"count": len(pending)},
+		}},
+	})
+	if err != nil {
+		conn.log.Warnf("Failed to send offline sync completion: %v", err)
+	}
+	for {
+		node, err := conn.readNode()
+		if err != nil {
+			if conn.ctx.Err() == nil {
+				conn.log.Debugf("Connection closed: %v", err)
+			}
+			return
+		}
+		conn.log.Debugf("Received %s", node.XMLString())
+		conn.srv.handleNode(conn, node)
+	}
+}
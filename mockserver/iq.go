@@ -0,0 +1,252 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver
+
+import (
+	"errors"
+	"fmt"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+// IQHandler handles an info query sent by a client. The returned nodes are sent as the content of the result.
+// If the handler returns an error, an error response is sent instead: *IQError can be used to choose the code.
+type IQHandler func(conn *Conn, iq *waBinary.Node) ([]waBinary.Node, error)
+
+// IQError is an error response to an info query.
+type IQError struct {
+	Code int
+	Text string
+}
+
+func (err *IQError) Error() string {
+	return fmt.Sprintf("iq error %d: %s", err.Code, err.Text)
+}
+
+var (
+	ErrIQBadRequest     = &IQError{Code: 400, Text: "bad-request"}
+	ErrIQNotFound       = &IQError{Code: 404, Text: "item-not-found"}
+	ErrIQNotImplemented = &IQError{Code: 501, Text: "feature-not-implemented"}
+)
+
+// HandleIQ sets the handler for info queries in the given namespace, replacing the default handler if there is one.
+func (srv *Server) HandleIQ(namespace string, handler IQHandler) {
+	srv.iqHandlersLock.Lock()
+	srv.iqHandlers[namespace] = handler
+	srv.iqHandlersLock.Unlock()
+}
+
+func (srv *Server) addDefaultIQHandlers() {
+	srv.iqHandlers["encrypt"] = srv.handleEncryptIQ
+	srv.iqHandlers["usync"] = srv.handleUsyncIQ
+	srv.iqHandlers["w:g2"] = srv.handleGroupIQ
+	srv.iqHandlers["w:m"] = srv.handleMediaConnIQ
+	srv.iqHandlers["w:sync:app:state"] = srv.handleAppStateIQ
+	srv.iqHandlers["passive"] = emptyIQHandler
+	srv.iqHandlers["w:p"] = emptyIQHandler
+}
+
+func emptyIQHandler(_ *Conn, _ *waBinary.Node) ([]waBinary.Node, error) {
+	return nil, nil
+}
+
+func (srv *Server) handleIQ(conn *Conn, iq *waBinary.Node) {
+	ag := iq.AttrGetter()
+	iqType := ag.String("type")
+	id := ag.String("id")
+	if iqType == "result" || iqType == "error" {
+		// Responses to server-initiated queries aren't needed
+		return
+	}
+	namespace := ag.OptionalString("xmlns")
+	srv.iqHandlersLock.RLock()
+	handler, ok := srv.iqHandlers[namespace]
+	srv.iqHandlersLock.RUnlock()
+	var content []waBinary.Node
+	var err error
+	if !ok {
+		srv.Log.Debugf("No handler for %s iq from %s", namespace, conn.JID)
+		err = ErrIQNotImplemented
+	} else {
+		content, err = handler(conn, iq)
+	}
+	resp := waBinary.Node{
+		Tag: "iq",
+		Attrs: waBinary.Attrs{
+			"id":   id,
+			"type": "result",
+			"from": ag.OptionalJIDOrEmpty("to"),
+		},
+	}
+	if err != nil {
+		var iqErr *IQError
+		if !errors.As(err, &iqErr) {
+			srv.Log.Warnf("Error handling %s iq from %s: %v", namespace, conn.JID, err)
+			iqErr = &IQError{Code: 500, Text: "internal-server-error"}
+		}
+		resp.Attrs["type"] = "error"
+		resp.Content = []waBinary.Node{{
+			Tag:   "error",
+			Attrs: waBinary.Attrs{"code": iqErr.Code, "text": iqErr.Text},
+		}}
+	} else if len(content) > 0 {
+		resp.Content = content
+	}
+	if err = conn.SendNode(resp); err != nil {
+		srv.Log.Warnf("Failed to send response to %s iq: %v", namespace, err)
+	}
+}
+
+func (srv *Server) handleEncryptIQ(conn *Conn, iq *waBinary.Node) ([]waBinary.Node, error) {
+	children := iq.GetChildren()
+	if len(children) == 0 {
+		return nil, ErrIQBadRequest
+	}
+	switch children[0].Tag {
+	case "count":
+		srv.lock.Lock()
+		count := len(srv.devices[conn.JID].preKeys)
+		srv.lock.Unlock()
+		return []waBinary.Node{{Tag: "count", Attrs: waBinary.Attrs{"value": count}}}, nil
+	case "registration":
+		uploaded, err := parseUploadedKeys(iq)
+		if err != nil {
+			return nil, err
+		}
+		srv.lock.Lock()
+		existing, ok := srv.devices[conn.JID]
+		if ok {
+			uploaded.preKeys = append(existing.preKeys, uploaded.preKeys...)
+		}
+		srv.devices[conn.JID] = uploaded
+		srv.lock.Unlock()
+		return nil, nil
+	case "key":
+		var users []waBinary.Node
+		for _, user := range children[0].GetChildren() {
+			jid, ok := user.Attrs["jid"].(types.JID)
+			if user.Tag != "user" || !ok {
+				continue
+			}
+			users = append(users, srv.makeBundleNode(jid))
+		}
+		return []waBinary.Node{{Tag: "list", Content: users}}, nil
+	default:
+		return nil, ErrIQNotImplemented
+	}
+}
+
+func (srv *Server) handleUsyncIQ(_ *Conn, iq *waBinary.Node) ([]waBinary.Node, error) {
+	usync := iq.GetChildByTag("usync")
+	query := usync.GetChildByTag("query")
+	var users []waBinary.Node
+	list := usync.GetChildByTag("list")
+	for _, user := range list.GetChildren() {
+		jid, ok := user.Attrs["jid"].(types.JID)
+		if !ok {
+			if contact, ok := user.GetOptionalChildByTag("contact"); ok {
+				contactString, _ := contact.Content.(string)
+				jid = types.NewJID(contactString, types.DefaultUserServer)
+			}
+		}
+		devices := srv.GetDevices(jid)
+		var userContent []waBinary.Node
+		for _, queryType := range query.GetChildren() {
+			switch queryType.Tag {
+			case "devices":
+				deviceNodes := make([]waBinary.Node, len(devices))
+				for i, device := range devices {
+					deviceNodes[i] = waBinary.Node{Tag: "device", Attrs: waBinary.Attrs{"id": int(device.Device)}}
+				}
+				userContent = append(userContent, waBinary.Node{
+					Tag: "devices",
+					Content: []waBinary.Node{{
+						Tag:     "device-list",
+						Content: deviceNodes,
+					}},
+				})
+			case "contact":
+				contactType := "out"
+				if len(devices) > 0 {
+					contactType = "in"
+				}
+				userContent = append(userContent, waBinary.Node{Tag: "contact", Attrs: waBinary.Attrs{"type": contactType}})
+			}
+		}
+		users = append(users, waBinary.Node{
+			Tag:     "user",
+			Attrs:   waBinary.Attrs{"jid": jid.ToNonAD()},
+			Content: userContent,
+		})
+	}
+	return []waBinary.Node{{
+		Tag:   "usync",
+		Attrs: usync.Attrs,
+		Content: []waBinary.Node{
+			{Tag: "result"},
+			{Tag: "list", Content: users},
+		},
+	}}, nil
+}
+
+func (srv *Server) handleGroupIQ(_ *Conn, iq *waBinary.Node) ([]waBinary.Node, error) {
+	to, _ := iq.Attrs["to"].(types.JID)
+	query, ok := iq.GetOptionalChildByTag("query")
+	if !ok || to.Server != types.GroupServer {
+		return nil, ErrIQNotImplemented
+	}
+	srv.lock.Lock()
+	group, ok := srv.groups[to]
+	var participants []waBinary.Node
+	if ok {
+		participants = make([]waBinary.Node, len(group.Participants))
+		for i, participant := range group.Participants {
+			participants[i] = waBinary.Node{Tag: "participant", Attrs: waBinary.Attrs{"jid": participant.JID}}
+			if participant.IsSuperAdmin {
+				participants[i].Attrs["type"] = "superadmin"
+			} else if participant.IsAdmin {
+				participants[i].Attrs["type"] = "admin"
+			}
+		}
+	}
+	srv.lock.Unlock()
+	if !ok {
+		return nil, ErrIQNotFound
+	} else if query.AttrGetter().OptionalString("request") != "interactive" {
+		return nil, ErrIQNotImplemented
+	}
+	return []waBinary.Node{{
+		Tag: "group",
+		Attrs: waBinary.Attrs{
+			"id":       group.JID.User,
+			"creator":  group.OwnerJID,
+			"creation": group.GroupCreated.Unix(),
+			"subject":  group.Name,
+			"s_t":      group.NameSetAt.Unix(),
+			"s_o":      group.NameSetBy,
+		},
+		Content: participants,
+	}}, nil
+}
+
+func (srv *Server) handleMediaConnIQ(_ *Conn, _ *waBinary.Node) ([]waBinary.Node, error) {
+	hosts := make([]waBinary.Node, len(srv.MediaHosts))
+	for i, host := range srv.MediaHosts {
+		hosts[i] = waBinary.Node{Tag: "host", Attrs: waBinary.Attrs{"hostname": host}}
+	}
+	return []waBinary.Node{{
+		Tag: "media_conn",
+		Attrs: waBinary.Attrs{
+			"auth":        "mock-media-auth",
+			"ttl":         3600,
+			"auth_ttl":    3600,
+			"max_buckets": 12,
+		},
+		Content: hosts,
+	}}, nil
+}
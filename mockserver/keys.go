@@ -0,0 +1,177 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"go.mau.fi/libsignal/ecc"
+	"go.mau.fi/libsignal/keys/identity"
+	"go.mau.fi/libsignal/keys/prekey"
+	"go.mau.fi/libsignal/util/optional"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+// deviceKeys contains the public keys that a device has uploaded to the server.
+// Only the public halves of the keys are used.
+type deviceKeys struct {
+	registrationID uint32
+	identity       [32]byte
+	signedPreKey   *keys.PreKey
+	preKeys        []*keys.PreKey
+}
+
+// popPreKey removes and returns the next one-time prekey, or nil if there are none left.
+func (dk *deviceKeys) popPreKey() *keys.PreKey {
+	if len(dk.preKeys) == 0 {
+		return nil
+	}
+	preKey := dk.preKeys[0]
+	dk.preKeys = dk.preKeys[1:]
+	return preKey
+}
+
+func preKeyToNode(key *keys.PreKey) waBinary.Node {
+	var keyID [4]byte
+	binary.BigEndian.PutUint32(keyID[:], key.KeyID)
+	node := waBinary.Node{
+		Tag: "key",
+		Content: []waBinary.Node{
+			{Tag: "id", Content: keyID[1:]},
+			{Tag: "value", Content: key.Pub[:]},
+		},
+	}
+	if key.Signature != nil {
+		node.Tag = "skey"
+		node.Content = append(node.GetChildren(), waBinary.Node{
+			Tag:     "signature",
+			Content: key.Signature[:],
+		})
+	}
+	return node
+}
+
+func nodeToPreKey(node waBinary.Node) (*keys.PreKey, error) {
+	key := keys.PreKey{
+		KeyPair: keys.KeyPair{Pub: new([32]byte)},
+	}
+	if id, ok := node.GetChildByTag("id").Content.([]byte); !ok || len(id) != 3 {
+		return nil, fmt.Errorf("invalid prekey ID")
+	} else {
+		key.KeyID = uint32(id[0])<<16 | uint32(id[1])<<8 | uint32(id[2])
+	}
+	if pub, ok := node.GetChildByTag("value").Content.([]byte); !ok || len(pub) != 32 {
+		return nil, fmt.Errorf("invalid prekey value")
+	} else {
+		copy(key.Pub[:], pub)
+	}
+	if node.Tag == "skey" {
+		if sig, ok := node.GetChildByTag("signature").Content.([]byte); !ok || len(sig) != 64 {
+			return nil, fmt.Errorf("invalid signed prekey signature")
+		} else {
+			key.Signature = (*[64]byte)(sig)
+		}
+	}
+	return &key, nil
+}
+
+// parseKeys reads the registration ID, identity key and prekeys from a prekey upload or retry receipt.
+func parseKeys(node, keysNode *waBinary.Node) (*deviceKeys, error) {
+	var dk deviceKeys
+	registration, ok := node.GetChildByTag("registration").Content.([]byte)
+	if !ok || len(registration) != 4 {
+		return nil, fmt.Errorf("%w: invalid registration ID", ErrIQBadRequest)
+	}
+	dk.registrationID = binary.BigEndian.Uint32(registration)
+	identityKey, ok := keysNode.GetChildByTag("identity").Content.([]byte)
+	if !ok || len(identityKey) != 32 {
+		return nil, fmt.Errorf("%w: invalid identity key", ErrIQBadRequest)
+	}
+	dk.identity = [32]byte(identityKey)
+	var err error
+	dk.signedPreKey, err = nodeToPreKey(keysNode.GetChildByTag("skey"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIQBadRequest, err)
+	}
+	var preKeyNodes []waBinary.Node
+	if list, ok := keysNode.GetOptionalChildByTag("list"); ok {
+		preKeyNodes = list.GetChildren()
+	} else if key, ok := keysNode.GetOptionalChildByTag("key"); ok {
+		preKeyNodes = []waBinary.Node{key}
+	}
+	for _, preKeyNode := range preKeyNodes {
+		preKey, err := nodeToPreKey(preKeyNode)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIQBadRequest, err)
+		}
+		dk.preKeys = append(dk.preKeys, preKey)
+	}
+	return &dk, nil
+}
+
+func parseUploadedKeys(iq *waBinary.Node) (*deviceKeys, error) {
+	return parseKeys(iq, iq)
+}
+
+func (dk *deviceKeys) toBundle(jid types.JID, preKey *keys.PreKey) *prekey.Bundle {
+	preKeyID := optional.NewEmptyUint32()
+	var preKeyPub ecc.ECPublicKeyable
+	if preKey != nil {
+		preKeyID = optional.NewOptionalUint32(preKey.KeyID)
+		preKeyPub = ecc.NewDjbECPublicKey(*preKey.Pub)
+	}
+	return prekey.NewBundle(
+		dk.registrationID, uint32(jid.Device), preKeyID, dk.signedPreKey.KeyID,
+		preKeyPub, ecc.NewDjbECPublicKey(*dk.signedPreKey.Pub), *dk.signedPreKey.Signature,
+		identity.NewKey(ecc.NewDjbECPublicKey(dk.identity)),
+	)
+}
+
+// fetchBundle returns a prekey bundle for the given device, consuming one of its one-time prekeys.
+func (srv *Server) fetchBundle(jid types.JID) (*prekey.Bundle, error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	dk, ok := srv.devices[jid]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownDevice, jid)
+	}
+	return dk.toBundle(jid, dk.popPreKey()), nil
+}
+
+// makeBundleNode returns a user node for responding to prekey queries, consuming one of the device's one-time prekeys.
+func (srv *Server) makeBundleNode(jid types.JID) waBinary.Node {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	dk, ok := srv.devices[jid]
+	if !ok {
+		return waBinary.Node{
+			Tag:     "user",
+			Attrs:   waBinary.Attrs{"jid": jid},
+			Content: []waBinary.Node{{Tag: "error", Attrs: waBinary.Attrs{"code": 404, "text": "item-not-found"}}},
+		}
+	}
+	var registrationID [4]byte
+	binary.BigEndian.PutUint32(registrationID[:], dk.registrationID)
+	content := []waBinary.Node{
+		{Tag: "registration", Content: registrationID[:]},
+		{Tag: "type", Content: []byte{ecc.DjbType}},
+		{Tag: "identity", Content: dk.identity[:]},
+	}
+	if preKey := dk.popPreKey(); preKey != nil {
+		content = append(content, preKeyToNode(preKey))
+	}
+	content = append(content, preKeyToNode(dk.signedPreKey))
+	return waBinary.Node{
+		Tag:     "user",
+		Attrs:   waBinary.Attrs{"jid": jid},
+		Content: content,
+	}
+}
@@ -0,0 +1,1010 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow"
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/mockserver"
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/store/memstore"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+const testTimeout = 10 * time.Second
+
+type testClient struct {
+	*whatsmeow.Client
+	container *memstore.Container
+	device    *store.Device
+	events    chan any
+}
+
+func connectClient(t *testing.T, srv *mockserver.Server, setup ...func(*testClient)) *testClient {
+	t.Helper()
+	container := memstore.New(nil)
+	device := container.NewDevice()
+	if err := srv.LoginDevice(device); err != nil {
+		t.Fatalf("Failed to log in device: %v", err)
+	}
+	tc := newTestClient(container, device)
+	tc.SetTransport(srv.Transport())
+	tc.ServerCertRootKey = srv.RootKey.Pub
+	for _, fn := range setup {
+		fn(tc)
+	}
+	if err := tc.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(tc.Disconnect)
+	waitForEvent(t, tc, func(evt *events.Connected) bool { return true })
+	return tc
+}
+
+func newTestClient(container *memstore.Container, device *store.Device) *testClient {
+	tc := &testClient{
+		Client:    whatsmeow.NewClient(device, nil),
+		container: container,
+		device:    device,
+		events:    make(chan any, 256),
+	}
+	tc.AddEventHandler(func(evt any) {
+		tc.events <- evt
+	})
+	return tc
+}
+
+func waitForEvent[T any](t *testing.T, tc *testClient, filter func(T) bool) T {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case rawEvt := <-tc.events:
+			if evt, ok := rawEvt.(T); ok && filter(evt) {
+				return evt
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("Timed out waiting for %T event", zero)
+			return zero
+		}
+	}
+}
+
+func waitForPeerMessage(t *testing.T, peer *mockserver.Peer, id types.MessageID) *mockserver.PeerMessage {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case msg := <-peer.Messages():
+			if msg.ID == id {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for message %s", id)
+			return nil
+		}
+	}
+}
+
+func waitForPeerReceipt(t *testing.T, peer *mockserver.Peer, id types.MessageID) *mockserver.PeerReceipt {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case receipt := <-peer.Receipts():
+			if receipt.ID == id {
+				return receipt
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for receipt for %s", id)
+			return nil
+		}
+	}
+}
+
+func newServer(t *testing.T) *mockserver.Server {
+	t.Helper()
+	srv, err := mockserver.New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newPeer(t *testing.T, srv *mockserver.Server) *mockserver.Peer {
+	t.Helper()
+	peer, err := srv.NewPeer("Peer")
+	if err != nil {
+		t.Fatalf("Failed to create peer: %v", err)
+	}
+	return peer
+}
+
+func textMessage(text string) *waE2E.Message {
+	return &waE2E.Message{Conversation: proto.String(text)}
+}
+
+func TestDirectMessages(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	peer := newPeer(t, srv)
+
+	resp, err := cli.SendMessage(context.Background(), peer.JID.ToNonAD(), textMessage("hello peer"))
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	peerMsg := waitForPeerMessage(t, peer, resp.ID)
+	if peerMsg.Message.GetConversation() != "hello peer" {
+		t.Errorf("Peer received %q, expected %q", peerMsg.Message.GetConversation(), "hello peer")
+	}
+	waitForEvent(t, cli, func(evt *events.Receipt) bool {
+		return len(evt.MessageIDs) > 0 && evt.MessageIDs[0] == resp.ID
+	})
+
+	id, err := peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("hello client"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	evt := waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	if evt.Message.GetConversation() != "hello client" {
+		t.Errorf("Client received %q, expected %q", evt.Message.GetConversation(), "hello client")
+	}
+	waitForPeerReceipt(t, peer, id)
+}
+
+func TestNormalizeEventJIDs(t *testing.T) {
+	srv := newServer(t)
+	peer := newPeer(t, srv)
+	peerLID := types.NewJID("100000000000001", types.HiddenUserServer)
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.NormalizeEventJIDs = whatsmeow.JIDFormLID
+		err := tc.device.LIDs.PutLIDMappings(store.LIDMapping{LID: peerLID, PN: peer.JID.ToNonAD()})
+		if err != nil {
+			t.Fatalf("Failed to store LID mapping: %v", err)
+		}
+	})
+
+	id, err := peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("hello lid"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	evt := waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	if evt.Info.Sender != peerLID || evt.Info.Chat != peerLID {
+		t.Errorf("Expected sender and chat to be normalized to %s, got %s in %s", peerLID, evt.Info.Sender, evt.Info.Chat)
+	} else if evt.Info.SenderAlt != peer.JID {
+		t.Errorf("Expected original sender %s in SenderAlt, got %s", peer.JID, evt.Info.SenderAlt)
+	}
+
+	resp, err := cli.SendMessage(context.Background(), peer.JID.ToNonAD(), textMessage("hello pn"))
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	receipt := waitForEvent(t, cli, func(evt *events.Receipt) bool {
+		return len(evt.MessageIDs) > 0 && evt.MessageIDs[0] == resp.ID
+	})
+	if receipt.Chat != peerLID {
+		t.Errorf("Expected receipt chat to be normalized to %s, got %s", peerLID, receipt.Chat)
+	}
+}
+
+func TestParticipantHashMismatch(t *testing.T) {
+	srv := newServer(t)
+	peer := newPeer(t, srv)
+	cli := connectClient(t, srv, func(tc *testClient) {
+		// A device list stored in a previous run that has a device that no longer exists
+		stale := []types.JID{peer.JID, types.NewADJID(peer.JID.User, 0, 7)}
+		if err := tc.device.DeviceLists.PutDeviceList(peer.JID.ToNonAD(), stale, ""); err != nil {
+			t.Fatalf("Failed to store device list: %v", err)
+		}
+	})
+	groupJID := srv.AddGroup("Test group", cli.device.ID.ToNonAD(), peer.JID.ToNonAD())
+
+	resp, err := cli.SendMessage(context.Background(), groupJID, textMessage("hello group"))
+	if err != nil {
+		t.Fatalf("Failed to send group message: %v", err)
+	}
+	waitForPeerMessage(t, peer, resp.ID)
+	if devices, _, _, err := cli.device.DeviceLists.GetDeviceList(peer.JID); err != nil || devices != nil {
+		t.Errorf("Expected stale device list to be deleted after phash mismatch, got %v (%v)", devices, err)
+	}
+
+	resp, err = cli.SendMessage(context.Background(), groupJID, textMessage("hello again"))
+	if err != nil {
+		t.Fatalf("Failed to send second group message: %v", err)
+	}
+	waitForPeerMessage(t, peer, resp.ID)
+	devices, _, _, err := cli.device.DeviceLists.GetDeviceList(peer.JID)
+	if err != nil || !slices.Equal(devices, srv.GetDevices(peer.JID)) {
+		t.Errorf("Expected device list to be fetched again, got %v (%v)", devices, err)
+	}
+}
+
+func TestRetryReceipts(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	peer := newPeer(t, srv)
+
+	// Peer asks the client to resend
+	resp, err := cli.SendMessage(context.Background(), peer.JID.ToNonAD(), textMessage("please retry"))
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	peer.SendRetryReceipt(waitForPeerMessage(t, peer, resp.ID))
+	resent := waitForPeerMessage(t, peer, resp.ID)
+	if resent.RetryCount < 1 {
+		t.Errorf("Expected resent message to have a retry count, got %d", resent.RetryCount)
+	} else if resent.Message.GetConversation() != "please retry" {
+		t.Errorf("Peer received %q after retry, expected %q", resent.Message.GetConversation(), "please retry")
+	}
+
+	// Client loses its session and asks the peer to resend
+	id, err := peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("establish session"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	err = cli.device.Sessions.DeleteSession(peer.JID.SignalAddress().String())
+	if err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	id, err = peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("after reset"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	evt := waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	if evt.RetryCount != 1 {
+		t.Errorf("Expected message to arrive after one retry, got retry count %d", evt.RetryCount)
+	} else if evt.Message.GetConversation() != "after reset" {
+		t.Errorf("Client received %q after retry, expected %q", evt.Message.GetConversation(), "after reset")
+	}
+}
+
+func TestSignedPreKeyUploadRetry(t *testing.T) {
+	srv := newServer(t)
+	var failUpload atomic.Bool
+	failUpload.Store(true)
+	srv.HandleIQ("encrypt", func(_ *mockserver.Conn, iq *waBinary.Node) ([]waBinary.Node, error) {
+		switch iq.GetChildren()[0].Tag {
+		case "count":
+			return []waBinary.Node{{Tag: "count", Attrs: waBinary.Attrs{"value": whatsmeow.WantedPreKeyCount}}}, nil
+		case "registration":
+			if failUpload.Load() {
+				return nil, &mockserver.IQError{Code: 500, Text: "internal-server-error"}
+			}
+		}
+		return nil, nil
+	})
+	var oldKey *keys.PreKey
+	// Event handlers must be able to upload prekeys without deadlocking
+	uploaded := make(chan struct{}, 1)
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.AddEventHandler(func(evt any) {
+			if _, ok := evt.(*events.SignedPreKeyRotated); ok {
+				tc.DangerousInternals().UploadPreKeys()
+				uploaded <- struct{}{}
+			}
+		})
+		oldKey = tc.device.SignedPreKey
+		tc.device.SignedPreKeyCreatedAt = time.Now().Add(-whatsmeow.SignedPreKeyRotationInterval - time.Hour)
+	})
+
+	// A failed upload must keep the new key, as the server may have received it anyway.
+	// The rotation loop may have already tried rotating after connecting, in which case this is a retry.
+	cli.DangerousInternals().RotateSignedPreKeyIfNeeded()
+	newKey, prevKey, _ := cli.device.GetSignedPreKeys()
+	if newKey.KeyID == oldKey.KeyID {
+		t.Fatalf("Signed prekey wasn't rotated")
+	} else if prevKey == nil || prevKey.KeyID != oldKey.KeyID {
+		t.Errorf("Expected previous signed prekey to be %d, got %v", oldKey.KeyID, prevKey)
+	} else if cli.device.LoadSignedPreKey(newKey.KeyID) == nil || cli.device.LoadSignedPreKey(oldKey.KeyID) == nil {
+		t.Errorf("Expected both signed prekeys to be loadable after failed upload")
+	}
+
+	failUpload.Store(false)
+	go cli.DangerousInternals().RotateSignedPreKeyIfNeeded()
+	evt := waitForEvent(t, cli, func(evt *events.SignedPreKeyRotated) bool { return true })
+	if evt.KeyID != newKey.KeyID || evt.PreviousKeyID != oldKey.KeyID {
+		t.Errorf("Unexpected rotation event %+v, expected %d -> %d", evt, oldKey.KeyID, newKey.KeyID)
+	}
+	select {
+	case <-uploaded:
+	case <-time.After(testTimeout):
+		t.Fatalf("Uploading prekeys from the rotation event handler deadlocked")
+	}
+	if key, _, _ := cli.device.GetSignedPreKeys(); key.KeyID != newKey.KeyID {
+		t.Errorf("Signed prekey changed to %d after retrying upload, expected %d", key.KeyID, newKey.KeyID)
+	}
+}
+
+func TestGroupMessages(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	peer := newPeer(t, srv)
+	groupJID := srv.AddGroup("Test group", cli.device.ID.ToNonAD(), peer.JID.ToNonAD())
+
+	info, err := cli.GetGroupInfo(groupJID)
+	if err != nil {
+		t.Fatalf("Failed to get group info: %v", err)
+	} else if info.Name != "Test group" {
+		t.Errorf("Group name is %q, expected %q", info.Name, "Test group")
+	} else if len(info.Participants) != 2 {
+		t.Errorf("Group has %d participants, expected 2", len(info.Participants))
+	}
+
+	resp, err := cli.SendMessage(context.Background(), groupJID, textMessage("hello group"))
+	if err != nil {
+		t.Fatalf("Failed to send group message: %v", err)
+	}
+	peerMsg := waitForPeerMessage(t, peer, resp.ID)
+	if peerMsg.Chat != groupJID {
+		t.Errorf("Peer received message in %s, expected %s", peerMsg.Chat, groupJID)
+	} else if peerMsg.Message.GetConversation() != "hello group" {
+		t.Errorf("Peer received %q, expected %q", peerMsg.Message.GetConversation(), "hello group")
+	}
+
+	id, err := peer.SendMessage(groupJID, textMessage("hello from peer"))
+	if err != nil {
+		t.Fatalf("Failed to send group message from peer: %v", err)
+	}
+	// The sender key distribution message is dispatched as a separate event with the same ID
+	evt := waitForEvent(t, cli, func(evt *events.Message) bool {
+		return evt.Info.ID == id && evt.Message.GetSenderKeyDistributionMessage() == nil
+	})
+	if evt.Info.Chat != groupJID {
+		t.Errorf("Client received message in %s, expected %s", evt.Info.Chat, groupJID)
+	} else if evt.Info.Sender.User != peer.JID.User {
+		t.Errorf("Client received message from %s, expected %s", evt.Info.Sender, peer.JID)
+	} else if evt.Message.GetConversation() != "hello from peer" {
+		t.Errorf("Client received %q, expected %q", evt.Message.GetConversation(), "hello from peer")
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that can be read while nodes sent in the background are still being recorded.
+type lockedBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return lb.buf.Write(p)
+}
+
+func (lb *lockedBuffer) Bytes() []byte {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return bytes.Clone(lb.buf.Bytes())
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	peer := newPeer(t, srv)
+
+	id, err := peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("before recording"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	waitForPeerReceipt(t, peer, id)
+
+	var snapshot bytes.Buffer
+	var recording lockedBuffer
+	if err = cli.container.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Failed to snapshot store: %v", err)
+	}
+	cli.SetNodeRecorder(whatsmeow.NewNodeRecorder(&recording))
+	id, err = peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("recorded"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	waitForPeerReceipt(t, peer, id)
+	cli.SetNodeRecorder(nil)
+
+	nodes, err := whatsmeow.ReadRecording(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	restored, err := memstore.Restore(&snapshot, nil)
+	if err != nil {
+		t.Fatalf("Failed to restore store: %v", err)
+	}
+	device, err := restored.GetDevice(*cli.device.ID)
+	if err != nil || device == nil {
+		t.Fatalf("Failed to get restored device: %v", err)
+	}
+	replayCli := newTestClient(restored, device)
+	if err = replayCli.Replay(context.Background(), nodes); err != nil {
+		t.Fatalf("Failed to replay recording: %v", err)
+	}
+	evt := waitForEvent(t, replayCli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	if evt.Message.GetConversation() != "recorded" {
+		t.Errorf("Replayed message is %q, expected %q", evt.Message.GetConversation(), "recorded")
+	}
+}
+
+func findSpan(t *testing.T, tr *whatsmeow.TraceRecorder, name string) whatsmeow.RecordedSpan {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		for _, span := range tr.Spans() {
+			if span.Name == name {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Span %s wasn't recorded", name)
+	return whatsmeow.RecordedSpan{}
+}
+
+func spanNames(spans []whatsmeow.RecordedSpan) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return names
+}
+
+func TestTracing(t *testing.T) {
+	srv := newServer(t)
+	receiveTracer := &whatsmeow.TraceRecorder{}
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.Tracer = receiveTracer
+	})
+	peer := newPeer(t, srv)
+
+	sendTracer := &whatsmeow.TraceRecorder{}
+	ctx := whatsmeow.ContextWithTracer(context.Background(), sendTracer)
+	resp, err := cli.SendMessage(ctx, peer.JID.ToNonAD(), textMessage("traced"))
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	sendSpan := findSpan(t, sendTracer, "send_message")
+	if sendSpan.Attributes["message_id"] != resp.ID {
+		t.Errorf("Send span has message ID %v, expected %s", sendSpan.Attributes["message_id"], resp.ID)
+	}
+	children := spanNames(sendTracer.Children(sendSpan))
+	for _, stage := range []string{"queue", "get_devices", "marshal", "peer_encrypt", "send", "resp"} {
+		if !slices.Contains(children, stage) {
+			t.Errorf("Send span is missing %s stage (children: %v)", stage, children)
+		}
+	}
+
+	id, err := peer.SendMessage(cli.device.ID.ToNonAD(), textMessage("traced reply"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Info.ID == id })
+	handleSpan := findSpan(t, receiveTracer, "handle_encrypted_message")
+	decryptSpan := findSpan(t, receiveTracer, "decrypt_messages")
+	if decryptSpan.ParentID != handleSpan.ID {
+		t.Errorf("decrypt_messages span isn't a child of handle_encrypted_message")
+	}
+	children = spanNames(receiveTracer.Children(decryptSpan))
+	if !slices.Contains(children, "decrypt") || !slices.Contains(children, "dispatch_event") {
+		t.Errorf("Decrypt span is missing children (got %v)", children)
+	}
+}
+
+func waitForOutboxState(t *testing.T, tc *testClient, id types.MessageID, state events.OutboxState) *events.OutboxMessageState {
+	t.Helper()
+	return waitForEvent(t, tc, func(evt *events.OutboxMessageState) bool {
+		return evt.ID == id && evt.State == state
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	srv := newServer(t)
+	peer := newPeer(t, srv)
+	to := peer.JID.ToNonAD()
+
+	// Messages queued before connecting are sent in order once the client connects.
+	// They may be sent before the Connected event is dispatched, so sent events are collected separately.
+	texts := []string{"first", "second", "third"}
+	var ids []types.MessageID
+	sent := make(chan types.MessageID, len(texts))
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.AddEventHandler(func(evt any) {
+			if state, ok := evt.(*events.OutboxMessageState); ok && state.State == events.OutboxSent {
+				sent <- state.ID
+			}
+		})
+		for _, text := range texts {
+			id, err := tc.EnqueueMessage(to, textMessage(text))
+			if err != nil {
+				t.Fatalf("Failed to enqueue message: %v", err)
+			}
+			ids = append(ids, id)
+		}
+	})
+	for i, id := range ids {
+		select {
+		case sentID := <-sent:
+			if sentID != id {
+				t.Errorf("Outbox sent %s, expected %s", sentID, id)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("Timed out waiting for %s to be sent", id)
+		}
+		if peerMsg := waitForPeerMessage(t, peer, id); peerMsg.Message.GetConversation() != texts[i] {
+			t.Errorf("Peer received %q, expected %q", peerMsg.Message.GetConversation(), texts[i])
+		}
+	}
+
+	// Messages queued while disconnected stay in the store and are sent by the next client using it
+	cli.Disconnect()
+	id, err := cli.EnqueueMessage(to, textMessage("after restart"))
+	if err != nil {
+		t.Fatalf("Failed to enqueue message: %v", err)
+	}
+	if queued, err := cli.GetOutboxMessages(); err != nil {
+		t.Fatalf("Failed to get outbox: %v", err)
+	} else if len(queued) != 1 || queued[0].ID != id {
+		t.Fatalf("Expected outbox to contain only %s, got %d messages", id, len(queued))
+	}
+	restarted := newTestClient(cli.container, cli.device)
+	restarted.SetTransport(srv.Transport())
+	restarted.ServerCertRootKey = srv.RootKey.Pub
+	if err = restarted.Connect(); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	t.Cleanup(restarted.Disconnect)
+	waitForOutboxState(t, restarted, id, events.OutboxSent)
+	if peerMsg := waitForPeerMessage(t, peer, id); peerMsg.Message.GetConversation() != "after restart" {
+		t.Errorf("Peer received %q, expected %q", peerMsg.Message.GetConversation(), "after restart")
+	}
+	if queued, err := restarted.GetOutboxMessages(); err != nil {
+		t.Fatalf("Failed to get outbox: %v", err)
+	} else if len(queued) != 0 {
+		t.Errorf("Expected outbox to be empty, got %d messages", len(queued))
+	}
+
+	// Permanent errors remove the message from the outbox without retrying
+	id, err = restarted.EnqueueMessage(types.NewJID("123", "example.com"), textMessage("nowhere"))
+	if err != nil {
+		t.Fatalf("Failed to enqueue message: %v", err)
+	}
+	if evt := waitForOutboxState(t, restarted, id, events.OutboxFailed); evt.Attempts != 1 {
+		t.Errorf("Expected message to fail after 1 attempt, got %d", evt.Attempts)
+	}
+}
+
+func TestOutboxRateLimited(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	peer := newPeer(t, srv)
+	to := peer.JID.ToNonAD()
+	cli.OutboxMaxAttempts = 1
+	cli.SetRateLimit(&whatsmeow.RateLimitConfig{ChatPerMinute: 1})
+	if _, err := cli.SendMessage(context.Background(), to, textMessage("hello")); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	// Rate limited sends aren't attempts, so the message isn't dropped even though only one attempt is allowed
+	id, err := cli.EnqueueMessage(to, textMessage("too fast"))
+	if err != nil {
+		t.Fatalf("Failed to enqueue message: %v", err)
+	}
+	evt := waitForOutboxState(t, cli, id, events.OutboxRetrying)
+	var rateLimitErr *whatsmeow.RateLimitError
+	if evt.Attempts != 0 {
+		t.Errorf("Expected rate limited message to have 0 attempts, got %d", evt.Attempts)
+	} else if !errors.As(evt.Error, &rateLimitErr) {
+		t.Errorf("Expected rate limit error, got %v", evt.Error)
+	} else if delay := time.Until(evt.NextAttempt); delay <= 0 || delay > time.Minute {
+		t.Errorf("Unexpected retry delay %s", delay)
+	}
+	if queued, err := cli.GetOutboxMessages(); err != nil {
+		t.Fatalf("Failed to get outbox: %v", err)
+	} else if len(queued) != 1 || queued[0].ID != id || queued[0].Attempts != 0 {
+		t.Fatalf("Expected outbox to contain %s with no attempts, got %+v", id, queued)
+	}
+
+	// When waiting for the rate limit, disconnecting interrupts the send without counting it as an attempt
+	other := newPeer(t, srv).JID.ToNonAD()
+	cli.SetRateLimit(&whatsmeow.RateLimitConfig{ChatPerMinute: 1, Wait: true})
+	if _, err = cli.SendMessage(context.Background(), other, textMessage("hello")); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	id, err = cli.EnqueueMessage(other, textMessage("waiting"))
+	if err != nil {
+		t.Fatalf("Failed to enqueue message: %v", err)
+	}
+	waitForOutboxState(t, cli, id, events.OutboxSending)
+	cli.Disconnect()
+	cli.SetRateLimit(nil)
+	if err = cli.Connect(); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	if evt = waitForOutboxState(t, cli, id, events.OutboxSent); evt.Attempts != 0 {
+		t.Errorf("Expected interrupted message to have 0 attempts, got %d", evt.Attempts)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	alice := newPeer(t, srv)
+	bob := newPeer(t, srv)
+	cli.SetRateLimit(&whatsmeow.RateLimitConfig{ChatPerMinute: 2, NewChatsPerHour: 1})
+
+	// Failed sends don't use up the budget
+	_, err := cli.SendMessage(context.Background(), types.NewJID("123", "example.com"), textMessage("nowhere"))
+	if !errors.Is(err, whatsmeow.ErrUnknownServer) {
+		t.Fatalf("Expected unknown server error, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cli.SendMessage(context.Background(), alice.JID.ToNonAD(), textMessage("hello")); err != nil {
+			t.Fatalf("Failed to send message #%d: %v", i+1, err)
+		}
+	}
+	_, err = cli.SendMessage(context.Background(), alice.JID.ToNonAD(), textMessage("too fast"))
+	var rateLimitErr *whatsmeow.RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.Reason != whatsmeow.RateLimitChat {
+		t.Fatalf("Expected chat rate limit error, got %v", err)
+	} else if rateLimitErr.RetryAfter <= 0 || rateLimitErr.RetryAfter > time.Minute {
+		t.Errorf("Unexpected retry delay %s", rateLimitErr.RetryAfter)
+	}
+
+	_, err = cli.SendMessage(context.Background(), bob.JID.ToNonAD(), textMessage("hello stranger"))
+	if !errors.Is(err, whatsmeow.ErrRateLimited) || !errors.As(err, &rateLimitErr) || rateLimitErr.Reason != whatsmeow.RateLimitNewChat {
+		t.Fatalf("Expected new chat rate limit error, got %v", err)
+	}
+
+	usage := cli.GetRateLimitUsage(alice.JID)
+	expected := whatsmeow.RateLimitUsage{Global: 2, Chat: 2, ChatLimit: 2, NewChats: 1, NewChatLimit: 1}
+	if usage != expected {
+		t.Errorf("Unexpected rate limit usage %+v, expected %+v", usage, expected)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv)
+	alice := newPeer(t, srv)
+	bob := newPeer(t, srv)
+
+	aliceMessages := make(chan *events.Message, 8)
+	aliceSub := whatsmeow.Subscribe(cli.Client, func(evt *events.Message) {
+		aliceMessages <- evt
+	}, whatsmeow.SubscribeOptions[*events.Message]{Chat: alice.JID, FromMe: proto.Bool(false), MessageTypes: []string{"text"}})
+	defer aliceSub.Close()
+	panicSub := whatsmeow.Subscribe(cli.Client, func(evt *events.Message) {
+		panic("handler failed")
+	}, whatsmeow.SubscribeOptions[*events.Message]{Sender: bob.JID})
+	defer panicSub.Close()
+
+	bobID, err := bob.SendMessage(cli.device.ID.ToNonAD(), textMessage("hello from bob"))
+	if err != nil {
+		t.Fatalf("Failed to send message from bob: %v", err)
+	}
+	aliceID, err := alice.SendMessage(cli.device.ID.ToNonAD(), textMessage("hello from alice"))
+	if err != nil {
+		t.Fatalf("Failed to send message from alice: %v", err)
+	}
+
+	panicEvt := waitForEvent(t, cli, func(evt *events.HandlerPanic) bool { return true })
+	if msg, ok := panicEvt.Event.(*events.Message); !ok || msg.Info.ID != bobID {
+		t.Errorf("Unexpected event in panic: %#v", panicEvt.Event)
+	} else if panicEvt.Panic != "handler failed" {
+		t.Errorf("Unexpected panic value %v", panicEvt.Panic)
+	}
+	select {
+	case evt := <-aliceMessages:
+		if evt.Info.ID != aliceID {
+			t.Errorf("Subscription received unexpected message %s, expected %s", evt.Info.ID, aliceID)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for subscription to receive message")
+	}
+
+	// Closed subscriptions don't receive any more events
+	aliceSub.Close()
+	if _, err = alice.SendMessage(cli.device.ID.ToNonAD(), textMessage("are you there?")); err != nil {
+		t.Fatalf("Failed to send message from alice: %v", err)
+	}
+	waitForEvent(t, cli, func(evt *events.Message) bool { return evt.Message.GetConversation() == "are you there?" })
+	select {
+	case evt := <-aliceMessages:
+		t.Errorf("Closed subscription received message %s", evt.Info.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestParallelMessageHandlers(t *testing.T) {
+	srv := newServer(t)
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.ParallelMessageHandlers = 4
+	})
+	alice := newPeer(t, srv)
+	bob := newPeer(t, srv)
+	groupJID := srv.AddGroup("Test group", cli.device.ID.ToNonAD(), alice.JID.ToNonAD(), bob.JID.ToNonAD())
+
+	// Handling alice's first message blocks until bob's message is handled, which only works if they're in parallel
+	bobHandled := make(chan struct{})
+	cli.AddEventHandler(func(rawEvt any) {
+		evt, ok := rawEvt.(*events.Message)
+		if !ok {
+			return
+		} else if evt.Message.GetConversation() == "alice 0" {
+			select {
+			case <-bobHandled:
+			case <-time.After(testTimeout):
+				t.Error("Timed out waiting for bob's message to be handled")
+			}
+		} else if evt.Message.GetConversation() == "bob" {
+			close(bobHandled)
+		}
+	})
+
+	const count = 10
+	for i := 0; i < count; i++ {
+		if _, err := alice.SendMessage(cli.device.ID.ToNonAD(), textMessage(fmt.Sprintf("alice %d", i))); err != nil {
+			t.Fatalf("Failed to send message from alice: %v", err)
+		}
+		if _, err := alice.SendMessage(groupJID, textMessage(fmt.Sprintf("group %d", i))); err != nil {
+			t.Fatalf("Failed to send group message from alice: %v", err)
+		}
+	}
+	if _, err := bob.SendMessage(cli.device.ID.ToNonAD(), textMessage("bob")); err != nil {
+		t.Fatalf("Failed to send message from bob: %v", err)
+	}
+
+	// Messages within each chat must still arrive in order
+	next := map[types.JID]int{alice.JID.ToNonAD(): 0, groupJID: 0}
+	prefixes := map[types.JID]string{alice.JID.ToNonAD(): "alice", groupJID: "group"}
+	for next[alice.JID.ToNonAD()] < count || next[groupJID] < count {
+		evt := waitForEvent(t, cli, func(evt *events.Message) bool {
+			return evt.Message.GetConversation() != "" && evt.Message.GetConversation() != "bob"
+		})
+		expected := fmt.Sprintf("%s %d", prefixes[evt.Info.Chat], next[evt.Info.Chat])
+		if evt.Message.GetConversation() != expected {
+			t.Fatalf("Received %q in %s, expected %q", evt.Message.GetConversation(), evt.Info.Chat, expected)
+		}
+		next[evt.Info.Chat]++
+	}
+}
+
+func TestReconnectPolicy(t *testing.T) {
+	srv := newServer(t)
+	attempts := make(chan whatsmeow.ReconnectAttempt, 8)
+	breaker := &whatsmeow.CircuitBreakerReconnectPolicy{
+		Policy:    &whatsmeow.ExponentialReconnectPolicy{Initial: 10 * time.Millisecond},
+		Threshold: 1,
+		Window:    time.Minute,
+	}
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.ReconnectPolicy = whatsmeow.ReconnectPolicyFunc(func(attempt whatsmeow.ReconnectAttempt) (time.Duration, bool) {
+			attempts <- attempt
+			return breaker.NextDelay(attempt)
+		})
+	})
+
+	// The server restarting is reported to the policy and the client reconnects
+	conn := srv.GetConn(*cli.device.ID)
+	if err := conn.SendNode(waBinary.Node{Tag: "stream:error", Attrs: waBinary.Attrs{"code": "503"}}); err != nil {
+		t.Fatalf("Failed to send stream error: %v", err)
+	}
+	conn.Close()
+	if evt := waitForEvent(t, cli, func(evt *events.ReconnectScheduled) bool { return true }); evt.Attempt != 1 || evt.Delay != 0 {
+		t.Errorf("Unexpected first reconnect %+v", evt)
+	}
+	if attempt := <-attempts; attempt.Reason.StreamErrorCode != "503" {
+		t.Errorf("Expected stream error code 503 in reconnect attempt, got %+v", attempt.Reason)
+	}
+	waitForEvent(t, cli, func(evt *events.Connected) bool { return true })
+
+	// Dropping the connection again right away opens the circuit breaker
+	srv.GetConn(*cli.device.ID).Close()
+	var evt any = waitForEvent(t, cli, func(evt *events.ReconnectGaveUp) bool { return true })
+	if _, ok := evt.(events.PermanentDisconnect); !ok {
+		t.Errorf("ReconnectGaveUp isn't a PermanentDisconnect event")
+	}
+	if attempt := <-attempts; attempt.Reason != (whatsmeow.DisconnectInfo{}) {
+		t.Errorf("Expected empty disconnect reason after connection was closed, got %+v", attempt.Reason)
+	}
+
+	backoff := &whatsmeow.ExponentialReconnectPolicy{Initial: time.Second, Max: 5 * time.Second, MaxAttempts: 5}
+	for i, expected := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if delay, stop := backoff.NextDelay(whatsmeow.ReconnectAttempt{Attempt: i + 1}); stop || delay != expected {
+			t.Errorf("Unexpected delay %s (stop: %t) for attempt #%d, expected %s", delay, stop, i+1, expected)
+		}
+	}
+	if _, stop := backoff.NextDelay(whatsmeow.ReconnectAttempt{Attempt: 6}); !stop {
+		t.Errorf("Expected policy to give up after 5 attempts")
+	}
+}
+
+func TestConnectionState(t *testing.T) {
+	srv := newServer(t)
+	stateChanges := make(chan *events.ConnectionStateChanged, 16)
+	cli := connectClient(t, srv, func(tc *testClient) {
+		tc.EnableAutoReconnect = false
+		if state := tc.State(); state != events.ConnectionDisconnected {
+			t.Errorf("Expected new client to be disconnected, got %s", state)
+		}
+		tc.AddEventHandler(func(rawEvt any) {
+			if evt, ok := rawEvt.(*events.ConnectionStateChanged); ok {
+				stateChanges <- evt
+			}
+		})
+	})
+	nextStateChange := func() *events.ConnectionStateChanged {
+		t.Helper()
+		select {
+		case evt := <-stateChanges:
+			return evt
+		case <-time.After(testTimeout):
+			t.Fatal("Timed out waiting for state change")
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if state, err := cli.WaitForState(ctx, events.ConnectionOnline); err != nil {
+		t.Fatalf("Failed to wait for online state: %v (state: %s)", err, state)
+	}
+
+	var states []events.ConnectionState
+	for len(states) == 0 || states[len(states)-1] != events.ConnectionOnline {
+		evt := nextStateChange()
+		if len(states) > 0 && evt.Old != states[len(states)-1] {
+			t.Errorf("State change event from %s doesn't follow previous state %s", evt.Old, states[len(states)-1])
+		}
+		states = append(states, evt.New)
+	}
+	expected := []events.ConnectionState{
+		events.ConnectionConnecting, events.ConnectionHandshaking, events.ConnectionAuthenticating,
+		events.ConnectionSyncingOffline, events.ConnectionOnline,
+	}
+	if !slices.Equal(states, expected) {
+		t.Errorf("Unexpected state changes %v, expected %v", states, expected)
+	}
+
+	// Being unlinked is a terminal state, so the following disconnection doesn't change it
+	conn := srv.GetConn(*cli.device.ID)
+	err := conn.SendNode(waBinary.Node{
+		Tag:     "stream:error",
+		Attrs:   waBinary.Attrs{"code": "401"},
+		Content: []waBinary.Node{{Tag: "conflict", Attrs: waBinary.Attrs{"type": "device_removed"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send stream error: %v", err)
+	}
+	evt := nextStateChange()
+	if evt.Old != events.ConnectionOnline || evt.New != events.ConnectionLoggedOut || evt.Cause != "device removed" {
+		t.Errorf("Unexpected state change %+v", evt)
+	}
+	conn.Close()
+	for cli.IsConnected() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state := cli.State(); state != events.ConnectionLoggedOut {
+		t.Errorf("Expected client to stay logged out, got %s", state)
+	}
+}
+
+func TestManager(t *testing.T) {
+	srv := newServer(t)
+	peer := newPeer(t, srv)
+	container := memstore.New(nil)
+	first, second := container.NewDevice(), container.NewDevice()
+	for _, device := range []*store.Device{first, second} {
+		if err := srv.LoginDevice(device); err != nil {
+			t.Fatalf("Failed to log in device: %v", err)
+		}
+	}
+
+	mgr := whatsmeow.NewManager(container, nil)
+	mgr.HTTPClient = &http.Client{}
+	mgr.Setup = func(cli *whatsmeow.Client) {
+		cli.SetTransport(srv.Transport())
+		cli.ServerCertRootKey = srv.RootKey.Pub
+	}
+	managedEvents := make(chan *whatsmeow.ManagedEvent, 256)
+	mgr.AddEventHandler(func(evt *whatsmeow.ManagedEvent) {
+		managedEvents <- evt
+	})
+	if err := mgr.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(mgr.Stop)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	waitForManagedEvent := func(filter func(*whatsmeow.ManagedEvent) bool) *whatsmeow.ManagedEvent {
+		t.Helper()
+		for {
+			select {
+			case evt := <-managedEvents:
+				if filter(evt) {
+					return evt
+				}
+			case <-ctx.Done():
+				t.Fatal("Timed out waiting for managed event")
+				return nil
+			}
+		}
+	}
+	connected := make(map[types.JID]bool)
+	for len(connected) < 2 {
+		evt := waitForManagedEvent(func(evt *whatsmeow.ManagedEvent) bool {
+			_, ok := evt.Event.(*events.Connected)
+			return ok
+		})
+		connected[evt.JID] = true
+	}
+	if !connected[*first.ID] || !connected[*second.ID] {
+		t.Errorf("Unexpected accounts connected: %v", connected)
+	}
+	for _, jid := range mgr.Accounts() {
+		if _, err := mgr.Get(jid).WaitForState(ctx, events.ConnectionOnline); err != nil {
+			t.Fatalf("Failed to wait for %s to be online: %v", jid, err)
+		}
+	}
+	if health, ok := mgr.Health(*first.ID); !ok || !health.Healthy() || health.LastConnected.IsZero() {
+		t.Errorf("Unexpected health for %s: %+v", first.ID, health)
+	}
+
+	id, err := peer.SendMessage(second.ID.ToNonAD(), textMessage("hello second"))
+	if err != nil {
+		t.Fatalf("Failed to send message from peer: %v", err)
+	}
+	evt := waitForManagedEvent(func(evt *whatsmeow.ManagedEvent) bool {
+		msg, ok := evt.Event.(*events.Message)
+		return ok && msg.Info.ID == id
+	})
+	if evt.JID != *second.ID || evt.Client != mgr.Get(*second.ID) {
+		t.Errorf("Message event came from %s, expected %s", evt.JID, second.ID)
+	}
+
+	// Logged out accounts are removed from the manager and the container
+	err = srv.GetConn(*second.ID).SendNode(waBinary.Node{
+		Tag:     "stream:error",
+		Attrs:   waBinary.Attrs{"code": "401"},
+		Content: []waBinary.Node{{Tag: "conflict", Attrs: waBinary.Attrs{"type": "device_removed"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send stream error: %v", err)
+	}
+	waitForManagedEvent(func(evt *whatsmeow.ManagedEvent) bool {
+		_, ok := evt.Event.(*events.LoggedOut)
+		return ok && evt.JID == *second.ID
+	})
+	for mgr.Get(*second.ID) != nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if accounts := mgr.Accounts(); !slices.Equal(accounts, []types.JID{*first.ID}) {
+		t.Errorf("Unexpected accounts after logout: %v", accounts)
+	}
+	if devices, err := container.GetAllDevices(); err != nil {
+		t.Fatalf("Failed to get devices: %v", err)
+	} else if len(devices) != 1 || *devices[0].ID != *first.ID {
+		t.Errorf("Expected only %s to be left in the container, got %d devices", first.ID, len(devices))
+	}
+}
@@ -0,0 +1,554 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mockserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/libsignal/ecc"
+	"go.mau.fi/libsignal/groups"
+	"go.mau.fi/libsignal/keys/prekey"
+	"go.mau.fi/libsignal/protocol"
+	"go.mau.fi/libsignal/session"
+	"go.mau.fi/util/random"
+	"google.golang.org/protobuf/proto"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+var pbSerializer = store.SignalProtobufSerializer
+
+// PeerPreKeyCount is the number of one-time prekeys that new peers upload to the server.
+var PeerPreKeyCount uint32 = 50
+
+// PeerMessage is a message that a peer received and decrypted successfully.
+type PeerMessage struct {
+	Chat       types.JID
+	Sender     types.JID
+	ID         types.MessageID
+	Message    *waE2E.Message
+	RetryCount int
+}
+
+// PeerReceipt is a receipt that a peer received for a message it sent.
+type PeerReceipt struct {
+	Chat   types.JID
+	Sender types.JID
+	ID     types.MessageID
+	Type   types.ReceiptType
+}
+
+type sentMessage struct {
+	to      types.JID
+	message *waE2E.Message
+}
+
+// Peer is a simulated WhatsApp device that lives inside the mock server.
+//
+// Peers have real Signal sessions with the clients they talk to, so they can be used to test sending,
+// decrypting, receipts and retries end-to-end. Peers automatically send delivery receipts for messages
+// they decrypt, retry receipts for messages they fail to decrypt, and resend messages when they receive
+// retry receipts.
+type Peer struct {
+	JID   types.JID
+	Store *store.Device
+
+	srv *Server
+	log waLog.Logger
+
+	incoming chan *waBinary.Node
+	messages chan *PeerMessage
+	receipts chan *PeerReceipt
+
+	lock    sync.Mutex
+	sent    map[types.MessageID]sentMessage
+	retries map[types.MessageID]int
+}
+
+// NewPeer creates a new simulated primary device with a new phone number and uploads its prekeys to the server.
+func (srv *Server) NewPeer(pushName string) (*Peer, error) {
+	device := srv.peerStore.NewDevice()
+	jid := types.NewJID(srv.newUser(), types.DefaultUserServer)
+	device.ID = &jid
+	device.PushName = pushName
+	device.Account = &waAdv.ADVSignedDeviceIdentity{}
+	if err := device.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save peer device: %w", err)
+	}
+	preKeys, err := device.PreKeys.GetOrGenPreKeys(PeerPreKeyCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate prekeys: %w", err)
+	} else if err = device.PreKeys.MarkPreKeysAsUploaded(preKeys[len(preKeys)-1].KeyID); err != nil {
+		return nil, fmt.Errorf("failed to mark prekeys as uploaded: %w", err)
+	}
+	peer := &Peer{
+		JID:   jid,
+		Store: device,
+
+		srv: srv,
+		log: srv.Log.Sub("Peer/" + jid.User),
+
+		incoming: make(chan *waBinary.Node, 256),
+		messages: make(chan *PeerMessage, 256),
+		receipts: make(chan *PeerReceipt, 256),
+
+		sent:    make(map[types.MessageID]sentMessage),
+		retries: make(map[types.MessageID]int),
+	}
+	srv.lock.Lock()
+	srv.devices[jid] = &deviceKeys{
+		registrationID: device.RegistrationID,
+		identity:       *device.IdentityKey.Pub,
+		signedPreKey:   device.SignedPreKey,
+		preKeys:        preKeys,
+	}
+	srv.peers[jid] = peer
+	srv.lock.Unlock()
+	go peer.loop()
+	return peer, nil
+}
+
+// Messages returns a channel that receives every message the peer decrypts.
+func (p *Peer) Messages() <-chan *PeerMessage {
+	return p.messages
+}
+
+// Receipts returns a channel that receives every non-retry receipt sent to the peer.
+func (p *Peer) Receipts() <-chan *PeerReceipt {
+	return p.receipts
+}
+
+func (p *Peer) loop() {
+	for {
+		select {
+		case node := <-p.incoming:
+			p.lock.Lock()
+			switch node.Tag {
+			case "message":
+				p.handleMessage(node)
+			case "receipt":
+				p.handleReceipt(node)
+			}
+			p.lock.Unlock()
+		case <-p.srv.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Peer) handleNode(node *waBinary.Node) {
+	select {
+	case p.incoming <- node:
+	case <-p.srv.ctx.Done():
+	}
+}
+
+func newMessageID() types.MessageID {
+	return "3EB0" + strings.ToUpper(hex.EncodeToString(random.Bytes(8)))
+}
+
+func padMessage(plaintext []byte) []byte {
+	pad := random.Bytes(1)
+	pad[0] &= 0xf
+	if pad[0] == 0 {
+		pad[0] = 0xf
+	}
+	return append(plaintext, bytes.Repeat(pad, int(pad[0]))...)
+}
+
+func unpadMessage(plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 || int(plaintext[len(plaintext)-1]) > len(plaintext) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return plaintext[:len(plaintext)-int(plaintext[len(plaintext)-1])], nil
+}
+
+// encryptFor encrypts the given plaintext for a device. If there's no existing session and bundle is nil,
+// a prekey bundle is fetched from the server.
+func (p *Peer) encryptFor(to types.JID, plaintext []byte, bundle *prekey.Bundle) (*waBinary.Node, error) {
+	builder := session.NewBuilderFromSignal(p.Store, to.SignalAddress(), pbSerializer)
+	if bundle == nil && !p.Store.ContainsSession(to.SignalAddress()) {
+		var err error
+		bundle, err = p.srv.fetchBundle(to)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if bundle != nil {
+		if err := builder.ProcessBundle(bundle); err != nil {
+			return nil, fmt.Errorf("failed to process prekey bundle of %s: %w", to, err)
+		}
+	}
+	ciphertext, err := session.NewCipher(builder, to.SignalAddress()).Encrypt(padMessage(plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt for %s: %w", to, err)
+	}
+	encType := "msg"
+	if ciphertext.Type() == protocol.PREKEY_TYPE {
+		encType = "pkmsg"
+	}
+	return &waBinary.Node{
+		Tag:     "enc",
+		Attrs:   waBinary.Attrs{"v": "2", "type": encType},
+		Content: ciphertext.Serialize(),
+	}, nil
+}
+
+// SendMessage sends a message to the given user or group and returns the message ID.
+func (p *Peer) SendMessage(to types.JID, message *waE2E.Message) (types.MessageID, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	id := newMessageID()
+	plaintext, err := proto.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal message: %w", err)
+	}
+	var participantNodes, extraNodes []waBinary.Node
+	if to.Server == types.GroupServer {
+		participantNodes, extraNodes, err = p.encryptGroup(to, plaintext)
+	} else {
+		participantNodes, err = p.encryptForAll(p.srv.GetDevices(to), plaintext)
+	}
+	if err != nil {
+		return "", err
+	}
+	p.sent[id] = sentMessage{to: to, message: message}
+	_, err = p.srv.routeMessage(p.JID, &waBinary.Node{
+		Tag: "message",
+		Attrs: waBinary.Attrs{
+			"id":     id,
+			"to":     to,
+			"type":   "text",
+			"notify": p.Store.PushName,
+		},
+		Content: append([]waBinary.Node{{Tag: "participants", Content: participantNodes}}, extraNodes...),
+	})
+	return id, err
+}
+
+func (p *Peer) encryptForAll(devices []types.JID, plaintext []byte) ([]waBinary.Node, error) {
+	nodes := make([]waBinary.Node, 0, len(devices))
+	for _, device := range devices {
+		if device == p.JID {
+			continue
+		}
+		enc, err := p.encryptFor(device, plaintext, nil)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, waBinary.Node{
+			Tag:     "to",
+			Attrs:   waBinary.Attrs{"jid": device},
+			Content: []waBinary.Node{*enc},
+		})
+	}
+	return nodes, nil
+}
+
+func (p *Peer) encryptGroup(to types.JID, plaintext []byte) (participantNodes, extraNodes []waBinary.Node, err error) {
+	participants, ok := p.srv.getGroupParticipants(to)
+	if !ok {
+		return nil, nil, fmt.Errorf("group %s not found", to)
+	}
+	builder := groups.NewGroupSessionBuilder(p.Store, pbSerializer)
+	senderKeyName := protocol.NewSenderKeyName(to.String(), p.JID.SignalAddress())
+	skdm, err := builder.Create(senderKeyName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create sender key distribution message: %w", err)
+	}
+	skdmPlaintext, err := proto.Marshal(&waE2E.Message{
+		SenderKeyDistributionMessage: &waE2E.SenderKeyDistributionMessage{
+			GroupID:                             proto.String(to.String()),
+			AxolotlSenderKeyDistributionMessage: skdm.Serialize(),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := groups.NewGroupCipher(builder, senderKeyName, p.Store).Encrypt(padMessage(plaintext))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt group message: %w", err)
+	}
+	var devices []types.JID
+	for _, participant := range participants {
+		devices = append(devices, p.srv.GetDevices(participant)...)
+	}
+	participantNodes, err = p.encryptForAll(devices, skdmPlaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	extraNodes = []waBinary.Node{{
+		Tag:     "enc",
+		Attrs:   waBinary.Attrs{"v": "2", "type": "skmsg"},
+		Content: encrypted.SignedSerialize(),
+	}}
+	return
+}
+
+func (p *Peer) decrypt(enc *waBinary.Node, chat, sender types.JID) ([]byte, error) {
+	content, _ := enc.Content.([]byte)
+	var plaintext []byte
+	switch enc.AttrGetter().String("type") {
+	case "pkmsg":
+		msg, err := protocol.NewPreKeySignalMessageFromBytes(content, pbSerializer.PreKeySignalMessage, pbSerializer.SignalMessage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prekey message: %w", err)
+		}
+		builder := session.NewBuilderFromSignal(p.Store, sender.SignalAddress(), pbSerializer)
+		plaintext, _, err = session.NewCipher(builder, sender.SignalAddress()).DecryptMessageReturnKey(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt prekey message: %w", err)
+		}
+	case "msg":
+		msg, err := protocol.NewSignalMessageFromBytes(content, pbSerializer.SignalMessage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse normal message: %w", err)
+		}
+		builder := session.NewBuilderFromSignal(p.Store, sender.SignalAddress(), pbSerializer)
+		plaintext, err = session.NewCipher(builder, sender.SignalAddress()).Decrypt(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt normal message: %w", err)
+		}
+	case "skmsg":
+		msg, err := protocol.NewSenderKeyMessageFromBytes(content, pbSerializer.SenderKeyMessage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse group message: %w", err)
+		}
+		senderKeyName := protocol.NewSenderKeyName(chat.String(), sender.SignalAddress())
+		builder := groups.NewGroupSessionBuilder(p.Store, pbSerializer)
+		plaintext, err = groups.NewGroupCipher(builder, senderKeyName, p.Store).Decrypt(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt group message: %w", err)
+		}
+	default:
+		return nil, nil
+	}
+	return unpadMessage(plaintext)
+}
+
+func (p *Peer) processSenderKeyDistribution(chat, sender types.JID, skdm *waE2E.SenderKeyDistributionMessage) {
+	msg, err := protocol.NewSenderKeyDistributionMessageFromBytes(skdm.GetAxolotlSenderKeyDistributionMessage(), pbSerializer.SenderKeyDistributionMessage)
+	if err != nil {
+		p.log.Warnf("Failed to parse sender key distribution message from %s: %v", sender, err)
+		return
+	}
+	builder := groups.NewGroupSessionBuilder(p.Store, pbSerializer)
+	builder.Process(protocol.NewSenderKeyName(chat.String(), sender.SignalAddress()), msg)
+}
+
+func (p *Peer) handleMessage(node *waBinary.Node) {
+	ag := node.AttrGetter()
+	from := ag.JID("from")
+	id := types.MessageID(ag.String("id"))
+	chat, sender := from.ToNonAD(), from
+	if from.Server == types.GroupServer {
+		chat, sender = from, ag.JID("participant")
+	}
+	if !ag.OK() {
+		p.log.Warnf("Invalid message node: %v", ag.Error())
+		return
+	}
+	var result *PeerMessage
+	for _, enc := range node.GetChildrenByTag("enc") {
+		plaintext, err := p.decrypt(&enc, chat, sender)
+		if err != nil {
+			p.log.Warnf("Failed to decrypt %s from %s: %v", id, sender, err)
+			p.sendRetryReceipt(chat, sender, id)
+			return
+		} else if plaintext == nil {
+			continue
+		}
+		var msg waE2E.Message
+		if err = proto.Unmarshal(plaintext, &msg); err != nil {
+			p.log.Warnf("Failed to unmarshal %s from %s: %v", id, sender, err)
+			continue
+		}
+		if skdm := msg.GetSenderKeyDistributionMessage(); skdm != nil {
+			p.processSenderKeyDistribution(chat, sender, skdm)
+			msg.SenderKeyDistributionMessage = nil
+			if proto.Size(&msg) == 0 {
+				continue
+			}
+		}
+		result = &PeerMessage{
+			Chat:       chat,
+			Sender:     sender,
+			ID:         id,
+			Message:    &msg,
+			RetryCount: enc.AttrGetter().OptionalInt("count"),
+		}
+	}
+	if result == nil {
+		return
+	}
+	p.sendReceipt(chat, sender, id, types.ReceiptTypeDelivered, nil)
+	p.messages <- result
+}
+
+func (p *Peer) sendReceipt(chat, sender types.JID, id types.MessageID, receiptType types.ReceiptType, content []waBinary.Node) {
+	attrs := waBinary.Attrs{
+		"id": id,
+		"to": sender,
+	}
+	if chat.Server == types.GroupServer {
+		attrs["to"] = chat
+		attrs["participant"] = sender
+	}
+	if receiptType != types.ReceiptTypeDelivered {
+		attrs["type"] = string(receiptType)
+	}
+	p.srv.routeReceipt(p.JID, &waBinary.Node{
+		Tag:     "receipt",
+		Attrs:   attrs,
+		Content: content,
+	})
+}
+
+// SendReceipt sends a receipt of the given type for a received message, e.g. types.ReceiptTypeRead.
+func (p *Peer) SendReceipt(msg *PeerMessage, receiptType types.ReceiptType) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sendReceipt(msg.Chat, msg.Sender, msg.ID, receiptType, nil)
+}
+
+// SendRetryReceipt asks the sender of the given message to send it again, which is useful for testing the
+// client's retry handling. The receipt includes a fresh prekey bundle, so the sender will create a new session.
+func (p *Peer) SendRetryReceipt(msg *PeerMessage) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sendRetryReceipt(msg.Chat, msg.Sender, msg.ID)
+}
+
+func (p *Peer) sendRetryReceipt(chat, sender types.JID, id types.MessageID) {
+	p.retries[id]++
+	retryCount := p.retries[id]
+	if retryCount >= 5 {
+		p.log.Warnf("Not sending any more retry receipts for %s", id)
+		return
+	}
+	preKey, err := p.Store.PreKeys.GenOnePreKey()
+	if err != nil {
+		p.log.Errorf("Failed to generate prekey for retry receipt: %v", err)
+		return
+	}
+	var registrationID [4]byte
+	binary.BigEndian.PutUint32(registrationID[:], p.Store.RegistrationID)
+	p.sendReceipt(chat, sender, id, types.ReceiptTypeRetry, []waBinary.Node{
+		{Tag: "retry", Attrs: waBinary.Attrs{
+			"count": retryCount,
+			"id":    id,
+			"t":     time.Now().Unix(),
+			"v":     1,
+		}},
+		{Tag: "registration", Content: registrationID[:]},
+		{Tag: "keys", Content: []waBinary.Node{
+			{Tag: "type", Content: []byte{ecc.DjbType}},
+			{Tag: "identity", Content: p.Store.IdentityKey.Pub[:]},
+			preKeyToNode(preKey),
+			preKeyToNode(p.Store.SignedPreKey),
+		}},
+	})
+}
+
+func (p *Peer) handleReceipt(node *waBinary.Node) {
+	ag := node.AttrGetter()
+	from := ag.JID("from")
+	receipt := &PeerReceipt{
+		Chat:   from.ToNonAD(),
+		Sender: from,
+		ID:     types.MessageID(ag.String("id")),
+		Type:   types.ReceiptType(ag.OptionalString("type")),
+	}
+	if from.Server == types.GroupServer {
+		receipt.Chat, receipt.Sender = from, ag.JID("participant")
+	}
+	if !ag.OK() {
+		p.log.Warnf("Invalid receipt node: %v", ag.Error())
+		return
+	}
+	if receipt.Type != types.ReceiptTypeRetry {
+		p.receipts <- receipt
+		return
+	}
+	if err := p.handleRetryReceipt(receipt, node); err != nil {
+		p.log.Warnf("Failed to handle retry receipt for %s from %s: %v", receipt.ID, receipt.Sender, err)
+	}
+}
+
+// handleRetryReceipt resends a message after the recipient failed to decrypt it. The session is always recreated,
+// either with the bundle included in the receipt or a new one fetched from the server.
+func (p *Peer) handleRetryReceipt(receipt *PeerReceipt, node *waBinary.Node) error {
+	sent, ok := p.sent[receipt.ID]
+	if !ok {
+		return fmt.Errorf("unknown message")
+	}
+	retryNode := node.GetChildByTag("retry")
+	retryCount := retryNode.AttrGetter().OptionalInt("count")
+	var bundle *prekey.Bundle
+	if keysNode, ok := node.GetOptionalChildByTag("keys"); ok {
+		dk, err := parseKeys(node, &keysNode)
+		if err != nil {
+			return fmt.Errorf("failed to parse keys in retry receipt: %w", err)
+		}
+		bundle = dk.toBundle(receipt.Sender, dk.popPreKey())
+	} else {
+		var err error
+		bundle, err = p.srv.fetchBundle(receipt.Sender)
+		if err != nil {
+			return err
+		}
+	}
+	message := sent.message
+	if receipt.Chat.Server == types.GroupServer {
+		builder := groups.NewGroupSessionBuilder(p.Store, pbSerializer)
+		skdm, err := builder.Create(protocol.NewSenderKeyName(receipt.Chat.String(), p.JID.SignalAddress()))
+		if err != nil {
+			return fmt.Errorf("failed to create sender key distribution message: %w", err)
+		}
+		message = proto.Clone(message).(*waE2E.Message)
+		message.SenderKeyDistributionMessage = &waE2E.SenderKeyDistributionMessage{
+			GroupID:                             proto.String(receipt.Chat.String()),
+			AxolotlSenderKeyDistributionMessage: skdm.Serialize(),
+		}
+	}
+	plaintext, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	enc, err := p.encryptFor(receipt.Sender, plaintext, bundle)
+	if err != nil {
+		return err
+	}
+	enc.Attrs["count"] = retryCount
+	attrs := waBinary.Attrs{
+		"id":     receipt.ID,
+		"to":     receipt.Sender,
+		"type":   "text",
+		"notify": p.Store.PushName,
+	}
+	if receipt.Chat.Server == types.GroupServer {
+		attrs["to"] = receipt.Chat
+		attrs["participant"] = receipt.Sender
+	}
+	_, err = p.srv.routeMessage(p.JID, &waBinary.Node{
+		Tag:     "message",
+		Attrs:   attrs,
+		Content: []waBinary.Node{*enc},
+	})
+	return err
+}
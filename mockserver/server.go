@@ -0,0 +1,483 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package mockserver contains an in-memory WhatsApp server for testing clients end-to-end without network access.
+//
+// The server speaks the real noise handshake and binary node protocol, answers the info queries that whatsmeow
+// sends while connecting and sending messages, and routes messages and receipts between connected clients and
+// simulated peer devices (see Peer), which have real Signal sessions with the clients.
+//
+// Clients must be configured to use the server's transport and to trust its certificate:
+//
+//	srv, _ := mockserver.New(nil)
+//	defer srv.Close()
+//	device := memstore.New(nil).NewDevice()
+//	_ = srv.LoginDevice(device)
+//	cli := whatsmeow.NewClient(device, nil)
+//	cli.SetTransport(srv.Transport())
+//	cli.ServerCertRootKey = srv.RootKey.Pub
+//	_ = cli.Connect()
+package mockserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/socket"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/store/memstore"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+// Server is an in-memory mock of the WhatsApp web server.
+type Server struct {
+	Log waLog.Logger
+	// RootKey is the key that the server's noise certificate chain is signed with.
+	// Clients must trust it by setting whatsmeow.Client.ServerCertRootKey to RootKey.Pub.
+	RootKey *keys.KeyPair
+	// MediaHosts are the hostnames returned in media_conn queries.
+	MediaHosts []string
+
+	transport *socket.PipeTransport
+	staticKey *keys.KeyPair
+	certChain []byte
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	iqHandlers     map[string]IQHandler
+	iqHandlersLock sync.RWMutex
+
+	lock      sync.Mutex
+	devices   map[types.JID]*deviceKeys
+	conns     map[types.JID]*Conn
+	peers     map[types.JID]*Peer
+	pending   map[types.JID][]waBinary.Node
+	groups    map[types.JID]*types.GroupInfo
+	appState  map[appStateKey][][]byte
+	nextPhone uint64
+	peerStore *memstore.Container
+}
+
+type appStateKey struct {
+	user string
+	name string
+}
+
+// New creates a new mock server with a freshly generated certificate chain.
+func New(log waLog.Logger) (*Server, error) {
+	if log == nil {
+		log = waLog.Noop
+	}
+	srv := &Server{
+		Log:        log,
+		RootKey:    keys.NewKeyPair(),
+		MediaHosts: []string{"mmg.whatsapp.net"},
+
+		transport: socket.NewPipeTransport(),
+		staticKey: keys.NewKeyPair(),
+
+		iqHandlers: make(map[string]IQHandler),
+
+		devices:   make(map[types.JID]*deviceKeys),
+		conns:     make(map[types.JID]*Conn),
+		peers:     make(map[types.JID]*Peer),
+		pending:   make(map[types.JID][]waBinary.Node),
+		groups:    make(map[types.JID]*types.GroupInfo),
+		appState:  make(map[appStateKey][][]byte),
+		nextPhone: 15550000000,
+		peerStore: memstore.New(log.Sub("PeerStore")),
+	}
+	var err error
+	srv.certChain, err = makeCertChain(srv.RootKey, keys.NewKeyPair(), srv.staticKey)
+	if err != nil {
+		return nil, err
+	}
+	srv.addDefaultIQHandlers()
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	go srv.acceptLoop()
+	return srv, nil
+}
+
+// Transport returns the transport that clients should use to connect to this server.
+func (srv *Server) Transport() socket.Transport {
+	return srv.transport
+}
+
+// Close stops accepting connections and disconnects all connected clients.
+func (srv *Server) Close() {
+	srv.cancel()
+	srv.transport.Close()
+	srv.lock.Lock()
+	conns := make([]*Conn, 0, len(srv.conns))
+	for _, conn := range srv.conns {
+		conns = append(conns, conn)
+	}
+	srv.lock.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (srv *Server) acceptLoop() {
+	for {
+		transportConn, err := srv.transport.Accept(srv.ctx)
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(srv.ctx)
+		conn := &Conn{
+			srv:    srv,
+			conn:   transportConn,
+			log:    srv.Log.Sub("Conn"),
+			ctx:    ctx,
+			cancel: cancel,
+		}
+		go func() {
+			<-ctx.Done()
+			_ = transportConn.Close(0)
+		}()
+		go conn.serve()
+	}
+}
+
+func (srv *Server) newUser() string {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.nextPhone++
+	return strconv.FormatUint(srv.nextPhone, 10)
+}
+
+// LoginDevice registers the given device on the server, so that a client using it can connect without pairing.
+//
+// If the device doesn't have a JID yet, it's assigned a new phone number (as device 1), and the device is saved.
+// To log in multiple devices of the same user, set the ID of the device before calling this.
+func (srv *Server) LoginDevice(device *store.Device) error {
+	if device.ID == nil {
+		jid := types.NewADJID(srv.newUser(), 0, 1)
+		device.ID = &jid
+	}
+	if device.Account == nil {
+		device.Account = &waAdv.ADVSignedDeviceIdentity{}
+	}
+	if err := device.Save(); err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	srv.lock.Lock()
+	srv.devices[*device.ID] = &deviceKeys{
+		registrationID: device.RegistrationID,
+		identity:       *device.IdentityKey.Pub,
+		signedPreKey:   device.SignedPreKey,
+	}
+	srv.lock.Unlock()
+	return nil
+}
+
+func (srv *Server) isKnownDevice(jid types.JID) bool {
+	srv.lock.Lock()
+	_, ok := srv.devices[jid]
+	srv.lock.Unlock()
+	return ok
+}
+
+// GetDevices returns all known devices of the given user.
+func (srv *Server) GetDevices(user types.JID) []types.JID {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.getDevices(user)
+}
+
+func (srv *Server) getDevices(user types.JID) []types.JID {
+	var devices []types.JID
+	for jid := range srv.devices {
+		if jid.User == user.User && jid.Server == user.Server {
+			devices = append(devices, jid)
+		}
+	}
+	slices.SortFunc(devices, func(a, b types.JID) int {
+		return int(a.Device) - int(b.Device)
+	})
+	return devices
+}
+
+// GetConn returns the current connection of the given device, or nil if it's not connected.
+func (srv *Server) GetConn(device types.JID) *Conn {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.conns[device]
+}
+
+// AddGroup creates a new group with the given participants. The first participant is the creator and superadmin.
+func (srv *Server) AddGroup(name string, participants ...types.JID) types.JID {
+	now := time.Now()
+	group := &types.GroupInfo{
+		JID:          types.NewJID(srv.newUser()+"-"+strconv.FormatInt(now.Unix(), 10), types.GroupServer),
+		GroupName:    types.GroupName{Name: name, NameSetAt: now},
+		GroupCreated: now,
+	}
+	for i, participant := range participants {
+		group.Participants = append(group.Participants, types.GroupParticipant{
+			JID:          participant.ToNonAD(),
+			IsAdmin:      i == 0,
+			IsSuperAdmin: i == 0,
+		})
+	}
+	if len(participants) > 0 {
+		group.OwnerJID = participants[0].ToNonAD()
+		group.NameSetBy = group.OwnerJID
+	}
+	srv.lock.Lock()
+	srv.groups[group.JID] = group
+	srv.lock.Unlock()
+	return group.JID
+}
+
+func (srv *Server) getGroupParticipants(jid types.JID) ([]types.JID, bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	group, ok := srv.groups[jid]
+	if !ok {
+		return nil, false
+	}
+	participants := make([]types.JID, len(group.Participants))
+	for i, participant := range group.Participants {
+		participants[i] = participant.JID
+	}
+	return participants, true
+}
+
+func (srv *Server) addConn(conn *Conn) []waBinary.Node {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if existing, ok := srv.conns[conn.JID]; ok {
+		go existing.Close()
+	}
+	srv.conns[conn.JID] = conn
+	pending := srv.pending[conn.JID]
+	delete(srv.pending, conn.JID)
+	return pending
+}
+
+func (srv *Server) removeConn(conn *Conn) {
+	srv.lock.Lock()
+	if srv.conns[conn.JID] == conn {
+		delete(srv.conns, conn.JID)
+	}
+	srv.lock.Unlock()
+}
+
+// deliver sends the given node to a device. If the device is a client that isn't connected,
+// the node is queued and sent when the client connects next.
+func (srv *Server) deliver(to types.JID, node waBinary.Node) {
+	srv.lock.Lock()
+	conn, isConnected := srv.conns[to]
+	peer, isPeer := srv.peers[to]
+	if !isConnected && !isPeer {
+		srv.pending[to] = append(srv.pending[to], node)
+	}
+	srv.lock.Unlock()
+	if isConnected {
+		if err := conn.SendNode(node); err != nil {
+			srv.Log.Warnf("Failed to deliver %s to %s: %v", node.Tag, to, err)
+		}
+	} else if isPeer {
+		go peer.handleNode(&node)
+	}
+}
+
+func (srv *Server) handleNode(conn *Conn, node *waBinary.Node) {
+	switch node.Tag {
+	case "iq":
+		srv.handleIQ(conn, node)
+	case "message":
+		phash, err := srv.routeMessage(conn.JID, node)
+		ack := waBinary.Node{
+			Tag: "ack",
+			Attrs: waBinary.Attrs{
+				"class": "message",
+				"id":    node.Attrs["id"],
+				"t":     time.Now().Unix(),
+			},
+		}
+		if err != nil {
+			srv.Log.Warnf("Failed to route message from %s: %v", conn.JID, err)
+			ack.Attrs["error"] = 479
+		} else if phash != "" && phash != node.Attrs["phash"] {
+			// Like the real server, tell the client if it didn't encrypt the message for the right devices
+			ack.Attrs["phash"] = phash
+		}
+		_ = conn.SendNode(ack)
+	case "receipt":
+		srv.routeReceipt(conn.JID, node)
+		attrs := waBinary.Attrs{
+			"class": "receipt",
+			"id":    node.Attrs["id"],
+		}
+		if receiptType, ok := node.Attrs["type"]; ok {
+			attrs["type"] = receiptType
+		}
+		_ = conn.SendNode(waBinary.Node{Tag: "ack", Attrs: attrs})
+	case "ack", "presence", "chatstate":
+		// Nothing to do
+	default:
+		srv.Log.Debugf("Ignoring unsupported %s node from %s", node.Tag, conn.JID)
+	}
+}
+
+// routeMessage delivers a message sent by the given device to all recipient devices.
+// routeMessage delivers a message sent by the given device to all the recipient devices.
+// For group messages, it also returns the participant list hash of the devices that the message should have
+// been encrypted for.
+func (srv *Server) routeMessage(from types.JID, node *waBinary.Node) (phash string, err error) {
+	ag := node.AttrGetter()
+	to := ag.JID("to")
+	id := ag.String("id")
+	if !ag.OK() {
+		return "", ag.Error()
+	}
+	deviceContent := make(map[types.JID][]waBinary.Node)
+	var sharedContent []waBinary.Node
+	for _, child := range node.GetChildren() {
+		switch child.Tag {
+		case "participants":
+			for _, toNode := range child.GetChildren() {
+				jid, ok := toNode.Attrs["jid"].(types.JID)
+				if toNode.Tag == "to" && ok {
+					deviceContent[jid] = append(deviceContent[jid], toNode.GetChildren()...)
+				}
+			}
+		case "enc", "device-identity":
+			sharedContent = append(sharedContent, child)
+		}
+	}
+	if len(deviceContent) == 0 && to.Server == types.DefaultUserServer {
+		// Retried messages are sent directly to the requesting device without a participants list
+		deviceContent[to] = nil
+	}
+	baseAttrs := waBinary.Attrs{
+		"id": id,
+		"t":  time.Now().Unix(),
+	}
+	for _, key := range []string{"type", "edit", "category", "notify"} {
+		if val, ok := node.Attrs[key]; ok {
+			baseAttrs[key] = val
+		}
+	}
+	var recipients []types.JID
+	switch to.Server {
+	case types.GroupServer:
+		participants, ok := srv.getGroupParticipants(to)
+		if !ok {
+			return "", fmt.Errorf("group %s not found", to)
+		}
+		baseAttrs["from"] = to
+		baseAttrs["participant"] = from
+		if retryTo, ok := node.Attrs["participant"].(types.JID); ok {
+			// Retried group messages are only sent to the device that requested the retry
+			recipients = []types.JID{retryTo}
+			break
+		}
+		srv.lock.Lock()
+		for _, participant := range participants {
+			recipients = append(recipients, srv.getDevices(participant)...)
+		}
+		srv.lock.Unlock()
+		phash = participantListHash(recipients)
+	case types.DefaultUserServer:
+		baseAttrs["from"] = from
+		for jid := range deviceContent {
+			recipients = append(recipients, jid)
+		}
+	default:
+		return "", fmt.Errorf("unsupported recipient server %s", to.Server)
+	}
+	for _, recipient := range recipients {
+		if recipient == from {
+			continue
+		}
+		content := append(deviceContent[recipient], sharedContent...)
+		if len(content) == 0 {
+			continue
+		}
+		attrs := make(waBinary.Attrs, len(baseAttrs)+1)
+		copyAttrs(baseAttrs, attrs)
+		if to.Server == types.DefaultUserServer && recipient.User == from.User {
+			attrs["recipient"] = to.ToNonAD()
+		}
+		srv.deliver(recipient, waBinary.Node{
+			Tag:     "message",
+			Attrs:   attrs,
+			Content: content,
+		})
+	}
+	return phash, nil
+}
+
+// participantListHash calculates the hash of a device list in the same way as clients do.
+func participantListHash(devices []types.JID) string {
+	strs := make([]string, len(devices))
+	for i, jid := range devices {
+		strs[i] = jid.ADString()
+	}
+	slices.Sort(strs)
+	hash := sha256.Sum256([]byte(strings.Join(strs, "")))
+	return "2:" + base64.RawStdEncoding.EncodeToString(hash[:6])
+}
+
+// routeReceipt delivers a receipt sent by the given device to the devices of the original message sender.
+func (srv *Server) routeReceipt(from types.JID, node *waBinary.Node) {
+	ag := node.AttrGetter()
+	to := ag.JID("to")
+	participant := ag.OptionalJIDOrEmpty("participant")
+	if !ag.OK() {
+		srv.Log.Warnf("Invalid receipt from %s: %v", from, ag.Error())
+		return
+	}
+	attrs := waBinary.Attrs{
+		"id": node.Attrs["id"],
+		"t":  time.Now().Unix(),
+	}
+	if receiptType, ok := node.Attrs["type"]; ok {
+		attrs["type"] = receiptType
+	}
+	target := to
+	if to.Server == types.GroupServer {
+		attrs["from"] = to
+		attrs["participant"] = from
+		target = participant
+	} else {
+		attrs["from"] = from
+	}
+	var recipients []types.JID
+	if target.Device != 0 || srv.isKnownDevice(target) {
+		recipients = []types.JID{target}
+	} else {
+		recipients = srv.GetDevices(target)
+	}
+	for _, recipient := range recipients {
+		srv.deliver(recipient, waBinary.Node{
+			Tag:     "receipt",
+			Attrs:   attrs,
+			Content: node.Content,
+		})
+	}
+}
+
+func copyAttrs(from, to waBinary.Attrs) {
+	for k, v := range from {
+		to[k] = v
+	}
+}
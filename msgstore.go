@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/proto/waHistorySync"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// isStorableMessage checks if the message has any content other than
+// the protocol-level parts that are handled internally (sender keys and message secrets).
+func isStorableMessage(msg *waE2E.Message) bool {
+	if msg == nil || msg.GetProtocolMessage() != nil {
+		return false
+	} else if msg.SenderKeyDistributionMessage == nil && msg.MessageContextInfo == nil {
+		return proto.Size(msg) > 0
+	}
+	clone := proto.Clone(msg).(*waE2E.Message)
+	clone.SenderKeyDistributionMessage = nil
+	clone.MessageContextInfo = nil
+	return proto.Size(clone) > 0
+}
+
+// storeMessage saves the given message in the message store, or applies it to
+// an existing message if it's an edit or a revoke.
+func (cli *Client) storeMessage(info *types.MessageInfo, rawMsg *waE2E.Message) {
+	if cli.Store.Messages == nil {
+		return
+	}
+	evt := (&events.Message{Info: *info, RawMessage: rawMsg}).UnwrapRaw()
+	protoMsg := evt.Message.GetProtocolMessage()
+	var err error
+	switch {
+	case protoMsg.GetType() == waE2E.ProtocolMessage_REVOKE:
+		err = cli.Store.Messages.MarkMessageDeleted(info.Chat, protoMsg.GetKey().GetID())
+	case protoMsg.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT:
+		err = cli.Store.Messages.MarkMessageEdited(info.Chat, protoMsg.GetKey().GetID(), protoMsg.GetEditedMessage(), info.Timestamp)
+	case isStorableMessage(evt.Message):
+		err = cli.Store.Messages.PutMessage(&store.StoredMessage{
+			Chat:      info.Chat,
+			Sender:    info.Sender,
+			ID:        info.ID,
+			IsFromMe:  info.IsFromMe,
+			Timestamp: info.Timestamp,
+			Message:   rawMsg,
+		})
+	default:
+		return
+	}
+	if err != nil {
+		cli.Log.Errorf("Failed to store message %s from %s in message store: %v", info.ID, info.SourceString(), err)
+	}
+}
+
+func (cli *Client) storeHistoricalMessages(conversations []*waHistorySync.Conversation) {
+	if cli.Store.Messages == nil {
+		return
+	}
+	var messages []*store.StoredMessage
+	for _, conv := range conversations {
+		chatJID, _ := types.ParseJID(conv.GetID())
+		if chatJID.IsEmpty() {
+			continue
+		}
+		for _, histMsg := range conv.GetMessages() {
+			evt, err := cli.ParseWebMessage(chatJID, histMsg.GetMessage())
+			// ParseWebMessage replaces edits with the new content, so check the unwrapped raw message instead
+			if err != nil || !isStorableMessage((&events.Message{RawMessage: evt.RawMessage}).UnwrapRaw().Message) {
+				continue
+			}
+			messages = append(messages, &store.StoredMessage{
+				Chat:      evt.Info.Chat,
+				Sender:    evt.Info.Sender,
+				ID:        evt.Info.ID,
+				IsFromMe:  evt.Info.IsFromMe,
+				Timestamp: evt.Info.Timestamp,
+				Message:   evt.RawMessage,
+			})
+		}
+	}
+	if len(messages) > 0 {
+		err := cli.Store.Messages.PutMessages(messages)
+		if err != nil {
+			cli.Log.Errorf("Failed to store messages from history sync: %v", err)
+		} else {
+			cli.Log.Debugf("Stored %d messages from history sync", len(messages))
+		}
+	}
+}
+
+func (cli *Client) getStoredMessageForRetry(chat types.JID, id types.MessageID) *waE2E.Message {
+	if cli.Store.Messages == nil {
+		return nil
+	}
+	msg, err := cli.Store.Messages.GetMessage(chat, id)
+	if err != nil {
+		cli.Log.Warnf("Failed to get message %s in %s from message store for retry: %v", id, chat, err)
+		return nil
+	} else if msg == nil || !msg.IsFromMe {
+		return nil
+	}
+	return msg.Message
+}
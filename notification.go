@@ -99,7 +99,7 @@ func (cli *Client) handleDeviceNotification(node *waBinary.Node) {
 	defer cli.userDevicesCacheLock.Unlock()
 	ag := node.AttrGetter()
 	from := ag.JID("from")
-	cached, ok := cli.userDevicesCache[from]
+	cached, ok := cli.getCachedDevices(from)
 	if !ok {
 		cli.Log.Debugf("No device list cached for %s, ignoring device list notification", from)
 		return
@@ -129,10 +129,10 @@ func (cli *Client) handleDeviceNotification(node *waBinary.Node) {
 		newParticipantHash := participantListHashV2(cached.devices)
 		if newParticipantHash == deviceHash {
 			cli.Log.Debugf("%s's device list hash changed from %s to %s (%s). New hash matches", from, cachedParticipantHash, deviceHash, child.Tag)
-			cli.userDevicesCache[from] = cached
+			cli.putCachedDevices(from, deviceCache{devices: cached.devices, dhash: deviceHash})
 		} else {
 			cli.Log.Warnf("%s's device list hash changed from %s to %s (%s). New hash doesn't match (%s)", from, cachedParticipantHash, deviceHash, child.Tag, newParticipantHash)
-			delete(cli.userDevicesCache, from)
+			cli.deleteCachedDevices(from)
 		}
 	}
 }
@@ -142,7 +142,7 @@ func (cli *Client) handleFBDeviceNotification(node *waBinary.Node) {
 	defer cli.userDevicesCacheLock.Unlock()
 	jid := node.AttrGetter().JID("from")
 	userDevices := parseFBDeviceList(jid, node.GetChildByTag("devices"))
-	cli.userDevicesCache[jid] = userDevices
+	cli.putCachedDevices(jid, userDevices)
 }
 
 func (cli *Client) handleOwnDevicesNotification(node *waBinary.Node) {
@@ -153,7 +153,7 @@ func (cli *Client) handleOwnDevicesNotification(node *waBinary.Node) {
 		cli.Log.Debugf("Ignoring own device change notification, session was deleted")
 		return
 	}
-	cached, ok := cli.userDevicesCache[ownID]
+	cached, ok := cli.getCachedDevices(ownID)
 	if !ok {
 		cli.Log.Debugf("Ignoring own device change notification, device list not cached")
 		return
@@ -170,10 +170,10 @@ func (cli *Client) handleOwnDevicesNotification(node *waBinary.Node) {
 	newHash := participantListHashV2(newDeviceList)
 	if newHash != expectedNewHash {
 		cli.Log.Debugf("Received own device list change notification %s -> %s, but expected hash was %s", oldHash, newHash, expectedNewHash)
-		delete(cli.userDevicesCache, ownID)
+		cli.deleteCachedDevices(ownID)
 	} else {
 		cli.Log.Debugf("Received own device list change notification %s -> %s", oldHash, newHash)
-		cli.userDevicesCache[ownID] = deviceCache{devices: newDeviceList, dhash: expectedNewHash}
+		cli.putCachedDevices(ownID, deviceCache{devices: newDeviceList, dhash: expectedNewHash})
 	}
 }
 
@@ -0,0 +1,297 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+const (
+	outboxMinBackoff      = 2 * time.Second
+	outboxMaxBackoff      = 5 * time.Minute
+	outboxStoreErrorDelay = 30 * time.Second
+)
+
+// DefaultOutboxBackoff is the retry delay used for outbox messages if Client.OutboxBackoff is nil.
+// It starts at 2 seconds and doubles after every failed attempt up to 5 minutes.
+func DefaultOutboxBackoff(attempts int) time.Duration {
+	backoff := outboxMinBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outboxMaxBackoff)
+}
+
+func (cli *Client) getOutboxBackoff(attempts int) time.Duration {
+	if cli.OutboxBackoff != nil {
+		return cli.OutboxBackoff(attempts)
+	}
+	return DefaultOutboxBackoff(attempts)
+}
+
+// isTransientSendError returns true if sending a message failed in a way that's likely to succeed if retried.
+func isTransientSendError(err error) bool {
+	var disconnectedErr *DisconnectedError
+	var serverErr *serverReturnedError
+	var iqErr *IQError
+	switch {
+	case errors.Is(err, ErrNotConnected), errors.Is(err, ErrIQTimedOut), errors.Is(err, ErrMessageTimedOut),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrRateLimited), errors.As(err, &disconnectedErr):
+		return true
+	case errors.As(err, &serverErr):
+		return serverErr.Code >= 500
+	case errors.As(err, &iqErr):
+		return iqErr.Code >= 500
+	default:
+		return false
+	}
+}
+
+// EnqueueMessage stores a message in the outbox (Store.Outbox) and returns immediately with the message ID.
+//
+// Messages in the outbox are sent in the background whenever the client is connected. Messages to the same chat
+// are sent in the order they were queued. If sending fails with a transient error, like the websocket disconnecting,
+// the server returning a 5xx error or the rate limiter rejecting the message, the message is retried with a backoff
+// (see OutboxBackoff and OutboxMaxAttempts). Messages that haven't been sent yet stay in the store, so they're sent
+// after the client is restarted and connects.
+//
+// Progress is reported with events.OutboxMessageState events.
+func (cli *Client) EnqueueMessage(to types.JID, message *waE2E.Message) (types.MessageID, error) {
+	if cli == nil {
+		return "", ErrClientIsNil
+	} else if cli.Store.Outbox == nil {
+		return "", ErrNoOutboxStore
+	} else if to.Device > 0 && !to.IsBot() {
+		return "", ErrRecipientADJID
+	}
+	msg := &store.OutboxMessage{
+		Chat:     to.ToNonAD(),
+		ID:       cli.GenerateMessageID(),
+		Message:  message,
+		QueuedAt: cli.nextOutboxQueueTime(),
+	}
+	err := cli.Store.Outbox.PutOutboxMessage(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to store message in outbox: %w", err)
+	}
+	cli.dispatchEvent(&events.OutboxMessageState{Chat: msg.Chat, ID: msg.ID, State: events.OutboxQueued})
+	cli.wakeOutbox()
+	return msg.ID, nil
+}
+
+// GetOutboxMessages returns all messages in the outbox that haven't been sent yet.
+func (cli *Client) GetOutboxMessages() ([]*store.OutboxMessage, error) {
+	if cli == nil {
+		return nil, ErrClientIsNil
+	} else if cli.Store.Outbox == nil {
+		return nil, ErrNoOutboxStore
+	}
+	return cli.Store.Outbox.GetOutboxMessages()
+}
+
+// CancelOutboxMessage removes a message from the outbox. Messages that are already being sent can't be cancelled.
+func (cli *Client) CancelOutboxMessage(chat types.JID, id types.MessageID) error {
+	if cli == nil {
+		return ErrClientIsNil
+	} else if cli.Store.Outbox == nil {
+		return ErrNoOutboxStore
+	}
+	return cli.Store.Outbox.DeleteOutboxMessage(chat, id)
+}
+
+// nextOutboxQueueTime returns the current time, but always later than the previous call,
+// so that messages queued in quick succession are sorted correctly.
+func (cli *Client) nextOutboxQueueTime() time.Time {
+	cli.outboxLock.Lock()
+	defer cli.outboxLock.Unlock()
+	now := time.Now()
+	if !now.After(cli.outboxLastQueued) {
+		now = cli.outboxLastQueued.Add(time.Nanosecond)
+	}
+	cli.outboxLastQueued = now
+	return now
+}
+
+// wakeOutbox starts the outbox loop, or tells it to check the outbox again if it's already running.
+func (cli *Client) wakeOutbox() {
+	if cli.Store.Outbox == nil {
+		return
+	}
+	if cli.outboxRunning.CompareAndSwap(false, true) {
+		go cli.runOutbox()
+	} else {
+		select {
+		case cli.outboxWakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (cli *Client) waitOutbox(until time.Time) {
+	var timer <-chan time.Time
+	if !until.IsZero() {
+		t := time.NewTimer(time.Until(until))
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-cli.outboxWakeup:
+	case <-timer:
+	}
+}
+
+// outboxContext returns a context that's cancelled when the current connection is closed,
+// so that sends waiting for the rate limiter are interrupted by Disconnect. It returns nil if not connected.
+func (cli *Client) outboxContext() context.Context {
+	cli.socketLock.RLock()
+	defer cli.socketLock.RUnlock()
+	if cli.socket == nil || !cli.socket.IsConnected() || !cli.IsLoggedIn() {
+		return nil
+	}
+	return cli.socket.Context()
+}
+
+// runOutbox sends messages from the outbox until it's empty or the client disconnects.
+func (cli *Client) runOutbox() {
+	for {
+		var ctx context.Context
+		msgs, err := cli.Store.Outbox.GetOutboxMessages()
+		if err != nil {
+			cli.Log.Errorf("Failed to get messages in outbox: %v", err)
+			cli.waitOutbox(time.Now().Add(outboxStoreErrorDelay))
+			continue
+		} else if ctx = cli.outboxContext(); len(msgs) == 0 || ctx == nil {
+			// The outbox is woken up again when a message is queued or the client connects
+			if cli.stopOutbox() {
+				return
+			}
+			continue
+		}
+		nextAttempt, progressed := cli.processOutbox(ctx, msgs)
+		// A zero next attempt time without progress means the client disconnected while processing the outbox
+		if !progressed && !nextAttempt.IsZero() {
+			cli.waitOutbox(nextAttempt)
+		}
+	}
+}
+
+// stopOutbox marks the outbox loop as stopped. It returns false if the loop should keep running,
+// because the outbox was woken up before the loop was marked as stopped.
+func (cli *Client) stopOutbox() bool {
+	cli.outboxRunning.Store(false)
+	// If a message was queued or the client connected after the outbox was read, but before the loop was marked
+	// as stopped, the wakeup signal was sent to this loop instead of starting a new one.
+	select {
+	case <-cli.outboxWakeup:
+		return !cli.outboxRunning.CompareAndSwap(false, true)
+	default:
+		return true
+	}
+}
+
+// processOutbox tries to send the first message of each chat in the outbox. It returns the earliest time when
+// a message should be retried, and whether any message was sent or removed from the outbox.
+func (cli *Client) processOutbox(ctx context.Context, msgs []*store.OutboxMessage) (nextAttempt time.Time, progressed bool) {
+	blockedChats := make(map[types.JID]struct{})
+	for _, msg := range msgs {
+		if _, blocked := blockedChats[msg.Chat]; blocked {
+			continue
+		} else if ctx.Err() != nil || !cli.IsConnected() || !cli.IsLoggedIn() {
+			return
+		}
+		if msg.NextAttempt.After(time.Now()) || !cli.sendOutboxMessage(ctx, msg) {
+			blockedChats[msg.Chat] = struct{}{}
+			if nextAttempt.IsZero() || msg.NextAttempt.Before(nextAttempt) {
+				nextAttempt = msg.NextAttempt
+			}
+		} else {
+			progressed = true
+		}
+	}
+	return
+}
+
+// sendOutboxMessage makes a single attempt to send a message from the outbox. It returns false if the message
+// should be retried later, and true if it was removed from the outbox.
+func (cli *Client) sendOutboxMessage(ctx context.Context, msg *store.OutboxMessage) bool {
+	log := waLog.With(cli.Log, waLog.FieldChat, msg.Chat, waLog.FieldMessageID, msg.ID)
+	cli.dispatchEvent(&events.OutboxMessageState{Chat: msg.Chat, ID: msg.ID, State: events.OutboxSending, Attempts: msg.Attempts})
+	resp, err := cli.SendMessage(ctx, msg.Chat, msg.Message, SendRequestExtra{ID: msg.ID})
+	if err == nil {
+		cli.deleteOutboxMessage(log, msg)
+		cli.dispatchEvent(&events.OutboxMessageState{
+			Chat:      msg.Chat,
+			ID:        msg.ID,
+			State:     events.OutboxSent,
+			Attempts:  msg.Attempts,
+			Timestamp: resp.Timestamp,
+		})
+		return true
+	} else if ctx.Err() != nil {
+		// The connection was closed while sending, the message is retried after reconnecting
+		log.Debugf("Sending %s from outbox was interrupted: %v", msg.ID, err)
+		return false
+	}
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		// The local rate limiter stopped the message before it was sent, so it doesn't count as an attempt
+		msg.NextAttempt = time.Now().Add(rateLimitErr.RetryAfter)
+		msg.LastError = err.Error()
+		log.Debugf("Sending %s from outbox was rate limited, retrying at %s", msg.ID, msg.NextAttempt)
+		cli.updateOutboxMessage(log, msg, err)
+		return false
+	}
+	msg.Attempts++
+	msg.LastError = err.Error()
+	if !isTransientSendError(err) || (cli.OutboxMaxAttempts > 0 && msg.Attempts >= cli.OutboxMaxAttempts) {
+		log.Warnf("Giving up on sending %s from outbox after %d attempts: %v", msg.ID, msg.Attempts, err)
+		cli.deleteOutboxMessage(log, msg)
+		cli.dispatchEvent(&events.OutboxMessageState{
+			Chat:     msg.Chat,
+			ID:       msg.ID,
+			State:    events.OutboxFailed,
+			Attempts: msg.Attempts,
+			Error:    err,
+		})
+		return true
+	}
+	msg.NextAttempt = time.Now().Add(cli.getOutboxBackoff(msg.Attempts))
+	log.Debugf("Failed to send %s from outbox (attempt #%d), retrying at %s: %v", msg.ID, msg.Attempts, msg.NextAttempt, err)
+	cli.updateOutboxMessage(log, msg, err)
+	return false
+}
+
+// updateOutboxMessage stores the next attempt of a message that failed to send and reports it as retrying.
+func (cli *Client) updateOutboxMessage(log waLog.Logger, msg *store.OutboxMessage, err error) {
+	if storeErr := cli.Store.Outbox.PutOutboxMessage(msg); storeErr != nil {
+		log.Errorf("Failed to update %s in outbox: %v", msg.ID, storeErr)
+	}
+	cli.dispatchEvent(&events.OutboxMessageState{
+		Chat:        msg.Chat,
+		ID:          msg.ID,
+		State:       events.OutboxRetrying,
+		Attempts:    msg.Attempts,
+		NextAttempt: msg.NextAttempt,
+		Error:       err,
+	})
+}
+
+func (cli *Client) deleteOutboxMessage(log waLog.Logger, msg *store.OutboxMessage) {
+	err := cli.Store.Outbox.DeleteOutboxMessage(msg.Chat, msg.ID)
+	if err != nil {
+		log.Errorf("Failed to remove %s from outbox: %v", msg.ID, err)
+	}
+}
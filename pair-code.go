@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
@@ -87,6 +88,11 @@ func generateCompanionEphemeralKey() (ephemeralKeyPair *keys.KeyPair, ephemeralK
 //
 // See https://faq.whatsapp.com/1324084875126592 for more info
 func (cli *Client) PairPhone(phone string, showPushNotification bool, clientType PairClientType, clientDisplayName string) (string, error) {
+	return cli.PairPhoneContext(context.TODO(), phone, showPushNotification, clientType, clientDisplayName)
+}
+
+// PairPhoneContext is like PairPhone, but takes a context for cancellation and deadlines.
+func (cli *Client) PairPhoneContext(ctx context.Context, phone string, showPushNotification bool, clientType PairClientType, clientDisplayName string) (string, error) {
 	if cli == nil {
 		return "", ErrClientIsNil
 	}
@@ -99,6 +105,7 @@ func (cli *Client) PairPhone(phone string, showPushNotification bool, clientType
 	}
 	jid := types.NewJID(phone, types.DefaultUserServer)
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "md",
 		Type:      iqSet,
 		To:        types.ServerJID,
@@ -19,6 +19,7 @@ import (
 
 	waBinary "github.com/shiestapoi/whatsmeow/binary"
 	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
 	"github.com/shiestapoi/whatsmeow/util/keys"
 )
 
@@ -29,6 +30,17 @@ const (
 	MinPreKeyCount = 5
 )
 
+var (
+	// SignedPreKeyRotationInterval specifies how old the signed prekey can get before it's replaced with a new one.
+	// Setting this to zero disables rotation.
+	SignedPreKeyRotationInterval = 30 * 24 * time.Hour
+	// SignedPreKeyGracePeriod specifies how long the previous signed prekey is kept after rotating,
+	// so that messages encrypted using the old key can still be decrypted.
+	SignedPreKeyGracePeriod = 14 * 24 * time.Hour
+	// SignedPreKeyRotationCheckInterval specifies how often the client checks whether the signed prekey needs to be rotated.
+	SignedPreKeyRotationCheckInterval = 1 * time.Hour
+)
+
 func (cli *Client) getServerPreKeyCount() (int, error) {
 	resp, err := cli.sendIQ(infoQuery{
 		Namespace: "encrypt",
@@ -57,13 +69,22 @@ func (cli *Client) uploadPreKeys() {
 			return
 		}
 	}
+	err := cli.uploadPreKeysWithSignedPreKey()
+	if err != nil {
+		cli.Log.Errorf("Prekey upload failed: %v", err)
+	}
+}
+
+// uploadPreKeysWithSignedPreKey uploads a batch of prekeys along with the current signed prekey.
+// The caller must hold uploadPreKeysLock.
+func (cli *Client) uploadPreKeysWithSignedPreKey() error {
 	var registrationIDBytes [4]byte
 	binary.BigEndian.PutUint32(registrationIDBytes[:], cli.Store.RegistrationID)
 	preKeys, err := cli.Store.PreKeys.GetOrGenPreKeys(WantedPreKeyCount)
 	if err != nil {
-		cli.Log.Errorf("Failed to get prekeys to upload: %v", err)
-		return
+		return fmt.Errorf("failed to get prekeys to upload: %w", err)
 	}
+	signedPreKey, _, _ := cli.Store.GetSignedPreKeys()
 	cli.Log.Infof("Uploading %d new prekeys to server", len(preKeys))
 	_, err = cli.sendIQ(infoQuery{
 		Namespace: "encrypt",
@@ -74,12 +95,11 @@ func (cli *Client) uploadPreKeys() {
 			{Tag: "type", Content: []byte{ecc.DjbType}},
 			{Tag: "identity", Content: cli.Store.IdentityKey.Pub[:]},
 			{Tag: "list", Content: preKeysToNodes(preKeys)},
-			preKeyToNode(cli.Store.SignedPreKey),
+			preKeyToNode(signedPreKey),
 		},
 	})
 	if err != nil {
-		cli.Log.Errorf("Failed to send request to upload prekeys: %v", err)
-		return
+		return fmt.Errorf("failed to send request to upload prekeys: %w", err)
 	}
 	cli.Log.Debugf("Got response to uploading prekeys")
 	err = cli.Store.PreKeys.MarkPreKeysAsUploaded(preKeys[len(preKeys)-1].KeyID)
@@ -87,6 +107,96 @@ func (cli *Client) uploadPreKeys() {
 		cli.Log.Warnf("Failed to mark prekeys as uploaded: %v", err)
 	}
 	cli.lastPreKeyUpload = time.Now()
+	cli.signedPreKeyUploadPending = false
+	return nil
+}
+
+func (cli *Client) signedPreKeyRotationLoop(ctx context.Context) {
+	if SignedPreKeyRotationInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(SignedPreKeyRotationCheckInterval)
+	defer ticker.Stop()
+	for {
+		cli.rotateSignedPreKeyIfNeeded()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rotateSignedPreKeyIfNeeded replaces the signed prekey if it's older than SignedPreKeyRotationInterval,
+// and forgets the previous signed prekey once SignedPreKeyGracePeriod has passed since the last rotation.
+//
+// If uploading a rotated key fails, the new key is kept and the upload is retried on the next check,
+// as the server may have accepted the key even if the request timed out.
+func (cli *Client) rotateSignedPreKeyIfNeeded() {
+	if SignedPreKeyRotationInterval <= 0 || !cli.IsLoggedIn() {
+		return
+	}
+	// The event is dispatched after releasing the lock, as event handlers may trigger prekey uploads
+	if evt := cli.rotateSignedPreKey(); evt != nil {
+		cli.dispatchEvent(evt)
+	}
+}
+
+func (cli *Client) rotateSignedPreKey() *events.SignedPreKeyRotated {
+	cli.uploadPreKeysLock.Lock()
+	defer cli.uploadPreKeysLock.Unlock()
+	device := cli.Store
+	if cli.signedPreKeyUploadPending {
+		return cli.retrySignedPreKeyUpload()
+	}
+	_, prevKey, createdAt := device.GetSignedPreKeys()
+	keyAge := time.Since(createdAt)
+	if prevKey != nil && keyAge > SignedPreKeyGracePeriod {
+		cli.Log.Debugf("Forgetting previous signed prekey %d as the grace period has passed", prevKey.KeyID)
+		device.ForgetPreviousSignedPreKey()
+		err := device.Save()
+		if err != nil {
+			cli.Log.Warnf("Failed to save device after removing previous signed prekey: %v", err)
+		}
+	}
+	if !createdAt.IsZero() && keyAge < SignedPreKeyRotationInterval {
+		return nil
+	}
+	newKey := device.RotateSignedPreKey()
+	_, oldKey, _ := device.GetSignedPreKeys()
+	cli.Log.Infof("Rotating signed prekey %d -> %d", oldKey.KeyID, newKey.KeyID)
+	// Save the new key before uploading, so that messages encrypted with it can always be decrypted.
+	// If saving fails, the new key stays in memory and is uploaded anyway, as it's still usable until restart.
+	err := device.Save()
+	if err != nil {
+		cli.Log.Errorf("Failed to save rotated signed prekey: %v", err)
+	}
+	err = cli.uploadPreKeysWithSignedPreKey()
+	if err != nil {
+		cli.Log.Errorf("Failed to upload rotated signed prekey, will retry later: %v", err)
+		cli.signedPreKeyUploadPending = true
+		return nil
+	}
+	return &events.SignedPreKeyRotated{
+		KeyID:         newKey.KeyID,
+		PreviousKeyID: oldKey.KeyID,
+	}
+}
+
+// retrySignedPreKeyUpload retries uploading a rotated signed prekey after a failed upload.
+// The caller must hold uploadPreKeysLock and dispatch the returned event after releasing it.
+func (cli *Client) retrySignedPreKeyUpload() *events.SignedPreKeyRotated {
+	key, prevKey, _ := cli.Store.GetSignedPreKeys()
+	err := cli.uploadPreKeysWithSignedPreKey()
+	if err != nil {
+		cli.Log.Errorf("Failed to retry uploading rotated signed prekey: %v", err)
+		return nil
+	}
+	evt := &events.SignedPreKeyRotated{KeyID: key.KeyID}
+	if prevKey != nil {
+		evt.PreviousKeyID = prevKey.KeyID
+	}
+	return evt
 }
 
 type preKeyResp struct {
@@ -7,6 +7,7 @@
 package whatsmeow
 
 import (
+	"context"
 	"strconv"
 	"time"
 
@@ -17,12 +18,18 @@ import (
 
 // TryFetchPrivacySettings will fetch the user's privacy settings, either from the in-memory cache or from the server.
 func (cli *Client) TryFetchPrivacySettings(ignoreCache bool) (*types.PrivacySettings, error) {
+	return cli.TryFetchPrivacySettingsContext(context.TODO(), ignoreCache)
+}
+
+// TryFetchPrivacySettingsContext is like TryFetchPrivacySettings, but takes a context for cancellation and deadlines.
+func (cli *Client) TryFetchPrivacySettingsContext(ctx context.Context, ignoreCache bool) (*types.PrivacySettings, error) {
 	if cli == nil {
 		return nil, ErrClientIsNil
 	} else if val := cli.privacySettingsCache.Load(); val != nil && !ignoreCache {
 		return val.(*types.PrivacySettings), nil
 	}
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "privacy",
 		Type:      iqGet,
 		To:        types.ServerJID,
@@ -44,10 +51,15 @@ func (cli *Client) TryFetchPrivacySettings(ignoreCache bool) (*types.PrivacySett
 // GetPrivacySettings will get the user's privacy settings. If an error occurs while fetching them, the error will be
 // logged, but the method will just return an empty struct.
 func (cli *Client) GetPrivacySettings() (settings types.PrivacySettings) {
+	return cli.GetPrivacySettingsContext(context.TODO())
+}
+
+// GetPrivacySettingsContext is like GetPrivacySettings, but takes a context for cancellation and deadlines.
+func (cli *Client) GetPrivacySettingsContext(ctx context.Context) (settings types.PrivacySettings) {
 	if cli == nil || cli.MessengerConfig != nil {
 		return
 	}
-	settingsPtr, err := cli.TryFetchPrivacySettings(false)
+	settingsPtr, err := cli.TryFetchPrivacySettingsContext(ctx, false)
 	if err != nil {
 		cli.Log.Errorf("Failed to fetch privacy settings: %v", err)
 	} else {
@@ -60,11 +72,17 @@ func (cli *Client) GetPrivacySettings() (settings types.PrivacySettings) {
 // The privacy settings will be fetched from the server after the change and the new settings will be returned.
 // If an error occurs while fetching the new settings, will return an empty struct.
 func (cli *Client) SetPrivacySetting(name types.PrivacySettingType, value types.PrivacySetting) (settings types.PrivacySettings, err error) {
-	settingsPtr, err := cli.TryFetchPrivacySettings(false)
+	return cli.SetPrivacySettingContext(context.TODO(), name, value)
+}
+
+// SetPrivacySettingContext is like SetPrivacySetting, but takes a context for cancellation and deadlines.
+func (cli *Client) SetPrivacySettingContext(ctx context.Context, name types.PrivacySettingType, value types.PrivacySetting) (settings types.PrivacySettings, err error) {
+	settingsPtr, err := cli.TryFetchPrivacySettingsContext(ctx, false)
 	if err != nil {
 		return settings, err
 	}
 	_, err = cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "privacy",
 		Type:      iqSet,
 		To:        types.ServerJID,
@@ -105,7 +123,13 @@ func (cli *Client) SetPrivacySetting(name types.PrivacySettingType, value types.
 
 // SetDefaultDisappearingTimer will set the default disappearing message timer.
 func (cli *Client) SetDefaultDisappearingTimer(timer time.Duration) (err error) {
+	return cli.SetDefaultDisappearingTimerContext(context.TODO(), timer)
+}
+
+// SetDefaultDisappearingTimerContext is like SetDefaultDisappearingTimer, but takes a context for cancellation and deadlines.
+func (cli *Client) SetDefaultDisappearingTimerContext(ctx context.Context, timer time.Duration) (err error) {
 	_, err = cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "disappearing_mode",
 		Type:      iqSet,
 		To:        types.ServerJID,
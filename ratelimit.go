@@ -0,0 +1,298 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+// RateLimitConfig configures the outgoing message rate limiter. Limits that are zero are not enforced.
+// Sends that fail don't count towards the limits.
+type RateLimitConfig struct {
+	// GlobalPerMinute is the maximum number of messages sent to all chats combined in any 60 second window.
+	GlobalPerMinute int
+	// ChatPerMinute is the maximum number of messages sent to a single chat in any 60 second window.
+	ChatPerMinute int
+	// NewChatsPerHour is the maximum number of messages to new chats in any 60 minute window.
+	// A chat is new if there are no messages in it in the message store and nothing has been sent to it
+	// since the rate limiter was configured. If message storage isn't enabled, every chat that nothing has been
+	// sent to since the rate limiter was configured is new.
+	NewChatsPerHour int
+
+	// If Wait is true, sends are delayed until they're within the limits (or the context is cancelled).
+	// Otherwise, sends that would exceed a limit fail immediately with a *RateLimitError.
+	Wait bool
+	// OverLimitPause is how long sending is paused after the server responds with a rate-overlimit error.
+	// Defaults to one minute.
+	OverLimitPause time.Duration
+}
+
+const defaultOverLimitPause = 1 * time.Minute
+
+// RateLimitReason specifies which limit caused a send to be rate limited.
+type RateLimitReason string
+
+const (
+	RateLimitGlobal  RateLimitReason = "global"
+	RateLimitChat    RateLimitReason = "chat"
+	RateLimitNewChat RateLimitReason = "new_chat"
+	// RateLimitPaused means sending is paused because the server returned a rate-overlimit error
+	// or the account is temporarily banned.
+	RateLimitPaused RateLimitReason = "paused"
+)
+
+// ErrRateLimited can be used with errors.Is to check if an error is a *RateLimitError.
+var ErrRateLimited = errors.New("message rate limit exceeded")
+
+// RateLimitError is returned by SendMessage when the rate limiter rejects a message.
+type RateLimitError struct {
+	Reason RateLimitReason
+	// RetryAfter is how long to wait until the message would be within the limits.
+	RetryAfter time.Duration
+}
+
+func (rle *RateLimitError) Error() string {
+	return fmt.Sprintf("%s (%s limit, retry after %s)", ErrRateLimited.Error(), rle.Reason, rle.RetryAfter)
+}
+
+func (rle *RateLimitError) Is(other error) bool {
+	return other == ErrRateLimited
+}
+
+// RateLimitUsage is the current usage of the rate limit budgets.
+type RateLimitUsage struct {
+	Global       int
+	GlobalLimit  int
+	Chat         int
+	ChatLimit    int
+	NewChats     int
+	NewChatLimit int
+	// PausedUntil is set if sending is paused due to a rate-overlimit error or temporary ban.
+	PausedUntil time.Time
+}
+
+type rateLimiter struct {
+	cfg         *RateLimitConfig
+	global      []time.Time
+	chats       map[types.JID][]time.Time
+	newChats    []time.Time
+	knownChats  map[types.JID]struct{}
+	pausedUntil time.Time
+	lock        sync.Mutex
+}
+
+// SetRateLimit configures limits for outgoing messages sent with SendMessage. Pass nil to disable rate limiting.
+//
+// Sending is also paused automatically when an info query fails with a rate-overlimit error or when the account
+// is temporarily banned, even if no limits are configured.
+func (cli *Client) SetRateLimit(cfg *RateLimitConfig) {
+	rl := &cli.rateLimit
+	rl.lock.Lock()
+	rl.cfg = cfg
+	rl.global = nil
+	rl.chats = make(map[types.JID][]time.Time)
+	rl.newChats = nil
+	rl.knownChats = make(map[types.JID]struct{})
+	rl.lock.Unlock()
+}
+
+// GetRateLimitUsage returns the number of messages sent within the current rate limit windows.
+// The per-chat usage is only filled if a chat is given.
+func (cli *Client) GetRateLimitUsage(chat types.JID) RateLimitUsage {
+	rl := &cli.rateLimit
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	now := time.Now()
+	rl.prune(now)
+	usage := RateLimitUsage{
+		Global:   len(rl.global),
+		NewChats: len(rl.newChats),
+	}
+	if !chat.IsEmpty() {
+		usage.Chat = len(rl.chats[chat.ToNonAD()])
+	}
+	if rl.cfg != nil {
+		usage.GlobalLimit = rl.cfg.GlobalPerMinute
+		usage.ChatLimit = rl.cfg.ChatPerMinute
+		usage.NewChatLimit = rl.cfg.NewChatsPerHour
+	}
+	if rl.pausedUntil.After(now) {
+		usage.PausedUntil = rl.pausedUntil
+	}
+	return usage
+}
+
+// pauseRateLimit stops all sends until the given time.
+func (cli *Client) pauseRateLimit(until time.Time) {
+	rl := &cli.rateLimit
+	rl.lock.Lock()
+	if until.After(rl.pausedUntil) {
+		rl.pausedUntil = until
+	}
+	rl.lock.Unlock()
+	cli.Log.Warnf("Pausing outgoing messages until %s", until.Format(time.RFC3339))
+}
+
+func (cli *Client) handleRateOverLimit() {
+	cli.rateLimit.lock.Lock()
+	pause := defaultOverLimitPause
+	if cli.rateLimit.cfg != nil && cli.rateLimit.cfg.OverLimitPause > 0 {
+		pause = cli.rateLimit.cfg.OverLimitPause
+	}
+	cli.rateLimit.lock.Unlock()
+	cli.pauseRateLimit(time.Now().Add(pause))
+}
+
+func pruneWindow(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// prune removes sends that are outside the rate limit windows. The lock must be held.
+func (rl *rateLimiter) prune(now time.Time) {
+	rl.global = pruneWindow(rl.global, now.Add(-time.Minute))
+	rl.newChats = pruneWindow(rl.newChats, now.Add(-time.Hour))
+	for chat, times := range rl.chats {
+		if times = pruneWindow(times, now.Add(-time.Minute)); len(times) == 0 {
+			delete(rl.chats, chat)
+		} else {
+			rl.chats[chat] = times
+		}
+	}
+}
+
+// retryAfter returns how long to wait until another send fits into a window that allows limit sends.
+func retryAfter(times []time.Time, limit int, window time.Duration, now time.Time) time.Duration {
+	if limit <= 0 || len(times) < limit {
+		return 0
+	}
+	return times[len(times)-limit].Add(window).Sub(now)
+}
+
+// rateLimitReservation is a send recorded by the rate limiter, which is refunded if the send fails.
+type rateLimitReservation struct {
+	chat      types.JID
+	at        time.Time
+	newChat   bool
+	knownChat bool
+}
+
+// reserve records a send to the given chat if it's within the limits. Otherwise, it returns an error
+// with the time until the send would be allowed. The reservation is nil if no limits are configured.
+// The lock must be held.
+func (rl *rateLimiter) reserve(chat types.JID, isNewChat bool, now time.Time) (*rateLimitReservation, *RateLimitError) {
+	if rl.pausedUntil.After(now) {
+		return nil, &RateLimitError{Reason: RateLimitPaused, RetryAfter: rl.pausedUntil.Sub(now)}
+	} else if rl.cfg == nil {
+		return nil, nil
+	}
+	rl.prune(now)
+	if wait := retryAfter(rl.global, rl.cfg.GlobalPerMinute, time.Minute, now); wait > 0 {
+		return nil, &RateLimitError{Reason: RateLimitGlobal, RetryAfter: wait}
+	} else if wait = retryAfter(rl.chats[chat], rl.cfg.ChatPerMinute, time.Minute, now); wait > 0 {
+		return nil, &RateLimitError{Reason: RateLimitChat, RetryAfter: wait}
+	} else if wait = retryAfter(rl.newChats, rl.cfg.NewChatsPerHour, time.Hour, now); isNewChat && wait > 0 {
+		return nil, &RateLimitError{Reason: RateLimitNewChat, RetryAfter: wait}
+	}
+	rl.global = append(rl.global, now)
+	rl.chats[chat] = append(rl.chats[chat], now)
+	if isNewChat {
+		rl.newChats = append(rl.newChats, now)
+	}
+	_, known := rl.knownChats[chat]
+	rl.knownChats[chat] = struct{}{}
+	return &rateLimitReservation{chat: chat, at: now, newChat: isNewChat, knownChat: known}, nil
+}
+
+// removeFromWindow removes one send at the given time from the window.
+func removeFromWindow(times []time.Time, at time.Time) []time.Time {
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i].Equal(at) {
+			return append(times[:i], times[i+1:]...)
+		}
+	}
+	return times
+}
+
+// refund removes a reserved send from the windows, so that failed sends don't count towards the limits.
+// The lock must be held.
+func (rl *rateLimiter) refund(res *rateLimitReservation) {
+	rl.global = removeFromWindow(rl.global, res.at)
+	if times := removeFromWindow(rl.chats[res.chat], res.at); len(times) > 0 {
+		rl.chats[res.chat] = times
+	} else {
+		delete(rl.chats, res.chat)
+	}
+	if res.newChat {
+		rl.newChats = removeFromWindow(rl.newChats, res.at)
+	}
+	if !res.knownChat {
+		delete(rl.knownChats, res.chat)
+	}
+}
+
+// refundRateLimit gives back the budget reserved by waitRateLimit after a send fails.
+func (cli *Client) refundRateLimit(res *rateLimitReservation) {
+	if res == nil {
+		return
+	}
+	cli.rateLimit.lock.Lock()
+	cli.rateLimit.refund(res)
+	cli.rateLimit.lock.Unlock()
+}
+
+// isNewChat checks if the chat has any messages in the message store. The rate limiter lock must not be held.
+func (cli *Client) isNewChat(chat types.JID) bool {
+	cli.rateLimit.lock.Lock()
+	_, known := cli.rateLimit.knownChats[chat]
+	limited := cli.rateLimit.cfg != nil && cli.rateLimit.cfg.NewChatsPerHour > 0
+	cli.rateLimit.lock.Unlock()
+	if known || !limited {
+		return false
+	} else if cli.Store.Messages == nil {
+		return true
+	}
+	msgs, err := cli.Store.Messages.GetChatMessages(chat, time.Time{}, "", 1)
+	if err != nil {
+		cli.Log.Warnf("Failed to check if %s is a new chat for rate limiting: %v", chat, err)
+		return false
+	}
+	return len(msgs) == 0
+}
+
+// waitRateLimit reserves a send to the given chat, waiting for the limits if the rate limiter is configured to wait.
+// The returned reservation should be passed to refundRateLimit if the send fails.
+func (cli *Client) waitRateLimit(ctx context.Context, chat types.JID) (*rateLimitReservation, error) {
+	chat = chat.ToNonAD()
+	isNewChat := cli.isNewChat(chat)
+	for {
+		cli.rateLimit.lock.Lock()
+		res, err := cli.rateLimit.reserve(chat, isNewChat, time.Now())
+		wait := cli.rateLimit.cfg != nil && cli.rateLimit.cfg.Wait
+		cli.rateLimit.lock.Unlock()
+		if err == nil {
+			return res, nil
+		} else if !wait {
+			return nil, err
+		}
+		cli.Log.Debugf("Waiting %s for %s rate limit before sending to %s", err.RetryAfter, err.Reason, chat)
+		select {
+		case <-time.After(err.RetryAfter):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
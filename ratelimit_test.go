@@ -0,0 +1,142 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+var (
+	testChatA = types.NewJID("1111111111", types.DefaultUserServer)
+	testChatB = types.NewJID("2222222222", types.DefaultUserServer)
+	testChatC = types.NewJID("3333333333", types.DefaultUserServer)
+)
+
+func newTestRateLimiter(cfg *RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		cfg:        cfg,
+		chats:      make(map[types.JID][]time.Time),
+		knownChats: make(map[types.JID]struct{}),
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	type send struct {
+		chat      types.JID
+		newChat   bool
+		at        time.Duration
+		reason    RateLimitReason
+		waitUntil time.Duration
+	}
+	tests := []struct {
+		name  string
+		cfg   *RateLimitConfig
+		sends []send
+	}{
+		{"Unlimited", nil, []send{
+			{chat: testChatA}, {chat: testChatA}, {chat: testChatA, newChat: true},
+		}},
+		{"Global", &RateLimitConfig{GlobalPerMinute: 2}, []send{
+			{chat: testChatA},
+			{chat: testChatB, at: 10 * time.Second},
+			{chat: testChatC, at: 20 * time.Second, reason: RateLimitGlobal, waitUntil: time.Minute},
+			{chat: testChatC, at: 59 * time.Second, reason: RateLimitGlobal, waitUntil: time.Minute},
+			{chat: testChatC, at: time.Minute},
+			{chat: testChatC, at: 61 * time.Second, reason: RateLimitGlobal, waitUntil: 70 * time.Second},
+		}},
+		{"Chat", &RateLimitConfig{ChatPerMinute: 1}, []send{
+			{chat: testChatA},
+			{chat: testChatB, at: time.Second},
+			{chat: testChatA, at: 30 * time.Second, reason: RateLimitChat, waitUntil: time.Minute},
+			{chat: testChatA, at: 61 * time.Second},
+		}},
+		{"NewChat", &RateLimitConfig{NewChatsPerHour: 1}, []send{
+			{chat: testChatA, newChat: true},
+			{chat: testChatB, newChat: true, at: time.Minute, reason: RateLimitNewChat, waitUntil: time.Hour},
+			{chat: testChatC, at: time.Minute},
+			{chat: testChatB, newChat: true, at: time.Hour + time.Second},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			rl := newTestRateLimiter(test.cfg)
+			for i, s := range test.sends {
+				now := start.Add(s.at)
+				res, err := rl.reserve(s.chat, s.newChat, now)
+				if s.reason == "" {
+					if err != nil {
+						t.Errorf("Send #%d: unexpected error %v", i+1, err)
+					} else if (res == nil) != (test.cfg == nil) {
+						t.Errorf("Send #%d: unexpected reservation %+v", i+1, res)
+					}
+				} else if err == nil {
+					t.Errorf("Send #%d: expected %s limit, got no error", i+1, s.reason)
+				} else if err.Reason != s.reason || err.RetryAfter != s.waitUntil-s.at {
+					t.Errorf("Send #%d: expected %s limit with retry after %s, got %v", i+1, s.reason, s.waitUntil-s.at, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterPaused(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := newTestRateLimiter(nil)
+	rl.pausedUntil = now.Add(time.Minute)
+	if _, err := rl.reserve(testChatA, false, now); err == nil || err.Reason != RateLimitPaused || err.RetryAfter != time.Minute {
+		t.Errorf("Expected paused error with retry after 1m, got %v", err)
+	}
+	if res, err := rl.reserve(testChatA, false, now.Add(time.Minute)); err != nil || res != nil {
+		t.Errorf("Expected send to be allowed after pause, got %+v, %v", res, err)
+	}
+}
+
+func TestRateLimiterRefund(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := newTestRateLimiter(&RateLimitConfig{GlobalPerMinute: 2, ChatPerMinute: 1, NewChatsPerHour: 1})
+	first, err := rl.reserve(testChatA, true, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := rl.reserve(testChatB, false, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rl.refund(first)
+	if len(rl.global) != 1 || len(rl.newChats) != 0 {
+		t.Errorf("Expected refund to remove one global and one new chat send, got %d and %d", len(rl.global), len(rl.newChats))
+	} else if _, ok := rl.chats[testChatA]; ok {
+		t.Errorf("Expected refunded chat to be removed from chat windows")
+	} else if _, ok := rl.knownChats[testChatA]; ok {
+		t.Errorf("Expected refunded chat to be forgotten")
+	}
+	if _, err = rl.reserve(testChatA, true, now); err != nil {
+		t.Errorf("Expected refunded budget to be reusable, got %v", err)
+	}
+
+	rl.refund(second)
+	if _, ok := rl.knownChats[testChatB]; ok {
+		t.Errorf("Expected refunded chat to be forgotten")
+	}
+
+	// Refunding a send to a chat that was already known keeps it known
+	if _, err = rl.reserve(testChatB, false, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err := rl.reserve(testChatB, false, now.Add(4*time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rl.refund(res)
+	if _, ok := rl.knownChats[testChatB]; !ok {
+		t.Errorf("Expected previously known chat to stay known after refund")
+	}
+}
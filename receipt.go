@@ -22,6 +22,7 @@ func (cli *Client) handleReceipt(node *waBinary.Node) {
 		cli.Log.Warnf("Failed to parse receipt: %v", err)
 	} else if receipt != nil {
 		if receipt.Type == types.ReceiptTypeRetry {
+			cli.getMetrics().RetryReceiptReceived()
 			go func() {
 				err := cli.handleRetryReceipt(receipt, node)
 				if err != nil {
@@ -0,0 +1,198 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// DisconnectInfo contains what's known about why the connection was lost before automatically reconnecting.
+// All fields are empty if the socket was just closed, e.g. due to a network error.
+type DisconnectInfo struct {
+	// StreamErrorCode is the code of the stream error that the server sent before disconnecting.
+	StreamErrorCode string
+	// ConnectFailure is the reason of the connect failure that the server sent instead of a connect success.
+	ConnectFailure events.ConnectFailureReason
+	// KeepAliveTimeout is true if the client disconnected by itself because keepalive pings failed.
+	KeepAliveTimeout bool
+}
+
+// ReconnectAttempt contains the information that a ReconnectPolicy can use to decide the next delay.
+type ReconnectAttempt struct {
+	// Attempt is the number of the upcoming reconnect attempt, starting from 1.
+	// It's reset after connecting successfully.
+	Attempt int
+	// Error is the error that the previous attempt failed with. It's nil before the first attempt.
+	Error error
+	// Reason is why the last connection was lost.
+	Reason DisconnectInfo
+}
+
+// ReconnectPolicy decides how long to wait before automatically reconnecting and when to stop trying.
+//
+// NextDelay may be called from different goroutines, so implementations with state must be safe for concurrent use.
+type ReconnectPolicy interface {
+	// NextDelay returns the delay before the given attempt, or stop=true to give up reconnecting.
+	NextDelay(attempt ReconnectAttempt) (delay time.Duration, stop bool)
+}
+
+// ReconnectPolicyFunc is a function that implements ReconnectPolicy.
+type ReconnectPolicyFunc func(attempt ReconnectAttempt) (time.Duration, bool)
+
+// NextDelay implements ReconnectPolicy.
+func (fn ReconnectPolicyFunc) NextDelay(attempt ReconnectAttempt) (time.Duration, bool) {
+	return fn(attempt)
+}
+
+// linearReconnectPolicy is used if Client.ReconnectPolicy is nil.
+// It reconnects immediately first and then adds 2 seconds of delay after each failed attempt.
+var linearReconnectPolicy = ReconnectPolicyFunc(func(attempt ReconnectAttempt) (time.Duration, bool) {
+	return time.Duration(attempt.Attempt-1) * 2 * time.Second, false
+})
+
+// ExponentialReconnectPolicy is a ReconnectPolicy that doubles the delay after each failed attempt.
+//
+// The first attempt is made immediately, the second one after Initial, the third one after Initial*Multiplier
+// and so on, up to Max.
+type ExponentialReconnectPolicy struct {
+	// Initial is the delay before the second attempt. Defaults to 1 second.
+	Initial time.Duration
+	// Max is the maximum delay. Defaults to 5 minutes.
+	Max time.Duration
+	// Multiplier is how much the delay grows after each attempt. Defaults to 2.
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, e.g. 0.2 means that the delay is between
+	// 80% and 120% of the calculated value, but never more than Max. This prevents many clients from
+	// reconnecting at the same time.
+	Jitter float64
+	// MaxAttempts is the number of attempts after which the policy gives up. Zero means never give up.
+	MaxAttempts int
+}
+
+var _ ReconnectPolicy = (*ExponentialReconnectPolicy)(nil)
+
+// NextDelay implements ReconnectPolicy.
+func (erp *ExponentialReconnectPolicy) NextDelay(attempt ReconnectAttempt) (time.Duration, bool) {
+	if erp.MaxAttempts > 0 && attempt.Attempt > erp.MaxAttempts {
+		return 0, true
+	} else if attempt.Attempt <= 1 {
+		return 0, false
+	}
+	initial, maxDelay, multiplier := erp.Initial, erp.Max, erp.Multiplier
+	if initial <= 0 {
+		initial = 1 * time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = 5 * time.Minute
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(initial)
+	for i := 2; i < attempt.Attempt && delay < float64(maxDelay); i++ {
+		delay *= multiplier
+	}
+	delay = min(delay, float64(maxDelay))
+	if erp.Jitter > 0 {
+		delay += delay * erp.Jitter * (rand.Float64()*2 - 1)
+		delay = min(delay, float64(maxDelay))
+	}
+	return time.Duration(delay), false
+}
+
+// CircuitBreakerReconnectPolicy wraps another ReconnectPolicy and stops reconnecting if the connection
+// keeps failing. Unlike the attempt counter, which is reset after each successful connection, the circuit
+// breaker also catches connections that succeed but are dropped again right away.
+//
+// The circuit opens when more than Threshold reconnects are scheduled within Window. While it's open, the next
+// reconnect is delayed by Cooldown, after which the counter starts from zero. If Cooldown is zero, the circuit
+// breaker gives up reconnecting instead.
+type CircuitBreakerReconnectPolicy struct {
+	// Policy decides the delays while the circuit is closed. Defaults to an ExponentialReconnectPolicy.
+	Policy ReconnectPolicy
+	// Threshold is the number of reconnects allowed within Window. Defaults to 10.
+	Threshold int
+	// Window is the duration over which reconnects are counted. Defaults to 10 minutes.
+	Window time.Duration
+	// Cooldown is how long to wait after the circuit opens. Zero means give up instead.
+	Cooldown time.Duration
+
+	attempts []time.Time
+	lock     sync.Mutex
+}
+
+var _ ReconnectPolicy = (*CircuitBreakerReconnectPolicy)(nil)
+
+// NextDelay implements ReconnectPolicy.
+func (cbrp *CircuitBreakerReconnectPolicy) NextDelay(attempt ReconnectAttempt) (time.Duration, bool) {
+	threshold, window := cbrp.Threshold, cbrp.Window
+	if threshold <= 0 {
+		threshold = 10
+	}
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	cbrp.lock.Lock()
+	now := time.Now()
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(cbrp.attempts) && !cbrp.attempts[i].After(cutoff) {
+		i++
+	}
+	cbrp.attempts = append(cbrp.attempts[i:], now)
+	isOpen := len(cbrp.attempts) > threshold
+	if isOpen {
+		cbrp.attempts = cbrp.attempts[:0]
+	}
+	cbrp.lock.Unlock()
+	if isOpen {
+		if cbrp.Cooldown <= 0 {
+			return 0, true
+		}
+		return cbrp.Cooldown, false
+	}
+	policy := cbrp.Policy
+	if policy == nil {
+		policy = &ExponentialReconnectPolicy{}
+	}
+	return policy.NextDelay(attempt)
+}
+
+func (cli *Client) setDisconnectReason(reason DisconnectInfo) {
+	cli.disconnectReason.Store(&reason)
+}
+
+// updateDisconnectReason stores the reason from stream errors and connect failures as soon as they're received,
+// because the server may close the socket before the handler queue gets to them.
+func (cli *Client) updateDisconnectReason(node *waBinary.Node) {
+	switch node.Tag {
+	case "stream:error":
+		code, _ := node.Attrs["code"].(string)
+		cli.setDisconnectReason(DisconnectInfo{StreamErrorCode: code})
+	case "failure":
+		cli.setDisconnectReason(DisconnectInfo{ConnectFailure: events.ConnectFailureReason(node.AttrGetter().Int("reason"))})
+	}
+}
+
+func (cli *Client) getDisconnectReason() DisconnectInfo {
+	if reason := cli.disconnectReason.Load(); reason != nil {
+		return *reason
+	}
+	return DisconnectInfo{}
+}
+
+func (cli *Client) getReconnectPolicy() ReconnectPolicy {
+	if cli.ReconnectPolicy != nil {
+		return cli.ReconnectPolicy
+	}
+	return linearReconnectPolicy
+}
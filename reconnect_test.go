@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialReconnectPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *ExponentialReconnectPolicy
+		attempt int
+		delay   time.Duration
+		stop    bool
+	}{
+		{"FirstAttempt", &ExponentialReconnectPolicy{}, 1, 0, false},
+		{"Defaults", &ExponentialReconnectPolicy{}, 2, time.Second, false},
+		{"DefaultMultiplier", &ExponentialReconnectPolicy{}, 4, 4 * time.Second, false},
+		{"DefaultMax", &ExponentialReconnectPolicy{}, 100, 5 * time.Minute, false},
+		{"Multiplier", &ExponentialReconnectPolicy{Initial: 100 * time.Millisecond, Multiplier: 3}, 4, 900 * time.Millisecond, false},
+		{"Max", &ExponentialReconnectPolicy{Initial: time.Second, Max: 10 * time.Second}, 6, 10 * time.Second, false},
+		{"LastAttempt", &ExponentialReconnectPolicy{MaxAttempts: 3}, 3, 2 * time.Second, false},
+		{"MaxAttempts", &ExponentialReconnectPolicy{MaxAttempts: 3}, 4, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay, stop := test.policy.NextDelay(ReconnectAttempt{Attempt: test.attempt})
+			if delay != test.delay || stop != test.stop {
+				t.Errorf("NextDelay(%d) = %s, %t; expected %s, %t", test.attempt, delay, stop, test.delay, test.stop)
+			}
+		})
+	}
+}
+
+func TestExponentialReconnectPolicyJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempt  int
+		min, max time.Duration
+	}{
+		{"BelowMax", 3, 1600 * time.Millisecond, 2400 * time.Millisecond},
+		{"AtMax", 10, 8 * time.Second, 10 * time.Second},
+	}
+	policy := &ExponentialReconnectPolicy{Initial: time.Second, Max: 10 * time.Second, Jitter: 0.2}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				delay, stop := policy.NextDelay(ReconnectAttempt{Attempt: test.attempt})
+				if stop || delay < test.min || delay > test.max {
+					t.Fatalf("NextDelay(%d) = %s, %t; expected a delay between %s and %s", test.attempt, delay, stop, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerReconnectPolicy(t *testing.T) {
+	inner := ReconnectPolicyFunc(func(attempt ReconnectAttempt) (time.Duration, bool) {
+		return time.Duration(attempt.Attempt) * time.Second, false
+	})
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		delay    time.Duration
+		stop     bool
+	}{
+		{"GiveUp", 0, 0, true},
+		{"Cooldown", time.Minute, time.Minute, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := &CircuitBreakerReconnectPolicy{Policy: inner, Threshold: 3, Cooldown: test.cooldown}
+			for i := 1; i <= 3; i++ {
+				if delay, stop := policy.NextDelay(ReconnectAttempt{Attempt: i}); delay != time.Duration(i)*time.Second || stop {
+					t.Fatalf("Attempt %d: expected inner policy delay, got %s, %t", i, delay, stop)
+				}
+			}
+			if delay, stop := policy.NextDelay(ReconnectAttempt{Attempt: 4}); delay != test.delay || stop != test.stop {
+				t.Errorf("Expected circuit to open with %s, %t; got %s, %t", test.delay, test.stop, delay, stop)
+			}
+			// The counter starts from zero after the circuit opens
+			if delay, stop := policy.NextDelay(ReconnectAttempt{Attempt: 5}); delay != 5*time.Second || stop {
+				t.Errorf("Expected inner policy delay after circuit opened, got %s, %t", delay, stop)
+			}
+		})
+	}
+
+	// Reconnects outside the window aren't counted
+	policy := &CircuitBreakerReconnectPolicy{Policy: inner, Threshold: 1, Window: time.Minute}
+	policy.attempts = []time.Time{time.Now().Add(-2 * time.Minute)}
+	if _, stop := policy.NextDelay(ReconnectAttempt{Attempt: 1}); stop {
+		t.Errorf("Expected old reconnects to be pruned from the window")
+	}
+	if _, stop := policy.NextDelay(ReconnectAttempt{Attempt: 2}); !stop {
+		t.Errorf("Expected circuit to open after exceeding threshold")
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/util/redact"
+)
+
+// NodeDirection is the direction of a recorded node.
+type NodeDirection string
+
+const (
+	NodeSent     NodeDirection = "send"
+	NodeReceived NodeDirection = "recv"
+)
+
+// RecordedNode is a single decrypted node sent or received by a client.
+type RecordedNode struct {
+	Time      time.Time     `json:"time"`
+	Direction NodeDirection `json:"direction"`
+	Node      waBinary.Node `json:"node"`
+}
+
+// Tags whose binary content is replaced with zeroes by NodeRecorder.RedactCiphertext.
+var recordingCiphertextTags = map[string]struct{}{
+	"enc":      {},
+	"patch":    {},
+	"snapshot": {},
+}
+
+// NodeRecorder writes decrypted nodes to a writer as newline-delimited JSON. Use Client.SetNodeRecorder to record
+// all nodes sent and received by a client, and ReadRecording and Client.Replay to replay the recording later.
+type NodeRecorder struct {
+	// RedactKeys replaces the content of nodes containing key material (the tags in redact.KeyTags)
+	// with zeroes of the same length.
+	RedactKeys bool
+	// RedactCiphertext replaces the content of encrypted messages and app state patches with zeroes of the same length.
+	// Recordings with redacted ciphertext can still be replayed, but the messages will fail to decrypt.
+	RedactCiphertext bool
+
+	enc  *json.Encoder
+	lock sync.Mutex
+}
+
+// NewNodeRecorder creates a NodeRecorder that writes to the given writer.
+func NewNodeRecorder(w io.Writer) *NodeRecorder {
+	return &NodeRecorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes a single node to the recording.
+func (rec *NodeRecorder) Record(direction NodeDirection, node *waBinary.Node) error {
+	recorded := RecordedNode{
+		Time:      time.Now(),
+		Direction: direction,
+		Node:      rec.redact(*node),
+	}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	return rec.enc.Encode(&recorded)
+}
+
+func (rec *NodeRecorder) redact(node waBinary.Node) waBinary.Node {
+	switch content := node.Content.(type) {
+	case []waBinary.Node:
+		children := make([]waBinary.Node, len(content))
+		for i, child := range content {
+			children[i] = rec.redact(child)
+		}
+		node.Content = children
+	case []byte:
+		_, isKey := redact.KeyTags[node.Tag]
+		_, isCiphertext := recordingCiphertextTags[node.Tag]
+		if (isKey && rec.RedactKeys) || (isCiphertext && rec.RedactCiphertext) {
+			node.Content = make([]byte, len(content))
+		}
+	case string:
+		// The JSON unmarshaler expects binary content to be base64
+		node.Content = []byte(content)
+	}
+	return node
+}
+
+// SetNodeRecorder sets the recorder that all decrypted nodes sent and received by the client are written to.
+// Pass nil to stop recording. This can be called while connected.
+func (cli *Client) SetNodeRecorder(rec *NodeRecorder) {
+	cli.recorder.Store(rec)
+}
+
+func (cli *Client) recordNode(direction NodeDirection, node *waBinary.Node) {
+	rec := cli.recorder.Load()
+	if rec == nil {
+		return
+	}
+	err := rec.Record(direction, node)
+	if err != nil {
+		cli.Log.Warnf("Failed to record %s node: %v", direction, err)
+	}
+}
+
+// ReadRecording reads all nodes from a recording written by a NodeRecorder.
+func ReadRecording(r io.Reader) ([]RecordedNode, error) {
+	var nodes []RecordedNode
+	dec := json.NewDecoder(r)
+	for {
+		var node RecordedNode
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return nodes, nil
+		} else if err != nil {
+			return nodes, fmt.Errorf("failed to read node #%d: %w", len(nodes)+1, err)
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+type recordedRequest struct {
+	request  *waBinary.Node
+	response *waBinary.Node
+	used     bool
+}
+
+// replayer answers the nodes that a client sends during a replay with the responses from the recording.
+type replayer struct {
+	cli      *Client
+	incoming []*waBinary.Node
+	requests []*recordedRequest
+	byID     map[string]*recordedRequest
+	lock     sync.Mutex
+}
+
+func newReplayer(cli *Client, recording []RecordedNode) *replayer {
+	rp := &replayer{
+		cli:  cli,
+		byID: make(map[string]*recordedRequest),
+	}
+	for i := range recording {
+		node := &recording[i].Node
+		id, _ := node.Attrs["id"].(string)
+		switch recording[i].Direction {
+		case NodeSent:
+			if id != "" && (node.Tag == "iq" || node.Tag == "message") {
+				req := &recordedRequest{request: node}
+				rp.requests = append(rp.requests, req)
+				rp.byID[id] = req
+			}
+		case NodeReceived:
+			if req, ok := rp.byID[id]; ok && req.response == nil && (node.Tag == "iq" || node.Tag == "ack") {
+				req.response = node
+			} else {
+				rp.incoming = append(rp.incoming, node)
+			}
+		}
+	}
+	return rp
+}
+
+func sameIQ(a, b *waBinary.Node) bool {
+	if a.Tag != "iq" || b.Tag != "iq" || a.Attrs["xmlns"] != b.Attrs["xmlns"] || a.Attrs["type"] != b.Attrs["type"] {
+		return false
+	}
+	aChildren, bChildren := a.GetChildren(), b.GetChildren()
+	if len(aChildren) == 0 || len(bChildren) == 0 {
+		return len(aChildren) == len(bChildren)
+	}
+	return aChildren[0].Tag == bChildren[0].Tag
+}
+
+// findResponse finds the recorded response to a node sent during the replay. Requests are matched by ID first,
+// then info queries are matched by namespace, type and the tag of the first child, as IDs aren't stable across runs.
+func (rp *replayer) findResponse(node *waBinary.Node) *waBinary.Node {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	id, _ := node.Attrs["id"].(string)
+	req, ok := rp.byID[id]
+	if !ok || req.used || req.request.Tag != node.Tag {
+		req = nil
+		for _, candidate := range rp.requests {
+			if !candidate.used && sameIQ(candidate.request, node) {
+				req = candidate
+				break
+			}
+		}
+	}
+	if req == nil || req.response == nil {
+		return nil
+	}
+	req.used = true
+	resp := *req.response
+	resp.Attrs = make(waBinary.Attrs, len(req.response.Attrs))
+	for key, value := range req.response.Attrs {
+		resp.Attrs[key] = value
+	}
+	resp.Attrs["id"] = id
+	return &resp
+}
+
+func (rp *replayer) respond(node *waBinary.Node) {
+	iqType, _ := node.Attrs["type"].(string)
+	if node.Tag == "iq" && iqType != "get" && iqType != "set" {
+		return
+	}
+	resp := rp.findResponse(node)
+	if resp == nil && node.Tag == "iq" {
+		rp.cli.Log.Warnf("No recorded response to %s iq in %s, responding with an error", iqType, node.Attrs["xmlns"])
+		resp = &waBinary.Node{
+			Tag:     "iq",
+			Attrs:   waBinary.Attrs{"id": node.Attrs["id"], "type": "error"},
+			Content: []waBinary.Node{{Tag: "error", Attrs: waBinary.Attrs{"code": 404, "text": "item-not-found"}}},
+		}
+	}
+	if resp != nil {
+		go rp.cli.receiveReplayedNode(resp)
+	}
+}
+
+func (cli *Client) receiveReplayedNode(node *waBinary.Node) {
+	payload, err := waBinary.Marshal(*node)
+	if err != nil {
+		cli.Log.Warnf("Failed to marshal replayed %s node: %v", node.Tag, err)
+		return
+	}
+	cli.handleFrame(payload)
+}
+
+// Replay feeds the received nodes from a recording into the client as if they had been received from the server.
+// The client must not be connected, and its store must be in the state it was in when the recording started
+// for encrypted messages to be decrypted.
+//
+// Nodes sent by the client during the replay aren't sent anywhere. Instead, info queries and messages are answered
+// with the matching responses from the recording. Info queries that don't have a recorded response get an error.
+//
+// Nodes are handled in order, and Replay returns once all of them have been handled. Events are dispatched to the
+// client's event handlers as usual.
+func (cli *Client) Replay(ctx context.Context, recording []RecordedNode) error {
+	if cli == nil {
+		return ErrClientIsNil
+	} else if cli.IsConnected() {
+		return ErrAlreadyConnected
+	}
+	rp := newReplayer(cli, recording)
+	if !cli.replayer.CompareAndSwap(nil, rp) {
+		return fmt.Errorf("client is already replaying a recording")
+	}
+	defer cli.replayer.Store(nil)
+	for _, node := range rp.incoming {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		cli.receiveReplayedNode(node)
+		cli.drainHandlerQueue()
+	}
+	return nil
+}
+
+// drainHandlerQueue synchronously handles all nodes in the handler queue, which is used for replays
+// to make sure each node is handled before the next one is received.
+func (cli *Client) drainHandlerQueue() {
+	for {
+		select {
+		case node := <-cli.handlerQueue:
+			cli.nodeHandlers[node.Tag](node)
+		default:
+			return
+		}
+	}
+}
@@ -8,6 +8,7 @@ package whatsmeow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -68,6 +69,14 @@ func (cli *Client) cancelResponse(reqID string, ch chan *waBinary.Node) {
 	cli.responseWaitersLock.Unlock()
 }
 
+// forgetResponse removes the response waiter for the given request ID without closing the channel.
+// It's used when the caller stops waiting, so that responses arriving later are not routed to an abandoned channel.
+func (cli *Client) forgetResponse(reqID string) {
+	cli.responseWaitersLock.Lock()
+	delete(cli.responseWaiters, reqID)
+	cli.responseWaitersLock.Unlock()
+}
+
 func (cli *Client) receiveResponse(data *waBinary.Node) bool {
 	id, ok := data.Attrs["id"].(string)
 	if !ok || (data.Tag != "iq" && data.Tag != "ack") {
@@ -143,7 +152,14 @@ func (cli *Client) sendIQAsync(query infoQuery) (<-chan *waBinary.Node, error) {
 
 const defaultRequestTimeout = 75 * time.Second
 
-func (cli *Client) sendIQ(query infoQuery) (*waBinary.Node, error) {
+func (cli *Client) sendIQ(query infoQuery) (resp *waBinary.Node, err error) {
+	start := time.Now()
+	defer func() {
+		cli.getMetrics().IQ(query.Namespace, time.Since(start), err)
+		if errors.Is(err, ErrIQRateOverLimit) {
+			cli.handleRateOverLimit()
+		}
+	}()
 	resChan, data, err := cli.sendIQAsyncAndGetData(&query)
 	if err != nil {
 		return nil, err
@@ -173,8 +189,10 @@ func (cli *Client) sendIQ(query infoQuery) (*waBinary.Node, error) {
 		}
 		return res, nil
 	case <-query.Context.Done():
+		cli.forgetResponse(query.ID)
 		return nil, query.Context.Err()
 	case <-time.After(query.Timeout):
+		cli.forgetResponse(query.ID)
 		return nil, ErrIQTimedOut
 	}
 }
@@ -212,8 +230,10 @@ func (cli *Client) retryFrame(reqType, id string, data []byte, origResp *waBinar
 	select {
 	case resp = <-respChan:
 	case <-ctx.Done():
+		cli.forgetResponse(id)
 		return nil, ctx.Err()
 	case <-timeoutChan:
+		cli.forgetResponse(id)
 		// FIXME this error isn't technically correct (but works for now - the timeout param is only used from sendIQ)
 		return nil, ErrIQTimedOut
 	}
@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/socket"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+// newSilentServerClient returns a logged in client connected to a server that reads everything and never responds.
+func newSilentServerClient(t *testing.T) *Client {
+	t.Helper()
+	transport := socket.NewPipeTransport()
+	t.Cleanup(transport.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		conn, err := transport.Accept(ctx)
+		if err != nil {
+			return
+		}
+		for {
+			if _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	fs := socket.NewFrameSocketWithTransport(waLog.Noop, transport)
+	if err := fs.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	nh := socket.NewNoiseHandshake()
+	nh.Start(socket.NoiseStartPattern, fs.Header)
+	ns, err := nh.Finish(fs, func([]byte) {}, func(*socket.NoiseSocket, bool) {})
+	if err != nil {
+		t.Fatalf("Failed to create noise socket: %v", err)
+	}
+	t.Cleanup(func() { ns.Stop(true) })
+	cli := NewClient(&store.Device{}, nil)
+	cli.socket = ns
+	cli.isLoggedIn.Store(true)
+	cli.setConnectionState(events.ConnectionOnline, "test")
+	return cli
+}
+
+func expectNoResponseWaiters(t *testing.T, cli *Client) {
+	t.Helper()
+	cli.responseWaitersLock.Lock()
+	defer cli.responseWaitersLock.Unlock()
+	if len(cli.responseWaiters) != 0 {
+		t.Errorf("Expected no response waiters to be left, got %d", len(cli.responseWaiters))
+	}
+}
+
+func TestRequestCancelForgetsResponse(t *testing.T) {
+	cli := newSilentServerClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := cli.sendIQ(infoQuery{Namespace: "test", Type: iqGet, To: types.ServerJID, Context: ctx})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected sendIQ to be cancelled, got %v", err)
+	}
+	expectNoResponseWaiters(t, cli)
+
+	_, err = cli.retryFrame("info query", cli.generateRequestID(), []byte("retry"), &waBinary.Node{Tag: "stream:error"}, ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected retryFrame to be cancelled, got %v", err)
+	}
+	expectNoResponseWaiters(t, cli)
+
+	_, err = cli.sendIQ(infoQuery{Namespace: "test", Type: iqGet, To: types.ServerJID, Timeout: time.Millisecond})
+	if !errors.Is(err, ErrIQTimedOut) {
+		t.Errorf("Expected sendIQ to time out, got %v", err)
+	}
+	expectNoResponseWaiters(t, cli)
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/shiestapoi/whatsmeow/proto/waMsgTransport"
 	"github.com/shiestapoi/whatsmeow/types"
 	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
 )
 
 // Number of sent messages to cache in memory for handling retry receipts.
@@ -70,17 +71,20 @@ func (cli *Client) getRecentMessage(to types.JID, id types.MessageID) RecentMess
 }
 
 func (cli *Client) getMessageForRetry(receipt *events.Receipt, messageID types.MessageID) (RecentMessage, error) {
+	log := waLog.With(cli.Log, waLog.FieldChat, receipt.Chat, waLog.FieldSender, receipt.Sender, waLog.FieldMessageID, messageID)
 	msg := cli.getRecentMessage(receipt.Chat, messageID)
 	if msg.IsEmpty() {
 		waMsg := cli.GetMessageForRetry(receipt.Sender, receipt.Chat, messageID)
-		if waMsg == nil {
-			return RecentMessage{}, fmt.Errorf("couldn't find message %s", messageID)
+		if waMsg != nil {
+			log.Debugf("Found message in GetMessageForRetry to accept retry receipt for %s/%s from %s", receipt.Chat, messageID, receipt.Sender)
+		} else if waMsg = cli.getStoredMessageForRetry(receipt.Chat, messageID); waMsg != nil {
+			log.Debugf("Found message in message store to accept retry receipt for %s/%s from %s", receipt.Chat, messageID, receipt.Sender)
 		} else {
-			cli.Log.Debugf("Found message in GetMessageForRetry to accept retry receipt for %s/%s from %s", receipt.Chat, messageID, receipt.Sender)
+			return RecentMessage{}, fmt.Errorf("couldn't find message %s", messageID)
 		}
 		msg = RecentMessage{wa: waMsg}
 	} else {
-		cli.Log.Debugf("Found message in local cache to accept retry receipt for %s/%s from %s", receipt.Chat, messageID, receipt.Sender)
+		log.Debugf("Found message in local cache to accept retry receipt for %s/%s from %s", receipt.Chat, messageID, receipt.Sender)
 	}
 	return msg, nil
 }
@@ -122,6 +126,7 @@ func (cli *Client) handleRetryReceipt(receipt *events.Receipt, node *waBinary.No
 	if !ag.OK() {
 		return ag.Error()
 	}
+	log := waLog.With(cli.Log, waLog.FieldChat, receipt.Chat, waLog.FieldSender, receipt.Sender, waLog.FieldMessageID, messageID)
 	msg, err := cli.getMessageForRetry(receipt, messageID)
 	if err != nil {
 		return err
@@ -143,7 +148,7 @@ func (cli *Client) handleRetryReceipt(receipt *events.Receipt, node *waBinary.No
 	internalCounter := cli.incomingRetryRequestCounter[retryKey]
 	cli.incomingRetryRequestCounterLock.Unlock()
 	if internalCounter >= 10 {
-		cli.Log.Warnf("Dropping retry request from %s for %s: internal retry counter is %d", messageID, receipt.Sender, internalCounter)
+		log.Warnf("Dropping retry request from %s for %s: internal retry counter is %d", messageID, receipt.Sender, internalCounter)
 		return nil
 	}
 
@@ -159,7 +164,7 @@ func (cli *Client) handleRetryReceipt(receipt *events.Receipt, node *waBinary.No
 		senderKeyName := protocol.NewSenderKeyName(receipt.Chat.String(), ownID.SignalAddress())
 		signalSKDMessage, err := builder.Create(senderKeyName)
 		if err != nil {
-			cli.Log.Warnf("Failed to create sender key distribution message to include in retry of %s in %s to %s: %v", messageID, receipt.Chat, receipt.Sender, err)
+			log.Warnf("Failed to create sender key distribution message to include in retry of %s in %s to %s: %v", messageID, receipt.Chat, receipt.Sender, err)
 		}
 		if msg.wa != nil {
 			msg.wa.SenderKeyDistributionMessage = &waE2E.SenderKeyDistributionMessage{
@@ -189,7 +194,7 @@ func (cli *Client) handleRetryReceipt(receipt *events.Receipt, node *waBinary.No
 
 	// TODO pre-retry callback for fb
 	if cli.PreRetryCallback != nil && !cli.PreRetryCallback(receipt, messageID, retryCount, msg.wa) {
-		cli.Log.Debugf("Cancelled retry receipt in PreRetryCallback")
+		log.Debugf("Cancelled retry receipt in PreRetryCallback")
 		return nil
 	}
 
@@ -216,7 +221,7 @@ func (cli *Client) handleRetryReceipt(receipt *events.Receipt, node *waBinary.No
 			return fmt.Errorf("failed to read prekey bundle in retry receipt: %w", err)
 		}
 	} else if reason, recreate := cli.shouldRecreateSession(retryCount, receipt.Sender); recreate {
-		cli.Log.Debugf("Fetching prekeys for %s for handling retry receipt with no prekey bundle because %s", receipt.Sender, reason)
+		log.Debugf("Fetching prekeys for %s for handling retry receipt with no prekey bundle because %s", receipt.Sender, reason)
 		var keys map[types.JID]preKeyResp
 		keys, err = cli.fetchPreKeys(context.TODO(), []types.JID{receipt.Sender})
 		if err != nil {
@@ -295,7 +300,7 @@ func (cli *Client) handleRetryReceipt(receipt *events.Receipt, node *waBinary.No
 	if err != nil {
 		return fmt.Errorf("failed to send retry message: %w", err)
 	}
-	cli.Log.Debugf("Sent retry #%d for %s/%s to %s", retryCount, receipt.Chat, messageID, receipt.Sender)
+	log.Debugf("Sent retry #%d for %s/%s to %s", retryCount, receipt.Chat, messageID, receipt.Sender)
 	return nil
 }
 
@@ -316,6 +321,7 @@ func (cli *Client) cancelDelayedRequestFromPhone(msgID types.MessageID) {
 var RequestFromPhoneDelay = 5 * time.Second
 
 func (cli *Client) delayedRequestMessageFromPhone(info *types.MessageInfo) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
 	if !cli.AutomaticMessageRerequestFromPhone || cli.MessengerConfig != nil {
 		return
 	}
@@ -338,7 +344,7 @@ func (cli *Client) delayedRequestMessageFromPhone(info *types.MessageInfo) {
 	select {
 	case <-time.After(RequestFromPhoneDelay):
 	case <-ctx.Done():
-		cli.Log.Debugf("Cancelled delayed request for message %s from phone", info.ID)
+		log.Debugf("Cancelled delayed request for message %s from phone", info.ID)
 		return
 	}
 	_, err := cli.SendMessage(
@@ -348,9 +354,9 @@ func (cli *Client) delayedRequestMessageFromPhone(info *types.MessageInfo) {
 		SendRequestExtra{Peer: true},
 	)
 	if err != nil {
-		cli.Log.Warnf("Failed to send request for unavailable message %s to phone: %v", info.ID, err)
+		log.Warnf("Failed to send request for unavailable message %s to phone: %v", info.ID, err)
 	} else {
-		cli.Log.Debugf("Requested message %s from phone", info.ID)
+		log.Debugf("Requested message %s from phone", info.ID)
 	}
 }
 
@@ -364,6 +370,7 @@ func (cli *Client) clearDelayedMessageRequests() {
 
 // sendRetryReceipt sends a retry receipt for an incoming message.
 func (cli *Client) sendRetryReceipt(node *waBinary.Node, info *types.MessageInfo, forceIncludeIdentity bool) {
+	log := waLog.With(cli.Log, waLog.FieldChat, info.Chat, waLog.FieldSender, info.Sender, waLog.FieldMessageID, info.ID)
 	id, _ := node.Attrs["id"].(string)
 	children := node.GetChildren()
 	var retryCountInMsg int
@@ -381,7 +388,7 @@ func (cli *Client) sendRetryReceipt(node *waBinary.Node, info *types.MessageInfo
 	}
 	cli.messageRetriesLock.Unlock()
 	if retryCount >= 5 {
-		cli.Log.Warnf("Not sending any more retry receipts for %s", id)
+		log.Warnf("Not sending any more retry receipts for %s", id)
 		return
 	}
 	if retryCount == 1 {
@@ -416,18 +423,19 @@ func (cli *Client) sendRetryReceipt(node *waBinary.Node, info *types.MessageInfo
 	}
 	if retryCount > 1 || forceIncludeIdentity {
 		if key, err := cli.Store.PreKeys.GenOnePreKey(); err != nil {
-			cli.Log.Errorf("Failed to get prekey for retry receipt: %v", err)
+			log.Errorf("Failed to get prekey for retry receipt: %v", err)
 		} else if deviceIdentity, err := proto.Marshal(cli.Store.Account); err != nil {
-			cli.Log.Errorf("Failed to marshal account info: %v", err)
+			log.Errorf("Failed to marshal account info: %v", err)
 			return
 		} else {
+			signedPreKey, _, _ := cli.Store.GetSignedPreKeys()
 			payload.Content = append(payload.GetChildren(), waBinary.Node{
 				Tag: "keys",
 				Content: []waBinary.Node{
 					{Tag: "type", Content: []byte{ecc.DjbType}},
 					{Tag: "identity", Content: cli.Store.IdentityKey.Pub[:]},
 					preKeyToNode(key),
-					preKeyToNode(cli.Store.SignedPreKey),
+					preKeyToNode(signedPreKey),
 					{Tag: "device-identity", Content: deviceIdentity},
 				},
 			})
@@ -435,6 +443,8 @@ func (cli *Client) sendRetryReceipt(node *waBinary.Node, info *types.MessageInfo
 	}
 	err := cli.sendNode(payload)
 	if err != nil {
-		cli.Log.Errorf("Failed to send retry receipt for %s: %v", id, err)
+		log.Errorf("Failed to send retry receipt for %s: %v", id, err)
+	} else {
+		cli.getMetrics().RetryReceiptSent()
 	}
 }
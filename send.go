@@ -33,6 +33,7 @@ import (
 	"github.com/shiestapoi/whatsmeow/proto/waE2E"
 	"github.com/shiestapoi/whatsmeow/types"
 	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
 )
 
 // GenerateMessageID generates a random string that can be used as a message ID on WhatsApp.
@@ -82,6 +83,8 @@ type MessageDebugTimings struct {
 	Send  time.Duration
 	Resp  time.Duration
 	Retry time.Duration
+
+	trace *messageTrace
 }
 
 func (mdt MessageDebugTimings) MarshalZerologObject(evt *zerolog.Event) {
@@ -204,6 +207,15 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, message *waE2E
 	}
 	resp.ID = req.ID
 
+	ctx, span := cli.startSpan(ctx, "send_message")
+	span.SetAttribute("chat", to.String())
+	span.SetAttribute("message_id", req.ID)
+	defer func() {
+		span.End(time.Now(), err)
+	}()
+	resp.DebugTimings.trace = &messageTrace{ctx: ctx, tracer: cli.getTracer(ctx)}
+	log := waLog.With(cli.Log, waLog.FieldChat, to, waLog.FieldMessageID, req.ID)
+
 	isInlineBotMode := false
 
 	if !req.InlineBotJID.IsEmpty() {
@@ -270,10 +282,27 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, message *waE2E
 		}
 	}
 
+	defer func() {
+		cli.getMetrics().MessageSent(getTypeFromMessage(message), resp.DebugTimings, err)
+	}()
+
+	if !req.Peer {
+		var reservation *rateLimitReservation
+		reservation, err = cli.waitRateLimit(ctx, to)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				cli.refundRateLimit(reservation)
+			}
+		}()
+	}
+
 	start := time.Now()
 	// Sending multiple messages at a time can cause weird issues and makes it harder to retry safely
 	cli.messageSendLock.Lock()
-	resp.DebugTimings.Queue = time.Since(start)
+	resp.DebugTimings.Queue = resp.DebugTimings.stage("queue", start)
 	defer cli.messageSendLock.Unlock()
 
 	respChan := cli.waitResponse(req.ID)
@@ -285,16 +314,17 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, message *waE2E
 	if message.GetMessageContextInfo().GetMessageSecret() != nil {
 		err = cli.Store.MsgSecrets.PutMessageSecret(to, ownID, req.ID, message.GetMessageContextInfo().GetMessageSecret())
 		if err != nil {
-			cli.Log.Warnf("Failed to store message secret key for outgoing message %s: %v", req.ID, err)
+			log.Warnf("Failed to store message secret key for outgoing message %s: %v", req.ID, err)
 		} else {
-			cli.Log.Debugf("Stored message secret key for outgoing message %s", req.ID)
+			log.Debugf("Stored message secret key for outgoing message %s", req.ID)
 		}
 	}
 	var phash string
+	var participants []types.JID
 	var data []byte
 	switch to.Server {
 	case types.GroupServer, types.BroadcastServer:
-		phash, data, err = cli.sendGroup(ctx, to, ownID, req.ID, message, &resp.DebugTimings, botNode)
+		phash, participants, data, err = cli.sendGroup(ctx, to, ownID, req.ID, message, &resp.DebugTimings, botNode)
 	case types.DefaultUserServer:
 		if req.Peer {
 			data, err = cli.sendPeerMessage(to, req.ID, message, &resp.DebugTimings)
@@ -329,11 +359,11 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, message *waE2E
 		err = ctx.Err()
 		return
 	}
-	resp.DebugTimings.Resp = time.Since(start)
+	resp.DebugTimings.Resp = resp.DebugTimings.stage("resp", start)
 	if isDisconnectNode(respNode) {
 		start = time.Now()
 		respNode, err = cli.retryFrame("message send", req.ID, data, respNode, ctx, 0)
-		resp.DebugTimings.Retry = time.Since(start)
+		resp.DebugTimings.Retry = resp.DebugTimings.stage("retry", start)
 		if err != nil {
 			return
 		}
@@ -342,15 +372,23 @@ func (cli *Client) SendMessage(ctx context.Context, to types.JID, message *waE2E
 	resp.ServerID = types.MessageServerID(ag.OptionalInt("server_id"))
 	resp.Timestamp = ag.UnixTime("t")
 	if errorCode := ag.Int("error"); errorCode != 0 {
-		err = fmt.Errorf("%w %d", ErrServerReturnedError, errorCode)
+		err = &serverReturnedError{Code: errorCode}
+	} else if !req.Peer {
+		cli.storeMessage(&types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:     to,
+				Sender:   ownID.ToNonAD(),
+				IsFromMe: true,
+				IsGroup:  to.Server == types.GroupServer || to.Server == types.BroadcastServer,
+			},
+			ID:        req.ID,
+			Timestamp: resp.Timestamp,
+		}, message)
 	}
 	expectedPHash := ag.OptionalString("phash")
 	if len(expectedPHash) > 0 && phash != expectedPHash {
-		cli.Log.Warnf("Server returned different participant list hash when sending to %s. Some devices may not have received the message.", to)
-		// TODO also invalidate device list caches
-		cli.groupParticipantsCacheLock.Lock()
-		delete(cli.groupParticipantsCache, to)
-		cli.groupParticipantsCacheLock.Unlock()
+		log.Warnf("Server returned different participant list hash when sending to %s. Some devices may not have received the message.", to)
+		cli.invalidateParticipantCaches(to, participants)
 	}
 	return
 }
@@ -522,9 +560,14 @@ func ParseDisappearingTimerString(val string) (time.Duration, bool) {
 //
 // In groups, the server will echo the change as a notification, so it'll show up as a *events.GroupInfo update.
 func (cli *Client) SetDisappearingTimer(chat types.JID, timer time.Duration) (err error) {
+	return cli.SetDisappearingTimerContext(context.TODO(), chat, timer)
+}
+
+// SetDisappearingTimerContext is like SetDisappearingTimer, but takes a context for cancellation and deadlines.
+func (cli *Client) SetDisappearingTimerContext(ctx context.Context, chat types.JID, timer time.Duration) (err error) {
 	switch chat.Server {
 	case types.DefaultUserServer:
-		_, err = cli.SendMessage(context.TODO(), chat, &waE2E.Message{
+		_, err = cli.SendMessage(ctx, chat, &waE2E.Message{
 			ProtocolMessage: &waE2E.ProtocolMessage{
 				Type:                waE2E.ProtocolMessage_EPHEMERAL_SETTING.Enum(),
 				EphemeralExpiration: proto.Uint32(uint32(timer.Seconds())),
@@ -532,9 +575,9 @@ func (cli *Client) SetDisappearingTimer(chat types.JID, timer time.Duration) (er
 		})
 	case types.GroupServer:
 		if timer == 0 {
-			_, err = cli.sendGroupIQ(context.TODO(), iqSet, chat, waBinary.Node{Tag: "not_ephemeral"})
+			_, err = cli.sendGroupIQ(ctx, iqSet, chat, waBinary.Node{Tag: "not_ephemeral"})
 		} else {
-			_, err = cli.sendGroupIQ(context.TODO(), iqSet, chat, waBinary.Node{
+			_, err = cli.sendGroupIQ(ctx, iqSet, chat, waBinary.Node{
 				Tag: "ephemeral",
 				Attrs: waBinary.Attrs{
 					"expiration": strconv.Itoa(int(timer.Seconds())),
@@ -579,7 +622,7 @@ func (cli *Client) sendNewsletter(to types.JID, id types.MessageID, message *waE
 	}
 	start := time.Now()
 	plaintext, _, err := marshalMessage(to, message)
-	timings.Marshal = time.Since(start)
+	timings.Marshal = timings.stage("marshal", start)
 	if err != nil {
 		return nil, err
 	}
@@ -598,35 +641,34 @@ func (cli *Client) sendNewsletter(to types.JID, id types.MessageID, message *waE
 	}
 	start = time.Now()
 	data, err := cli.sendNodeAndGetData(node)
-	timings.Send = time.Since(start)
+	timings.Send = timings.stage("send", start)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send message node: %w", err)
 	}
 	return data, nil
 }
 
-func (cli *Client) sendGroup(ctx context.Context, to, ownID types.JID, id types.MessageID, message *waE2E.Message, timings *MessageDebugTimings, botNode *waBinary.Node) (string, []byte, error) {
+func (cli *Client) sendGroup(ctx context.Context, to, ownID types.JID, id types.MessageID, message *waE2E.Message, timings *MessageDebugTimings, botNode *waBinary.Node) (string, []types.JID, []byte, error) {
 	var participants []types.JID
 	var err error
 	start := time.Now()
 	if to.Server == types.GroupServer {
 		participants, err = cli.getGroupMembers(ctx, to)
 		if err != nil {
-			return "", nil, fmt.Errorf("failed to get group members: %w", err)
+			return "", nil, nil, fmt.Errorf("failed to get group members: %w", err)
 		}
 	} else {
-		// TODO use context
-		participants, err = cli.getBroadcastListParticipants(to)
+		participants, err = cli.getBroadcastListParticipants(ctx, to)
 		if err != nil {
-			return "", nil, fmt.Errorf("failed to get broadcast list members: %w", err)
+			return "", nil, nil, fmt.Errorf("failed to get broadcast list members: %w", err)
 		}
 	}
-	timings.GetParticipants = time.Since(start)
+	timings.GetParticipants = timings.stage("get_participants", start)
 	start = time.Now()
 	plaintext, _, err := marshalMessage(to, message)
-	timings.Marshal = time.Since(start)
+	timings.Marshal = timings.stage("marshal", start)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
 	start = time.Now()
@@ -634,7 +676,7 @@ func (cli *Client) sendGroup(ctx context.Context, to, ownID types.JID, id types.
 	senderKeyName := protocol.NewSenderKeyName(to.String(), ownID.SignalAddress())
 	signalSKDMessage, err := builder.Create(senderKeyName)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to create sender key distribution message to send %s to %s: %w", id, to, err)
+		return "", nil, nil, fmt.Errorf("failed to create sender key distribution message to send %s to %s: %w", id, to, err)
 	}
 	skdMessage := &waE2E.Message{
 		SenderKeyDistributionMessage: &waE2E.SenderKeyDistributionMessage{
@@ -644,20 +686,20 @@ func (cli *Client) sendGroup(ctx context.Context, to, ownID types.JID, id types.
 	}
 	skdPlaintext, err := proto.Marshal(skdMessage)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to marshal sender key distribution message to send %s to %s: %w", id, to, err)
+		return "", nil, nil, fmt.Errorf("failed to marshal sender key distribution message to send %s to %s: %w", id, to, err)
 	}
 
 	cipher := groups.NewGroupCipher(builder, senderKeyName, cli.Store)
 	encrypted, err := cipher.Encrypt(padMessage(plaintext))
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to encrypt group message to send %s to %s: %w", id, to, err)
+		return "", nil, nil, fmt.Errorf("failed to encrypt group message to send %s to %s: %w", id, to, err)
 	}
 	ciphertext := encrypted.SignedSerialize()
-	timings.GroupEncrypt = time.Since(start)
+	timings.GroupEncrypt = timings.stage("group_encrypt", start)
 
 	node, allDevices, err := cli.prepareMessageNode(ctx, to, ownID, id, message, participants, skdPlaintext, nil, timings, botNode)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
 	phash := participantListHashV2(allDevices)
@@ -674,11 +716,11 @@ func (cli *Client) sendGroup(ctx context.Context, to, ownID types.JID, id types.
 
 	start = time.Now()
 	data, err := cli.sendNodeAndGetData(*node)
-	timings.Send = time.Since(start)
+	timings.Send = timings.stage("send", start)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to send message node: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to send message node: %w", err)
 	}
-	return phash, data, nil
+	return phash, participants, data, nil
 }
 
 func (cli *Client) sendPeerMessage(to types.JID, id types.MessageID, message *waE2E.Message, timings *MessageDebugTimings) ([]byte, error) {
@@ -688,7 +730,7 @@ func (cli *Client) sendPeerMessage(to types.JID, id types.MessageID, message *wa
 	}
 	start := time.Now()
 	data, err := cli.sendNodeAndGetData(*node)
-	timings.Send = time.Since(start)
+	timings.Send = timings.stage("send", start)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send message node: %w", err)
 	}
@@ -698,7 +740,7 @@ func (cli *Client) sendPeerMessage(to types.JID, id types.MessageID, message *wa
 func (cli *Client) sendDM(ctx context.Context, to, ownID types.JID, id types.MessageID, message *waE2E.Message, timings *MessageDebugTimings, botNode *waBinary.Node) ([]byte, error) {
 	start := time.Now()
 	messagePlaintext, deviceSentMessagePlaintext, err := marshalMessage(to, message)
-	timings.Marshal = time.Since(start)
+	timings.Marshal = timings.stage("marshal", start)
 	if err != nil {
 		return nil, err
 	}
@@ -709,7 +751,7 @@ func (cli *Client) sendDM(ctx context.Context, to, ownID types.JID, id types.Mes
 	}
 	start = time.Now()
 	data, err := cli.sendNodeAndGetData(*node)
-	timings.Send = time.Since(start)
+	timings.Send = timings.stage("send", start)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send message node: %w", err)
 	}
@@ -880,14 +922,14 @@ func (cli *Client) preparePeerMessageNode(to types.JID, id types.MessageID, mess
 	}
 	start := time.Now()
 	plaintext, err := proto.Marshal(message)
-	timings.Marshal = time.Since(start)
+	timings.Marshal = timings.stage("marshal", start)
 	if err != nil {
 		err = fmt.Errorf("failed to marshal message: %w", err)
 		return nil, err
 	}
 	start = time.Now()
 	encrypted, isPreKey, err := cli.encryptMessageForDevice(plaintext, to, nil, nil)
-	timings.PeerEncrypt = time.Since(start)
+	timings.PeerEncrypt = timings.stage("peer_encrypt", start)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt peer message for %s: %v", to, err)
 	}
@@ -939,7 +981,7 @@ func (cli *Client) getMessageContent(baseNode waBinary.Node, message *waE2E.Mess
 func (cli *Client) prepareMessageNode(ctx context.Context, to, ownID types.JID, id types.MessageID, message *waE2E.Message, participants []types.JID, plaintext, dsmPlaintext []byte, timings *MessageDebugTimings, botNode *waBinary.Node) (*waBinary.Node, []types.JID, error) {
 	start := time.Now()
 	allDevices, err := cli.GetUserDevicesContext(ctx, participants)
-	timings.GetDevices = time.Since(start)
+	timings.GetDevices = timings.stage("get_devices", start)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get device list: %w", err)
 	}
@@ -965,7 +1007,7 @@ func (cli *Client) prepareMessageNode(ctx context.Context, to, ownID types.JID,
 
 	start = time.Now()
 	participantNodes, includeIdentity := cli.encryptMessageForDevices(ctx, allDevices, ownID, id, plaintext, dsmPlaintext, encAttrs)
-	timings.PeerEncrypt = time.Since(start)
+	timings.PeerEncrypt = timings.stage("peer_encrypt", start)
 	participantNode := waBinary.Node{
 		Tag:     "participants",
 		Content: participantNodes,
@@ -1015,6 +1057,7 @@ func (cli *Client) makeDeviceIdentityNode() waBinary.Node {
 }
 
 func (cli *Client) encryptMessageForDevices(ctx context.Context, allDevices []types.JID, ownID types.JID, id string, msgPlaintext, dsmPlaintext []byte, encAttrs waBinary.Attrs) ([]waBinary.Node, bool) {
+	log := waLog.With(cli.Log, waLog.FieldMessageID, id)
 	includeIdentity := false
 	participantNodes := make([]waBinary.Node, 0, len(allDevices))
 	var retryDevices []types.JID
@@ -1031,7 +1074,7 @@ func (cli *Client) encryptMessageForDevices(ctx context.Context, allDevices []ty
 			retryDevices = append(retryDevices, jid)
 			continue
 		} else if err != nil {
-			cli.Log.Warnf("Failed to encrypt %s for %s: %v", id, jid, err)
+			log.Warnf("Failed to encrypt %s for %s: %v", id, jid, err)
 			continue
 		}
 
@@ -1043,12 +1086,12 @@ func (cli *Client) encryptMessageForDevices(ctx context.Context, allDevices []ty
 	if len(retryDevices) > 0 {
 		bundles, err := cli.fetchPreKeys(ctx, retryDevices)
 		if err != nil {
-			cli.Log.Warnf("Failed to fetch prekeys for %v to retry encryption: %v", retryDevices, err)
+			log.Warnf("Failed to fetch prekeys for %v to retry encryption: %v", retryDevices, err)
 		} else {
 			for _, jid := range retryDevices {
 				resp := bundles[jid]
 				if resp.err != nil {
-					cli.Log.Warnf("Failed to fetch prekey for %s: %v", jid, resp.err)
+					log.Warnf("Failed to fetch prekey for %s: %v", jid, resp.err)
 					continue
 				}
 				plaintext := msgPlaintext
@@ -1057,7 +1100,7 @@ func (cli *Client) encryptMessageForDevices(ctx context.Context, allDevices []ty
 				}
 				encrypted, isPreKey, err := cli.encryptMessageForDeviceAndWrap(plaintext, jid, resp.bundle, encAttrs)
 				if err != nil {
-					cli.Log.Warnf("Failed to encrypt %s for %s (retry): %v", id, jid, err)
+					log.Warnf("Failed to encrypt %s for %s (retry): %v", id, jid, err)
 					continue
 				}
 				participantNodes = append(participantNodes, *encrypted)
@@ -1089,12 +1132,13 @@ func copyAttrs(from, to waBinary.Attrs) {
 }
 
 func (cli *Client) encryptMessageForDevice(plaintext []byte, to types.JID, bundle *prekey.Bundle, extraAttrs waBinary.Attrs) (*waBinary.Node, bool, error) {
+	log := waLog.With(cli.Log, waLog.FieldDevice, to)
 	builder := session.NewBuilderFromSignal(cli.Store, to.SignalAddress(), pbSerializer)
 	if bundle != nil {
-		cli.Log.Debugf("Processing prekey bundle for %s", to)
+		log.Debugf("Processing prekey bundle for %s", to)
 		err := builder.ProcessBundle(bundle)
 		if cli.AutoTrustIdentity && errors.Is(err, signalerror.ErrUntrustedIdentity) {
-			cli.Log.Warnf("Got %v error while trying to process prekey bundle for %s, clearing stored identity and retrying", err, to)
+			log.Warnf("Got %v error while trying to process prekey bundle for %s, clearing stored identity and retrying", err, to)
 			cli.clearUntrustedIdentity(to)
 			err = builder.ProcessBundle(bundle)
 		}
@@ -130,10 +130,35 @@ func (cli *Client) SendFBMessage(
 	}
 	resp.ID = req.ID
 
+	ctx, span := cli.startSpan(ctx, "send_fb_message")
+	span.SetAttribute("chat", to.String())
+	span.SetAttribute("message_id", req.ID)
+	defer func() {
+		span.End(time.Now(), err)
+	}()
+	resp.DebugTimings.trace = &messageTrace{ctx: ctx, tracer: cli.getTracer(ctx)}
+
+	defer func() {
+		cli.getMetrics().MessageSent(msgAttrs.Type, resp.DebugTimings, err)
+	}()
+
+	if !req.Peer {
+		var reservation *rateLimitReservation
+		reservation, err = cli.waitRateLimit(ctx, to)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				cli.refundRateLimit(reservation)
+			}
+		}()
+	}
+
 	start := time.Now()
 	// Sending multiple messages at a time can cause weird issues and makes it harder to retry safely
 	cli.messageSendLock.Lock()
-	resp.DebugTimings.Queue = time.Since(start)
+	resp.DebugTimings.Queue = resp.DebugTimings.stage("queue", start)
 	defer cli.messageSendLock.Unlock()
 
 	respChan := cli.waitResponse(req.ID)
@@ -141,15 +166,17 @@ func (cli *Client) SendFBMessage(
 		cli.addRecentMessage(to, req.ID, nil, messageAppProto)
 	}
 	var phash string
+	var participants []types.JID
 	var data []byte
 	switch to.Server {
 	case types.GroupServer:
-		phash, data, err = cli.sendGroupV3(ctx, to, ownID, req.ID, messageApp, msgAttrs, frankingTag, &resp.DebugTimings)
+		phash, participants, data, err = cli.sendGroupV3(ctx, to, ownID, req.ID, messageApp, msgAttrs, frankingTag, &resp.DebugTimings)
 	case types.DefaultUserServer, types.MessengerServer:
 		if req.Peer {
 			err = fmt.Errorf("peer messages to fb are not yet supported")
 			//data, err = cli.sendPeerMessage(to, req.ID, message, &resp.DebugTimings)
 		} else {
+			participants = []types.JID{to, ownID.ToNonAD()}
 			data, phash, err = cli.sendDMV3(ctx, to, ownID, req.ID, messageApp, msgAttrs, frankingTag, &resp.DebugTimings)
 		}
 	default:
@@ -178,11 +205,11 @@ func (cli *Client) SendFBMessage(
 		err = ctx.Err()
 		return
 	}
-	resp.DebugTimings.Resp = time.Since(start)
+	resp.DebugTimings.Resp = resp.DebugTimings.stage("resp", start)
 	if isDisconnectNode(respNode) {
 		start = time.Now()
 		respNode, err = cli.retryFrame("message send", req.ID, data, respNode, ctx, 0)
-		resp.DebugTimings.Retry = time.Since(start)
+		resp.DebugTimings.Retry = resp.DebugTimings.stage("retry", start)
 		if err != nil {
 			return
 		}
@@ -196,10 +223,7 @@ func (cli *Client) SendFBMessage(
 	expectedPHash := ag.OptionalString("phash")
 	if len(expectedPHash) > 0 && phash != expectedPHash {
 		cli.Log.Warnf("Server returned different participant list hash when sending to %s. Some devices may not have received the message.", to)
-		// TODO also invalidate device list caches
-		cli.groupParticipantsCacheLock.Lock()
-		delete(cli.groupParticipantsCache, to)
-		cli.groupParticipantsCacheLock.Unlock()
+		cli.invalidateParticipantCaches(to, participants)
 	}
 	return
 }
@@ -213,24 +237,24 @@ func (cli *Client) sendGroupV3(
 	msgAttrs messageAttrs,
 	frankingTag []byte,
 	timings *MessageDebugTimings,
-) (string, []byte, error) {
+) (string, []types.JID, []byte, error) {
 	var participants []types.JID
 	var err error
 	start := time.Now()
 	if to.Server == types.GroupServer {
 		participants, err = cli.getGroupMembers(ctx, to)
 		if err != nil {
-			return "", nil, fmt.Errorf("failed to get group members: %w", err)
+			return "", nil, nil, fmt.Errorf("failed to get group members: %w", err)
 		}
 	}
-	timings.GetParticipants = time.Since(start)
+	timings.GetParticipants = timings.stage("get_participants", start)
 
 	start = time.Now()
 	builder := groups.NewGroupSessionBuilder(cli.Store, pbSerializer)
 	senderKeyName := protocol.NewSenderKeyName(to.String(), ownID.SignalAddress())
 	signalSKDMessage, err := builder.Create(senderKeyName)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to create sender key distribution message to send %s to %s: %w", id, to, err)
+		return "", nil, nil, fmt.Errorf("failed to create sender key distribution message to send %s to %s: %w", id, to, err)
 	}
 	skdm := &waMsgTransport.MessageTransport_Protocol_Ancillary_SenderKeyDistributionMessage{
 		GroupID:                             proto.String(to.String()),
@@ -263,18 +287,18 @@ func (cli *Client) sendGroupV3(
 		},
 	})
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to marshal message transport: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to marshal message transport: %w", err)
 	}
 	encrypted, err := cipher.Encrypt(plaintext)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to encrypt group message to send %s to %s: %w", id, to, err)
+		return "", nil, nil, fmt.Errorf("failed to encrypt group message to send %s to %s: %w", id, to, err)
 	}
 	ciphertext := encrypted.SignedSerialize()
-	timings.GroupEncrypt = time.Since(start)
+	timings.GroupEncrypt = timings.stage("group_encrypt", start)
 
 	node, allDevices, err := cli.prepareMessageNodeV3(ctx, to, ownID, id, nil, skdm, msgAttrs, frankingTag, participants, timings)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 
 	phash := participantListHashV2(allDevices)
@@ -291,11 +315,11 @@ func (cli *Client) sendGroupV3(
 
 	start = time.Now()
 	data, err := cli.sendNodeAndGetData(*node)
-	timings.Send = time.Since(start)
+	timings.Send = timings.stage("send", start)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to send message node: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to send message node: %w", err)
 	}
-	return phash, data, nil
+	return phash, participants, data, nil
 }
 
 func (cli *Client) sendDMV3(
@@ -322,7 +346,7 @@ func (cli *Client) sendDMV3(
 	}
 	start := time.Now()
 	data, err := cli.sendNodeAndGetData(*node)
-	timings.Send = time.Since(start)
+	timings.Send = timings.stage("send", start)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to send message node: %w", err)
 	}
@@ -437,7 +461,7 @@ func (cli *Client) prepareMessageNodeV3(
 ) (*waBinary.Node, []types.JID, error) {
 	start := time.Now()
 	allDevices, err := cli.GetUserDevicesContext(ctx, participants)
-	timings.GetDevices = time.Since(start)
+	timings.GetDevices = timings.stage("get_devices", start)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get device list: %w", err)
 	}
@@ -466,7 +490,7 @@ func (cli *Client) prepareMessageNodeV3(
 
 	start = time.Now()
 	participantNodes := cli.encryptMessageForDevicesV3(ctx, allDevices, ownID, id, payload, skdm, dsm, encAttrs)
-	timings.PeerEncrypt = time.Since(start)
+	timings.PeerEncrypt = timings.stage("peer_encrypt", start)
 	content := make([]waBinary.Node, 0, 4)
 	content = append(content, waBinary.Node{
 		Tag:     "participants",
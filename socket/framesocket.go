@@ -10,6 +10,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -20,7 +21,7 @@ import (
 )
 
 type FrameSocket struct {
-	conn   *websocket.Conn
+	conn   TransportConn
 	ctx    context.Context
 	cancel func()
 	log    waLog.Logger
@@ -33,7 +34,9 @@ type FrameSocket struct {
 	OnDisconnect func(remote bool)
 	WriteTimeout time.Duration
 
-	Header []byte
+	Header    []byte
+	Transport Transport
+	// Deprecated: set Transport instead. If Transport is nil, a websocket transport using this dialer is used.
 	Dialer websocket.Dialer
 
 	incomingLength int
@@ -42,7 +45,16 @@ type FrameSocket struct {
 	partialHeader  []byte
 }
 
+// NewFrameSocket creates a new frame socket that connects to the WhatsApp web websocket using the given dialer.
+//
+// Deprecated: use NewFrameSocketWithTransport instead.
 func NewFrameSocket(log waLog.Logger, dialer websocket.Dialer) *FrameSocket {
+	return NewFrameSocketWithTransport(log, NewWebsocketTransport(dialer))
+}
+
+// NewFrameSocketWithTransport creates a new frame socket that connects using the given transport.
+// Use NewWebsocketTransport for the default websocket connection.
+func NewFrameSocketWithTransport(log waLog.Logger, transport Transport) *FrameSocket {
 	return &FrameSocket{
 		conn:   nil,
 		log:    log,
@@ -52,15 +64,19 @@ func NewFrameSocket(log waLog.Logger, dialer websocket.Dialer) *FrameSocket {
 		URL:         URL,
 		HTTPHeaders: http.Header{"Origin": {Origin}},
 
-		Dialer: dialer,
+		Transport: transport,
 	}
 }
 
 func (fs *FrameSocket) IsConnected() bool {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
 	return fs.conn != nil
 }
 
 func (fs *FrameSocket) Context() context.Context {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
 	return fs.ctx
 }
 
@@ -72,18 +88,10 @@ func (fs *FrameSocket) Close(code int) {
 		return
 	}
 
-	if code > 0 {
-		message := websocket.FormatCloseMessage(code, "")
-		err := fs.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
-		if err != nil {
-			fs.log.Warnf("Error sending close message: %v", err)
-		}
-	}
-
 	fs.cancel()
-	err := fs.conn.Close()
+	err := fs.conn.Close(code)
 	if err != nil {
-		fs.log.Errorf("Error closing websocket: %v", err)
+		fs.log.Errorf("Error closing socket: %v", err)
 	}
 	fs.conn = nil
 	fs.ctx = nil
@@ -102,48 +110,47 @@ func (fs *FrameSocket) Connect() error {
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 
+	transport := fs.Transport
+	if transport == nil {
+		transport = NewWebsocketTransport(fs.Dialer)
+	}
 	fs.log.Debugf("Dialing %s", fs.URL)
-	conn, _, err := fs.Dialer.Dial(fs.URL, fs.HTTPHeaders)
+	conn, err := transport.Dial(ctx, fs.URL, fs.HTTPHeaders)
 	if err != nil {
 		cancel()
-		return fmt.Errorf("couldn't dial whatsapp web websocket: %w", err)
+		return err
 	}
 
 	fs.ctx, fs.cancel = ctx, cancel
 	fs.conn = conn
-	conn.SetCloseHandler(func(code int, text string) error {
-		fs.log.Debugf("Server closed websocket with status %d/%s", code, text)
-		cancel()
-		// from default CloseHandler
-		message := websocket.FormatCloseMessage(code, "")
-		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
-		return nil
-	})
 
 	go fs.readPump(conn, ctx)
 	return nil
 }
 
 func (fs *FrameSocket) SendFrame(data []byte) error {
-	conn := fs.conn
-	if conn == nil {
-		return ErrSocketClosed
-	}
 	dataLength := len(data)
 	if dataLength >= FrameMaxSize {
 		return fmt.Errorf("%w (got %d bytes, max %d bytes)", ErrFrameTooLarge, len(data), FrameMaxSize)
 	}
 
-	headerLength := len(fs.Header)
+	fs.lock.Lock()
+	conn := fs.conn
+	if conn == nil {
+		fs.lock.Unlock()
+		return ErrSocketClosed
+	}
+	header := fs.Header
+	// We only want to send the header once
+	fs.Header = nil
+	fs.lock.Unlock()
+
+	headerLength := len(header)
 	// Whole frame is header + 3 bytes for length + data
 	wholeFrame := make([]byte, headerLength+FrameLengthSize+dataLength)
 
 	// Copy the header if it's there
-	if fs.Header != nil {
-		copy(wholeFrame[:headerLength], fs.Header)
-		// We only want to send the header once
-		fs.Header = nil
-	}
+	copy(wholeFrame[:headerLength], header)
 
 	// Encode length of frame
 	wholeFrame[headerLength] = byte(dataLength >> 16)
@@ -159,7 +166,7 @@ func (fs *FrameSocket) SendFrame(data []byte) error {
 			fs.log.Warnf("Failed to set write deadline: %v", err)
 		}
 	}
-	return conn.WriteMessage(websocket.BinaryMessage, wholeFrame)
+	return conn.WriteMessage(wholeFrame)
 }
 
 func (fs *FrameSocket) frameComplete() {
@@ -182,7 +189,6 @@ func (fs *FrameSocket) processData(msg []byte) {
 			if len(msg) >= FrameLengthSize {
 				length := (int(msg[0]) << 16) + (int(msg[1]) << 8) + int(msg[2])
 				fs.incomingLength = length
-				fs.receivedLength = len(msg)
 				msg = msg[FrameLengthSize:]
 				if len(msg) >= length {
 					fs.incoming = msg[:length]
@@ -190,7 +196,7 @@ func (fs *FrameSocket) processData(msg []byte) {
 					fs.frameComplete()
 				} else {
 					fs.incoming = make([]byte, length)
-					copy(fs.incoming, msg)
+					fs.receivedLength = copy(fs.incoming, msg)
 					msg = nil
 				}
 			} else {
@@ -212,23 +218,23 @@ func (fs *FrameSocket) processData(msg []byte) {
 	}
 }
 
-func (fs *FrameSocket) readPump(conn *websocket.Conn, ctx context.Context) {
-	fs.log.Debugf("Frame websocket read pump starting %p", fs)
+func (fs *FrameSocket) readPump(conn TransportConn, ctx context.Context) {
+	fs.log.Debugf("Frame socket read pump starting %p", fs)
 	defer func() {
-		fs.log.Debugf("Frame websocket read pump exiting %p", fs)
+		fs.log.Debugf("Frame socket read pump exiting %p", fs)
 		go fs.Close(0)
 	}()
 	for {
-		msgType, data, err := conn.ReadMessage()
+		data, err := conn.ReadMessage()
 		if err != nil {
-			// Ignore the error if the context has been closed
-			if !errors.Is(ctx.Err(), context.Canceled) {
-				fs.log.Errorf("Error reading from websocket: %v", err)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				// Ignore the error if the context has been closed
+			} else if errors.Is(err, io.EOF) {
+				fs.log.Debugf("Connection closed by server: %v", err)
+			} else {
+				fs.log.Errorf("Error reading from socket: %v", err)
 			}
 			return
-		} else if msgType != websocket.BinaryMessage {
-			fs.log.Warnf("Got unexpected websocket message type %d", msgType)
-			continue
 		}
 		fs.processData(data)
 	}
@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package socket
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+func TestFrameSocketPipe(t *testing.T) {
+	transport := NewPipeTransport()
+	defer transport.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	serverConns := make(chan TransportConn, 1)
+	go func() {
+		conn, err := transport.Accept(ctx)
+		if err != nil {
+			t.Errorf("Failed to accept connection: %v", err)
+		}
+		serverConns <- conn
+	}()
+	fs := NewFrameSocketWithTransport(waLog.Noop, transport)
+	if err := fs.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer fs.Close(0)
+	server := <-serverConns
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- fs.SendFrame([]byte("hello"))
+	}()
+	var received []byte
+	for len(received) < len(WAConnHeader)+FrameLengthSize+5 {
+		data, err := server.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read from server side: %v", err)
+		}
+		received = append(received, data...)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	expected := append(append([]byte{}, WAConnHeader...), 0, 0, 5, 'h', 'e', 'l', 'l', 'o')
+	if !bytes.Equal(received, expected) {
+		t.Errorf("Unexpected data on server side: %x", received)
+	}
+
+	// Two frames in one write, the second one split across writes
+	go func() {
+		_ = server.WriteMessage([]byte{0, 0, 1, 'a', 0, 0, 3, 'b'})
+		_ = server.WriteMessage([]byte{'c', 'd'})
+	}()
+	for _, want := range []string{"a", "bcd"} {
+		select {
+		case frame := <-fs.Frames:
+			if string(frame) != want {
+				t.Errorf("Expected frame %q, got %q", want, frame)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for frame %q", want)
+		}
+	}
+}
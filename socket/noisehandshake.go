@@ -74,13 +74,23 @@ func (nh *NoiseHandshake) Decrypt(ciphertext []byte) (plaintext []byte, err erro
 	return
 }
 
+// FinalKeys derives the ciphers used for the rest of the connection after the handshake is complete.
+// The write cipher is used for frames sent by the initiator and the read cipher for frames sent by the responder.
+func (nh *NoiseHandshake) FinalKeys() (writeKey, readKey cipher.AEAD, err error) {
+	write, read, err := nh.extractAndExpand(nh.salt, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to extract final keys: %w", err)
+	} else if writeKey, err = gcmutil.Prepare(write); err != nil {
+		return nil, nil, fmt.Errorf("failed to create final write cipher: %w", err)
+	} else if readKey, err = gcmutil.Prepare(read); err != nil {
+		return nil, nil, fmt.Errorf("failed to create final read cipher: %w", err)
+	}
+	return
+}
+
 func (nh *NoiseHandshake) Finish(fs *FrameSocket, frameHandler FrameHandler, disconnectHandler DisconnectHandler) (*NoiseSocket, error) {
-	if write, read, err := nh.extractAndExpand(nh.salt, nil); err != nil {
-		return nil, fmt.Errorf("failed to extract final keys: %w", err)
-	} else if writeKey, err := gcmutil.Prepare(write); err != nil {
-		return nil, fmt.Errorf("failed to create final write cipher: %w", err)
-	} else if readKey, err := gcmutil.Prepare(read); err != nil {
-		return nil, fmt.Errorf("failed to create final read cipher: %w", err)
+	if writeKey, readKey, err := nh.FinalKeys(); err != nil {
+		return nil, err
 	} else if ns, err := newNoiseSocket(fs, writeKey, readKey, frameHandler, disconnectHandler); err != nil {
 		return nil, fmt.Errorf("failed to create noise socket: %w", err)
 	} else {
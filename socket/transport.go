@@ -0,0 +1,247 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package socket
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport is used by FrameSocket to open connections to the server.
+//
+// The returned connection carries the raw frame stream: FrameSocket takes care of the connection header and
+// frame length prefixes, so the transport only needs to move bytes back and forth.
+type Transport interface {
+	Dial(ctx context.Context, url string, headers http.Header) (TransportConn, error)
+}
+
+// TransportConn is a connection opened by a Transport.
+type TransportConn interface {
+	// ReadMessage blocks until some data is received. The data may contain partial frames or multiple frames.
+	// When the connection is closed by the other side, the error must wrap io.EOF.
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends data to the server. A single call will always contain one or more whole frames.
+	WriteMessage(data []byte) error
+	// SetWriteDeadline sets the deadline for future WriteMessage calls.
+	SetWriteDeadline(t time.Time) error
+	// Close closes the connection. If code is non-zero, transports that support it should send it
+	// to the server as the reason for closing.
+	Close(code int) error
+}
+
+// WebsocketTransport is the default transport, which connects to the WhatsApp web websocket.
+type WebsocketTransport struct {
+	Dialer websocket.Dialer
+}
+
+var _ Transport = (*WebsocketTransport)(nil)
+
+// NewWebsocketTransport creates a websocket transport that uses the given dialer.
+func NewWebsocketTransport(dialer websocket.Dialer) *WebsocketTransport {
+	return &WebsocketTransport{Dialer: dialer}
+}
+
+func (wt *WebsocketTransport) Dial(ctx context.Context, url string, headers http.Header) (TransportConn, error) {
+	conn, _, err := wt.Dialer.DialContext(ctx, url, headers)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't dial whatsapp web websocket: %w", err)
+	}
+	conn.SetCloseHandler(func(code int, text string) error {
+		// from default CloseHandler
+		message := websocket.FormatCloseMessage(code, "")
+		_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		return nil
+	})
+	return &websocketConn{conn: conn}, nil
+}
+
+type websocketConn struct {
+	conn *websocket.Conn
+}
+
+func (wc *websocketConn) ReadMessage() ([]byte, error) {
+	for {
+		msgType, data, err := wc.conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			return nil, fmt.Errorf("server closed websocket with status %d/%s: %w", closeErr.Code, closeErr.Text, io.EOF)
+		} else if err != nil {
+			return nil, err
+		} else if msgType == websocket.BinaryMessage {
+			return data, nil
+		}
+		// Non-binary messages aren't used by WhatsApp, so just ignore them
+	}
+}
+
+func (wc *websocketConn) WriteMessage(data []byte) error {
+	return wc.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (wc *websocketConn) SetWriteDeadline(t time.Time) error {
+	return wc.conn.SetWriteDeadline(t)
+}
+
+func (wc *websocketConn) Close(code int) error {
+	if code > 0 {
+		message := websocket.FormatCloseMessage(code, "")
+		err := wc.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		if err != nil {
+			_ = wc.conn.Close()
+			return fmt.Errorf("error sending close message: %w", err)
+		}
+	}
+	return wc.conn.Close()
+}
+
+// TCPTransport connects to the server over a raw TCP (or TLS) stream without websocket framing.
+// The URL passed to Dial must be in the form tcp://host:port or tls://host:port.
+type TCPTransport struct {
+	// DialContext is used to open the connection. If nil, a default net.Dialer is used.
+	// This can be used to plug in custom network stacks.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// TLSConfig is used for tls:// URLs.
+	TLSConfig *tls.Config
+}
+
+var _ Transport = (*TCPTransport)(nil)
+
+func (tt *TCPTransport) Dial(ctx context.Context, rawURL string, _ http.Header) (TransportConn, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	} else if parsed.Scheme != "tcp" && parsed.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported URL scheme %q for TCP transport", parsed.Scheme)
+	}
+	dial := tt.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", parsed.Host)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't dial %s: %w", parsed.Host, err)
+	}
+	if parsed.Scheme == "tls" {
+		tlsConfig := tt.TLSConfig.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = parsed.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %s failed: %w", parsed.Host, err)
+		}
+		conn = tlsConn
+	}
+	return NewNetConn(conn), nil
+}
+
+// NewNetConn wraps a stream connection into a TransportConn.
+func NewNetConn(conn net.Conn) TransportConn {
+	return &netConn{conn: conn, buf: make([]byte, 32*1024)}
+}
+
+type netConn struct {
+	conn net.Conn
+	buf  []byte
+}
+
+func (nc *netConn) ReadMessage() ([]byte, error) {
+	n, err := nc.conn.Read(nc.buf)
+	if n > 0 {
+		// Return the data first, any error will be returned again by the next read
+		return append([]byte(nil), nc.buf[:n]...), nil
+	} else if errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+		return nil, fmt.Errorf("%w: %w", io.EOF, err)
+	}
+	return nil, err
+}
+
+func (nc *netConn) WriteMessage(data []byte) error {
+	_, err := nc.conn.Write(data)
+	return err
+}
+
+func (nc *netConn) SetWriteDeadline(t time.Time) error {
+	return nc.conn.SetWriteDeadline(t)
+}
+
+func (nc *netConn) Close(_ int) error {
+	return nc.conn.Close()
+}
+
+// PipeTransport is an in-memory transport for tests. Every Dial call creates a new connection pair,
+// and the server side of the pair can be received with Accept.
+type PipeTransport struct {
+	conns     chan TransportConn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Transport = (*PipeTransport)(nil)
+
+// ErrTransportClosed is returned by PipeTransport after it has been closed.
+var ErrTransportClosed = errors.New("transport is closed")
+
+// NewPipeTransport creates a new in-memory transport.
+func NewPipeTransport() *PipeTransport {
+	return &PipeTransport{
+		conns:  make(chan TransportConn),
+		closed: make(chan struct{}),
+	}
+}
+
+// NewPipe returns both ends of a new in-memory connection.
+func NewPipe() (client, server TransportConn) {
+	clientConn, serverConn := net.Pipe()
+	return NewNetConn(clientConn), NewNetConn(serverConn)
+}
+
+// Dial creates a new connection and waits until the server end is accepted. The URL and headers are ignored.
+func (pt *PipeTransport) Dial(ctx context.Context, _ string, _ http.Header) (TransportConn, error) {
+	client, server := NewPipe()
+	select {
+	case pt.conns <- server:
+		return client, nil
+	case <-pt.closed:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Accept waits for the next Dial call and returns the server end of the connection.
+func (pt *PipeTransport) Accept(ctx context.Context) (TransportConn, error) {
+	select {
+	case conn := <-pt.conns:
+		return conn, nil
+	case <-pt.closed:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops accepting new connections. Existing connections are not closed.
+func (pt *PipeTransport) Close() {
+	pt.closeOnce.Do(func() {
+		close(pt.closed)
+	})
+}
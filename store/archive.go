@@ -0,0 +1,589 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mau.fi/util/random"
+	"golang.org/x/crypto/scrypt"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/gcmutil"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+const (
+	// ArchiveFormat is the value of the format field in device archives.
+	ArchiveFormat = "whatsmeow-device-archive"
+	// ArchiveVersion is the current version of the device archive format.
+	ArchiveVersion = 1
+)
+
+var (
+	ErrArchiveExportNotSupported = errors.New("store doesn't support exporting data")
+	ErrArchiveImportNotSupported = errors.New("store doesn't support importing prekeys")
+	ErrInvalidArchive            = errors.New("not a whatsmeow device archive")
+	ErrUnsupportedArchiveVersion = errors.New("unsupported device archive version")
+	ErrArchivePassphraseRequired = errors.New("device archive is encrypted, but no passphrase was given")
+	ErrWrongArchivePassphrase    = errors.New("failed to decrypt device archive (wrong passphrase?)")
+	ErrArchiveDeviceExists       = errors.New("device from archive already exists in the target container")
+)
+
+// deviceGetter is implemented by device containers that can look up devices by JID.
+// Restore uses it to avoid overwriting existing devices.
+type deviceGetter interface {
+	GetDevice(jid types.JID) (*Device, error)
+}
+
+// DataExporter is implemented by stores that can list all the data of a device, which is needed for Device.Export.
+type DataExporter interface {
+	ExportData() (*DeviceData, error)
+}
+
+// PreKeyImporter is implemented by PreKeyStores that can store existing prekeys, which is needed for ImportDevice.
+type PreKeyImporter interface {
+	ImportPreKey(key *keys.PreKey, uploaded bool) error
+}
+
+// DeviceData contains all the data that the stores of a single device hold. It's used in device archives.
+type DeviceData struct {
+	Identities       []ArchivedIdentity      `json:"identities"`
+	Sessions         []ArchivedSession       `json:"sessions"`
+	PreKeys          []ArchivedPreKey        `json:"pre_keys"`
+	SenderKeys       []ArchivedSenderKey     `json:"sender_keys"`
+	AppStateSyncKeys []ArchivedAppStateKey   `json:"app_state_sync_keys"`
+	AppStates        []ArchivedAppState      `json:"app_states"`
+	Contacts         []ArchivedContact       `json:"contacts"`
+	ChatSettings     []ArchivedChatSettings  `json:"chat_settings"`
+	MessageSecrets   []ArchivedMessageSecret `json:"message_secrets"`
+	PrivacyTokens    []ArchivedPrivacyToken  `json:"privacy_tokens"`
+}
+
+type ArchivedIdentity struct {
+	Address string `json:"address"`
+	Key     []byte `json:"key"`
+}
+
+type ArchivedSession struct {
+	Address string `json:"address"`
+	Session []byte `json:"session"`
+}
+
+type ArchivedPreKey struct {
+	KeyID    uint32 `json:"key_id"`
+	Key      []byte `json:"key"`
+	Uploaded bool   `json:"uploaded"`
+}
+
+type ArchivedSenderKey struct {
+	Group     string `json:"group"`
+	User      string `json:"user"`
+	SenderKey []byte `json:"sender_key"`
+}
+
+type ArchivedAppStateKey struct {
+	KeyID       []byte `json:"key_id"`
+	Data        []byte `json:"data"`
+	Fingerprint []byte `json:"fingerprint"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+type ArchivedAppState struct {
+	Name         string                  `json:"name"`
+	Version      uint64                  `json:"version"`
+	Hash         []byte                  `json:"hash"`
+	MutationMACs []ArchivedMutationMAC   `json:"mutation_macs"`
+	Values       []ArchivedAppStateValue `json:"values,omitempty"`
+}
+
+// ArchivedAppStateValue is the current value of an app state index. The value is a protobuf-encoded SyncActionValue.
+type ArchivedAppStateValue struct {
+	Index []string `json:"index"`
+	Value []byte   `json:"value"`
+}
+
+type ArchivedMutationMAC struct {
+	Version  uint64 `json:"version"`
+	IndexMAC []byte `json:"index_mac"`
+	ValueMAC []byte `json:"value_mac"`
+}
+
+type ArchivedContact struct {
+	JID          types.JID `json:"jid"`
+	FirstName    string    `json:"first_name,omitempty"`
+	FullName     string    `json:"full_name,omitempty"`
+	PushName     string    `json:"push_name,omitempty"`
+	BusinessName string    `json:"business_name,omitempty"`
+}
+
+type ArchivedChatSettings struct {
+	Chat                types.JID `json:"chat"`
+	MutedUntil          int64     `json:"muted_until,omitempty"`
+	Pinned              bool      `json:"pinned,omitempty"`
+	Archived            bool      `json:"archived,omitempty"`
+	MarkedAsUnread      bool      `json:"marked_as_unread,omitempty"`
+	LastCleared         int64     `json:"last_cleared,omitempty"`
+	EphemeralExpiration uint32    `json:"ephemeral_expiration,omitempty"`
+	Locked              bool      `json:"locked,omitempty"`
+	Labels              []string  `json:"labels,omitempty"`
+}
+
+type ArchivedMessageSecret struct {
+	Chat   types.JID       `json:"chat"`
+	Sender types.JID       `json:"sender"`
+	ID     types.MessageID `json:"id"`
+	Secret []byte          `json:"secret"`
+}
+
+type ArchivedPrivacyToken struct {
+	User      types.JID `json:"user"`
+	Token     []byte    `json:"token"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+type archivedDevice struct {
+	JID             types.JID `json:"jid"`
+	RegistrationID  uint32    `json:"registration_id"`
+	NoiseKey        []byte    `json:"noise_key"`
+	IdentityKey     []byte    `json:"identity_key"`
+	SignedPreKey    []byte    `json:"signed_pre_key"`
+	SignedPreKeyID  uint32    `json:"signed_pre_key_id"`
+	SignedPreKeySig []byte    `json:"signed_pre_key_sig"`
+	AdvSecretKey    []byte    `json:"adv_secret_key"`
+	Account         []byte    `json:"account"`
+	Platform        string    `json:"platform,omitempty"`
+	BusinessName    string    `json:"business_name,omitempty"`
+	PushName        string    `json:"push_name,omitempty"`
+	FacebookUUID    uuid.UUID `json:"facebook_uuid,omitempty"`
+
+	SignedPreKeyCreatedAt int64  `json:"signed_pre_key_created_at,omitempty"`
+	PrevSignedPreKey      []byte `json:"prev_signed_pre_key,omitempty"`
+	PrevSignedPreKeyID    uint32 `json:"prev_signed_pre_key_id,omitempty"`
+	PrevSignedPreKeySig   []byte `json:"prev_signed_pre_key_sig,omitempty"`
+}
+
+type archiveContent struct {
+	Device archivedDevice `json:"device"`
+	Data   *DeviceData    `json:"data"`
+}
+
+type archiveEncryption struct {
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Nonce []byte `json:"nonce"`
+}
+
+type archiveEnvelope struct {
+	Format     string             `json:"format"`
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Encryption *archiveEncryption `json:"encryption,omitempty"`
+	// Content is set for unencrypted archives, Ciphertext for encrypted ones.
+	Content    *archiveContent `json:"content,omitempty"`
+	Ciphertext []byte          `json:"ciphertext,omitempty"`
+}
+
+// scrypt parameters for new archives. The parameters are stored in the archive, so they can be changed later.
+const (
+	archiveScryptN = 1 << 15
+	archiveScryptR = 8
+	archiveScryptP = 1
+)
+
+func (enc *archiveEncryption) key(passphrase string) ([]byte, error) {
+	if enc.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation function %q", enc.KDF)
+	}
+	return scrypt.Key([]byte(passphrase), enc.Salt, enc.N, enc.R, enc.P, 32)
+}
+
+func archiveAdditionalData(version int) []byte {
+	return []byte(fmt.Sprintf("%s/%d", ArchiveFormat, version))
+}
+
+// Export writes all the data of this device into a versioned archive, which can be restored
+// into any DeviceContainer using ImportDevice.
+//
+// If passphrase is not empty, the contents of the archive are encrypted with a key derived from it.
+// Note that unencrypted archives contain all the private keys of the device in plaintext.
+//
+// The stores of the device must implement DataExporter.
+func (device *Device) Export(w io.Writer, passphrase string) error {
+	if device.ID == nil {
+		return fmt.Errorf("can't export device that isn't logged in")
+	}
+	exporter, ok := device.Identities.(DataExporter)
+	if !ok {
+		return ErrArchiveExportNotSupported
+	}
+	data, err := exporter.ExportData()
+	if err != nil {
+		return fmt.Errorf("failed to export data: %w", err)
+	}
+	account, err := proto.Marshal(device.Account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %w", err)
+	}
+	signedPreKey, prevSignedPreKey, signedPreKeyCreatedAt := device.GetSignedPreKeys()
+	content := &archiveContent{
+		Device: archivedDevice{
+			JID:             *device.ID,
+			RegistrationID:  device.RegistrationID,
+			NoiseKey:        device.NoiseKey.Priv[:],
+			IdentityKey:     device.IdentityKey.Priv[:],
+			SignedPreKey:    signedPreKey.Priv[:],
+			SignedPreKeyID:  signedPreKey.KeyID,
+			SignedPreKeySig: signedPreKey.Signature[:],
+			AdvSecretKey:    device.AdvSecretKey,
+			Account:         account,
+			Platform:        device.Platform,
+			BusinessName:    device.BusinessName,
+			PushName:        device.PushName,
+			FacebookUUID:    device.FacebookUUID,
+		},
+		Data: data,
+	}
+	if !signedPreKeyCreatedAt.IsZero() {
+		content.Device.SignedPreKeyCreatedAt = signedPreKeyCreatedAt.Unix()
+	}
+	if prev := prevSignedPreKey; prev != nil {
+		content.Device.PrevSignedPreKey = prev.Priv[:]
+		content.Device.PrevSignedPreKeyID = prev.KeyID
+		content.Device.PrevSignedPreKeySig = prev.Signature[:]
+	}
+	envelope := archiveEnvelope{
+		Format:     ArchiveFormat,
+		Version:    ArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+	}
+	if passphrase == "" {
+		envelope.Content = content
+	} else {
+		envelope.Encryption = &archiveEncryption{
+			KDF:   "scrypt",
+			Salt:  random.Bytes(16),
+			N:     archiveScryptN,
+			R:     archiveScryptR,
+			P:     archiveScryptP,
+			Nonce: random.Bytes(12),
+		}
+		var plaintext, key []byte
+		plaintext, err = json.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("failed to marshal archive content: %w", err)
+		}
+		key, err = envelope.Encryption.key(passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to derive archive key: %w", err)
+		}
+		envelope.Ciphertext, err = gcmutil.Encrypt(key, envelope.Encryption.Nonce, plaintext, archiveAdditionalData(envelope.Version))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt archive: %w", err)
+		}
+	}
+	return json.NewEncoder(w).Encode(&envelope)
+}
+
+func readArchive(r io.Reader, passphrase string) (time.Time, *archiveContent, error) {
+	var envelope archiveEnvelope
+	err := json.NewDecoder(r).Decode(&envelope)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	} else if envelope.Format != ArchiveFormat {
+		return time.Time{}, nil, ErrInvalidArchive
+	} else if envelope.Version != ArchiveVersion {
+		return time.Time{}, nil, fmt.Errorf("%w %d", ErrUnsupportedArchiveVersion, envelope.Version)
+	}
+	if envelope.Encryption == nil {
+		if envelope.Content == nil {
+			return time.Time{}, nil, fmt.Errorf("%w: missing content", ErrInvalidArchive)
+		}
+		return envelope.ExportedAt, envelope.Content, nil
+	} else if passphrase == "" {
+		return time.Time{}, nil, ErrArchivePassphraseRequired
+	}
+	key, err := envelope.Encryption.key(passphrase)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("failed to derive archive key: %w", err)
+	}
+	plaintext, err := gcmutil.Decrypt(key, envelope.Encryption.Nonce, envelope.Ciphertext, archiveAdditionalData(envelope.Version))
+	if err != nil {
+		return time.Time{}, nil, ErrWrongArchivePassphrase
+	}
+	var content archiveContent
+	err = json.Unmarshal(plaintext, &content)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	return envelope.ExportedAt, &content, nil
+}
+
+func (ad *archivedDevice) apply(device *Device) error {
+	if len(ad.NoiseKey) != 32 || len(ad.IdentityKey) != 32 || len(ad.SignedPreKey) != 32 || len(ad.SignedPreKeySig) != 64 {
+		return fmt.Errorf("%w: invalid device key length", ErrInvalidArchive)
+	} else if ad.PrevSignedPreKey != nil && (len(ad.PrevSignedPreKey) != 32 || len(ad.PrevSignedPreKeySig) != 64) {
+		return fmt.Errorf("%w: invalid previous signed prekey length", ErrInvalidArchive)
+	}
+	var account waAdv.ADVSignedDeviceIdentity
+	err := proto.Unmarshal(ad.Account, &account)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal account: %w", err)
+	}
+	jid := ad.JID
+	device.ID = &jid
+	device.RegistrationID = ad.RegistrationID
+	device.NoiseKey = keys.NewKeyPairFromPrivateKey([32]byte(ad.NoiseKey))
+	device.IdentityKey = keys.NewKeyPairFromPrivateKey([32]byte(ad.IdentityKey))
+	device.SignedPreKey = &keys.PreKey{
+		KeyPair:   *keys.NewKeyPairFromPrivateKey([32]byte(ad.SignedPreKey)),
+		KeyID:     ad.SignedPreKeyID,
+		Signature: (*[64]byte)(ad.SignedPreKeySig),
+	}
+	device.SignedPreKeyCreatedAt = unixOrZero(ad.SignedPreKeyCreatedAt)
+	device.PreviousSignedPreKey = nil
+	if ad.PrevSignedPreKey != nil {
+		device.PreviousSignedPreKey = &keys.PreKey{
+			KeyPair:   *keys.NewKeyPairFromPrivateKey([32]byte(ad.PrevSignedPreKey)),
+			KeyID:     ad.PrevSignedPreKeyID,
+			Signature: (*[64]byte)(ad.PrevSignedPreKeySig),
+		}
+	}
+	device.AdvSecretKey = ad.AdvSecretKey
+	device.Account = &account
+	device.Platform = ad.Platform
+	device.BusinessName = ad.BusinessName
+	device.PushName = ad.PushName
+	device.FacebookUUID = ad.FacebookUUID
+	return nil
+}
+
+// DeviceArchive is a decoded device archive created with Device.Export.
+type DeviceArchive struct {
+	ExportedAt time.Time
+
+	content *archiveContent
+}
+
+// ReadDeviceArchive reads and decrypts a device archive created with Device.Export.
+//
+// The passphrase is only required if the archive is encrypted.
+func ReadDeviceArchive(r io.Reader, passphrase string) (*DeviceArchive, error) {
+	exportedAt, content, err := readArchive(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceArchive{ExportedAt: exportedAt, content: content}, nil
+}
+
+// JID returns the JID of the device in the archive.
+func (archive *DeviceArchive) JID() types.JID {
+	return archive.content.Device.JID
+}
+
+// Restore writes the contents of the archive into the given device.
+//
+// The device should be a new device from the target container (e.g. from sqlstore.Container.NewDevice).
+// All the keys of the device are replaced with the ones from the archive, after which the device is saved
+// and the rest of the data is written into its stores. The prekey store must implement PreKeyImporter.
+//
+// If the container already has a device with the same JID, ErrArchiveDeviceExists is returned.
+// The existing device must be deleted first to replace it with the archive.
+func (archive *DeviceArchive) Restore(device *Device) error {
+	if getter, ok := device.Container.(deviceGetter); ok {
+		existing, err := getter.GetDevice(archive.JID())
+		if err != nil {
+			return fmt.Errorf("failed to check for existing device: %w", err)
+		} else if existing != nil {
+			return fmt.Errorf("%w: %s", ErrArchiveDeviceExists, archive.JID())
+		}
+	}
+	err := archive.content.Device.apply(device)
+	if err != nil {
+		return err
+	}
+	if err = device.Save(); err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	if archive.content.Data != nil {
+		if err = archive.content.Data.importInto(device); err != nil {
+			return fmt.Errorf("failed to import data: %w", err)
+		}
+	}
+	return nil
+}
+
+// ImportDevice is a shortcut for ReadDeviceArchive followed by DeviceArchive.Restore.
+func ImportDevice(r io.Reader, passphrase string, device *Device) error {
+	archive, err := ReadDeviceArchive(r, passphrase)
+	if err != nil {
+		return err
+	}
+	return archive.Restore(device)
+}
+
+func (data *DeviceData) importInto(device *Device) error {
+	preKeyImporter, ok := device.PreKeys.(PreKeyImporter)
+	if !ok && len(data.PreKeys) > 0 {
+		return ErrArchiveImportNotSupported
+	}
+	for _, identity := range data.Identities {
+		if len(identity.Key) != 32 {
+			return fmt.Errorf("%w: invalid identity key length for %s", ErrInvalidArchive, identity.Address)
+		} else if err := device.Identities.PutIdentity(identity.Address, [32]byte(identity.Key)); err != nil {
+			return fmt.Errorf("failed to import identity of %s: %w", identity.Address, err)
+		}
+	}
+	for _, session := range data.Sessions {
+		if err := device.Sessions.PutSession(session.Address, session.Session); err != nil {
+			return fmt.Errorf("failed to import session with %s: %w", session.Address, err)
+		}
+	}
+	for _, preKey := range data.PreKeys {
+		if len(preKey.Key) != 32 {
+			return fmt.Errorf("%w: invalid length for prekey %d", ErrInvalidArchive, preKey.KeyID)
+		}
+		key := &keys.PreKey{
+			KeyPair: *keys.NewKeyPairFromPrivateKey([32]byte(preKey.Key)),
+			KeyID:   preKey.KeyID,
+		}
+		if err := preKeyImporter.ImportPreKey(key, preKey.Uploaded); err != nil {
+			return fmt.Errorf("failed to import prekey %d: %w", preKey.KeyID, err)
+		}
+	}
+	for _, senderKey := range data.SenderKeys {
+		if err := device.SenderKeys.PutSenderKey(senderKey.Group, senderKey.User, senderKey.SenderKey); err != nil {
+			return fmt.Errorf("failed to import sender key of %s in %s: %w", senderKey.User, senderKey.Group, err)
+		}
+	}
+	for _, key := range data.AppStateSyncKeys {
+		err := device.AppStateKeys.PutAppStateSyncKey(key.KeyID, AppStateSyncKey{
+			Data:        key.Data,
+			Fingerprint: key.Fingerprint,
+			Timestamp:   key.Timestamp,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import app state sync key %X: %w", key.KeyID, err)
+		}
+	}
+	for _, state := range data.AppStates {
+		if len(state.Hash) != 128 {
+			return fmt.Errorf("%w: invalid hash length for app state %s", ErrInvalidArchive, state.Name)
+		} else if err := device.AppState.PutAppStateVersion(state.Name, state.Version, [128]byte(state.Hash)); err != nil {
+			return fmt.Errorf("failed to import app state version of %s: %w", state.Name, err)
+		}
+		macsByVersion := make(map[uint64][]AppStateMutationMAC)
+		for _, mac := range state.MutationMACs {
+			macsByVersion[mac.Version] = append(macsByVersion[mac.Version], AppStateMutationMAC{IndexMAC: mac.IndexMAC, ValueMAC: mac.ValueMAC})
+		}
+		for version, macs := range macsByVersion {
+			if err := device.AppState.PutAppStateMutationMACs(state.Name, version, macs); err != nil {
+				return fmt.Errorf("failed to import mutation MACs of %s: %w", state.Name, err)
+			}
+		}
+		values := make([]AppStateValue, len(state.Values))
+		for i, value := range state.Values {
+			values[i] = AppStateValue{Index: value.Index, Value: &waSyncAction.SyncActionValue{}}
+			if err := proto.Unmarshal(value.Value, values[i].Value); err != nil {
+				return fmt.Errorf("%w: invalid value of %v in app state %s: %v", ErrInvalidArchive, value.Index, state.Name, err)
+			}
+		}
+		if err := device.AppStateValues.PutAppStateValues(state.Name, values); err != nil {
+			return fmt.Errorf("failed to import values of %s: %w", state.Name, err)
+		}
+	}
+	contactNames := make([]ContactEntry, 0, len(data.Contacts))
+	for _, contact := range data.Contacts {
+		contactNames = append(contactNames, ContactEntry{JID: contact.JID, FirstName: contact.FirstName, FullName: contact.FullName})
+	}
+	if err := device.Contacts.PutAllContactNames(contactNames); err != nil {
+		return fmt.Errorf("failed to import contact names: %w", err)
+	}
+	for _, contact := range data.Contacts {
+		if contact.PushName != "" {
+			if _, _, err := device.Contacts.PutPushName(contact.JID, contact.PushName); err != nil {
+				return fmt.Errorf("failed to import push name of %s: %w", contact.JID, err)
+			}
+		}
+		if contact.BusinessName != "" {
+			if _, _, err := device.Contacts.PutBusinessName(contact.JID, contact.BusinessName); err != nil {
+				return fmt.Errorf("failed to import business name of %s: %w", contact.JID, err)
+			}
+		}
+	}
+	for _, settings := range data.ChatSettings {
+		if err := importChatSettings(device.ChatSettings, settings); err != nil {
+			return fmt.Errorf("failed to import chat settings of %s: %w", settings.Chat, err)
+		}
+	}
+	if len(data.MessageSecrets) > 0 {
+		secrets := make([]MessageSecretInsert, len(data.MessageSecrets))
+		for i, secret := range data.MessageSecrets {
+			secrets[i] = MessageSecretInsert{Chat: secret.Chat, Sender: secret.Sender, ID: secret.ID, Secret: secret.Secret}
+		}
+		if err := device.MsgSecrets.PutMessageSecrets(secrets); err != nil {
+			return fmt.Errorf("failed to import message secrets: %w", err)
+		}
+	}
+	if len(data.PrivacyTokens) > 0 {
+		tokens := make([]PrivacyToken, len(data.PrivacyTokens))
+		for i, token := range data.PrivacyTokens {
+			tokens[i] = PrivacyToken{User: token.User, Token: token.Token, Timestamp: time.Unix(token.Timestamp, 0)}
+		}
+		if err := device.PrivacyTokens.PutPrivacyTokens(tokens...); err != nil {
+			return fmt.Errorf("failed to import privacy tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+func unixOrZero(ts int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
+
+func importChatSettings(chatSettings ChatSettingsStore, settings ArchivedChatSettings) error {
+	err := chatSettings.PutMutedUntil(settings.Chat, unixOrZero(settings.MutedUntil))
+	if err == nil {
+		err = chatSettings.PutPinned(settings.Chat, settings.Pinned)
+	}
+	if err == nil {
+		err = chatSettings.PutArchived(settings.Chat, settings.Archived)
+	}
+	if err == nil {
+		err = chatSettings.PutMarkedAsUnread(settings.Chat, settings.MarkedAsUnread)
+	}
+	if err == nil {
+		err = chatSettings.PutLastCleared(settings.Chat, unixOrZero(settings.LastCleared))
+	}
+	if err == nil {
+		err = chatSettings.PutEphemeralExpiration(settings.Chat, settings.EphemeralExpiration)
+	}
+	if err == nil {
+		err = chatSettings.PutLocked(settings.Chat, settings.Locked)
+	}
+	for _, labelID := range settings.Labels {
+		if err != nil {
+			break
+		}
+		err = chatSettings.PutChatLabel(settings.Chat, labelID, true)
+	}
+	return err
+}
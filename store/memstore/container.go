@@ -0,0 +1,283 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package memstore contains an in-memory implementation of the interfaces in the store package.
+//
+// Everything is lost when the process exits, unless the container is explicitly saved with
+// Container.Snapshot and loaded back with Restore.
+package memstore
+
+import (
+	"errors"
+	mathRand "math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mau.fi/util/random"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+// ErrDeviceIDMustBeSet is the error returned by PutDevice if you try to save a device before knowing its JID.
+var ErrDeviceIDMustBeSet = errors.New("device JID must be known before accessing the store")
+
+// deviceRecord contains the fields of a store.Device that are saved by PutDevice.
+type deviceRecord struct {
+	ID             types.JID
+	RegistrationID uint32
+	NoiseKey       [32]byte
+	IdentityKey    [32]byte
+
+	SignedPreKey          [32]byte
+	SignedPreKeyID        uint32
+	SignedPreKeySig       [64]byte
+	SignedPreKeyCreatedAt time.Time
+
+	// The previous signed prekey is only set if HasPrevSignedPreKey is true
+	HasPrevSignedPreKey bool
+	PrevSignedPreKey    [32]byte
+	PrevSignedPreKeyID  uint32
+	PrevSignedPreKeySig [64]byte
+
+	AdvSecretKey []byte
+	Account      []byte
+
+	Platform     string
+	BusinessName string
+	PushName     string
+	FacebookUUID uuid.UUID
+}
+
+// Container is an in-memory store that can contain multiple whatsmeow sessions.
+type Container struct {
+	log           waLog.Logger
+	storeMessages bool
+
+	lock    sync.RWMutex
+	devices map[types.JID]*deviceRecord
+	stores  map[types.JID]*MemoryStore
+}
+
+var _ store.DeviceContainer = (*Container)(nil)
+
+// New creates a new empty in-memory Container.
+//
+// The logger can be nil and will default to a no-op logger.
+func New(log waLog.Logger) *Container {
+	if log == nil {
+		log = waLog.Noop
+	}
+	return &Container{
+		log:     log,
+		devices: make(map[types.JID]*deviceRecord),
+		stores:  make(map[types.JID]*MemoryStore),
+	}
+}
+
+// NewDevice creates a new device in this container.
+//
+// No data is actually stored before Save is called. However, the pairing process will automatically
+// call Save after a successful pairing, so you most likely don't need to call it yourself.
+func (c *Container) NewDevice() *store.Device {
+	device := &store.Device{
+		Log:       c.log,
+		Container: c,
+
+		NoiseKey:       keys.NewKeyPair(),
+		IdentityKey:    keys.NewKeyPair(),
+		RegistrationID: mathRand.Uint32(),
+		AdvSecretKey:   random.Bytes(32),
+	}
+	device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(1)
+	device.SignedPreKeyCreatedAt = time.Now()
+	return device
+}
+
+func (c *Container) recordToDevice(record *deviceRecord) (*store.Device, error) {
+	var account waAdv.ADVSignedDeviceIdentity
+	if err := proto.Unmarshal(record.Account, &account); err != nil {
+		return nil, err
+	}
+	id := record.ID
+	signature := record.SignedPreKeySig
+	device := &store.Device{
+		Log:       c.log,
+		Container: c,
+
+		NoiseKey:    keys.NewKeyPairFromPrivateKey(record.NoiseKey),
+		IdentityKey: keys.NewKeyPairFromPrivateKey(record.IdentityKey),
+		SignedPreKey: &keys.PreKey{
+			KeyPair:   *keys.NewKeyPairFromPrivateKey(record.SignedPreKey),
+			KeyID:     record.SignedPreKeyID,
+			Signature: &signature,
+		},
+		SignedPreKeyCreatedAt: record.SignedPreKeyCreatedAt,
+		RegistrationID:        record.RegistrationID,
+		AdvSecretKey:          append([]byte(nil), record.AdvSecretKey...),
+
+		ID:           &id,
+		Account:      &account,
+		Platform:     record.Platform,
+		BusinessName: record.BusinessName,
+		PushName:     record.PushName,
+		FacebookUUID: record.FacebookUUID,
+	}
+	if record.HasPrevSignedPreKey {
+		prevSignature := record.PrevSignedPreKeySig
+		device.PreviousSignedPreKey = &keys.PreKey{
+			KeyPair:   *keys.NewKeyPairFromPrivateKey(record.PrevSignedPreKey),
+			KeyID:     record.PrevSignedPreKeyID,
+			Signature: &prevSignature,
+		}
+	}
+	c.initStores(device, c.stores[id])
+	return device, nil
+}
+
+// GetAllDevices finds all the devices in the container, sorted by JID.
+func (c *Container) GetAllDevices() ([]*store.Device, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	devices := make([]*store.Device, 0, len(c.devices))
+	for _, record := range c.devices {
+		device, err := c.recordToDevice(record)
+		if err != nil {
+			return devices, err
+		}
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID.String() < devices[j].ID.String()
+	})
+	return devices, nil
+}
+
+// GetFirstDevice is a convenience method for getting the first device in the container. If there are
+// no devices, then a new device will be created. You should only use this if you don't want to
+// have multiple sessions simultaneously.
+func (c *Container) GetFirstDevice() (*store.Device, error) {
+	devices, err := c.GetAllDevices()
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return c.NewDevice(), nil
+	}
+	return devices[0], nil
+}
+
+// GetDevice finds the device with the specified JID in the container.
+//
+// If the device is not found, nil is returned instead.
+func (c *Container) GetDevice(jid types.JID) (*store.Device, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	record, ok := c.devices[jid]
+	if !ok {
+		return nil, nil
+	}
+	return c.recordToDevice(record)
+}
+
+// PutDevice stores the given device in this container. This should be called through Device.Save()
+// (which usually doesn't need to be called manually, as the library does that automatically when relevant).
+func (c *Container) PutDevice(device *store.Device) error {
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	account, err := proto.Marshal(device.Account)
+	if err != nil {
+		return err
+	}
+	signedPreKey, prevSignedPreKey, signedPreKeyCreatedAt := device.GetSignedPreKeys()
+	record := &deviceRecord{
+		ID:             *device.ID,
+		RegistrationID: device.RegistrationID,
+		NoiseKey:       *device.NoiseKey.Priv,
+		IdentityKey:    *device.IdentityKey.Priv,
+		SignedPreKey:   *signedPreKey.Priv,
+		SignedPreKeyID: signedPreKey.KeyID,
+		AdvSecretKey:   append([]byte(nil), device.AdvSecretKey...),
+		Account:        account,
+		Platform:       device.Platform,
+		BusinessName:   device.BusinessName,
+		PushName:       device.PushName,
+		FacebookUUID:   device.FacebookUUID,
+	}
+	if signedPreKey.Signature != nil {
+		record.SignedPreKeySig = *signedPreKey.Signature
+	}
+	record.SignedPreKeyCreatedAt = signedPreKeyCreatedAt
+	if prev := prevSignedPreKey; prev != nil && prev.Signature != nil {
+		record.HasPrevSignedPreKey = true
+		record.PrevSignedPreKey = *prev.Priv
+		record.PrevSignedPreKeyID = prev.KeyID
+		record.PrevSignedPreKeySig = *prev.Signature
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.devices[record.ID] = record
+	if !device.Initialized {
+		memStore, ok := c.stores[record.ID]
+		if !ok {
+			memStore = NewMemoryStore(record.ID)
+			c.stores[record.ID] = memStore
+		}
+		c.initStores(device, memStore)
+	}
+	return nil
+}
+
+// SetMessageStorage enables or disables keeping the content of sent and received messages in memory.
+// Message storage is disabled by default, as the messages would otherwise accumulate for as long as the process runs.
+//
+// This only affects devices that are loaded or created after the call, so it should be called before GetDevice.
+func (c *Container) SetMessageStorage(enabled bool) {
+	c.storeMessages = enabled
+}
+
+// DeleteDevice deletes the given device and all of its data from this container.
+// This should be called through Device.Delete()
+func (c *Container) DeleteDevice(device *store.Device) error {
+	if device.ID == nil {
+		return ErrDeviceIDMustBeSet
+	}
+	c.lock.Lock()
+	delete(c.devices, *device.ID)
+	delete(c.stores, *device.ID)
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *Container) initStores(device *store.Device, memStore *MemoryStore) {
+	device.Identities = memStore
+	device.Sessions = memStore
+	device.PreKeys = memStore
+	device.SenderKeys = memStore
+	device.AppStateKeys = memStore
+	device.AppState = memStore
+	device.AppStateValues = memStore
+	device.Contacts = memStore
+	device.ChatSettings = memStore
+	device.MsgSecrets = memStore
+	device.PrivacyTokens = memStore
+	if c.storeMessages {
+		device.Messages = memStore
+	}
+	device.LIDs = memStore
+	device.DeviceLists = memStore
+	device.Groups = memStore
+	device.Outbox = memStore
+	device.Initialized = true
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package memstore
+
+import (
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+var (
+	_ store.DataExporter   = (*MemoryStore)(nil)
+	_ store.PreKeyImporter = (*MemoryStore)(nil)
+)
+
+// ExportData returns all the data in this store for device archives.
+func (s *MemoryStore) ExportData() (*store.DeviceData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var data store.DeviceData
+	for address, key := range s.data.Identities {
+		data.Identities = append(data.Identities, store.ArchivedIdentity{Address: address, Key: cloneBytes(key[:])})
+	}
+	for address, session := range s.data.Sessions {
+		data.Sessions = append(data.Sessions, store.ArchivedSession{Address: address, Session: cloneBytes(session)})
+	}
+	for id, key := range s.data.PreKeys {
+		data.PreKeys = append(data.PreKeys, store.ArchivedPreKey{KeyID: id, Key: cloneBytes(key.Priv[:]), Uploaded: key.Uploaded})
+	}
+	for id, senderKey := range s.data.SenderKeys {
+		data.SenderKeys = append(data.SenderKeys, store.ArchivedSenderKey{Group: id.Group, User: id.User, SenderKey: cloneBytes(senderKey)})
+	}
+	for id, key := range s.data.AppStateKeys {
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, store.ArchivedAppStateKey{
+			KeyID:       []byte(id),
+			Data:        cloneBytes(key.Data),
+			Fingerprint: cloneBytes(key.Fingerprint),
+			Timestamp:   key.Timestamp,
+		})
+	}
+	for name, version := range s.data.AppStateVersions {
+		state := store.ArchivedAppState{Name: name, Version: version.Version, Hash: cloneBytes(version.Hash[:])}
+		for indexMAC, mac := range s.data.AppStateMACs[name] {
+			state.MutationMACs = append(state.MutationMACs, store.ArchivedMutationMAC{
+				Version:  mac.Version,
+				IndexMAC: []byte(indexMAC),
+				ValueMAC: cloneBytes(mac.ValueMAC),
+			})
+		}
+		for _, value := range s.data.AppStateValues[name] {
+			state.Values = append(state.Values, store.ArchivedAppStateValue{
+				Index: append([]string{}, value.Index...),
+				Value: cloneBytes(value.Value),
+			})
+		}
+		data.AppStates = append(data.AppStates, state)
+	}
+	for jid, contact := range s.data.Contacts {
+		data.Contacts = append(data.Contacts, store.ArchivedContact{
+			JID:          jid,
+			FirstName:    contact.FirstName,
+			FullName:     contact.FullName,
+			PushName:     contact.PushName,
+			BusinessName: contact.BusinessName,
+		})
+	}
+	for chat, settings := range s.data.ChatSettings {
+		archived := store.ArchivedChatSettings{
+			Chat:                chat,
+			Pinned:              settings.Pinned,
+			Archived:            settings.Archived,
+			MarkedAsUnread:      settings.MarkedAsUnread,
+			EphemeralExpiration: settings.EphemeralExpiration,
+			Locked:              settings.Locked,
+			Labels:              append([]string(nil), settings.Labels...),
+		}
+		if !settings.MutedUntil.IsZero() {
+			archived.MutedUntil = settings.MutedUntil.Unix()
+		}
+		if !settings.LastCleared.IsZero() {
+			archived.LastCleared = settings.LastCleared.Unix()
+		}
+		data.ChatSettings = append(data.ChatSettings, archived)
+	}
+	for id, secret := range s.data.MsgSecrets {
+		data.MessageSecrets = append(data.MessageSecrets, store.ArchivedMessageSecret{Chat: id.Chat, Sender: id.Sender, ID: id.ID, Secret: cloneBytes(secret)})
+	}
+	for user, token := range s.data.PrivacyTokens {
+		data.PrivacyTokens = append(data.PrivacyTokens, store.ArchivedPrivacyToken{User: user, Token: cloneBytes(token.Token), Timestamp: token.Timestamp.Unix()})
+	}
+	return &data, nil
+}
+
+// ImportPreKey stores an existing prekey, replacing any previous key with the same ID.
+func (s *MemoryStore) ImportPreKey(key *keys.PreKey, uploaded bool) error {
+	s.lock.Lock()
+	s.data.PreKeys[key.KeyID] = &preKey{Priv: *key.Priv, Uploaded: uploaded}
+	s.lock.Unlock()
+	return nil
+}
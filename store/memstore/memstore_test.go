@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package memstore_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/store/memstore"
+	"github.com/shiestapoi/whatsmeow/store/storetest"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.AllStores {
+		return memstore.NewMemoryStore(types.NewADJID("1234567890", 0, 1))
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	container := memstore.New(nil)
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	device.Account = &waAdv.ADVSignedDeviceIdentity{Details: []byte("details")}
+	device.PushName = "Test"
+	if err := device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if err := device.Sessions.PutSession("1111111111:1", []byte("session")); err != nil {
+		t.Fatalf("Failed to put session: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := container.Snapshot(&buf); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	restored, err := memstore.Restore(&buf, nil)
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	restoredDevice, err := restored.GetDevice(jid)
+	if err != nil || restoredDevice == nil {
+		t.Fatalf("Failed to get restored device: %v", err)
+	}
+	if restoredDevice.PushName != "Test" || *restoredDevice.NoiseKey.Priv != *device.NoiseKey.Priv ||
+		!bytes.Equal(restoredDevice.Account.GetDetails(), []byte("details")) {
+		t.Errorf("Restored device doesn't match the original")
+	}
+	session, err := restoredDevice.Sessions.GetSession("1111111111:1")
+	if err != nil || !bytes.Equal(session, []byte("session")) {
+		t.Errorf("Restored session doesn't match the original: %q (%v)", session, err)
+	}
+}
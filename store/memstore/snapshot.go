@@ -0,0 +1,125 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package memstore
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+// snapshotVersion is the current version of the snapshot format. It must be bumped
+// whenever the encoded structs change in an incompatible way.
+const snapshotVersion = 1
+
+type deviceSnapshot struct {
+	Device *deviceRecord
+	Data   *storeData
+}
+
+type snapshot struct {
+	Version int
+	Devices []deviceSnapshot
+}
+
+// Snapshot writes the full contents of the container (all devices and their data) to the given writer.
+// The output can be loaded back with Restore.
+//
+// The snapshot contains private keys in plaintext, so it should be stored as securely as any other database.
+func (c *Container) Snapshot(w io.Writer) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	snap := snapshot{
+		Version: snapshotVersion,
+		Devices: make([]deviceSnapshot, 0, len(c.devices)),
+	}
+	for jid, record := range c.devices {
+		memStore := c.stores[jid]
+		// The lock is held until the snapshot is encoded to avoid copying all the data
+		memStore.lock.RLock()
+		defer memStore.lock.RUnlock()
+		snap.Devices = append(snap.Devices, deviceSnapshot{Device: record, Data: memStore.data})
+	}
+	err := gob.NewEncoder(w).Encode(&snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore creates a new Container from a snapshot previously written with Container.Snapshot.
+//
+// The logger can be nil and will default to a no-op logger.
+func Restore(r io.Reader, log waLog.Logger) (*Container, error) {
+	var snap snapshot
+	err := gob.NewDecoder(r).Decode(&snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	} else if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	c := New(log)
+	for _, dev := range snap.Devices {
+		if dev.Device == nil {
+			continue
+		}
+		data := newStoreData()
+		if dev.Data != nil {
+			data.merge(dev.Data)
+		}
+		c.devices[dev.Device.ID] = dev.Device
+		c.stores[dev.Device.ID] = &MemoryStore{JID: dev.Device.ID, data: data}
+	}
+	return c, nil
+}
+
+// merge copies all the maps from the given decoded data into this struct.
+// gob doesn't transmit empty maps, so decoded data may contain nil maps that can't be written to.
+func (data *storeData) merge(other *storeData) {
+	copyMap(data.Identities, other.Identities)
+	copyMap(data.Sessions, other.Sessions)
+	copyMap(data.PreKeys, other.PreKeys)
+	copyMap(data.SenderKeys, other.SenderKeys)
+	copyMap(data.AppStateKeys, other.AppStateKeys)
+	copyMap(data.AppStateVersions, other.AppStateVersions)
+	for name, macs := range other.AppStateMACs {
+		if macs != nil {
+			data.AppStateMACs[name] = macs
+		}
+	}
+	for name, values := range other.AppStateValues {
+		if values != nil {
+			data.AppStateValues[name] = values
+		}
+	}
+	copyMap(data.Contacts, other.Contacts)
+	copyMap(data.ChatSettings, other.ChatSettings)
+	copyMap(data.MsgSecrets, other.MsgSecrets)
+	copyMap(data.PrivacyTokens, other.PrivacyTokens)
+	for chat, messages := range other.Messages {
+		if messages != nil {
+			data.Messages[chat] = messages
+		}
+	}
+	copyMap(data.LIDToPN, other.LIDToPN)
+	copyMap(data.PNToLID, other.PNToLID)
+	copyMap(data.DeviceLists, other.DeviceLists)
+	copyMap(data.Groups, other.Groups)
+	for chat, messages := range other.Outbox {
+		if messages != nil {
+			data.Outbox[chat] = messages
+		}
+	}
+}
+
+func copyMap[K comparable, V any](dst, src map[K]V) {
+	for key, value := range src {
+		dst[key] = value
+	}
+}
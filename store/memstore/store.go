@@ -0,0 +1,1042 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package memstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+type preKey struct {
+	Priv     [32]byte
+	Uploaded bool
+}
+
+type senderKeyID struct {
+	Group string
+	User  string
+}
+
+type appStateVersion struct {
+	Version uint64
+	Hash    [128]byte
+}
+
+type appStateMAC struct {
+	Version  uint64
+	ValueMAC []byte
+}
+
+type appStateValue struct {
+	Index []string
+	Value []byte
+}
+
+type deviceList struct {
+	Devices   []types.JID
+	DHash     string
+	UpdatedAt time.Time
+}
+
+type outboxMessage struct {
+	Message     []byte
+	QueuedAt    int64
+	Attempts    int
+	NextAttempt int64
+	LastError   string
+}
+
+type msgSecretID struct {
+	Chat   types.JID
+	Sender types.JID
+	ID     types.MessageID
+}
+
+type storedMessage struct {
+	Sender        types.JID
+	IsFromMe      bool
+	Timestamp     int64
+	Message       []byte
+	EditedMessage []byte
+	EditedAt      int64
+	Deleted       bool
+}
+
+// storeData contains all the data of a single device. All fields are exported so that
+// the whole struct can be encoded with encoding/gob for snapshots.
+type storeData struct {
+	Identities       map[string][32]byte
+	Sessions         map[string][]byte
+	PreKeys          map[uint32]*preKey
+	SenderKeys       map[senderKeyID][]byte
+	AppStateKeys     map[string]store.AppStateSyncKey
+	AppStateVersions map[string]appStateVersion
+	AppStateMACs     map[string]map[string]appStateMAC
+	AppStateValues   map[string]map[string]appStateValue
+	Contacts         map[types.JID]types.ContactInfo
+	ChatSettings     map[types.JID]types.LocalChatSettings
+	MsgSecrets       map[msgSecretID][]byte
+	PrivacyTokens    map[types.JID]store.PrivacyToken
+	Messages         map[types.JID]map[types.MessageID]*storedMessage
+	LIDToPN          map[types.JID]types.JID
+	PNToLID          map[types.JID]types.JID
+	DeviceLists      map[types.JID]deviceList
+	Groups           map[types.JID][]types.JID
+	Outbox           map[types.JID]map[types.MessageID]*outboxMessage
+}
+
+func newStoreData() *storeData {
+	return &storeData{
+		Identities:       make(map[string][32]byte),
+		Sessions:         make(map[string][]byte),
+		PreKeys:          make(map[uint32]*preKey),
+		SenderKeys:       make(map[senderKeyID][]byte),
+		AppStateKeys:     make(map[string]store.AppStateSyncKey),
+		AppStateVersions: make(map[string]appStateVersion),
+		AppStateMACs:     make(map[string]map[string]appStateMAC),
+		AppStateValues:   make(map[string]map[string]appStateValue),
+		Contacts:         make(map[types.JID]types.ContactInfo),
+		ChatSettings:     make(map[types.JID]types.LocalChatSettings),
+		MsgSecrets:       make(map[msgSecretID][]byte),
+		PrivacyTokens:    make(map[types.JID]store.PrivacyToken),
+		Messages:         make(map[types.JID]map[types.MessageID]*storedMessage),
+		LIDToPN:          make(map[types.JID]types.JID),
+		PNToLID:          make(map[types.JID]types.JID),
+		DeviceLists:      make(map[types.JID]deviceList),
+		Groups:           make(map[types.JID][]types.JID),
+		Outbox:           make(map[types.JID]map[types.MessageID]*outboxMessage),
+	}
+}
+
+// MemoryStore is a thread-safe in-memory implementation of all the different stores in the store package.
+//
+// Byte slices are copied on the way in and out, so callers are free to modify them afterwards.
+type MemoryStore struct {
+	JID types.JID
+
+	lock sync.RWMutex
+	data *storeData
+}
+
+var _ store.AllStores = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new empty MemoryStore for the given user JID.
+//
+// In general, you should use Container.NewDevice or Container.GetDevice instead of this.
+func NewMemoryStore(jid types.JID) *MemoryStore {
+	return &MemoryStore{JID: jid, data: newStoreData()}
+}
+
+func cloneBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	return append([]byte{}, data...)
+}
+
+func (s *MemoryStore) PutIdentity(address string, key [32]byte) error {
+	s.lock.Lock()
+	s.data.Identities[address] = key
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) DeleteAllIdentities(phone string) error {
+	s.lock.Lock()
+	for address := range s.data.Identities {
+		if strings.HasPrefix(address, phone+":") {
+			delete(s.data.Identities, address)
+		}
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdentity(address string) error {
+	s.lock.Lock()
+	delete(s.data.Identities, address)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) IsTrustedIdentity(address string, key [32]byte) (bool, error) {
+	s.lock.RLock()
+	existing, ok := s.data.Identities[address]
+	s.lock.RUnlock()
+	// Trust if not known, it'll be saved automatically later
+	return !ok || existing == key, nil
+}
+
+func (s *MemoryStore) GetSession(address string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return cloneBytes(s.data.Sessions[address]), nil
+}
+
+func (s *MemoryStore) HasSession(address string) (bool, error) {
+	s.lock.RLock()
+	_, ok := s.data.Sessions[address]
+	s.lock.RUnlock()
+	return ok, nil
+}
+
+func (s *MemoryStore) PutSession(address string, session []byte) error {
+	s.lock.Lock()
+	s.data.Sessions[address] = cloneBytes(session)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) DeleteAllSessions(phone string) error {
+	s.lock.Lock()
+	for address := range s.data.Sessions {
+		if strings.HasPrefix(address, phone+":") {
+			delete(s.data.Sessions, address)
+		}
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) DeleteSession(address string) error {
+	s.lock.Lock()
+	delete(s.data.Sessions, address)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) nextPreKeyID() uint32 {
+	var lastKeyID uint32
+	for id := range s.data.PreKeys {
+		if id > lastKeyID {
+			lastKeyID = id
+		}
+	}
+	return lastKeyID + 1
+}
+
+func (s *MemoryStore) genOnePreKey(id uint32, markUploaded bool) *keys.PreKey {
+	key := keys.NewPreKey(id)
+	s.data.PreKeys[id] = &preKey{Priv: *key.Priv, Uploaded: markUploaded}
+	return key
+}
+
+func (s *MemoryStore) GenOnePreKey() (*keys.PreKey, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.genOnePreKey(s.nextPreKeyID(), true), nil
+}
+
+func (s *MemoryStore) GetOrGenPreKeys(count uint32) ([]*keys.PreKey, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	existingIDs := make([]uint32, 0, count)
+	for id, key := range s.data.PreKeys {
+		if !key.Uploaded {
+			existingIDs = append(existingIDs, id)
+		}
+	}
+	sort.Slice(existingIDs, func(i, j int) bool {
+		return existingIDs[i] < existingIDs[j]
+	})
+	if uint32(len(existingIDs)) > count {
+		existingIDs = existingIDs[:count]
+	}
+	newKeys := make([]*keys.PreKey, count)
+	for i, id := range existingIDs {
+		newKeys[i] = &keys.PreKey{
+			KeyPair: *keys.NewKeyPairFromPrivateKey(s.data.PreKeys[id].Priv),
+			KeyID:   id,
+		}
+	}
+	nextKeyID := s.nextPreKeyID()
+	for i := uint32(len(existingIDs)); i < count; i++ {
+		newKeys[i] = s.genOnePreKey(nextKeyID, false)
+		nextKeyID++
+	}
+	return newKeys, nil
+}
+
+func (s *MemoryStore) GetPreKey(id uint32) (*keys.PreKey, error) {
+	s.lock.RLock()
+	key, ok := s.data.PreKeys[id]
+	s.lock.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	return &keys.PreKey{
+		KeyPair: *keys.NewKeyPairFromPrivateKey(key.Priv),
+		KeyID:   id,
+	}, nil
+}
+
+func (s *MemoryStore) RemovePreKey(id uint32) error {
+	s.lock.Lock()
+	delete(s.data.PreKeys, id)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) MarkPreKeysAsUploaded(upToID uint32) error {
+	s.lock.Lock()
+	for id, key := range s.data.PreKeys {
+		if id <= upToID {
+			key.Uploaded = true
+		}
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) UploadedPreKeyCount() (count int, err error) {
+	s.lock.RLock()
+	for _, key := range s.data.PreKeys {
+		if key.Uploaded {
+			count++
+		}
+	}
+	s.lock.RUnlock()
+	return
+}
+
+func (s *MemoryStore) PutSenderKey(group, user string, session []byte) error {
+	s.lock.Lock()
+	s.data.SenderKeys[senderKeyID{Group: group, User: user}] = cloneBytes(session)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GetSenderKey(group, user string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return cloneBytes(s.data.SenderKeys[senderKeyID{Group: group, User: user}]), nil
+}
+
+func (s *MemoryStore) PutAppStateSyncKey(id []byte, key store.AppStateSyncKey) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	existing, ok := s.data.AppStateKeys[string(id)]
+	if !ok || key.Timestamp > existing.Timestamp {
+		s.data.AppStateKeys[string(id)] = store.AppStateSyncKey{
+			Data:        cloneBytes(key.Data),
+			Fingerprint: cloneBytes(key.Fingerprint),
+			Timestamp:   key.Timestamp,
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateSyncKey(id []byte) (*store.AppStateSyncKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key, ok := s.data.AppStateKeys[string(id)]
+	if !ok {
+		return nil, nil
+	}
+	return &store.AppStateSyncKey{
+		Data:        cloneBytes(key.Data),
+		Fingerprint: cloneBytes(key.Fingerprint),
+		Timestamp:   key.Timestamp,
+	}, nil
+}
+
+func (s *MemoryStore) GetLatestAppStateSyncKeyID() ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var latestID []byte
+	var latestTS int64
+	for id, key := range s.data.AppStateKeys {
+		if latestID == nil || key.Timestamp > latestTS {
+			latestID = []byte(id)
+			latestTS = key.Timestamp
+		}
+	}
+	return latestID, nil
+}
+
+func (s *MemoryStore) PutAppStateVersion(name string, version uint64, hash [128]byte) error {
+	s.lock.Lock()
+	s.data.AppStateVersions[name] = appStateVersion{Version: version, Hash: hash}
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateVersion(name string) (uint64, [128]byte, error) {
+	s.lock.RLock()
+	// If the state isn't known, version will be 0 and hash will be an empty array, which is the correct initial state
+	existing := s.data.AppStateVersions[name]
+	s.lock.RUnlock()
+	return existing.Version, existing.Hash, nil
+}
+
+func (s *MemoryStore) DeleteAppStateVersion(name string) error {
+	s.lock.Lock()
+	delete(s.data.AppStateVersions, name)
+	delete(s.data.AppStateMACs, name)
+	delete(s.data.AppStateValues, name)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) PutAppStateMutationMACs(name string, version uint64, mutations []store.AppStateMutationMAC) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	macs, ok := s.data.AppStateMACs[name]
+	if !ok {
+		macs = make(map[string]appStateMAC, len(mutations))
+		s.data.AppStateMACs[name] = macs
+	}
+	for _, mutation := range mutations {
+		// Only the latest version of each index is ever read, so older ones don't need to be kept
+		if existing, ok := macs[string(mutation.IndexMAC)]; !ok || version >= existing.Version {
+			macs[string(mutation.IndexMAC)] = appStateMAC{Version: version, ValueMAC: cloneBytes(mutation.ValueMAC)}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteAppStateMutationMACs(name string, indexMACs [][]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	macs, ok := s.data.AppStateMACs[name]
+	if !ok {
+		return nil
+	}
+	for _, indexMAC := range indexMACs {
+		delete(macs, string(indexMAC))
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateMutationMAC(name string, indexMAC []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return cloneBytes(s.data.AppStateMACs[name][string(indexMAC)].ValueMAC), nil
+}
+
+// indexKey returns the map key for an app state index. The index is JSON-encoded the same way
+// as in the actual app state, so that parts containing any characters can't collide.
+func indexKey(index []string) string {
+	data, _ := json.Marshal(index)
+	return string(data)
+}
+
+func hasIndexPrefix(index, prefix []string) bool {
+	if len(index) < len(prefix) {
+		return false
+	}
+	for i, part := range prefix {
+		if index[i] != part {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MemoryStore) PutAppStateValues(name string, values []store.AppStateValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	encoded := make([]appStateValue, len(values))
+	for i, value := range values {
+		data, err := proto.Marshal(value.Value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal value of %v: %w", value.Index, err)
+		}
+		encoded[i] = appStateValue{Index: append([]string{}, value.Index...), Value: data}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stateValues, ok := s.data.AppStateValues[name]
+	if !ok {
+		stateValues = make(map[string]appStateValue, len(values))
+		s.data.AppStateValues[name] = stateValues
+	}
+	for _, value := range encoded {
+		stateValues[indexKey(value.Index)] = value
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteAppStateValues(name string, indexes [][]string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stateValues, ok := s.data.AppStateValues[name]
+	if !ok {
+		return nil
+	}
+	for _, index := range indexes {
+		delete(stateValues, indexKey(index))
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteAllAppStateValues(name string) error {
+	s.lock.Lock()
+	delete(s.data.AppStateValues, name)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GetAppStateValue(name string, index []string) (*waSyncAction.SyncActionValue, error) {
+	s.lock.RLock()
+	value, ok := s.data.AppStateValues[name][indexKey(index)]
+	s.lock.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	var output waSyncAction.SyncActionValue
+	err := proto.Unmarshal(value.Value, &output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal value of %v: %w", index, err)
+	}
+	return &output, nil
+}
+
+func (s *MemoryStore) GetAppStateValuesByPrefix(name string, prefix []string) ([]store.AppStateValue, error) {
+	if len(prefix) == 0 {
+		return nil, fmt.Errorf("index prefix must not be empty")
+	}
+	s.lock.RLock()
+	var matches []appStateValue
+	for _, value := range s.data.AppStateValues[name] {
+		if hasIndexPrefix(value.Index, prefix) {
+			matches = append(matches, value)
+		}
+	}
+	s.lock.RUnlock()
+	sort.Slice(matches, func(i, j int) bool {
+		return indexKey(matches[i].Index) < indexKey(matches[j].Index)
+	})
+	output := make([]store.AppStateValue, len(matches))
+	for i, value := range matches {
+		output[i].Index = append([]string{}, value.Index...)
+		output[i].Value = &waSyncAction.SyncActionValue{}
+		err := proto.Unmarshal(value.Value, output[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal value of %v: %w", value.Index, err)
+		}
+	}
+	return output, nil
+}
+
+func (s *MemoryStore) PutPushName(user types.JID, pushName string) (bool, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	contact := s.data.Contacts[user]
+	if contact.PushName == pushName {
+		return false, "", nil
+	}
+	previousName := contact.PushName
+	contact.PushName = pushName
+	contact.Found = true
+	s.data.Contacts[user] = contact
+	return true, previousName, nil
+}
+
+func (s *MemoryStore) PutBusinessName(user types.JID, businessName string) (bool, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	contact := s.data.Contacts[user]
+	if contact.BusinessName == businessName {
+		return false, "", nil
+	}
+	previousName := contact.BusinessName
+	contact.BusinessName = businessName
+	contact.Found = true
+	s.data.Contacts[user] = contact
+	return true, previousName, nil
+}
+
+func (s *MemoryStore) PutContactName(user types.JID, firstName, fullName string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	contact := s.data.Contacts[user]
+	if contact.FirstName != firstName || contact.FullName != fullName {
+		contact.FirstName = firstName
+		contact.FullName = fullName
+		contact.Found = true
+		s.data.Contacts[user] = contact
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutAllContactNames(contacts []store.ContactEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, entry := range contacts {
+		if entry.JID.IsEmpty() {
+			continue
+		}
+		contact := s.data.Contacts[entry.JID]
+		contact.FirstName = entry.FirstName
+		contact.FullName = entry.FullName
+		contact.Found = true
+		s.data.Contacts[entry.JID] = contact
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetContact(user types.JID) (types.ContactInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.data.Contacts[user], nil
+}
+
+func (s *MemoryStore) GetAllContacts() (map[types.JID]types.ContactInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	output := make(map[types.JID]types.ContactInfo, len(s.data.Contacts))
+	for jid, contact := range s.data.Contacts {
+		output[jid] = contact
+	}
+	return output, nil
+}
+
+func (s *MemoryStore) putChatSetting(chat types.JID, fn func(settings *types.LocalChatSettings)) error {
+	s.lock.Lock()
+	settings := s.data.ChatSettings[chat]
+	fn(&settings)
+	settings.Found = true
+	s.data.ChatSettings[chat] = settings
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) PutMutedUntil(chat types.JID, mutedUntil time.Time) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		if mutedUntil.IsZero() {
+			settings.MutedUntil = time.Time{}
+		} else {
+			settings.MutedUntil = time.Unix(mutedUntil.Unix(), 0)
+		}
+	})
+}
+
+func (s *MemoryStore) PutPinned(chat types.JID, pinned bool) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		settings.Pinned = pinned
+	})
+}
+
+func (s *MemoryStore) PutArchived(chat types.JID, archived bool) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		settings.Archived = archived
+	})
+}
+
+func (s *MemoryStore) PutMarkedAsUnread(chat types.JID, unread bool) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		settings.MarkedAsUnread = unread
+	})
+}
+
+func (s *MemoryStore) PutLastCleared(chat types.JID, clearedAt time.Time) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		if clearedAt.IsZero() {
+			settings.LastCleared = time.Time{}
+		} else {
+			settings.LastCleared = time.Unix(clearedAt.Unix(), 0)
+		}
+	})
+}
+
+func (s *MemoryStore) PutEphemeralExpiration(chat types.JID, expiration uint32) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		settings.EphemeralExpiration = expiration
+	})
+}
+
+func (s *MemoryStore) PutLocked(chat types.JID, locked bool) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		settings.Locked = locked
+	})
+}
+
+func (s *MemoryStore) PutChatLabel(chat types.JID, labelID string, labeled bool) error {
+	return s.putChatSetting(chat, func(settings *types.LocalChatSettings) {
+		// The slice is always replaced rather than modified, as previously returned copies may share the array
+		labels := make([]string, 0, len(settings.Labels)+1)
+		for _, existing := range settings.Labels {
+			if existing != labelID {
+				labels = append(labels, existing)
+			}
+		}
+		if labeled {
+			labels = append(labels, labelID)
+			sort.Strings(labels)
+		}
+		settings.Labels = labels
+	})
+}
+
+func (s *MemoryStore) GetChatSettings(chat types.JID) (types.LocalChatSettings, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	settings := s.data.ChatSettings[chat]
+	if len(settings.Labels) > 0 {
+		settings.Labels = append([]string{}, settings.Labels...)
+	} else {
+		settings.Labels = nil
+	}
+	return settings, nil
+}
+
+func (s *MemoryStore) PutMessageSecrets(inserts []store.MessageSecretInsert) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, insert := range inserts {
+		id := msgSecretID{Chat: insert.Chat.ToNonAD(), Sender: insert.Sender.ToNonAD(), ID: insert.ID}
+		// Existing secrets are never overwritten
+		if _, ok := s.data.MsgSecrets[id]; !ok {
+			s.data.MsgSecrets[id] = cloneBytes(insert.Secret)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutMessageSecret(chat, sender types.JID, id types.MessageID, secret []byte) error {
+	return s.PutMessageSecrets([]store.MessageSecretInsert{{Chat: chat, Sender: sender, ID: id, Secret: secret}})
+}
+
+func (s *MemoryStore) GetMessageSecret(chat, sender types.JID, id types.MessageID) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return cloneBytes(s.data.MsgSecrets[msgSecretID{Chat: chat.ToNonAD(), Sender: sender.ToNonAD(), ID: id}]), nil
+}
+
+func (s *MemoryStore) PutPrivacyTokens(tokens ...store.PrivacyToken) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, token := range tokens {
+		user := token.User.ToNonAD()
+		s.data.PrivacyTokens[user] = store.PrivacyToken{
+			User:      user,
+			Token:     cloneBytes(token.Token),
+			Timestamp: time.Unix(token.Timestamp.Unix(), 0),
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetPrivacyToken(user types.JID) (*store.PrivacyToken, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	token, ok := s.data.PrivacyTokens[user.ToNonAD()]
+	if !ok {
+		return nil, nil
+	}
+	token.Token = cloneBytes(token.Token)
+	return &token, nil
+}
+
+func (s *MemoryStore) putMessage(msg *store.StoredMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message %s: %w", msg.ID, err)
+	}
+	chat := msg.Chat.ToNonAD()
+	chatMessages, ok := s.data.Messages[chat]
+	if !ok {
+		chatMessages = make(map[types.MessageID]*storedMessage)
+		s.data.Messages[chat] = chatMessages
+	}
+	existing, ok := chatMessages[msg.ID]
+	if !ok {
+		existing = &storedMessage{}
+		chatMessages[msg.ID] = existing
+	}
+	existing.Sender = msg.Sender.ToNonAD()
+	existing.IsFromMe = msg.IsFromMe
+	existing.Timestamp = msg.Timestamp.Unix()
+	existing.Message = data
+	return nil
+}
+
+func (s *MemoryStore) PutMessage(msg *store.StoredMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.putMessage(msg)
+}
+
+func (s *MemoryStore) PutMessages(msgs []*store.StoredMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, msg := range msgs {
+		if err := s.putMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (msg *storedMessage) toStoredMessage(chat types.JID, id types.MessageID) (*store.StoredMessage, error) {
+	output := &store.StoredMessage{
+		Chat:      chat,
+		Sender:    msg.Sender,
+		ID:        id,
+		IsFromMe:  msg.IsFromMe,
+		Timestamp: time.Unix(msg.Timestamp, 0),
+		Message:   &waE2E.Message{},
+		Deleted:   msg.Deleted,
+	}
+	err := proto.Unmarshal(msg.Message, output.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message %s: %w", id, err)
+	}
+	if msg.EditedMessage != nil {
+		output.EditedMessage = &waE2E.Message{}
+		err = proto.Unmarshal(msg.EditedMessage, output.EditedMessage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal edited content of message %s: %w", id, err)
+		}
+	}
+	if msg.EditedAt != 0 {
+		output.EditedAt = time.Unix(msg.EditedAt, 0)
+	}
+	return output, nil
+}
+
+func (s *MemoryStore) GetMessage(chat types.JID, id types.MessageID) (*store.StoredMessage, error) {
+	chat = chat.ToNonAD()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	msg, ok := s.data.Messages[chat][id]
+	if !ok {
+		return nil, nil
+	}
+	return msg.toStoredMessage(chat, id)
+}
+
+func (s *MemoryStore) GetChatMessages(chat types.JID, before time.Time, beforeID types.MessageID, limit int) ([]*store.StoredMessage, error) {
+	chat = chat.ToNonAD()
+	beforeTS := before.Unix()
+	if before.IsZero() {
+		beforeTS = 1<<63 - 1
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ids := make([]types.MessageID, 0, len(s.data.Messages[chat]))
+	for id, msg := range s.data.Messages[chat] {
+		if msg.Timestamp < beforeTS || (msg.Timestamp == beforeTS && id < beforeID) {
+			ids = append(ids, id)
+		}
+	}
+	chatMessages := s.data.Messages[chat]
+	sort.Slice(ids, func(i, j int) bool {
+		tsI, tsJ := chatMessages[ids[i]].Timestamp, chatMessages[ids[j]].Timestamp
+		if tsI != tsJ {
+			return tsI > tsJ
+		}
+		return ids[i] > ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	output := make([]*store.StoredMessage, len(ids))
+	for i, id := range ids {
+		var err error
+		output[i], err = chatMessages[id].toStoredMessage(chat, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+func (s *MemoryStore) MarkMessageDeleted(chat types.JID, id types.MessageID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if msg, ok := s.data.Messages[chat.ToNonAD()][id]; ok {
+		msg.Deleted = true
+	}
+	return nil
+}
+
+func (s *MemoryStore) MarkMessageEdited(chat types.JID, id types.MessageID, newContent *waE2E.Message, editedAt time.Time) error {
+	data, err := proto.Marshal(newContent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal edited message: %w", err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// Older edits arriving late must not replace newer ones
+	if msg, ok := s.data.Messages[chat.ToNonAD()][id]; ok && msg.EditedAt <= editedAt.Unix() {
+		msg.EditedMessage = data
+		msg.EditedAt = editedAt.Unix()
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutLIDMappings(mappings ...store.LIDMapping) error {
+	for _, mapping := range mappings {
+		if mapping.LID.Server != types.HiddenUserServer || mapping.PN.Server != types.DefaultUserServer {
+			return fmt.Errorf("invalid LID mapping %s -> %s", mapping.LID, mapping.PN)
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, mapping := range mappings {
+		lid, pn := mapping.LID.ToNonAD(), mapping.PN.ToNonAD()
+		if oldPN, ok := s.data.LIDToPN[lid]; ok {
+			delete(s.data.PNToLID, oldPN)
+		}
+		if oldLID, ok := s.data.PNToLID[pn]; ok {
+			delete(s.data.LIDToPN, oldLID)
+		}
+		s.data.LIDToPN[lid] = pn
+		s.data.PNToLID[pn] = lid
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetPNForLID(lid types.JID) (types.JID, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.data.LIDToPN[lid.ToNonAD()], nil
+}
+
+func (s *MemoryStore) GetLIDForPN(pn types.JID) (types.JID, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.data.PNToLID[pn.ToNonAD()], nil
+}
+
+func (s *MemoryStore) PutDeviceList(user types.JID, devices []types.JID, dhash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.DeviceLists[user.ToNonAD()] = deviceList{Devices: append([]types.JID{}, devices...), DHash: dhash, UpdatedAt: time.Now()}
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceList(user types.JID) ([]types.JID, string, time.Time, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	list, ok := s.data.DeviceLists[user.ToNonAD()]
+	if !ok {
+		return nil, "", time.Time{}, nil
+	}
+	// Empty lists are returned as non-nil so that they're distinguishable from unknown users
+	return append([]types.JID{}, list.Devices...), list.DHash, list.UpdatedAt, nil
+}
+
+func (s *MemoryStore) DeleteDeviceList(user types.JID) error {
+	s.lock.Lock()
+	delete(s.data.DeviceLists, user.ToNonAD())
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) PutGroupParticipants(group types.JID, participants []types.JID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Groups[group] = append([]types.JID{}, participants...)
+	return nil
+}
+
+func (s *MemoryStore) GetGroupParticipants(group types.JID) ([]types.JID, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	participants, ok := s.data.Groups[group]
+	if !ok {
+		return nil, nil
+	}
+	return append([]types.JID{}, participants...), nil
+}
+
+func (s *MemoryStore) DeleteGroupParticipants(group types.JID) error {
+	s.lock.Lock()
+	delete(s.data.Groups, group)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) PutOutboxMessage(msg *store.OutboxMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message %s: %w", msg.ID, err)
+	}
+	chat := msg.Chat.ToNonAD()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	chatMessages, ok := s.data.Outbox[chat]
+	if !ok {
+		chatMessages = make(map[types.MessageID]*outboxMessage)
+		s.data.Outbox[chat] = chatMessages
+	}
+	stored := &outboxMessage{
+		Message:   data,
+		QueuedAt:  msg.QueuedAt.UnixNano(),
+		Attempts:  msg.Attempts,
+		LastError: msg.LastError,
+	}
+	if !msg.NextAttempt.IsZero() {
+		stored.NextAttempt = msg.NextAttempt.UnixNano()
+	}
+	chatMessages[msg.ID] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetOutboxMessages() ([]*store.OutboxMessage, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var output []*store.OutboxMessage
+	for chat, chatMessages := range s.data.Outbox {
+		for id, msg := range chatMessages {
+			parsed := &store.OutboxMessage{
+				Chat:      chat,
+				ID:        id,
+				Message:   &waE2E.Message{},
+				QueuedAt:  time.Unix(0, msg.QueuedAt),
+				Attempts:  msg.Attempts,
+				LastError: msg.LastError,
+			}
+			if msg.NextAttempt != 0 {
+				parsed.NextAttempt = time.Unix(0, msg.NextAttempt)
+			}
+			err := proto.Unmarshal(msg.Message, parsed.Message)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal message %s: %w", id, err)
+			}
+			output = append(output, parsed)
+		}
+	}
+	sort.Slice(output, func(i, j int) bool {
+		if !output[i].QueuedAt.Equal(output[j].QueuedAt) {
+			return output[i].QueuedAt.Before(output[j].QueuedAt)
+		}
+		return output[i].ID < output[j].ID
+	})
+	return output, nil
+}
+
+func (s *MemoryStore) DeleteOutboxMessage(chat types.JID, id types.MessageID) error {
+	chat = chat.ToNonAD()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.data.Outbox[chat], id)
+	if len(s.data.Outbox[chat]) == 0 {
+		delete(s.data.Outbox, chat)
+	}
+	return nil
+}
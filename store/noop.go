@@ -10,6 +10,8 @@ import (
 	"errors"
 	"time"
 
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
 	"github.com/shiestapoi/whatsmeow/types"
 	"github.com/shiestapoi/whatsmeow/util/keys"
 )
@@ -25,17 +27,23 @@ var NoopDevice = &Device{
 	NoiseKey:    nilKey,
 	IdentityKey: nilKey,
 
-	Identities:    nilStore,
-	Sessions:      nilStore,
-	PreKeys:       nilStore,
-	SenderKeys:    nilStore,
-	AppStateKeys:  nilStore,
-	AppState:      nilStore,
-	Contacts:      nilStore,
-	ChatSettings:  nilStore,
-	MsgSecrets:    nilStore,
-	PrivacyTokens: nilStore,
-	Container:     nilStore,
+	Identities:     nilStore,
+	Sessions:       nilStore,
+	PreKeys:        nilStore,
+	SenderKeys:     nilStore,
+	AppStateKeys:   nilStore,
+	AppState:       nilStore,
+	AppStateValues: nilStore,
+	Contacts:       nilStore,
+	ChatSettings:   nilStore,
+	MsgSecrets:     nilStore,
+	PrivacyTokens:  nilStore,
+	Messages:       nilStore,
+	LIDs:           nilStore,
+	DeviceLists:    nilStore,
+	Groups:         nilStore,
+	Outbox:         nilStore,
+	Container:      nilStore,
 }
 
 var _ AllStores = (*NoopStore)(nil)
@@ -145,6 +153,26 @@ func (n *NoopStore) GetAppStateMutationMAC(name string, indexMAC []byte) (valueM
 	return nil, n.Error
 }
 
+func (n *NoopStore) PutAppStateValues(name string, values []AppStateValue) error {
+	return n.Error
+}
+
+func (n *NoopStore) DeleteAppStateValues(name string, indexes [][]string) error {
+	return n.Error
+}
+
+func (n *NoopStore) DeleteAllAppStateValues(name string) error {
+	return n.Error
+}
+
+func (n *NoopStore) GetAppStateValue(name string, index []string) (*waSyncAction.SyncActionValue, error) {
+	return nil, n.Error
+}
+
+func (n *NoopStore) GetAppStateValuesByPrefix(name string, prefix []string) ([]AppStateValue, error) {
+	return nil, n.Error
+}
+
 func (n *NoopStore) PutPushName(user types.JID, pushName string) (bool, string, error) {
 	return false, "", n.Error
 }
@@ -181,6 +209,26 @@ func (n *NoopStore) PutArchived(chat types.JID, archived bool) error {
 	return n.Error
 }
 
+func (n *NoopStore) PutMarkedAsUnread(chat types.JID, unread bool) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutLastCleared(chat types.JID, clearedAt time.Time) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutEphemeralExpiration(chat types.JID, expiration uint32) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutLocked(chat types.JID, locked bool) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutChatLabel(chat types.JID, labelID string, labeled bool) error {
+	return n.Error
+}
+
 func (n *NoopStore) GetChatSettings(chat types.JID) (types.LocalChatSettings, error) {
 	return types.LocalChatSettings{}, n.Error
 }
@@ -205,6 +253,42 @@ func (n *NoopStore) GetPrivacyToken(user types.JID) (*PrivacyToken, error) {
 	return nil, n.Error
 }
 
+func (n *NoopStore) PutMessage(msg *StoredMessage) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutMessages(msgs []*StoredMessage) error {
+	return n.Error
+}
+
+func (n *NoopStore) GetMessage(chat types.JID, id types.MessageID) (*StoredMessage, error) {
+	return nil, n.Error
+}
+
+func (n *NoopStore) GetChatMessages(chat types.JID, before time.Time, beforeID types.MessageID, limit int) ([]*StoredMessage, error) {
+	return nil, n.Error
+}
+
+func (n *NoopStore) MarkMessageDeleted(chat types.JID, id types.MessageID) error {
+	return n.Error
+}
+
+func (n *NoopStore) MarkMessageEdited(chat types.JID, id types.MessageID, newContent *waE2E.Message, editedAt time.Time) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutLIDMappings(mappings ...LIDMapping) error {
+	return n.Error
+}
+
+func (n *NoopStore) GetPNForLID(lid types.JID) (types.JID, error) {
+	return types.EmptyJID, n.Error
+}
+
+func (n *NoopStore) GetLIDForPN(pn types.JID) (types.JID, error) {
+	return types.EmptyJID, n.Error
+}
+
 func (n *NoopStore) PutDevice(store *Device) error {
 	return n.Error
 }
@@ -212,3 +296,39 @@ func (n *NoopStore) PutDevice(store *Device) error {
 func (n *NoopStore) DeleteDevice(store *Device) error {
 	return n.Error
 }
+
+func (n *NoopStore) PutDeviceList(user types.JID, devices []types.JID, dhash string) error {
+	return n.Error
+}
+
+func (n *NoopStore) GetDeviceList(user types.JID) ([]types.JID, string, time.Time, error) {
+	return nil, "", time.Time{}, n.Error
+}
+
+func (n *NoopStore) DeleteDeviceList(user types.JID) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutGroupParticipants(group types.JID, participants []types.JID) error {
+	return n.Error
+}
+
+func (n *NoopStore) GetGroupParticipants(group types.JID) ([]types.JID, error) {
+	return nil, n.Error
+}
+
+func (n *NoopStore) DeleteGroupParticipants(group types.JID) error {
+	return n.Error
+}
+
+func (n *NoopStore) PutOutboxMessage(msg *OutboxMessage) error {
+	return n.Error
+}
+
+func (n *NoopStore) GetOutboxMessages() ([]*OutboxMessage, error) {
+	return nil, n.Error
+}
+
+func (n *NoopStore) DeleteOutboxMessage(chat types.JID, id types.MessageID) error {
+	return n.Error
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/store"
+)
+
+const (
+	putAppStateValueQuery          = `INSERT INTO whatsmeow_app_state_values (jid, name, action, index_json, value) VALUES ($1, $2, $3, $4, $5)`
+	deleteAppStateValueQuery       = `DELETE FROM whatsmeow_app_state_values WHERE jid=$1 AND name=$2 AND index_json=$3`
+	deleteAllAppStateValuesQuery   = `DELETE FROM whatsmeow_app_state_values WHERE jid=$1 AND name=$2`
+	getAppStateValueQuery          = `SELECT value FROM whatsmeow_app_state_values WHERE jid=$1 AND name=$2 AND index_json=$3`
+	getAppStateValuesByActionQuery = `
+		SELECT index_json, value FROM whatsmeow_app_state_values WHERE jid=$1 AND name=$2 AND action=$3 ORDER BY index_json
+	`
+)
+
+// Indexes are stored as JSON, which is the same format used inside the app state itself.
+// The first part (the action name) is also stored separately, so that it can be used for filtering.
+
+func encodeIndex(index []string) (string, error) {
+	if len(index) == 0 {
+		return "", fmt.Errorf("app state index must not be empty")
+	}
+	data, err := json.Marshal(index)
+	return string(data), err
+}
+
+func hasIndexPrefix(index, prefix []string) bool {
+	if len(index) < len(prefix) {
+		return false
+	}
+	for i, part := range prefix {
+		if index[i] != part {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SQLStore) PutAppStateValues(name string, values []store.AppStateValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for _, value := range values {
+		err = s.putAppStateValue(tx, name, value)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) putAppStateValue(tx execable, name string, value store.AppStateValue) error {
+	indexJSON, err := encodeIndex(value.Index)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(value.Value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value of %s: %w", indexJSON, err)
+	}
+	_, err = tx.Exec(s.dialectQuery(deleteAppStateValueQuery), s.JID, name, indexJSON)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(s.dialectQuery(putAppStateValueQuery), s.JID, name, value.Index[0], indexJSON, data)
+	return err
+}
+
+func (s *SQLStore) DeleteAppStateValues(name string, indexes [][]string) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for _, index := range indexes {
+		var indexJSON string
+		indexJSON, err = encodeIndex(index)
+		if err == nil {
+			_, err = tx.Exec(s.dialectQuery(deleteAppStateValueQuery), s.JID, name, indexJSON)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteAllAppStateValues(name string) error {
+	_, err := s.db.Exec(s.dialectQuery(deleteAllAppStateValuesQuery), s.JID, name)
+	return err
+}
+
+func (s *SQLStore) GetAppStateValue(name string, index []string) (*waSyncAction.SyncActionValue, error) {
+	indexJSON, err := encodeIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = s.db.QueryRow(s.dialectQuery(getAppStateValueQuery), s.JID, name, indexJSON).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var value waSyncAction.SyncActionValue
+	err = proto.Unmarshal(data, &value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal value of %s: %w", indexJSON, err)
+	}
+	return &value, nil
+}
+
+func (s *SQLStore) GetAppStateValuesByPrefix(name string, prefix []string) ([]store.AppStateValue, error) {
+	if len(prefix) == 0 {
+		return nil, fmt.Errorf("index prefix must not be empty")
+	}
+	rows, err := s.db.Query(s.dialectQuery(getAppStateValuesByActionQuery), s.JID, name, prefix[0])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []store.AppStateValue
+	for rows.Next() {
+		var indexJSON string
+		var data []byte
+		err = rows.Scan(&indexJSON, &data)
+		if err != nil {
+			return nil, err
+		}
+		var value store.AppStateValue
+		err = json.Unmarshal([]byte(indexJSON), &value.Index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stored index %s: %w", indexJSON, err)
+		} else if !hasIndexPrefix(value.Index, prefix) {
+			continue
+		}
+		value.Value = &waSyncAction.SyncActionValue{}
+		err = proto.Unmarshal(data, value.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal value of %s: %w", indexJSON, err)
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+const (
+	deleteDeviceListQuery        = `DELETE FROM whatsmeow_device_lists WHERE our_jid=$1 AND user_jid=$2`
+	putDeviceListQuery           = `INSERT INTO whatsmeow_device_lists (our_jid, user_jid, devices, dhash, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	getDeviceListQuery           = `SELECT devices, dhash, updated_at FROM whatsmeow_device_lists WHERE our_jid=$1 AND user_jid=$2`
+	deleteGroupParticipantsQuery = `DELETE FROM whatsmeow_group_participants WHERE our_jid=$1 AND group_jid=$2`
+	putGroupParticipantsQuery    = `INSERT INTO whatsmeow_group_participants (our_jid, group_jid, participants) VALUES ($1, $2, $3)`
+	getGroupParticipantsQuery    = `SELECT participants FROM whatsmeow_group_participants WHERE our_jid=$1 AND group_jid=$2`
+)
+
+// JID lists are stored as comma-separated strings, as they're always read and written all at once.
+
+func joinJIDs(jids []types.JID) string {
+	strs := make([]string, len(jids))
+	for i, jid := range jids {
+		strs[i] = jid.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+func splitJIDs(str string) ([]types.JID, error) {
+	if str == "" {
+		return []types.JID{}, nil
+	}
+	parts := strings.Split(str, ",")
+	jids := make([]types.JID, len(parts))
+	for i, part := range parts {
+		var err error
+		jids[i], err = types.ParseJID(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cached JID %q: %w", part, err)
+		}
+	}
+	return jids, nil
+}
+
+// replaceRow deletes the row matching the first two arguments and inserts a new one in a single transaction.
+func (s *SQLStore) replaceRow(deleteQuery, insertQuery string, args ...any) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	_, err = tx.Exec(s.dialectQuery(deleteQuery), args[:2]...)
+	if err == nil {
+		_, err = tx.Exec(s.dialectQuery(insertQuery), args...)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) PutDeviceList(user types.JID, devices []types.JID, dhash string) error {
+	return s.replaceRow(deleteDeviceListQuery, putDeviceListQuery, s.JID, user.ToNonAD(), joinJIDs(devices), dhash, time.Now().Unix())
+}
+
+func (s *SQLStore) GetDeviceList(user types.JID) ([]types.JID, string, time.Time, error) {
+	var devices, dhash string
+	var updatedAt int64
+	err := s.db.QueryRow(s.dialectQuery(getDeviceListQuery), s.JID, user.ToNonAD()).Scan(&devices, &dhash, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", time.Time{}, nil
+	} else if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	jids, err := splitJIDs(devices)
+	return jids, dhash, time.Unix(updatedAt, 0), err
+}
+
+func (s *SQLStore) DeleteDeviceList(user types.JID) error {
+	_, err := s.db.Exec(s.dialectQuery(deleteDeviceListQuery), s.JID, user.ToNonAD())
+	return err
+}
+
+func (s *SQLStore) PutGroupParticipants(group types.JID, participants []types.JID) error {
+	return s.replaceRow(deleteGroupParticipantsQuery, putGroupParticipantsQuery, s.JID, group, joinJIDs(participants))
+}
+
+func (s *SQLStore) GetGroupParticipants(group types.JID) ([]types.JID, error) {
+	var participants string
+	err := s.db.QueryRow(s.dialectQuery(getGroupParticipantsQuery), s.JID, group).Scan(&participants)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return splitJIDs(participants)
+}
+
+func (s *SQLStore) DeleteGroupParticipants(group types.JID) error {
+	_, err := s.db.Exec(s.dialectQuery(deleteGroupParticipantsQuery), s.JID, group)
+	return err
+}
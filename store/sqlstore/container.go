@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	mathRand "math/rand"
+	"time"
 
 	"github.com/google/uuid"
 	"go.mau.fi/util/random"
@@ -28,6 +29,9 @@ type Container struct {
 	dialect string
 	log     waLog.Logger
 
+	keyProvider   KeyProvider
+	storeMessages bool
+
 	DatabaseErrorHandler func(device *store.Device, action string, attemptIndex int, err error) (retry bool)
 }
 
@@ -88,7 +92,8 @@ const getAllDevicesQuery = `
 SELECT jid, registration_id, noise_key, identity_key,
        signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
        adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-       platform, business_name, push_name, facebook_uuid
+       platform, business_name, push_name, facebook_uuid, sealed_keys,
+       signed_pre_key_created_at, prev_signed_pre_key, prev_signed_pre_key_id, prev_signed_pre_key_sig
 FROM whatsmeow_device
 `
 
@@ -103,18 +108,28 @@ func (c *Container) scanDevice(row scannable) (*store.Device, error) {
 	device.DatabaseErrorHandler = c.DatabaseErrorHandler
 	device.Log = c.log
 	device.SignedPreKey = &keys.PreKey{}
-	var noisePriv, identityPriv, preKeyPriv, preKeySig []byte
+	var noisePriv, identityPriv, preKeyPriv, preKeySig, sealedKeys, prevPreKeyPriv, prevPreKeySig []byte
 	var account waAdv.ADVSignedDeviceIdentity
 	var fbUUID uuid.NullUUID
+	var preKeyCreatedAt int64
+	var prevPreKeyID sql.NullInt64
 
 	err := row.Scan(
 		&device.ID, &device.RegistrationID, &noisePriv, &identityPriv,
 		&preKeyPriv, &device.SignedPreKey.KeyID, &preKeySig,
 		&device.AdvSecretKey, &account.Details, &account.AccountSignature, &account.AccountSignatureKey, &account.DeviceSignature,
-		&device.Platform, &device.BusinessName, &device.PushName, &fbUUID)
+		&device.Platform, &device.BusinessName, &device.PushName, &fbUUID, &sealedKeys,
+		&preKeyCreatedAt, &prevPreKeyPriv, &prevPreKeyID, &prevPreKeySig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan session: %w", err)
-	} else if len(noisePriv) != 32 || len(identityPriv) != 32 || len(preKeyPriv) != 32 || len(preKeySig) != 64 {
+	}
+	if sealedKeys != nil {
+		noisePriv, identityPriv, preKeyPriv, device.AdvSecretKey, err = c.openDeviceKeys(device.ID.String(), sealedKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(noisePriv) != 32 || len(identityPriv) != 32 || len(preKeyPriv) != 32 || len(preKeySig) != 64 {
 		return nil, ErrInvalidLength
 	}
 
@@ -122,22 +137,27 @@ func (c *Container) scanDevice(row scannable) (*store.Device, error) {
 	device.IdentityKey = keys.NewKeyPairFromPrivateKey(*(*[32]byte)(identityPriv))
 	device.SignedPreKey.KeyPair = *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(preKeyPriv))
 	device.SignedPreKey.Signature = (*[64]byte)(preKeySig)
+	if preKeyCreatedAt != 0 {
+		device.SignedPreKeyCreatedAt = time.Unix(preKeyCreatedAt, 0)
+	}
+	if prevPreKeyPriv != nil && prevPreKeyID.Valid {
+		prevPreKeyPriv, err = c.decryptValue(aadPrevSignedPreKey, device.ID.String(), prevPreKeyPriv)
+		if err != nil {
+			return nil, err
+		} else if len(prevPreKeyPriv) != 32 || len(prevPreKeySig) != 64 {
+			return nil, ErrInvalidLength
+		}
+		device.PreviousSignedPreKey = &keys.PreKey{
+			KeyPair:   *keys.NewKeyPairFromPrivateKey(*(*[32]byte)(prevPreKeyPriv)),
+			KeyID:     uint32(prevPreKeyID.Int64),
+			Signature: (*[64]byte)(prevPreKeySig),
+		}
+	}
 	device.Account = &account
 	device.FacebookUUID = fbUUID.UUID
 
-	innerStore := NewSQLStore(c, *device.ID)
-	device.Identities = innerStore
-	device.Sessions = innerStore
-	device.PreKeys = innerStore
-	device.SenderKeys = innerStore
-	device.AppStateKeys = innerStore
-	device.AppState = innerStore
-	device.Contacts = innerStore
-	device.ChatSettings = innerStore
-	device.MsgSecrets = innerStore
-	device.PrivacyTokens = innerStore
+	c.initStores(&device)
 	device.Container = c
-	device.Initialized = true
 
 	return &device, nil
 }
@@ -192,8 +212,9 @@ const (
 		INSERT INTO whatsmeow_device (jid, registration_id, noise_key, identity_key,
 									  signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
 									  adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-									  platform, business_name, push_name, facebook_uuid)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+									  platform, business_name, push_name, facebook_uuid, sealed_keys,
+									  signed_pre_key_created_at, prev_signed_pre_key, prev_signed_pre_key_id, prev_signed_pre_key_sig)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 		ON CONFLICT (jid) DO UPDATE
 		    SET platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name
 	`
@@ -217,6 +238,7 @@ func (c *Container) NewDevice() *store.Device {
 		AdvSecretKey:   random.Bytes(32),
 	}
 	device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(1)
+	device.SignedPreKeyCreatedAt = time.Now()
 	return device
 }
 
@@ -247,22 +269,34 @@ func (c *Container) PutDevice(device *store.Device) error {
 		INSERT INTO whatsmeow_device (jid, registration_id, noise_key, identity_key,
 									  signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
 									  adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-									  platform, business_name, push_name, facebook_uuid)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+									  platform, business_name, push_name, facebook_uuid, sealed_keys,
+									  signed_pre_key_created_at, prev_signed_pre_key, prev_signed_pre_key_id, prev_signed_pre_key_sig)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE
+		    noise_key=VALUES(noise_key), identity_key=VALUES(identity_key), adv_key=VALUES(adv_key),
 		    platform=VALUES(platform), business_name=VALUES(business_name), push_name=VALUES(push_name),
-		    facebook_uuid=VALUES(facebook_uuid)
+		    facebook_uuid=VALUES(facebook_uuid), signed_pre_key=VALUES(signed_pre_key),
+		    signed_pre_key_id=VALUES(signed_pre_key_id), signed_pre_key_sig=VALUES(signed_pre_key_sig),
+		    sealed_keys=VALUES(sealed_keys), signed_pre_key_created_at=VALUES(signed_pre_key_created_at),
+		    prev_signed_pre_key=VALUES(prev_signed_pre_key), prev_signed_pre_key_id=VALUES(prev_signed_pre_key_id),
+		    prev_signed_pre_key_sig=VALUES(prev_signed_pre_key_sig)
 		`
 	} else if c.dialect == "sqlite" {
 		query = `
 		INSERT INTO whatsmeow_device (jid, registration_id, noise_key, identity_key,
 									  signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
 									  adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-									  platform, business_name, push_name, facebook_uuid)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+									  platform, business_name, push_name, facebook_uuid, sealed_keys,
+									  signed_pre_key_created_at, prev_signed_pre_key, prev_signed_pre_key_id, prev_signed_pre_key_sig)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT (jid) DO UPDATE
-		    SET platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name,
-		    facebook_uuid=excluded.facebook_uuid
+		    SET noise_key=excluded.noise_key, identity_key=excluded.identity_key, adv_key=excluded.adv_key,
+		    platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name,
+		    facebook_uuid=excluded.facebook_uuid, signed_pre_key=excluded.signed_pre_key,
+		    signed_pre_key_id=excluded.signed_pre_key_id, signed_pre_key_sig=excluded.signed_pre_key_sig,
+		    sealed_keys=excluded.sealed_keys, signed_pre_key_created_at=excluded.signed_pre_key_created_at,
+		    prev_signed_pre_key=excluded.prev_signed_pre_key, prev_signed_pre_key_id=excluded.prev_signed_pre_key_id,
+		    prev_signed_pre_key_sig=excluded.prev_signed_pre_key_sig
 		`
 	} else {
 		// PostgreSQL
@@ -270,11 +304,17 @@ func (c *Container) PutDevice(device *store.Device) error {
 		INSERT INTO whatsmeow_device (jid, registration_id, noise_key, identity_key,
 									  signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
 									  adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig,
-									  platform, business_name, push_name, facebook_uuid)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+									  platform, business_name, push_name, facebook_uuid, sealed_keys,
+									  signed_pre_key_created_at, prev_signed_pre_key, prev_signed_pre_key_id, prev_signed_pre_key_sig)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 		ON CONFLICT (jid) DO UPDATE
-		    SET platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name,
-		    facebook_uuid=excluded.facebook_uuid
+		    SET noise_key=excluded.noise_key, identity_key=excluded.identity_key, adv_key=excluded.adv_key,
+		    platform=excluded.platform, business_name=excluded.business_name, push_name=excluded.push_name,
+		    facebook_uuid=excluded.facebook_uuid, signed_pre_key=excluded.signed_pre_key,
+		    signed_pre_key_id=excluded.signed_pre_key_id, signed_pre_key_sig=excluded.signed_pre_key_sig,
+		    sealed_keys=excluded.sealed_keys, signed_pre_key_created_at=excluded.signed_pre_key_created_at,
+		    prev_signed_pre_key=excluded.prev_signed_pre_key, prev_signed_pre_key_id=excluded.prev_signed_pre_key_id,
+		    prev_signed_pre_key_sig=excluded.prev_signed_pre_key_sig
 		`
 	}
 
@@ -292,16 +332,50 @@ func (c *Container) PutDevice(device *store.Device) error {
 		fbUUIDValue = uuid.NullUUID{UUID: device.FacebookUUID, Valid: device.FacebookUUID != uuid.Nil}
 	}
 
+	// Signed prekeys may be rotated concurrently, so take a consistent snapshot of them
+	signedPreKey, prevSignedPreKey, signedPreKeyCreatedAt := device.GetSignedPreKeys()
+
+	// When encryption is enabled, the private keys are only stored in the sealed_keys column.
+	// The plaintext columns are overwritten on update too, so that saving a device that was stored
+	// before encryption was enabled doesn't leave its private keys in the database.
+	noisePriv, identityPriv, preKeyPriv, advKey := device.NoiseKey.Priv[:], device.IdentityKey.Priv[:], signedPreKey.Priv[:], device.AdvSecretKey
+	var sealedKeys []byte
+	if c.keyProvider != nil {
+		var err error
+		sealedKeys, err = c.sealDeviceKeys(device.ID.String(), noisePriv, identityPriv, preKeyPriv, advKey)
+		if err != nil {
+			return err
+		}
+		noisePriv, identityPriv, preKeyPriv, advKey = sealedKeyPlaceholder, sealedKeyPlaceholder, sealedKeyPlaceholder, []byte{}
+	}
+
+	// Signed prekeys are rotated, so the previous key is stored too until it expires
+	var preKeyCreatedAt int64
+	if !signedPreKeyCreatedAt.IsZero() {
+		preKeyCreatedAt = signedPreKeyCreatedAt.Unix()
+	}
+	var prevPreKeyPriv, prevPreKeySig []byte
+	var prevPreKeyID sql.NullInt64
+	if prev := prevSignedPreKey; prev != nil {
+		var err error
+		prevPreKeyPriv, err = c.encryptValue(aadPrevSignedPreKey, device.ID.String(), prev.Priv[:])
+		if err != nil {
+			return err
+		}
+		prevPreKeyID = sql.NullInt64{Int64: int64(prev.KeyID), Valid: true}
+		prevPreKeySig = prev.Signature[:]
+	}
+
 	// Create the args array
 	args = []interface{}{
 		device.ID.String(),
 		device.RegistrationID,
-		device.NoiseKey.Priv[:],
-		device.IdentityKey.Priv[:],
-		device.SignedPreKey.Priv[:],
-		device.SignedPreKey.KeyID,
-		device.SignedPreKey.Signature[:],
-		device.AdvSecretKey,
+		noisePriv,
+		identityPriv,
+		preKeyPriv,
+		signedPreKey.KeyID,
+		signedPreKey.Signature[:],
+		advKey,
 		device.Account.Details,
 		device.Account.AccountSignature,
 		device.Account.AccountSignatureKey,
@@ -310,27 +384,52 @@ func (c *Container) PutDevice(device *store.Device) error {
 		device.BusinessName,
 		device.PushName,
 		fbUUIDValue,
+		sealedKeys,
+		preKeyCreatedAt,
+		prevPreKeyPriv,
+		prevPreKeyID,
+		prevPreKeySig,
 	}
 
 	_, err := c.db.Exec(query, args...)
 
 	if !device.Initialized {
-		innerStore := NewSQLStore(c, *device.ID)
-		device.Identities = innerStore
-		device.Sessions = innerStore
-		device.PreKeys = innerStore
-		device.SenderKeys = innerStore
-		device.AppStateKeys = innerStore
-		device.AppState = innerStore
-		device.Contacts = innerStore
-		device.ChatSettings = innerStore
-		device.MsgSecrets = innerStore
-		device.PrivacyTokens = innerStore
-		device.Initialized = true
+		c.initStores(device)
 	}
 	return err
 }
 
+func (c *Container) initStores(device *store.Device) {
+	innerStore := NewSQLStore(c, *device.ID)
+	device.Identities = innerStore
+	device.Sessions = innerStore
+	device.PreKeys = innerStore
+	device.SenderKeys = innerStore
+	device.AppStateKeys = innerStore
+	device.AppState = innerStore
+	device.AppStateValues = innerStore
+	device.Contacts = innerStore
+	device.ChatSettings = innerStore
+	device.MsgSecrets = innerStore
+	device.PrivacyTokens = innerStore
+	if c.storeMessages {
+		device.Messages = innerStore
+	}
+	device.LIDs = innerStore
+	device.DeviceLists = innerStore
+	device.Groups = innerStore
+	device.Outbox = innerStore
+	device.Initialized = true
+}
+
+// SetMessageStorage enables or disables keeping the content of sent and received messages in the database.
+// Message storage is disabled by default, as it means all decrypted message plaintext is kept indefinitely.
+//
+// This only affects devices that are loaded or created after the call, so it should be called before GetDevice.
+func (c *Container) SetMessageStorage(enabled bool) {
+	c.storeMessages = enabled
+}
+
 // DeleteDevice deletes the given device from this database. This should be called through Device.Delete()
 func (c *Container) DeleteDevice(store *store.Device) error {
 	if store.ID == nil {
@@ -0,0 +1,387 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/util/random"
+
+	"github.com/shiestapoi/whatsmeow/util/gcmutil"
+)
+
+// KeyProvider provides the keys that are used to encrypt private key material in the database.
+//
+// Keys are identified by short string IDs, which are stored next to the encrypted data.
+// When rotating keys, the old keys must stay available through GetKey until
+// Container.RotateEncryptionKey has re-encrypted everything with the new current key.
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the key that should be used to encrypt new data.
+	CurrentKeyID() string
+	// GetKey returns the 32-byte AES key with the given ID.
+	GetKey(id string) ([]byte, error)
+}
+
+// StaticKeyProvider is a simple KeyProvider that holds all the keys in memory.
+type StaticKeyProvider struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+var _ KeyProvider = (*StaticKeyProvider)(nil)
+
+func (skp *StaticKeyProvider) CurrentKeyID() string {
+	return skp.Current
+}
+
+func (skp *StaticKeyProvider) GetKey(id string) ([]byte, error) {
+	key, ok := skp.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEncryptionKey, id)
+	}
+	return key, nil
+}
+
+var (
+	// ErrUnknownEncryptionKey is returned if the KeyProvider doesn't have the key that some data was encrypted with.
+	ErrUnknownEncryptionKey = errors.New("unknown encryption key")
+	// ErrEncryptionNotConfigured is returned when reading encrypted data from a Container without a KeyProvider.
+	ErrEncryptionNotConfigured = errors.New("database contains encrypted data, but no key provider is set")
+	// ErrInvalidEncryptedData is returned if encrypted data in the database is truncated.
+	ErrInvalidEncryptedData = errors.New("invalid encrypted data in database")
+)
+
+// encryptedPrefix marks values that have been encrypted. The leading null byte makes sure
+// it can't appear at the start of any protobuf-encoded session or sender key.
+var encryptedPrefix = []byte("\x00wmenc1")
+
+const (
+	encryptionNonceLength = 12
+	encryptedKeyIDSz      = 1
+)
+
+// Additional data used when encrypting each kind of value, which prevents moving values between columns.
+const (
+	aadDeviceKeys       = "whatsmeow_device.sealed_keys"
+	aadSession          = "whatsmeow_sessions.session"
+	aadPreKey           = "whatsmeow_pre_keys.key"
+	aadSenderKey        = "whatsmeow_sender_keys.sender_key"
+	aadAppStateKey      = "whatsmeow_app_state_sync_keys.key_data"
+	aadPrevSignedPreKey = "whatsmeow_device.prev_signed_pre_key"
+)
+
+// SetKeyProvider enables encryption of private key material (device keys, sessions, prekeys,
+// sender keys and app state sync keys) using keys from the given provider.
+//
+// New data is encrypted immediately, but existing rows are left as-is until EncryptExistingData is called.
+// Both plaintext and encrypted rows can be read while a provider is set.
+func (c *Container) SetKeyProvider(provider KeyProvider) {
+	c.keyProvider = provider
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedPrefix)
+}
+
+// encryptedKeyID returns the ID of the key that the given encrypted value was encrypted with.
+func encryptedKeyID(data []byte) (string, []byte, error) {
+	data = data[len(encryptedPrefix):]
+	if len(data) < encryptedKeyIDSz {
+		return "", nil, ErrInvalidEncryptedData
+	}
+	idLength := int(data[0])
+	data = data[encryptedKeyIDSz:]
+	if len(data) < idLength+encryptionNonceLength {
+		return "", nil, ErrInvalidEncryptedData
+	}
+	return string(data[:idLength]), data[idLength:], nil
+}
+
+func (c *Container) encryptValue(aad string, ourJID string, plaintext []byte) ([]byte, error) {
+	if c.keyProvider == nil || plaintext == nil {
+		return plaintext, nil
+	}
+	keyID := c.keyProvider.CurrentKeyID()
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("encryption key ID %q is too long", keyID)
+	}
+	key, err := c.keyProvider.GetKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	nonce := random.Bytes(encryptionNonceLength)
+	ciphertext, err := gcmutil.Encrypt(key, nonce, plaintext, []byte(aad+"|"+ourJID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", aad, err)
+	}
+	output := make([]byte, 0, len(encryptedPrefix)+encryptedKeyIDSz+len(keyID)+len(nonce)+len(ciphertext))
+	output = append(output, encryptedPrefix...)
+	output = append(output, byte(len(keyID)))
+	output = append(output, keyID...)
+	output = append(output, nonce...)
+	output = append(output, ciphertext...)
+	return output, nil
+}
+
+func (c *Container) decryptValue(aad string, ourJID string, data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	} else if c.keyProvider == nil {
+		return nil, ErrEncryptionNotConfigured
+	}
+	keyID, data, err := encryptedKeyID(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.keyProvider.GetKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	plaintext, err := gcmutil.Decrypt(key, data[:encryptionNonceLength], data[encryptionNonceLength:], []byte(aad+"|"+ourJID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", aad, err)
+	}
+	return plaintext, nil
+}
+
+// needsReencryption checks if the given value should be re-encrypted with the current key.
+// If onlyPlaintext is true, values that are already encrypted with any key are left alone.
+func (c *Container) needsReencryption(data []byte, onlyPlaintext bool) bool {
+	if data == nil {
+		return false
+	} else if !isEncrypted(data) {
+		return true
+	} else if onlyPlaintext {
+		return false
+	}
+	keyID, _, err := encryptedKeyID(data)
+	return err == nil && keyID != c.keyProvider.CurrentKeyID()
+}
+
+// sealedKeyPlaceholder is stored in the plaintext private key columns of whatsmeow_device
+// when the real keys are encrypted in the sealed_keys column.
+var sealedKeyPlaceholder = make([]byte, 32)
+
+func (c *Container) sealDeviceKeys(jid string, noisePriv, identityPriv, preKeyPriv, advKey []byte) ([]byte, error) {
+	plaintext := make([]byte, 0, 96+len(advKey))
+	plaintext = append(plaintext, noisePriv...)
+	plaintext = append(plaintext, identityPriv...)
+	plaintext = append(plaintext, preKeyPriv...)
+	plaintext = append(plaintext, advKey...)
+	return c.encryptValue(aadDeviceKeys, jid, plaintext)
+}
+
+func (c *Container) openDeviceKeys(jid string, sealed []byte) (noisePriv, identityPriv, preKeyPriv, advKey []byte, err error) {
+	var plaintext []byte
+	plaintext, err = c.decryptValue(aadDeviceKeys, jid, sealed)
+	if err != nil {
+		return
+	} else if len(plaintext) < 96 {
+		err = ErrInvalidLength
+		return
+	}
+	return plaintext[:32], plaintext[32:64], plaintext[64:96], plaintext[96:], nil
+}
+
+// ErrNoKeyProvider is returned by EncryptExistingData and RotateEncryptionKey if SetKeyProvider hasn't been called.
+var ErrNoKeyProvider = errors.New("no encryption key provider set")
+
+// EncryptExistingData encrypts all private key material that is currently stored in plaintext
+// using the current key of the KeyProvider. Values that are already encrypted are not touched.
+//
+// This should be called once after enabling encryption on an existing database.
+// It's safe to call it multiple times, e.g. if it was interrupted previously.
+func (c *Container) EncryptExistingData() error {
+	return c.reencryptAll(true)
+}
+
+// RotateEncryptionKey re-encrypts all private key material that isn't encrypted with the current key
+// of the KeyProvider. Plaintext values are encrypted as well.
+//
+// To rotate keys, change the current key ID of the KeyProvider (while keeping the old keys available),
+// call this method, and then the old keys can be removed from the provider.
+func (c *Container) RotateEncryptionKey() error {
+	return c.reencryptAll(false)
+}
+
+type encryptedColumn struct {
+	table   string
+	jidCol  string
+	keyCols []string
+	column  string
+	aad     string
+}
+
+// keyColumn returns the name of the column called key, which has to be quoted in MySQL.
+func (c *Container) keyColumn() string {
+	if c.dialect == "mysql" {
+		return "`key`"
+	}
+	return "key"
+}
+
+func (c *Container) encryptedColumns() []encryptedColumn {
+	keyColumn := c.keyColumn()
+	return []encryptedColumn{
+		{table: "whatsmeow_sessions", jidCol: "our_jid", keyCols: []string{"their_id"}, column: "session", aad: aadSession},
+		{table: "whatsmeow_pre_keys", jidCol: "jid", keyCols: []string{"key_id"}, column: keyColumn, aad: aadPreKey},
+		{table: "whatsmeow_sender_keys", jidCol: "our_jid", keyCols: []string{"chat_id", "sender_id"}, column: "sender_key", aad: aadSenderKey},
+		{table: "whatsmeow_app_state_sync_keys", jidCol: "jid", keyCols: []string{"key_id"}, column: "key_data", aad: aadAppStateKey},
+		{table: "whatsmeow_device", jidCol: "jid", column: "prev_signed_pre_key", aad: aadPrevSignedPreKey},
+	}
+}
+
+func (c *Container) reencryptAll(onlyPlaintext bool) error {
+	if c.keyProvider == nil {
+		return ErrNoKeyProvider
+	}
+	err := c.reencryptDevices(onlyPlaintext)
+	if err != nil {
+		return err
+	}
+	for _, col := range c.encryptedColumns() {
+		err = c.reencryptColumn(col, onlyPlaintext)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", col.table, err)
+		}
+	}
+	return nil
+}
+
+type encryptedRow struct {
+	jid   string
+	keys  []any
+	value []byte
+}
+
+func (c *Container) reencryptColumn(col encryptedColumn, onlyPlaintext bool) error {
+	selectCols := append(append([]string{col.jidCol}, col.keyCols...), col.column)
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s IS NOT NULL", strings.Join(selectCols, ", "), col.table, col.column)
+	rows, err := c.db.Query(selectQuery)
+	if err != nil {
+		return fmt.Errorf("failed to query rows: %w", err)
+	}
+	var pending []encryptedRow
+	for rows.Next() {
+		row := encryptedRow{keys: make([]any, len(col.keyCols))}
+		dest := make([]any, 0, 2+len(col.keyCols))
+		dest = append(dest, &row.jid)
+		for i := range row.keys {
+			dest = append(dest, &row.keys[i])
+		}
+		dest = append(dest, &row.value)
+		if err = rows.Scan(dest...); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if c.needsReencryption(row.value, onlyPlaintext) {
+			pending = append(pending, row)
+		}
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	} else if len(pending) == 0 {
+		return nil
+	}
+
+	// The old value is included in the WHERE clause, so values that are changed concurrently aren't overwritten.
+	where := make([]string, 0, 2+len(col.keyCols))
+	where = append(where, fmt.Sprintf("%s=$2", col.jidCol))
+	for i, keyCol := range col.keyCols {
+		where = append(where, fmt.Sprintf("%s=$%d", keyCol, i+3))
+	}
+	where = append(where, fmt.Sprintf("%s=$%d", col.column, len(col.keyCols)+3))
+	updateQuery := c.dialectQuery(fmt.Sprintf("UPDATE %s SET %s=$1 WHERE %s", col.table, col.column, strings.Join(where, " AND ")))
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, row := range pending {
+		var plaintext, ciphertext []byte
+		plaintext, err = c.decryptValue(col.aad, row.jid, row.value)
+		if err == nil {
+			ciphertext, err = c.encryptValue(col.aad, row.jid, plaintext)
+		}
+		if err == nil {
+			args := make([]any, 0, 3+len(row.keys))
+			args = append(args, ciphertext, row.jid)
+			args = append(args, row.keys...)
+			args = append(args, row.value)
+			_, err = tx.Exec(updateQuery, args...)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	c.log.Infof("Encrypted %d rows in %s", len(pending), col.table)
+	return tx.Commit()
+}
+
+const getAllDeviceKeysQuery = `SELECT jid, noise_key, identity_key, signed_pre_key, adv_key, sealed_keys FROM whatsmeow_device`
+
+func (c *Container) reencryptDevices(onlyPlaintext bool) error {
+	type deviceKeys struct {
+		jid                                 string
+		noisePriv, identityPriv, preKeyPriv []byte
+		advKey, sealedKeys                  []byte
+	}
+	rows, err := c.db.Query(getAllDeviceKeysQuery)
+	if err != nil {
+		return fmt.Errorf("failed to query devices: %w", err)
+	}
+	var pending []deviceKeys
+	for rows.Next() {
+		var dk deviceKeys
+		if err = rows.Scan(&dk.jid, &dk.noisePriv, &dk.identityPriv, &dk.preKeyPriv, &dk.advKey, &dk.sealedKeys); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan device: %w", err)
+		}
+		if c.needsReencryption(dk.sealedKeys, onlyPlaintext) || dk.sealedKeys == nil {
+			pending = append(pending, dk)
+		}
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate devices: %w", err)
+	}
+
+	for _, dk := range pending {
+		var sealed []byte
+		if dk.sealedKeys != nil {
+			dk.noisePriv, dk.identityPriv, dk.preKeyPriv, dk.advKey, err = c.openDeviceKeys(dk.jid, dk.sealedKeys)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt keys of %s: %w", dk.jid, err)
+			}
+		}
+		sealed, err = c.sealDeviceKeys(dk.jid, dk.noisePriv, dk.identityPriv, dk.preKeyPriv, dk.advKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt keys of %s: %w", dk.jid, err)
+		}
+		var query string
+		args := []any{sealedKeyPlaceholder, sealedKeyPlaceholder, sealedKeyPlaceholder, []byte{}, sealed, dk.jid}
+		if dk.sealedKeys == nil {
+			query = `UPDATE whatsmeow_device SET noise_key=$1, identity_key=$2, signed_pre_key=$3, adv_key=$4, sealed_keys=$5 WHERE jid=$6 AND sealed_keys IS NULL`
+		} else {
+			query = `UPDATE whatsmeow_device SET noise_key=$1, identity_key=$2, signed_pre_key=$3, adv_key=$4, sealed_keys=$5 WHERE jid=$6 AND sealed_keys=$7`
+			args = append(args, dk.sealedKeys)
+		}
+		_, err = c.db.Exec(c.dialectQuery(query), args...)
+		if err != nil {
+			return fmt.Errorf("failed to update keys of %s: %w", dk.jid, err)
+		}
+	}
+	if len(pending) > 0 {
+		c.log.Infof("Encrypted keys of %d devices", len(pending))
+	}
+	return nil
+}
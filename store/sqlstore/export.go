@@ -0,0 +1,250 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+var (
+	_ store.DataExporter   = (*SQLStore)(nil)
+	_ store.PreKeyImporter = (*SQLStore)(nil)
+)
+
+// ErrDeviceAlreadyExists is returned by Container.ImportDevice if the container already has a device with the same JID.
+var ErrDeviceAlreadyExists = store.ErrArchiveDeviceExists
+
+// ExportDevice writes a device archive of the device with the given JID. See store.Device.Export for details.
+func (c *Container) ExportDevice(jid types.JID, w io.Writer, passphrase string) error {
+	device, err := c.GetDevice(jid)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	} else if device == nil {
+		return fmt.Errorf("device %s not found", jid)
+	}
+	return device.Export(w, passphrase)
+}
+
+// ImportDevice restores a device archive created with store.Device.Export (in any container) into this database.
+func (c *Container) ImportDevice(r io.Reader, passphrase string) (*store.Device, error) {
+	archive, err := store.ReadDeviceArchive(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	device := c.NewDevice()
+	if err = archive.Restore(device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// ImportPreKey stores an existing prekey, replacing any previous key with the same ID.
+func (s *SQLStore) ImportPreKey(key *keys.PreKey, uploaded bool) error {
+	priv, err := s.encryptValue(aadPreKey, s.JID, key.Priv[:])
+	if err != nil {
+		return err
+	}
+	s.preKeyLock.Lock()
+	defer s.preKeyLock.Unlock()
+	// Delete and insert instead of upserting to avoid having yet another dialect-specific query
+	_, err = s.db.Exec(s.dialectQuery(deletePreKeyQuery), s.JID, key.KeyID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.dialectQuery(fmt.Sprintf("INSERT INTO whatsmeow_pre_keys (jid, key_id, %s, uploaded) VALUES ($1, $2, $3, $4)", s.keyColumn())), s.JID, key.KeyID, priv, uploaded)
+	return err
+}
+
+// exportRows runs the given query with the store's JID as the only parameter and calls fn for each row.
+func (s *SQLStore) exportRows(query string, fn func(rows *sql.Rows) error) error {
+	rows, err := s.db.Query(s.dialectQuery(query), s.JID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportData returns all the data in this store for device archives. Encrypted values are decrypted.
+func (s *SQLStore) ExportData() (*store.DeviceData, error) {
+	var data store.DeviceData
+	err := s.exportRows(`SELECT their_id, identity FROM whatsmeow_identity_keys WHERE our_jid=$1`, func(rows *sql.Rows) error {
+		var identity store.ArchivedIdentity
+		err := rows.Scan(&identity.Address, &identity.Key)
+		data.Identities = append(data.Identities, identity)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export identities: %w", err)
+	}
+	err = s.exportRows(`SELECT their_id, session FROM whatsmeow_sessions WHERE our_jid=$1`, func(rows *sql.Rows) error {
+		var session store.ArchivedSession
+		err := rows.Scan(&session.Address, &session.Session)
+		if err == nil {
+			session.Session, err = s.decryptValue(aadSession, s.JID, session.Session)
+		}
+		data.Sessions = append(data.Sessions, session)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	err = s.exportRows(fmt.Sprintf(`SELECT key_id, %s, uploaded FROM whatsmeow_pre_keys WHERE jid=$1`, s.keyColumn()), func(rows *sql.Rows) error {
+		var preKey store.ArchivedPreKey
+		err := rows.Scan(&preKey.KeyID, &preKey.Key, &preKey.Uploaded)
+		if err == nil {
+			preKey.Key, err = s.decryptValue(aadPreKey, s.JID, preKey.Key)
+		}
+		data.PreKeys = append(data.PreKeys, preKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export prekeys: %w", err)
+	}
+	err = s.exportRows(`SELECT chat_id, sender_id, sender_key FROM whatsmeow_sender_keys WHERE our_jid=$1`, func(rows *sql.Rows) error {
+		var senderKey store.ArchivedSenderKey
+		err := rows.Scan(&senderKey.Group, &senderKey.User, &senderKey.SenderKey)
+		if err == nil {
+			senderKey.SenderKey, err = s.decryptValue(aadSenderKey, s.JID, senderKey.SenderKey)
+		}
+		data.SenderKeys = append(data.SenderKeys, senderKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sender keys: %w", err)
+	}
+	err = s.exportRows(`SELECT key_id, key_data, fingerprint, timestamp FROM whatsmeow_app_state_sync_keys WHERE jid=$1`, func(rows *sql.Rows) error {
+		var key store.ArchivedAppStateKey
+		err := rows.Scan(&key.KeyID, &key.Data, &key.Fingerprint, &key.Timestamp)
+		if err == nil {
+			key.Data, err = s.decryptValue(aadAppStateKey, s.JID, key.Data)
+		}
+		data.AppStateSyncKeys = append(data.AppStateSyncKeys, key)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state sync keys: %w", err)
+	}
+	appStateIndexes := make(map[string]int)
+	err = s.exportRows(`SELECT name, version, hash FROM whatsmeow_app_state_version WHERE jid=$1`, func(rows *sql.Rows) error {
+		var state store.ArchivedAppState
+		err := rows.Scan(&state.Name, &state.Version, &state.Hash)
+		appStateIndexes[state.Name] = len(data.AppStates)
+		data.AppStates = append(data.AppStates, state)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state versions: %w", err)
+	}
+	err = s.exportRows(`SELECT name, version, index_mac, value_mac FROM whatsmeow_app_state_mutation_macs WHERE jid=$1`, func(rows *sql.Rows) error {
+		var name string
+		var mac store.ArchivedMutationMAC
+		err := rows.Scan(&name, &mac.Version, &mac.IndexMAC, &mac.ValueMAC)
+		if idx, ok := appStateIndexes[name]; ok && err == nil {
+			data.AppStates[idx].MutationMACs = append(data.AppStates[idx].MutationMACs, mac)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state mutation MACs: %w", err)
+	}
+	err = s.exportRows(`SELECT name, index_json, value FROM whatsmeow_app_state_values WHERE jid=$1`, func(rows *sql.Rows) error {
+		var name, indexJSON string
+		var value store.ArchivedAppStateValue
+		err := rows.Scan(&name, &indexJSON, &value.Value)
+		if err == nil {
+			err = json.Unmarshal([]byte(indexJSON), &value.Index)
+		}
+		if idx, ok := appStateIndexes[name]; ok && err == nil {
+			data.AppStates[idx].Values = append(data.AppStates[idx].Values, value)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export app state values: %w", err)
+	}
+	err = s.exportRows(`SELECT their_jid, first_name, full_name, push_name, business_name FROM whatsmeow_contacts WHERE our_jid=$1`, func(rows *sql.Rows) error {
+		var contact store.ArchivedContact
+		var first, full, push, business sql.NullString
+		err := rows.Scan(&contact.JID, &first, &full, &push, &business)
+		contact.FirstName, contact.FullName, contact.PushName, contact.BusinessName = first.String, full.String, push.String, business.String
+		data.Contacts = append(data.Contacts, contact)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export contacts: %w", err)
+	}
+	chatIndexes := make(map[types.JID]int)
+	err = s.exportRows(`
+		SELECT chat_jid, muted_until, pinned, archived, marked_unread, last_cleared, ephemeral_expiration, locked
+		FROM whatsmeow_chat_settings WHERE our_jid=$1
+	`, func(rows *sql.Rows) error {
+		var settings store.ArchivedChatSettings
+		var ephemeralExpiration int64
+		err := rows.Scan(
+			&settings.Chat, &settings.MutedUntil, &settings.Pinned, &settings.Archived,
+			&settings.MarkedAsUnread, &settings.LastCleared, &ephemeralExpiration, &settings.Locked,
+		)
+		settings.EphemeralExpiration = uint32(ephemeralExpiration)
+		chatIndexes[settings.Chat] = len(data.ChatSettings)
+		data.ChatSettings = append(data.ChatSettings, settings)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export chat settings: %w", err)
+	}
+	err = s.exportRows(`SELECT chat_jid, label_id FROM whatsmeow_chat_labels WHERE our_jid=$1 ORDER BY label_id`, func(rows *sql.Rows) error {
+		var chat types.JID
+		var labelID string
+		err := rows.Scan(&chat, &labelID)
+		if err != nil {
+			return err
+		}
+		idx, ok := chatIndexes[chat]
+		if !ok {
+			idx = len(data.ChatSettings)
+			chatIndexes[chat] = idx
+			data.ChatSettings = append(data.ChatSettings, store.ArchivedChatSettings{Chat: chat})
+		}
+		data.ChatSettings[idx].Labels = append(data.ChatSettings[idx].Labels, labelID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export chat labels: %w", err)
+	}
+	err = s.exportRows(fmt.Sprintf(`SELECT chat_jid, sender_jid, message_id, %s FROM whatsmeow_message_secrets WHERE our_jid=$1`, s.keyColumn()), func(rows *sql.Rows) error {
+		var secret store.ArchivedMessageSecret
+		err := rows.Scan(&secret.Chat, &secret.Sender, &secret.ID, &secret.Secret)
+		data.MessageSecrets = append(data.MessageSecrets, secret)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export message secrets: %w", err)
+	}
+	err = s.exportRows(`SELECT their_jid, token, timestamp FROM whatsmeow_privacy_tokens WHERE our_jid=$1`, func(rows *sql.Rows) error {
+		var token store.ArchivedPrivacyToken
+		err := rows.Scan(&token.User, &token.Token, &token.Timestamp)
+		data.PrivacyTokens = append(data.PrivacyTokens, token)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export privacy tokens: %w", err)
+	}
+	return &data, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+const (
+	deleteLIDMappingQuery = `DELETE FROM whatsmeow_lid_map WHERE our_jid=$1 AND (lid=$2 OR pn=$3)`
+	putLIDMappingQuery    = `INSERT INTO whatsmeow_lid_map (our_jid, lid, pn) VALUES ($1, $2, $3)`
+	getPNForLIDQuery      = `SELECT pn FROM whatsmeow_lid_map WHERE our_jid=$1 AND lid=$2`
+	getLIDForPNQuery      = `SELECT lid FROM whatsmeow_lid_map WHERE our_jid=$1 AND pn=$2`
+)
+
+func (s *SQLStore) PutLIDMappings(mappings ...store.LIDMapping) error {
+	s.lidCacheLock.Lock()
+	defer s.lidCacheLock.Unlock()
+	changed := make([]store.LIDMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		lid, pn := mapping.LID.ToNonAD(), mapping.PN.ToNonAD()
+		if lid.Server != types.HiddenUserServer || pn.Server != types.DefaultUserServer {
+			return fmt.Errorf("invalid LID mapping %s -> %s", mapping.LID, mapping.PN)
+		} else if cached, ok := s.lidCache[lid]; ok && cached == pn {
+			continue
+		}
+		changed = append(changed, store.LIDMapping{LID: lid, PN: pn})
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for _, mapping := range changed {
+		_, err = tx.Exec(s.dialectQuery(deleteLIDMappingQuery), s.JID, mapping.LID.String(), mapping.PN.String())
+		if err == nil {
+			_, err = tx.Exec(s.dialectQuery(putLIDMappingQuery), s.JID, mapping.LID.String(), mapping.PN.String())
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to store LID mapping %s -> %s: %w", mapping.LID, mapping.PN, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for _, mapping := range changed {
+		if oldPN, ok := s.lidCache[mapping.LID]; ok {
+			delete(s.lidCache, oldPN)
+		}
+		if oldLID, ok := s.lidCache[mapping.PN]; ok {
+			delete(s.lidCache, oldLID)
+		}
+		s.lidCache[mapping.LID] = mapping.PN
+		s.lidCache[mapping.PN] = mapping.LID
+	}
+	return nil
+}
+
+func (s *SQLStore) getLIDMapping(query string, source types.JID) (types.JID, error) {
+	source = source.ToNonAD()
+	s.lidCacheLock.RLock()
+	cached, ok := s.lidCache[source]
+	s.lidCacheLock.RUnlock()
+	if ok {
+		return cached, nil
+	}
+	var target types.JID
+	err := s.db.QueryRow(s.dialectQuery(query), s.JID, source.String()).Scan(&target)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Misses aren't cached, as most JIDs that are looked up never get a mapping,
+		// and caching them would grow the cache forever.
+		return types.EmptyJID, nil
+	} else if err != nil {
+		return types.EmptyJID, err
+	}
+	s.lidCacheLock.Lock()
+	s.lidCache[source] = target
+	s.lidCacheLock.Unlock()
+	return target, nil
+}
+
+func (s *SQLStore) GetPNForLID(lid types.JID) (types.JID, error) {
+	return s.getLIDMapping(getPNForLIDQuery, lid)
+}
+
+func (s *SQLStore) GetLIDForPN(pn types.JID) (types.JID, error) {
+	return s.getLIDMapping(getLIDForPNQuery, pn)
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+const (
+	putMessageQuery = `
+		INSERT INTO whatsmeow_messages (our_jid, chat_jid, message_id, sender_jid, from_me, timestamp, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (our_jid, chat_jid, message_id) DO UPDATE
+			SET sender_jid=excluded.sender_jid, from_me=excluded.from_me, timestamp=excluded.timestamp, message=excluded.message
+	`
+	putMessageQueryMySQL = `
+		INSERT INTO whatsmeow_messages (our_jid, chat_jid, message_id, sender_jid, from_me, timestamp, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			sender_jid=VALUES(sender_jid), from_me=VALUES(from_me), timestamp=VALUES(timestamp), message=VALUES(message)
+	`
+	getMessageQuery = `
+		SELECT chat_jid, message_id, sender_jid, from_me, timestamp, message, edited_message, edited_at, deleted
+		FROM whatsmeow_messages WHERE our_jid=$1 AND chat_jid=$2 AND message_id=$3
+	`
+	getChatMessagesQuery = `
+		SELECT chat_jid, message_id, sender_jid, from_me, timestamp, message, edited_message, edited_at, deleted
+		FROM whatsmeow_messages
+		WHERE our_jid=$1 AND chat_jid=$2 AND (timestamp<$3 OR (timestamp=$4 AND message_id<$5))
+		ORDER BY timestamp DESC, message_id DESC LIMIT $6
+	`
+	markMessageDeletedQuery = `UPDATE whatsmeow_messages SET deleted=true WHERE our_jid=$1 AND chat_jid=$2 AND message_id=$3`
+	markMessageEditedQuery  = `
+		UPDATE whatsmeow_messages SET edited_message=$1, edited_at=$2
+		WHERE our_jid=$3 AND chat_jid=$4 AND message_id=$5 AND edited_at<=$6
+	`
+)
+
+const messageBatchSize = 100
+
+func (s *SQLStore) putMessage(tx execable, msg *store.StoredMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message %s: %w", msg.ID, err)
+	}
+	query := s.dialectQuery(putMessageQuery)
+	if s.dialect == "mysql" {
+		query = putMessageQueryMySQL
+	}
+	_, err = tx.Exec(query, s.JID, msg.Chat.ToNonAD().String(), msg.ID, msg.Sender.ToNonAD().String(), msg.IsFromMe, msg.Timestamp.Unix(), data)
+	return err
+}
+
+func (s *SQLStore) PutMessage(msg *store.StoredMessage) error {
+	return s.putMessage(s.db, msg)
+}
+
+func (s *SQLStore) PutMessages(msgs []*store.StoredMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for i, msg := range msgs {
+		err = s.putMessage(tx, msg)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		// Commit in batches to avoid holding the write lock for too long with huge history syncs
+		if (i+1)%messageBatchSize == 0 && i+1 < len(msgs) {
+			if err = tx.Commit(); err != nil {
+				return fmt.Errorf("failed to commit transaction: %w", err)
+			} else if tx, err = s.db.Begin(); err != nil {
+				return fmt.Errorf("failed to start transaction: %w", err)
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func scanStoredMessage(row scannable) (*store.StoredMessage, error) {
+	var msg store.StoredMessage
+	var timestamp, editedAt int64
+	var data, editedData []byte
+	err := row.Scan(&msg.Chat, &msg.ID, &msg.Sender, &msg.IsFromMe, &timestamp, &data, &editedData, &editedAt, &msg.Deleted)
+	if err != nil {
+		return nil, err
+	}
+	msg.Timestamp = time.Unix(timestamp, 0)
+	msg.Message = &waE2E.Message{}
+	err = proto.Unmarshal(data, msg.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message %s: %w", msg.ID, err)
+	}
+	if editedData != nil {
+		msg.EditedMessage = &waE2E.Message{}
+		err = proto.Unmarshal(editedData, msg.EditedMessage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal edited content of message %s: %w", msg.ID, err)
+		}
+	}
+	if editedAt != 0 {
+		msg.EditedAt = time.Unix(editedAt, 0)
+	}
+	return &msg, nil
+}
+
+func (s *SQLStore) GetMessage(chat types.JID, id types.MessageID) (*store.StoredMessage, error) {
+	msg, err := scanStoredMessage(s.db.QueryRow(s.dialectQuery(getMessageQuery), s.JID, chat.ToNonAD().String(), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return msg, err
+}
+
+func (s *SQLStore) GetChatMessages(chat types.JID, before time.Time, beforeID types.MessageID, limit int) ([]*store.StoredMessage, error) {
+	beforeTS := before.Unix()
+	if before.IsZero() {
+		beforeTS = 1<<63 - 1
+	}
+	rows, err := s.db.Query(s.dialectQuery(getChatMessagesQuery), s.JID, chat.ToNonAD().String(), beforeTS, beforeTS, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	output := make([]*store.StoredMessage, 0, limit)
+	for rows.Next() {
+		msg, err := scanStoredMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		output = append(output, msg)
+	}
+	return output, rows.Err()
+}
+
+func (s *SQLStore) MarkMessageDeleted(chat types.JID, id types.MessageID) error {
+	_, err := s.db.Exec(s.dialectQuery(markMessageDeletedQuery), s.JID, chat.ToNonAD().String(), id)
+	return err
+}
+
+func (s *SQLStore) MarkMessageEdited(chat types.JID, id types.MessageID, newContent *waE2E.Message, editedAt time.Time) error {
+	data, err := proto.Marshal(newContent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal edited message: %w", err)
+	}
+	ts := editedAt.Unix()
+	_, err = s.db.Exec(s.dialectQuery(markMessageEditedQuery), data, ts, s.JID, chat.ToNonAD().String(), id, ts)
+	return err
+}
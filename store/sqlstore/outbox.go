@@ -0,0 +1,103 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+const (
+	putOutboxMessageQuery = `
+		INSERT INTO whatsmeow_outbox (our_jid, chat_jid, message_id, message, queued_at, attempts, next_attempt, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (our_jid, chat_jid, message_id) DO UPDATE
+			SET message=excluded.message, queued_at=excluded.queued_at, attempts=excluded.attempts,
+				next_attempt=excluded.next_attempt, last_error=excluded.last_error
+	`
+	putOutboxMessageQueryMySQL = `
+		INSERT INTO whatsmeow_outbox (our_jid, chat_jid, message_id, message, queued_at, attempts, next_attempt, last_error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			message=VALUES(message), queued_at=VALUES(queued_at), attempts=VALUES(attempts),
+			next_attempt=VALUES(next_attempt), last_error=VALUES(last_error)
+	`
+	getOutboxMessagesQuery = `
+		SELECT chat_jid, message_id, message, queued_at, attempts, next_attempt, last_error
+		FROM whatsmeow_outbox WHERE our_jid=$1
+		ORDER BY queued_at, message_id
+	`
+	deleteOutboxMessageQuery = `DELETE FROM whatsmeow_outbox WHERE our_jid=$1 AND chat_jid=$2 AND message_id=$3`
+)
+
+func (s *SQLStore) PutOutboxMessage(msg *store.OutboxMessage) error {
+	data, err := proto.Marshal(msg.Message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message %s: %w", msg.ID, err)
+	}
+	query := s.dialectQuery(putOutboxMessageQuery)
+	if s.dialect == "mysql" {
+		query = putOutboxMessageQueryMySQL
+	}
+	var nextAttempt int64
+	if !msg.NextAttempt.IsZero() {
+		nextAttempt = msg.NextAttempt.UnixNano()
+	}
+	_, err = s.db.Exec(
+		query, s.JID, msg.Chat.ToNonAD().String(), msg.ID, data,
+		msg.QueuedAt.UnixNano(), msg.Attempts, nextAttempt, msg.LastError,
+	)
+	return err
+}
+
+func scanOutboxMessage(row scannable) (*store.OutboxMessage, error) {
+	var msg store.OutboxMessage
+	var queuedAt, nextAttempt int64
+	var data []byte
+	err := row.Scan(&msg.Chat, &msg.ID, &data, &queuedAt, &msg.Attempts, &nextAttempt, &msg.LastError)
+	if err != nil {
+		return nil, err
+	}
+	msg.QueuedAt = time.Unix(0, queuedAt)
+	if nextAttempt != 0 {
+		msg.NextAttempt = time.Unix(0, nextAttempt)
+	}
+	msg.Message = &waE2E.Message{}
+	err = proto.Unmarshal(data, msg.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message %s: %w", msg.ID, err)
+	}
+	return &msg, nil
+}
+
+func (s *SQLStore) GetOutboxMessages() ([]*store.OutboxMessage, error) {
+	rows, err := s.db.Query(s.dialectQuery(getOutboxMessagesQuery), s.JID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var output []*store.OutboxMessage
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		output = append(output, msg)
+	}
+	return output, rows.Err()
+}
+
+func (s *SQLStore) DeleteOutboxMessage(chat types.JID, id types.MessageID) error {
+	_, err := s.db.Exec(s.dialectQuery(deleteOutboxMessageQuery), s.JID, chat.ToNonAD().String(), id)
+	return err
+}
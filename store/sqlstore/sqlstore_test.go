@@ -0,0 +1,506 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sqlstore
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/store/memstore"
+	"github.com/shiestapoi/whatsmeow/store/storetest"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func newTestContainer(t *testing.T, keyProvider KeyProvider) *Container {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "whatsmeow.db")+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	container := NewWithDB(db, "sqlite3", nil)
+	if keyProvider != nil {
+		container.SetKeyProvider(keyProvider)
+	}
+	if err = container.Upgrade(); err != nil {
+		t.Fatalf("Failed to upgrade database: %v", err)
+	}
+	return container
+}
+
+func newTestStore(t *testing.T, keyProvider KeyProvider) *SQLStore {
+	container := newTestContainer(t, keyProvider)
+	device := container.NewDevice()
+	jid := types.NewADJID("1234567890", 0, 1)
+	device.ID = &jid
+	device.Account = &waAdv.ADVSignedDeviceIdentity{
+		Details:             []byte{1},
+		AccountSignature:    make([]byte, 64),
+		AccountSignatureKey: make([]byte, 32),
+		DeviceSignature:     make([]byte, 64),
+	}
+	if err := device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	return device.Identities.(*SQLStore)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.AllStores {
+		return newTestStore(t, nil)
+	})
+}
+
+func newTestKeyProvider() *StaticKeyProvider {
+	return &StaticKeyProvider{
+		Current: "k1",
+		Keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+}
+
+func TestEncryptedConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.AllStores {
+		return newTestStore(t, newTestKeyProvider())
+	})
+}
+
+// rawKeyIDs returns the encryption key IDs of all the values in the encrypted columns.
+// Plaintext values are returned as empty strings.
+func rawKeyIDs(t *testing.T, c *Container) []string {
+	t.Helper()
+	var values [][]byte
+	for _, query := range []string{
+		"SELECT sealed_keys FROM whatsmeow_device",
+		"SELECT session FROM whatsmeow_sessions",
+		"SELECT key FROM whatsmeow_pre_keys",
+		"SELECT sender_key FROM whatsmeow_sender_keys",
+		"SELECT key_data FROM whatsmeow_app_state_sync_keys",
+	} {
+		rows, err := c.db.Query(query)
+		if err != nil {
+			t.Fatalf("Failed to query %q: %v", query, err)
+		}
+		for rows.Next() {
+			var value []byte
+			if err = rows.Scan(&value); err != nil {
+				t.Fatalf("Failed to scan %q: %v", query, err)
+			}
+			values = append(values, value)
+		}
+		_ = rows.Close()
+	}
+	keyIDs := make([]string, len(values))
+	for i, value := range values {
+		if isEncrypted(value) {
+			keyIDs[i], _, _ = encryptedKeyID(value)
+		}
+	}
+	return keyIDs
+}
+
+func expectKeyIDs(t *testing.T, c *Container, expected string) {
+	t.Helper()
+	for i, keyID := range rawKeyIDs(t, c) {
+		if keyID != expected {
+			t.Errorf("Expected value #%d to be encrypted with %q, got %q", i, expected, keyID)
+		}
+	}
+}
+
+func TestEncryptExistingData(t *testing.T) {
+	s := newTestStore(t, nil)
+	if err := s.PutSession("1111111111:1", []byte("session")); err != nil {
+		t.Fatalf("Failed to put session: %v", err)
+	} else if err = s.PutSenderKey("group@g.us", "1111111111:1", []byte("sender key")); err != nil {
+		t.Fatalf("Failed to put sender key: %v", err)
+	} else if err = s.PutAppStateSyncKey([]byte("id"), store.AppStateSyncKey{Data: []byte("app state key"), Fingerprint: []byte("fp"), Timestamp: 1}); err != nil {
+		t.Fatalf("Failed to put app state sync key: %v", err)
+	}
+	preKeys, err := s.GetOrGenPreKeys(3)
+	if err != nil {
+		t.Fatalf("Failed to generate prekeys: %v", err)
+	}
+	expectKeyIDs(t, s.Container, "")
+	origDevice, err := s.Container.GetDevice(types.NewADJID("1234567890", 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	if err = s.Container.EncryptExistingData(); !errors.Is(err, ErrNoKeyProvider) {
+		t.Errorf("Expected ErrNoKeyProvider without key provider, got %v", err)
+	}
+	kp := newTestKeyProvider()
+	s.Container.SetKeyProvider(kp)
+	if err = s.Container.EncryptExistingData(); err != nil {
+		t.Fatalf("Failed to encrypt existing data: %v", err)
+	}
+	expectKeyIDs(t, s.Container, "k1")
+
+	checkData := func(step string) {
+		t.Helper()
+		if session, err := s.GetSession("1111111111:1"); err != nil || string(session) != "session" {
+			t.Errorf("Unexpected session %s: %q / %v", step, session, err)
+		}
+		if senderKey, err := s.GetSenderKey("group@g.us", "1111111111:1"); err != nil || string(senderKey) != "sender key" {
+			t.Errorf("Unexpected sender key %s: %q / %v", step, senderKey, err)
+		}
+		if key, err := s.GetAppStateSyncKey([]byte("id")); err != nil || key == nil || string(key.Data) != "app state key" {
+			t.Errorf("Unexpected app state sync key %s: %+v / %v", step, key, err)
+		}
+		if preKey, err := s.GetPreKey(2); err != nil || preKey == nil || *preKey.Priv != *preKeys[1].Priv {
+			t.Errorf("Unexpected prekey %s: %v", step, err)
+		}
+		device, err := s.Container.GetDevice(*origDevice.ID)
+		if err != nil {
+			t.Fatalf("Failed to get device %s: %v", step, err)
+		} else if *device.NoiseKey.Priv != *origDevice.NoiseKey.Priv ||
+			*device.IdentityKey.Priv != *origDevice.IdentityKey.Priv ||
+			*device.SignedPreKey.Priv != *origDevice.SignedPreKey.Priv ||
+			!bytes.Equal(device.AdvSecretKey, origDevice.AdvSecretKey) {
+			t.Errorf("Device keys changed %s", step)
+		}
+	}
+	checkData("after encryption")
+
+	kp.Current = "k2"
+	if err = s.Container.EncryptExistingData(); err != nil {
+		t.Fatalf("Failed to encrypt existing data again: %v", err)
+	}
+	expectKeyIDs(t, s.Container, "k1")
+	if err = s.Container.RotateEncryptionKey(); err != nil {
+		t.Fatalf("Failed to rotate encryption key: %v", err)
+	}
+	expectKeyIDs(t, s.Container, "k2")
+	delete(kp.Keys, "k1")
+	checkData("after rotation")
+
+	s.Container.SetKeyProvider(nil)
+	if _, err = s.GetSession("1111111111:1"); !errors.Is(err, ErrEncryptionNotConfigured) {
+		t.Errorf("Expected ErrEncryptionNotConfigured without key provider, got %v", err)
+	}
+}
+
+func TestSaveClearsPlaintextKeys(t *testing.T) {
+	s := newTestStore(t, nil)
+	jid := types.NewADJID("1234567890", 0, 1)
+	s.Container.SetKeyProvider(newTestKeyProvider())
+	device, err := s.Container.GetDevice(jid)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	} else if err = device.Save(); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	var noisePriv, identityPriv, advKey []byte
+	err = s.db.QueryRow("SELECT noise_key, identity_key, adv_key FROM whatsmeow_device WHERE jid=?", jid.String()).
+		Scan(&noisePriv, &identityPriv, &advKey)
+	if err != nil {
+		t.Fatalf("Failed to get device keys: %v", err)
+	} else if !bytes.Equal(noisePriv, sealedKeyPlaceholder) || !bytes.Equal(identityPriv, sealedKeyPlaceholder) || len(advKey) != 0 {
+		t.Errorf("Expected plaintext keys to be cleared after saving with a key provider")
+	}
+	loaded, err := s.Container.GetDevice(jid)
+	if err != nil {
+		t.Fatalf("Failed to get device after saving: %v", err)
+	} else if *loaded.NoiseKey.Priv != *device.NoiseKey.Priv || *loaded.IdentityKey.Priv != *device.IdentityKey.Priv ||
+		!bytes.Equal(loaded.AdvSecretKey, device.AdvSecretKey) {
+		t.Errorf("Loaded device keys don't match the saved keys")
+	}
+}
+
+func TestSignedPreKeyRotation(t *testing.T) {
+	for name, keyProvider := range map[string]KeyProvider{"Plaintext": nil, "Encrypted": newTestKeyProvider()} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStore(t, keyProvider)
+			device, err := s.Container.GetDevice(types.NewADJID("1234567890", 0, 1))
+			if err != nil {
+				t.Fatalf("Failed to get device: %v", err)
+			}
+			oldKey := device.SignedPreKey
+			newKey := device.RotateSignedPreKey()
+			if newKey.KeyID != oldKey.KeyID+1 || device.PreviousSignedPreKey != oldKey {
+				t.Fatalf("Unexpected keys after rotation: %d -> %d", oldKey.KeyID, newKey.KeyID)
+			} else if err = device.Save(); err != nil {
+				t.Fatalf("Failed to save device: %v", err)
+			}
+			loaded, err := s.Container.GetDevice(*device.ID)
+			if err != nil {
+				t.Fatalf("Failed to get device after rotation: %v", err)
+			} else if loaded.SignedPreKey.KeyID != newKey.KeyID || *loaded.SignedPreKey.Priv != *newKey.Priv ||
+				*loaded.SignedPreKey.Signature != *newKey.Signature {
+				t.Errorf("Loaded signed prekey doesn't match the rotated key")
+			} else if prev := loaded.PreviousSignedPreKey; prev == nil || prev.KeyID != oldKey.KeyID ||
+				*prev.Priv != *oldKey.Priv || *prev.Signature != *oldKey.Signature {
+				t.Errorf("Loaded previous signed prekey doesn't match the original key")
+			} else if loaded.SignedPreKeyCreatedAt.Unix() != device.SignedPreKeyCreatedAt.Unix() {
+				t.Errorf("Expected signed prekey creation time %v, got %v", device.SignedPreKeyCreatedAt, loaded.SignedPreKeyCreatedAt)
+			}
+			if loaded.LoadSignedPreKey(oldKey.KeyID) == nil || loaded.LoadSignedPreKey(newKey.KeyID) == nil {
+				t.Errorf("Expected both signed prekeys to be loadable")
+			}
+
+			loaded.PreviousSignedPreKey = nil
+			if err = loaded.Save(); err != nil {
+				t.Fatalf("Failed to save device: %v", err)
+			}
+			loaded, err = s.Container.GetDevice(*device.ID)
+			if err != nil {
+				t.Fatalf("Failed to get device after removing previous key: %v", err)
+			} else if loaded.PreviousSignedPreKey != nil || loaded.LoadSignedPreKey(oldKey.KeyID) != nil {
+				t.Errorf("Expected previous signed prekey to be removed")
+			}
+		})
+	}
+}
+
+func TestSaveDuringSignedPreKeyRotation(t *testing.T) {
+	s := newTestStore(t, nil)
+	device, err := s.Container.GetDevice(types.NewADJID("1234567890", 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	const rotations = 50
+	rotated := make(map[uint32][32]byte, rotations+1)
+	rotated[device.SignedPreKey.KeyID] = *device.SignedPreKey.Priv
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rotations; i++ {
+			key := device.RotateSignedPreKey()
+			rotated[key.KeyID] = *key.Priv
+		}
+	}()
+	var saved []*store.Device
+	for i := 0; i < rotations; i++ {
+		if err = device.Save(); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+		loaded, err := s.Container.GetDevice(*device.ID)
+		if err != nil {
+			t.Fatalf("Failed to get device: %v", err)
+		}
+		saved = append(saved, loaded)
+	}
+	wg.Wait()
+	// Every saved row must have the private key that belongs to its key ID
+	for _, loaded := range saved {
+		if priv, ok := rotated[loaded.SignedPreKey.KeyID]; !ok || priv != *loaded.SignedPreKey.Priv {
+			t.Fatalf("Saved signed prekey %d doesn't match the rotated key", loaded.SignedPreKey.KeyID)
+		}
+	}
+}
+
+func TestMessageStorageOptIn(t *testing.T) {
+	s := newTestStore(t, nil)
+	jid := types.NewADJID("1234567890", 0, 1)
+	device, err := s.Container.GetDevice(jid)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	} else if device.Messages != nil {
+		t.Errorf("Expected message storage to be disabled by default")
+	}
+	s.Container.SetMessageStorage(true)
+	device, err = s.Container.GetDevice(jid)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	} else if device.Messages == nil {
+		t.Errorf("Expected message storage to be enabled")
+	}
+}
+
+func TestLIDCacheMisses(t *testing.T) {
+	s := newTestStore(t, nil)
+	lid := types.NewJID("100000000000001", types.HiddenUserServer)
+	pn := types.NewJID("1111111111", types.DefaultUserServer)
+	if found, err := s.GetPNForLID(lid); err != nil || !found.IsEmpty() {
+		t.Fatalf("Expected no mapping for unknown LID, got %s (%v)", found, err)
+	} else if len(s.lidCache) != 0 {
+		t.Errorf("Expected misses to not be cached, got %d cache entries", len(s.lidCache))
+	}
+	// Mappings added outside this store instance must be visible after a miss
+	_, err := s.db.Exec("INSERT INTO whatsmeow_lid_map (our_jid, lid, pn) VALUES (?, ?, ?)", s.JID, lid.String(), pn.String())
+	if err != nil {
+		t.Fatalf("Failed to insert LID mapping: %v", err)
+	}
+	if found, err := s.GetPNForLID(lid); err != nil || found != pn {
+		t.Errorf("Expected %s for LID after inserting mapping, got %s (%v)", pn, found, err)
+	}
+}
+
+func TestInvalidLength(t *testing.T) {
+	s := newTestStore(t, nil)
+	// The schema has CHECKs for the lengths, so they have to be disabled to insert broken data
+	_, err := s.db.Exec("PRAGMA ignore_check_constraints = ON")
+	if err != nil {
+		t.Fatalf("Failed to disable check constraints: %v", err)
+	}
+	_, err = s.db.Exec("INSERT INTO whatsmeow_identity_keys (our_jid, their_id, identity) VALUES (?, ?, ?)", s.JID, "1111111111:1", []byte{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Failed to insert broken identity: %v", err)
+	}
+	_, err = s.IsTrustedIdentity("1111111111:1", [32]byte{})
+	if !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Expected ErrInvalidLength for broken identity, got %v", err)
+	}
+	_, err = s.db.Exec("INSERT INTO whatsmeow_pre_keys (jid, key_id, key, uploaded) VALUES (?, ?, ?, ?)", s.JID, 1, []byte{1, 2, 3}, true)
+	if err != nil {
+		t.Fatalf("Failed to insert broken prekey: %v", err)
+	}
+	_, err = s.GetPreKey(1)
+	if !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Expected ErrInvalidLength for broken prekey, got %v", err)
+	}
+	_, err = s.db.Exec("INSERT INTO whatsmeow_app_state_version (jid, name, version, hash) VALUES (?, ?, ?, ?)", s.JID, "regular", 1, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Failed to insert broken app state version: %v", err)
+	}
+	_, _, err = s.GetAppStateVersion("regular")
+	if !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Expected ErrInvalidLength for broken app state hash, got %v", err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	s := newTestStore(t, newTestKeyProvider())
+	alice := types.NewJID("1111111111", types.DefaultUserServer)
+	group := types.NewJID("123456789-123456", types.GroupServer)
+	for _, err := range []error{
+		s.PutIdentity("1111111111:1", [32]byte{1}),
+		s.PutSession("1111111111:1", []byte("session")),
+		s.PutSenderKey(group.String(), "1111111111:1", []byte("sender key")),
+		s.PutAppStateSyncKey([]byte("id"), store.AppStateSyncKey{Data: []byte("app state key"), Fingerprint: []byte("fp"), Timestamp: 1}),
+		s.PutAppStateVersion("regular", 5, [128]byte{5}),
+		s.PutAppStateMutationMACs("regular", 5, []store.AppStateMutationMAC{{IndexMAC: bytes.Repeat([]byte{1}, 32), ValueMAC: bytes.Repeat([]byte{2}, 32)}}),
+		s.PutAppStateValues("regular", []store.AppStateValue{{Index: []string{"pin_v1", group.String()}, Value: &waSyncAction.SyncActionValue{PinAction: &waSyncAction.PinAction{Pinned: proto.Bool(true)}}}}),
+		s.PutAllContactNames([]store.ContactEntry{{JID: alice, FirstName: "Alice", FullName: "Alice Liddell"}}),
+		s.PutMutedUntil(group, time.Unix(2000000000, 0)),
+		s.PutPinned(group, true),
+		s.PutEphemeralExpiration(group, 86400),
+		s.PutChatLabel(group, "3", true),
+		s.PutMessageSecret(group, alice, "MSGID", []byte("secret")),
+		s.PutPrivacyTokens(store.PrivacyToken{User: alice, Token: []byte("token"), Timestamp: time.Unix(1700000000, 0)}),
+	} {
+		if err != nil {
+			t.Fatalf("Failed to fill store: %v", err)
+		}
+	}
+	if _, _, err := s.PutPushName(alice, "Ally"); err != nil {
+		t.Fatalf("Failed to put push name: %v", err)
+	}
+	preKeys, err := s.GetOrGenPreKeys(2)
+	if err != nil {
+		t.Fatalf("Failed to generate prekeys: %v", err)
+	}
+	ownJID, _ := types.ParseJID(s.JID)
+
+	var encrypted bytes.Buffer
+	if err = s.Container.ExportDevice(ownJID, &encrypted, "hunter2"); err != nil {
+		t.Fatalf("Failed to export device: %v", err)
+	}
+	if bytes.Contains(encrypted.Bytes(), []byte("Alice")) {
+		t.Error("Encrypted archive contains plaintext data")
+	}
+	if err = store.ImportDevice(bytes.NewReader(encrypted.Bytes()), "", memstore.New(nil).NewDevice()); !errors.Is(err, store.ErrArchivePassphraseRequired) {
+		t.Errorf("Expected ErrArchivePassphraseRequired, got %v", err)
+	}
+	if err = store.ImportDevice(bytes.NewReader(encrypted.Bytes()), "hunter3", memstore.New(nil).NewDevice()); !errors.Is(err, store.ErrWrongArchivePassphrase) {
+		t.Errorf("Expected ErrWrongArchivePassphrase, got %v", err)
+	}
+
+	// Move the device to a memory store and then back to a new database without encryption
+	memDevice := memstore.New(nil).NewDevice()
+	if err = store.ImportDevice(&encrypted, "hunter2", memDevice); err != nil {
+		t.Fatalf("Failed to import device into memory store: %v", err)
+	}
+	var plain bytes.Buffer
+	if err = memDevice.Export(&plain, ""); err != nil {
+		t.Fatalf("Failed to export device from memory store: %v", err)
+	}
+	err = store.ImportDevice(bytes.NewReader(plain.Bytes()), "", memDevice.Container.(*memstore.Container).NewDevice())
+	if !errors.Is(err, store.ErrArchiveDeviceExists) {
+		t.Errorf("Expected ErrArchiveDeviceExists when restoring over an existing device, got %v", err)
+	}
+	target := newTestContainer(t, nil)
+	imported, err := target.ImportDevice(bytes.NewReader(plain.Bytes()), "")
+	if err != nil {
+		t.Fatalf("Failed to import device into database: %v", err)
+	}
+	if _, err = target.ImportDevice(bytes.NewReader(plain.Bytes()), ""); !errors.Is(err, ErrDeviceAlreadyExists) {
+		t.Errorf("Expected ErrDeviceAlreadyExists when importing twice, got %v", err)
+	}
+
+	original, err := s.Container.GetDevice(ownJID)
+	if err != nil {
+		t.Fatalf("Failed to get original device: %v", err)
+	}
+	loaded, err := target.GetDevice(ownJID)
+	if err != nil || loaded == nil {
+		t.Fatalf("Failed to get imported device: %v", err)
+	} else if *loaded.NoiseKey.Priv != *original.NoiseKey.Priv || *loaded.IdentityKey.Priv != *original.IdentityKey.Priv ||
+		*loaded.SignedPreKey.Priv != *original.SignedPreKey.Priv || *loaded.SignedPreKey.Signature != *original.SignedPreKey.Signature ||
+		loaded.RegistrationID != original.RegistrationID || !bytes.Equal(loaded.AdvSecretKey, original.AdvSecretKey) ||
+		!bytes.Equal(loaded.Account.AccountSignature, original.Account.AccountSignature) {
+		t.Error("Imported device keys don't match original")
+	}
+
+	dst := imported.Identities.(*SQLStore)
+	if trusted, err := dst.IsTrustedIdentity("1111111111:1", [32]byte{1}); err != nil || !trusted {
+		t.Errorf("Identity not imported: %v", err)
+	}
+	if session, err := dst.GetSession("1111111111:1"); err != nil || string(session) != "session" {
+		t.Errorf("Session not imported: %q / %v", session, err)
+	}
+	if senderKey, err := dst.GetSenderKey(group.String(), "1111111111:1"); err != nil || string(senderKey) != "sender key" {
+		t.Errorf("Sender key not imported: %q / %v", senderKey, err)
+	}
+	if key, err := dst.GetPreKey(preKeys[1].KeyID); err != nil || key == nil || *key.Priv != *preKeys[1].Priv {
+		t.Errorf("Prekey not imported: %v", err)
+	}
+	if count, err := dst.UploadedPreKeyCount(); err != nil || count != 0 {
+		t.Errorf("Expected imported prekeys to not be uploaded, got %d / %v", count, err)
+	}
+	if key, err := dst.GetAppStateSyncKey([]byte("id")); err != nil || key == nil || string(key.Data) != "app state key" {
+		t.Errorf("App state sync key not imported: %+v / %v", key, err)
+	}
+	if version, hash, err := dst.GetAppStateVersion("regular"); err != nil || version != 5 || hash != [128]byte{5} {
+		t.Errorf("App state version not imported: %d / %v", version, err)
+	}
+	if mac, err := dst.GetAppStateMutationMAC("regular", bytes.Repeat([]byte{1}, 32)); err != nil || !bytes.Equal(mac, bytes.Repeat([]byte{2}, 32)) {
+		t.Errorf("Mutation MAC not imported: %X / %v", mac, err)
+	}
+	if value, err := dst.GetAppStateValue("regular", []string{"pin_v1", group.String()}); err != nil || !value.GetPinAction().GetPinned() {
+		t.Errorf("App state value not imported: %v / %v", value, err)
+	}
+	if contact, err := dst.GetContact(alice); err != nil || contact.FullName != "Alice Liddell" || contact.PushName != "Ally" {
+		t.Errorf("Contact not imported: %+v / %v", contact, err)
+	}
+	if settings, err := dst.GetChatSettings(group); err != nil || !settings.Pinned || settings.MutedUntil.Unix() != 2000000000 ||
+		settings.EphemeralExpiration != 86400 || len(settings.Labels) != 1 {
+		t.Errorf("Chat settings not imported: %+v / %v", settings, err)
+	}
+	if secret, err := dst.GetMessageSecret(group, alice, "MSGID"); err != nil || string(secret) != "secret" {
+		t.Errorf("Message secret not imported: %q / %v", secret, err)
+	}
+	if token, err := dst.GetPrivacyToken(alice); err != nil || token == nil || string(token.Token) != "token" || token.Timestamp.Unix() != 1700000000 {
+		t.Errorf("Privacy token not imported: %+v / %v", token, err)
+	}
+}
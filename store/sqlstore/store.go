@@ -43,6 +43,9 @@ type SQLStore struct {
 
 	contactCache     map[types.JID]*types.ContactInfo
 	contactCacheLock sync.Mutex
+
+	lidCache     map[types.JID]types.JID
+	lidCacheLock sync.RWMutex
 }
 
 // NewSQLStore creates a new SQLStore with the given database container and user JID.
@@ -54,6 +57,7 @@ func NewSQLStore(c *Container, jid types.JID) *SQLStore {
 		Container:    c,
 		JID:          jid.String(),
 		contactCache: make(map[types.JID]*types.ContactInfo),
+		lidCache:     make(map[types.JID]types.JID),
 	}
 }
 
@@ -70,16 +74,17 @@ const (
 	insertPreKeyQuery        = `INSERT INTO whatsmeow_pre_keys (jid, key_id, ` + "`key`" + `, uploaded) VALUES ($1, $2, $3, $4)`
 )
 
-func (s *SQLStore) dialectQuery(query string) string {
-	if s.dialect == "mysql" || s.dialect == "sqlite3" {
+func (c *Container) dialectQuery(query string) string {
+	if c.dialect == "mysql" || c.dialect == "sqlite3" {
 		// Replace $N with ? for MySQL and SQLite
 		result := query
-		for i := 1; i <= 20; i++ {
+		// Go in reverse order so that $1 doesn't match the beginning of $10
+		for i := 20; i >= 1; i-- {
 			result = strings.ReplaceAll(result, fmt.Sprintf("$%d", i), "?")
 		}
 
 		// Replace key with `key` for MySQL
-		if s.dialect == "mysql" {
+		if c.dialect == "mysql" {
 			// Handle the field name correctly by escaping with backticks
 			result = strings.ReplaceAll(result, "key FROM", "`key` FROM")
 			result = strings.ReplaceAll(result, "key_id, key FROM", "key_id, `key` FROM")
@@ -213,6 +218,8 @@ func (s *SQLStore) GetSession(address string) (session []byte, err error) {
 	err = s.db.QueryRow(s.dialectQuery(getSessionQuery), s.JID, address).Scan(&session)
 	if errors.Is(err, sql.ErrNoRows) {
 		err = nil
+	} else if err == nil {
+		session, err = s.decryptValue(aadSession, s.JID, session)
 	}
 	return
 }
@@ -243,7 +250,11 @@ func (s *SQLStore) PutSession(address string, session []byte) error {
 		query = putSessionQuery
 	}
 
-	_, err := s.db.Exec(query, s.JID, address, session)
+	session, err := s.encryptValue(aadSession, s.JID, session)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, s.JID, address, session)
 	return err
 }
 
@@ -268,6 +279,10 @@ const (
 
 func (s *SQLStore) genOnePreKey(id uint32, markUploaded bool) (*keys.PreKey, error) {
 	key := keys.NewPreKey(id)
+	priv, err := s.encryptValue(aadPreKey, s.JID, key.Priv[:])
+	if err != nil {
+		return nil, err
+	}
 
 	var query string
 	if s.dialect == "mysql" {
@@ -276,7 +291,7 @@ func (s *SQLStore) genOnePreKey(id uint32, markUploaded bool) (*keys.PreKey, err
 		query = s.dialectQuery(insertPreKeyQuery)
 	}
 
-	_, err := s.db.Exec(query, s.JID, key.KeyID, key.Priv[:], markUploaded)
+	_, err = s.db.Exec(query, s.JID, key.KeyID, priv, markUploaded)
 	return key, err
 }
 
@@ -311,7 +326,7 @@ func (s *SQLStore) GetOrGenPreKeys(count uint32) ([]*keys.PreKey, error) {
 	var existingCount uint32
 	for res.Next() {
 		var key *keys.PreKey
-		key, err = scanPreKey(res)
+		key, err = s.scanPreKey(res)
 		if err != nil {
 			return nil, err
 		} else if key != nil {
@@ -338,7 +353,7 @@ func (s *SQLStore) GetOrGenPreKeys(count uint32) ([]*keys.PreKey, error) {
 	return newKeys, nil
 }
 
-func scanPreKey(row scannable) (*keys.PreKey, error) {
+func (s *SQLStore) scanPreKey(row scannable) (*keys.PreKey, error) {
 	var priv []byte
 	var id uint32
 	err := row.Scan(&id, &priv)
@@ -346,6 +361,8 @@ func scanPreKey(row scannable) (*keys.PreKey, error) {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
+	} else if priv, err = s.decryptValue(aadPreKey, s.JID, priv); err != nil {
+		return nil, err
 	} else if len(priv) != 32 {
 		return nil, ErrInvalidLength
 	}
@@ -356,7 +373,7 @@ func scanPreKey(row scannable) (*keys.PreKey, error) {
 }
 
 func (s *SQLStore) GetPreKey(id uint32) (*keys.PreKey, error) {
-	return scanPreKey(s.db.QueryRow(s.dialectQuery(getPreKeyQuery), s.JID, id))
+	return s.scanPreKey(s.db.QueryRow(s.dialectQuery(getPreKeyQuery), s.JID, id))
 }
 
 func (s *SQLStore) RemovePreKey(id uint32) error {
@@ -384,6 +401,10 @@ const (
 )
 
 func (s *SQLStore) PutSenderKey(group, user string, session []byte) error {
+	session, err := s.encryptValue(aadSenderKey, s.JID, session)
+	if err != nil {
+		return err
+	}
 	if s.dialect == "mysql" {
 		// Use a direct MySQL query with proper backtick escaping
 		_, err := s.db.Exec(`
@@ -393,7 +414,7 @@ func (s *SQLStore) PutSenderKey(group, user string, session []byte) error {
 		`, s.JID, group, user, session)
 		return err
 	}
-	_, err := s.db.Exec(s.dialectQuery(putSenderKeyQuery), s.JID, group, user, session)
+	_, err = s.db.Exec(s.dialectQuery(putSenderKeyQuery), s.JID, group, user, session)
 	return err
 }
 
@@ -406,6 +427,8 @@ func (s *SQLStore) GetSenderKey(group, user string) (key []byte, err error) {
 	}
 	if errors.Is(err, sql.ErrNoRows) {
 		err = nil
+	} else if err == nil {
+		key, err = s.decryptValue(aadSenderKey, s.JID, key)
 	}
 	return
 }
@@ -422,6 +445,11 @@ const (
 )
 
 func (s *SQLStore) PutAppStateSyncKey(id []byte, key store.AppStateSyncKey) error {
+	var err error
+	key.Data, err = s.encryptValue(aadAppStateKey, s.JID, key.Data)
+	if err != nil {
+		return err
+	}
 	if s.dialect == "mysql" {
 		// Use standard MySQL syntax that works in all versions
 		tx, err := s.db.Begin()
@@ -451,11 +479,19 @@ func (s *SQLStore) PutAppStateSyncKey(id []byte, key store.AppStateSyncKey) erro
 	}
 
 	// For other databases, use the standard query
-	_, err := s.db.Exec(s.dialectQuery(putAppStateSyncKeyQuery), s.JID, id, key.Data, key.Timestamp, key.Fingerprint)
+	_, err = s.db.Exec(s.dialectQuery(putAppStateSyncKeyQuery), s.JID, id, key.Data, key.Timestamp, key.Fingerprint)
 	return err
 }
 
 func (s *SQLStore) GetAppStateSyncKey(id []byte) (*store.AppStateSyncKey, error) {
+	key, err := s.getAppStateSyncKey(id)
+	if key != nil && err == nil {
+		key.Data, err = s.decryptValue(aadAppStateKey, s.JID, key.Data)
+	}
+	return key, err
+}
+
+func (s *SQLStore) getAppStateSyncKey(id []byte) (*store.AppStateSyncKey, error) {
 	var key store.AppStateSyncKey
 
 	// Special handling for MySQL - binary key lookup can be problematic
@@ -537,7 +573,12 @@ func (s *SQLStore) GetAppStateVersion(name string) (version uint64, hash [128]by
 }
 
 func (s *SQLStore) DeleteAppStateVersion(name string) error {
-	_, err := s.db.Exec(s.dialectQuery(deleteAppStateVersionQuery), s.JID, name)
+	// Mutation MACs are deleted by the foreign key cascade, but values aren't tied to the version row
+	_, err := s.db.Exec(s.dialectQuery(deleteAllAppStateValuesQuery), s.JID, name)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.dialectQuery(deleteAppStateVersionQuery), s.JID, name)
 	return err
 }
 
@@ -639,7 +680,7 @@ func (s *SQLStore) DeleteAppStateMutationMACs(name string, indexMACs [][]byte) (
 		queryParts := make([]string, len(indexMACs))
 		for i, item := range indexMACs {
 			args[2+i] = item
-			if s.dialect == "mysql" || s.dialect == "sqlite" {
+			if s.dialect == "mysql" || s.dialect == "sqlite" || s.dialect == "sqlite3" {
 				queryParts[i] = "?"
 			} else {
 				queryParts[i] = fmt.Sprintf("$%d", i+3)
@@ -749,11 +790,14 @@ func (s *SQLStore) PutContactName(user types.JID, firstName, fullName string) er
 const contactBatchSize = 300
 
 func (s *SQLStore) putContactNamesBatch(tx execable, contacts []store.ContactEntry) error {
-	values := make([]interface{}, 1, 1+len(contacts)*3)
+	values := make([]interface{}, 1, 1+len(contacts)*4)
 	queryParts := make([]string, 0, len(contacts))
 	values[0] = s.JID
 	placeholderSyntax := "($1, $%d, $%d, $%d)"
-	if s.dialect == "sqlite3" || s.dialect == "mysql" {
+	positional := s.dialect == "sqlite3" || s.dialect == "mysql"
+	if positional {
+		// Positional placeholders can't reuse the first parameter, so the JID is repeated for every row
+		values = values[:0]
 		placeholderSyntax = "(?, ?, ?, ?)"
 	}
 	i := 0
@@ -771,8 +815,11 @@ func (s *SQLStore) putContactNamesBatch(tx execable, contacts []store.ContactEnt
 		}
 		handledContacts[contact.JID] = struct{}{}
 		baseIndex := i*3 + 1
+		if positional {
+			values = append(values, s.JID)
+		}
 		values = append(values, contact.JID.String(), contact.FirstName, contact.FullName)
-		if s.dialect == "sqlite3" || s.dialect == "mysql" {
+		if positional {
 			queryParts = append(queryParts, placeholderSyntax)
 		} else {
 			queryParts = append(queryParts, fmt.Sprintf(placeholderSyntax, baseIndex+1, baseIndex+2, baseIndex+3))
@@ -895,60 +942,89 @@ const (
 		ON CONFLICT (our_jid, chat_jid) DO UPDATE SET %[1]s=excluded.%[1]s
 	`
 	getChatSettingsQuery = `
-		SELECT muted_until, pinned, archived FROM whatsmeow_chat_settings WHERE our_jid=$1 AND chat_jid=$2
+		SELECT muted_until, pinned, archived, marked_unread, last_cleared, ephemeral_expiration, locked
+		FROM whatsmeow_chat_settings WHERE our_jid=$1 AND chat_jid=$2
 	`
+	putChatLabelQuery    = `INSERT INTO whatsmeow_chat_labels (our_jid, chat_jid, label_id) VALUES ($1, $2, $3)`
+	deleteChatLabelQuery = `DELETE FROM whatsmeow_chat_labels WHERE our_jid=$1 AND chat_jid=$2 AND label_id=$3`
+	getChatLabelsQuery   = `SELECT label_id FROM whatsmeow_chat_labels WHERE our_jid=$1 AND chat_jid=$2 ORDER BY label_id`
 )
 
-func (s *SQLStore) PutMutedUntil(chat types.JID, mutedUntil time.Time) error {
-	var val int64
-	if !mutedUntil.IsZero() {
-		val = mutedUntil.Unix()
-	}
-
+func (s *SQLStore) putChatSetting(chat types.JID, column string, value any) error {
 	var query string
 	if s.dialect == "mysql" {
-		query = fmt.Sprintf(putChatSettingQueryMySQL, "muted_until")
+		query = fmt.Sprintf(putChatSettingQueryMySQL, column)
 	} else if s.dialect == "sqlite3" {
-		query = fmt.Sprintf(putChatSettingQuerySQLite, "muted_until")
+		query = fmt.Sprintf(putChatSettingQuerySQLite, column)
 	} else {
-		query = fmt.Sprintf(putChatSettingQueryPostgres, "muted_until")
+		query = fmt.Sprintf(putChatSettingQueryPostgres, column)
 	}
 
-	_, err := s.db.Exec(s.dialectQuery(query), s.JID, chat, val)
+	_, err := s.db.Exec(s.dialectQuery(query), s.JID, chat, value)
 	return err
 }
 
-func (s *SQLStore) PutPinned(chat types.JID, pinned bool) error {
-	var query string
-	if s.dialect == "mysql" {
-		query = fmt.Sprintf(putChatSettingQueryMySQL, "pinned")
-	} else if s.dialect == "sqlite3" {
-		query = fmt.Sprintf(putChatSettingQuerySQLite, "pinned")
-	} else {
-		query = fmt.Sprintf(putChatSettingQueryPostgres, "pinned")
+func (s *SQLStore) PutMutedUntil(chat types.JID, mutedUntil time.Time) error {
+	var val int64
+	if !mutedUntil.IsZero() {
+		val = mutedUntil.Unix()
 	}
+	return s.putChatSetting(chat, "muted_until", val)
+}
 
-	_, err := s.db.Exec(s.dialectQuery(query), s.JID, chat, pinned)
-	return err
+func (s *SQLStore) PutPinned(chat types.JID, pinned bool) error {
+	return s.putChatSetting(chat, "pinned", pinned)
 }
 
 func (s *SQLStore) PutArchived(chat types.JID, archived bool) error {
-	var query string
-	if s.dialect == "mysql" {
-		query = fmt.Sprintf(putChatSettingQueryMySQL, "archived")
-	} else if s.dialect == "sqlite3" {
-		query = fmt.Sprintf(putChatSettingQuerySQLite, "archived")
-	} else {
-		query = fmt.Sprintf(putChatSettingQueryPostgres, "archived")
+	return s.putChatSetting(chat, "archived", archived)
+}
+
+func (s *SQLStore) PutMarkedAsUnread(chat types.JID, unread bool) error {
+	return s.putChatSetting(chat, "marked_unread", unread)
+}
+
+func (s *SQLStore) PutLastCleared(chat types.JID, clearedAt time.Time) error {
+	var val int64
+	if !clearedAt.IsZero() {
+		val = clearedAt.Unix()
 	}
+	return s.putChatSetting(chat, "last_cleared", val)
+}
 
-	_, err := s.db.Exec(s.dialectQuery(query), s.JID, chat, archived)
-	return err
+func (s *SQLStore) PutEphemeralExpiration(chat types.JID, expiration uint32) error {
+	return s.putChatSetting(chat, "ephemeral_expiration", int64(expiration))
+}
+
+func (s *SQLStore) PutLocked(chat types.JID, locked bool) error {
+	return s.putChatSetting(chat, "locked", locked)
+}
+
+func (s *SQLStore) PutChatLabel(chat types.JID, labelID string, labeled bool) error {
+	if !labeled {
+		_, err := s.db.Exec(s.dialectQuery(deleteChatLabelQuery), s.JID, chat, labelID)
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	_, err = tx.Exec(s.dialectQuery(deleteChatLabelQuery), s.JID, chat, labelID)
+	if err == nil {
+		_, err = tx.Exec(s.dialectQuery(putChatLabelQuery), s.JID, chat, labelID)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *SQLStore) GetChatSettings(chat types.JID) (settings types.LocalChatSettings, err error) {
-	var mutedUntil int64
-	err = s.db.QueryRow(s.dialectQuery(getChatSettingsQuery), s.JID, chat).Scan(&mutedUntil, &settings.Pinned, &settings.Archived)
+	var mutedUntil, lastCleared, ephemeralExpiration int64
+	err = s.db.QueryRow(s.dialectQuery(getChatSettingsQuery), s.JID, chat).Scan(
+		&mutedUntil, &settings.Pinned, &settings.Archived, &settings.MarkedAsUnread, &lastCleared, &ephemeralExpiration, &settings.Locked,
+	)
 	if errors.Is(err, sql.ErrNoRows) {
 		err = nil
 	} else if err != nil {
@@ -959,9 +1035,35 @@ func (s *SQLStore) GetChatSettings(chat types.JID) (settings types.LocalChatSett
 	if mutedUntil != 0 {
 		settings.MutedUntil = time.Unix(mutedUntil, 0)
 	}
+	if lastCleared != 0 {
+		settings.LastCleared = time.Unix(lastCleared, 0)
+	}
+	settings.EphemeralExpiration = uint32(ephemeralExpiration)
+	settings.Labels, err = s.getChatLabels(chat)
+	if len(settings.Labels) > 0 {
+		settings.Found = true
+	}
 	return
 }
 
+func (s *SQLStore) getChatLabels(chat types.JID) ([]string, error) {
+	rows, err := s.db.Query(s.dialectQuery(getChatLabelsQuery), s.JID, chat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var labels []string
+	for rows.Next() {
+		var labelID string
+		err = rows.Scan(&labelID)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, labelID)
+	}
+	return labels, rows.Err()
+}
+
 const (
 	putMsgSecret = `
 		INSERT INTO whatsmeow_message_secrets (our_jid, chat_jid, sender_jid, message_id, ` + "`key`" + `)
@@ -1121,7 +1223,22 @@ func (s *SQLStore) PutPrivacyTokens(tokens ...store.PrivacyToken) error {
 		return tx.Commit()
 	}
 
-	// Standard approach for non-MySQL databases
+	if len(tokens) == 0 {
+		return nil
+	} else if s.dialect == "sqlite3" {
+		// SQLite uses positional placeholders after dialectQuery, so the JID can't be shared between rows
+		args := make([]any, 0, len(tokens)*4)
+		placeholders := make([]string, len(tokens))
+		for i, token := range tokens {
+			args = append(args, s.JID, token.User.ToNonAD().String(), token.Token, token.Timestamp.Unix())
+			placeholders[i] = "(?, ?, ?, ?)"
+		}
+		query := strings.ReplaceAll(s.dialectQuery(putPrivacyTokens), "(?, ?, ?, ?)", strings.Join(placeholders, ","))
+		_, err := s.db.Exec(query, args...)
+		return err
+	}
+
+	// Standard approach for other databases
 	args := make([]any, 1+len(tokens)*3)
 	placeholders := make([]string, len(tokens))
 	args[0] = s.JID
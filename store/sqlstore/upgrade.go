@@ -18,7 +18,7 @@ type upgradeFunc func(*sql.Tx, *Container) error
 //
 // This may be of use if you want to manage the database fully manually, but in most cases you
 // should just call Container.Upgrade to let the library handle everything.
-var Upgrades = [...]upgradeFunc{upgradeV1, upgradeV2, upgradeV3, upgradeV4, upgradeV5, upgradeV6, upgradeV7}
+var Upgrades = [...]upgradeFunc{upgradeV1, upgradeV2, upgradeV3, upgradeV4, upgradeV5, upgradeV6, upgradeV7, upgradeV8, upgradeV9, upgradeV10, upgradeV11, upgradeV12, upgradeV13, upgradeV14, upgradeV15, upgradeV16}
 
 func (c *Container) getVersion() (int, error) {
 	_, err := c.db.Exec("CREATE TABLE IF NOT EXISTS whatsmeow_version (version INTEGER)")
@@ -615,3 +615,293 @@ func upgradeV7(tx *sql.Tx, container *Container) error {
 	}
 	return nil
 }
+
+func upgradeV8(tx *sql.Tx, container *Container) error {
+	var err error
+	if container.dialect == "mysql" {
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_messages (
+            our_jid VARCHAR(255),
+            chat_jid VARCHAR(255),
+            message_id VARCHAR(255),
+            sender_jid VARCHAR(255) NOT NULL,
+            from_me TINYINT(1) NOT NULL,
+            timestamp BIGINT NOT NULL,
+            message LONGBLOB NOT NULL,
+            edited_message LONGBLOB,
+            edited_at BIGINT NOT NULL DEFAULT 0,
+            deleted TINYINT(1) NOT NULL DEFAULT 0,
+            PRIMARY KEY (our_jid, chat_jid, message_id),
+            INDEX idx_whatsmeow_messages_chat_ts (our_jid, chat_jid, timestamp),
+            FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_messages (
+		our_jid        TEXT,
+		chat_jid       TEXT,
+		message_id     TEXT,
+		sender_jid     TEXT    NOT NULL,
+		from_me        BOOLEAN NOT NULL,
+		timestamp      BIGINT  NOT NULL,
+		message        bytea   NOT NULL,
+		edited_message bytea,
+		edited_at      BIGINT  NOT NULL DEFAULT 0,
+		deleted        BOOLEAN NOT NULL DEFAULT false,
+
+		PRIMARY KEY (our_jid, chat_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`CREATE INDEX whatsmeow_messages_chat_ts_idx ON whatsmeow_messages (our_jid, chat_jid, timestamp)`)
+	return err
+}
+
+func upgradeV9(tx *sql.Tx, container *Container) error {
+	var err error
+	if container.dialect == "mysql" {
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_lid_map (
+            our_jid VARCHAR(255),
+            lid VARCHAR(255),
+            pn VARCHAR(255) NOT NULL,
+            PRIMARY KEY (our_jid, lid),
+            UNIQUE (our_jid, pn),
+            FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_lid_map (
+		our_jid TEXT,
+		lid     TEXT,
+		pn      TEXT NOT NULL,
+
+		PRIMARY KEY (our_jid, lid),
+		UNIQUE (our_jid, pn),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	return err
+}
+
+func upgradeV10(tx *sql.Tx, container *Container) error {
+	if container.dialect == "mysql" {
+		// MySQL doesn't have the length checks, so only the new column is needed
+		_, err := tx.Exec("ALTER TABLE whatsmeow_device ADD COLUMN sealed_keys LONGBLOB")
+		if err != nil && !strings.Contains(err.Error(), "Duplicate column name") {
+			return err
+		}
+		return nil
+	}
+	_, err := tx.Exec("ALTER TABLE whatsmeow_device ADD COLUMN sealed_keys bytea")
+	if err != nil {
+		return err
+	}
+	// Encrypted prekeys are longer than 32 bytes, so the length check must be dropped.
+	// The length is checked after decrypting instead.
+	if strings.Contains(container.dialect, "postgres") || container.dialect == "pgx" {
+		_, err = tx.Exec("ALTER TABLE whatsmeow_pre_keys DROP CONSTRAINT IF EXISTS whatsmeow_pre_keys_key_check")
+		return err
+	}
+	// SQLite can't drop constraints, so recreate the table instead
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_pre_keys_new (
+		jid      TEXT,
+		key_id   INTEGER          CHECK ( key_id >= 0 AND key_id < 16777216 ),
+		key      bytea   NOT NULL,
+		uploaded BOOLEAN NOT NULL,
+
+		PRIMARY KEY (jid, key_id),
+		FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO whatsmeow_pre_keys_new (jid, key_id, key, uploaded) SELECT jid, key_id, key, uploaded FROM whatsmeow_pre_keys")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DROP TABLE whatsmeow_pre_keys")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("ALTER TABLE whatsmeow_pre_keys_new RENAME TO whatsmeow_pre_keys")
+	return err
+}
+
+func upgradeV11(tx *sql.Tx, container *Container) error {
+	var err error
+	if container.dialect == "mysql" {
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_device_lists (
+            our_jid VARCHAR(255),
+            user_jid VARCHAR(255),
+            devices LONGTEXT NOT NULL,
+            dhash VARCHAR(255) NOT NULL,
+            PRIMARY KEY (our_jid, user_jid),
+            FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_group_participants (
+            our_jid VARCHAR(255),
+            group_jid VARCHAR(255),
+            participants LONGTEXT NOT NULL,
+            PRIMARY KEY (our_jid, group_jid),
+            FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_device_lists (
+		our_jid  TEXT,
+		user_jid TEXT,
+		devices  TEXT NOT NULL,
+		dhash    TEXT NOT NULL,
+
+		PRIMARY KEY (our_jid, user_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_group_participants (
+		our_jid      TEXT,
+		group_jid    TEXT,
+		participants TEXT NOT NULL,
+
+		PRIMARY KEY (our_jid, group_jid),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	return err
+}
+
+func upgradeV12(tx *sql.Tx, container *Container) error {
+	var err error
+	if container.dialect == "mysql" {
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_app_state_values (
+            jid VARCHAR(255),
+            name VARCHAR(64),
+            action VARCHAR(64) NOT NULL,
+            index_json VARCHAR(400),
+            value LONGBLOB NOT NULL,
+            PRIMARY KEY (jid, name, index_json),
+            INDEX (jid, name, action),
+            FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_app_state_values (
+		jid        TEXT,
+		name       TEXT,
+		action     TEXT  NOT NULL,
+		index_json TEXT,
+		value      bytea NOT NULL,
+
+		PRIMARY KEY (jid, name, index_json),
+		FOREIGN KEY (jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`CREATE INDEX whatsmeow_app_state_values_action_idx ON whatsmeow_app_state_values (jid, name, action)`)
+	return err
+}
+
+func upgradeV13(tx *sql.Tx, container *Container) error {
+	boolType, falseValue := "BOOLEAN", "false"
+	if container.dialect == "mysql" {
+		boolType, falseValue = "TINYINT(1)", "0"
+	}
+	for _, column := range []string{
+		fmt.Sprintf("marked_unread %s NOT NULL DEFAULT %s", boolType, falseValue),
+		"last_cleared BIGINT NOT NULL DEFAULT 0",
+		"ephemeral_expiration BIGINT NOT NULL DEFAULT 0",
+		fmt.Sprintf("locked %s NOT NULL DEFAULT %s", boolType, falseValue),
+	} {
+		_, err := tx.Exec("ALTER TABLE whatsmeow_chat_settings ADD COLUMN " + column)
+		if err != nil {
+			return fmt.Errorf("failed to add chat settings column: %w", err)
+		}
+	}
+	var err error
+	if container.dialect == "mysql" {
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_chat_labels (
+            our_jid VARCHAR(255),
+            chat_jid VARCHAR(255),
+            label_id VARCHAR(64),
+            PRIMARY KEY (our_jid, chat_jid, label_id),
+            FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_chat_labels (
+		our_jid  TEXT,
+		chat_jid TEXT,
+		label_id TEXT,
+
+		PRIMARY KEY (our_jid, chat_jid, label_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	return err
+}
+
+func upgradeV14(tx *sql.Tx, container *Container) error {
+	blobType, intType := "bytea", "INTEGER"
+	if container.dialect == "mysql" {
+		blobType, intType = "LONGBLOB", "INT UNSIGNED"
+	}
+	for _, column := range []string{
+		"signed_pre_key_created_at BIGINT NOT NULL DEFAULT 0",
+		"prev_signed_pre_key " + blobType,
+		"prev_signed_pre_key_id " + intType,
+		"prev_signed_pre_key_sig " + blobType,
+	} {
+		_, err := tx.Exec("ALTER TABLE whatsmeow_device ADD COLUMN " + column)
+		if err != nil {
+			return fmt.Errorf("failed to add device column: %w", err)
+		}
+	}
+	return nil
+}
+
+func upgradeV15(tx *sql.Tx, container *Container) error {
+	var err error
+	if container.dialect == "mysql" {
+		_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS whatsmeow_outbox (
+            our_jid VARCHAR(255),
+            chat_jid VARCHAR(255),
+            message_id VARCHAR(255),
+            message LONGBLOB NOT NULL,
+            queued_at BIGINT NOT NULL,
+            attempts INT NOT NULL DEFAULT 0,
+            next_attempt BIGINT NOT NULL DEFAULT 0,
+            last_error TEXT NOT NULL,
+            PRIMARY KEY (our_jid, chat_jid, message_id),
+            INDEX idx_whatsmeow_outbox_queued_at (our_jid, queued_at),
+            FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+        ) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci`)
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE whatsmeow_outbox (
+		our_jid      TEXT,
+		chat_jid     TEXT,
+		message_id   TEXT,
+		message      bytea   NOT NULL,
+		queued_at    BIGINT  NOT NULL,
+		attempts     INTEGER NOT NULL DEFAULT 0,
+		next_attempt BIGINT  NOT NULL DEFAULT 0,
+		last_error   TEXT    NOT NULL DEFAULT '',
+
+		PRIMARY KEY (our_jid, chat_jid, message_id),
+		FOREIGN KEY (our_jid) REFERENCES whatsmeow_device(jid) ON DELETE CASCADE ON UPDATE CASCADE
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`CREATE INDEX whatsmeow_outbox_queued_at_idx ON whatsmeow_outbox (our_jid, queued_at)`)
+	return err
+}
+
+func upgradeV16(tx *sql.Tx, container *Container) error {
+	// Existing device lists get zero as the update time, so they're considered expired and fetched again
+	_, err := tx.Exec("ALTER TABLE whatsmeow_device_lists ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0")
+	return err
+}
@@ -9,11 +9,14 @@ package store
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/shiestapoi/whatsmeow/proto/waAdv"
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
 	"github.com/shiestapoi/whatsmeow/types"
 	"github.com/shiestapoi/whatsmeow/util/keys"
 	waLog "github.com/shiestapoi/whatsmeow/util/log"
@@ -75,6 +78,29 @@ type AppStateStore interface {
 	GetAppStateMutationMAC(name string, indexMAC []byte) (valueMAC []byte, err error)
 }
 
+// AppStateValue is the current value of a single app state index.
+type AppStateValue struct {
+	Index []string
+	Value *waSyncAction.SyncActionValue
+}
+
+// AppStateValueStore stores the latest decoded value of every app state index, so that the current state
+// can be queried without replaying all the mutations.
+//
+// Deleting an app state version with AppStateStore.DeleteAppStateVersion also deletes all values of that state.
+type AppStateValueStore interface {
+	// PutAppStateValues inserts or replaces the values of the given indexes.
+	PutAppStateValues(name string, values []AppStateValue) error
+	DeleteAppStateValues(name string, indexes [][]string) error
+	DeleteAllAppStateValues(name string) error
+	// GetAppStateValue returns the current value of the given index, or nil if the index isn't set.
+	GetAppStateValue(name string, index []string) (*waSyncAction.SyncActionValue, error)
+	// GetAppStateValuesByPrefix returns all values whose index starts with the given parts.
+	// The prefix must contain at least the first part of the index (the action name).
+	// The values are sorted by their JSON-encoded index.
+	GetAppStateValuesByPrefix(name string, prefix []string) ([]AppStateValue, error)
+}
+
 type ContactEntry struct {
 	JID       types.JID
 	FirstName string
@@ -94,6 +120,12 @@ type ChatSettingsStore interface {
 	PutMutedUntil(chat types.JID, mutedUntil time.Time) error
 	PutPinned(chat types.JID, pinned bool) error
 	PutArchived(chat types.JID, archived bool) error
+	PutMarkedAsUnread(chat types.JID, unread bool) error
+	PutLastCleared(chat types.JID, clearedAt time.Time) error
+	PutEphemeralExpiration(chat types.JID, expiration uint32) error
+	PutLocked(chat types.JID, locked bool) error
+	// PutChatLabel adds the label to the chat if labeled is true and removes it otherwise.
+	PutChatLabel(chat types.JID, labelID string, labeled bool) error
 	GetChatSettings(chat types.JID) (types.LocalChatSettings, error)
 }
 
@@ -126,6 +158,103 @@ type PrivacyTokenStore interface {
 	GetPrivacyToken(user types.JID) (*PrivacyToken, error)
 }
 
+// StoredMessage is a single message kept in a MessageStore.
+type StoredMessage struct {
+	Chat      types.JID
+	Sender    types.JID
+	ID        types.MessageID
+	IsFromMe  bool
+	Timestamp time.Time
+
+	// The raw message as it was sent or received, before any edits.
+	Message *waE2E.Message
+	// The latest edited content of the message. This is nil if the message hasn't been edited.
+	EditedMessage *waE2E.Message
+	EditedAt      time.Time
+	// Deleted is true if the message has been revoked.
+	Deleted bool
+}
+
+type MessageStore interface {
+	PutMessage(msg *StoredMessage) error
+	PutMessages(msgs []*StoredMessage) error
+	GetMessage(chat types.JID, id types.MessageID) (*StoredMessage, error)
+	// GetChatMessages returns up to limit messages in the given chat that come before the given message,
+	// sorted from newest to oldest. Messages are ordered by timestamp, and messages with the same timestamp
+	// by ID. If before is zero, the newest messages are returned.
+	//
+	// To get the next page, pass the timestamp and ID of the last message of the previous page. If beforeID
+	// is empty, all messages with the given timestamp are excluded.
+	GetChatMessages(chat types.JID, before time.Time, beforeID types.MessageID, limit int) ([]*StoredMessage, error)
+	MarkMessageDeleted(chat types.JID, id types.MessageID) error
+	MarkMessageEdited(chat types.JID, id types.MessageID, newContent *waE2E.Message, editedAt time.Time) error
+}
+
+// LIDMapping is a mapping between a hidden user ID (LID) and a phone number JID.
+type LIDMapping struct {
+	LID types.JID
+	PN  types.JID
+}
+
+// LIDStore stores the mappings between hidden user IDs (`@lid` JIDs) and phone number JIDs.
+//
+// Both sides are stored without the device part: implementations must call ToNonAD on inputs.
+// Each LID maps to at most one phone number and vice versa, so putting a mapping replaces any
+// previous mapping that either side was part of.
+type LIDStore interface {
+	PutLIDMappings(mappings ...LIDMapping) error
+	// GetPNForLID returns the phone number JID for the given LID, or an empty JID if it's not known.
+	GetPNForLID(lid types.JID) (types.JID, error)
+	// GetLIDForPN returns the LID for the given phone number JID, or an empty JID if it's not known.
+	GetLIDForPN(pn types.JID) (types.JID, error)
+}
+
+// DeviceListStore caches the device lists of users, so that they don't have to be fetched again after restarting.
+//
+// The user JIDs are stored without the device part, while the device lists contain AD JIDs.
+type DeviceListStore interface {
+	// PutDeviceList stores the device list of the given user. Implementations must also store the current time,
+	// which is returned by GetDeviceList, so that old entries can be ignored.
+	PutDeviceList(user types.JID, devices []types.JID, dhash string) error
+	// GetDeviceList returns the cached device list, its hash and when it was stored,
+	// or nil if the user's device list isn't cached.
+	GetDeviceList(user types.JID) (devices []types.JID, dhash string, updatedAt time.Time, err error)
+	DeleteDeviceList(user types.JID) error
+}
+
+// GroupParticipantStore caches the participant lists of groups, which are needed for sending messages.
+type GroupParticipantStore interface {
+	PutGroupParticipants(group types.JID, participants []types.JID) error
+	// GetGroupParticipants returns the cached participant list, or nil if the group's participants aren't cached.
+	GetGroupParticipants(group types.JID) ([]types.JID, error)
+	DeleteGroupParticipants(group types.JID) error
+}
+
+// OutboxMessage is a message waiting to be sent by the client's outbox.
+type OutboxMessage struct {
+	Chat    types.JID
+	ID      types.MessageID
+	Message *waE2E.Message
+
+	// QueuedAt is when the message was added to the outbox. Messages are sent in the order they were queued.
+	QueuedAt time.Time
+	// Attempts is the number of failed attempts to send the message so far.
+	Attempts int
+	// NextAttempt is the earliest time when the message should be sent again after a failed attempt.
+	NextAttempt time.Time
+	// LastError is the error of the last failed attempt.
+	LastError string
+}
+
+// OutboxStore persists messages that haven't been sent yet, so that they survive restarts.
+type OutboxStore interface {
+	// PutOutboxMessage inserts a message or replaces the stored message with the same chat and ID.
+	PutOutboxMessage(msg *OutboxMessage) error
+	// GetOutboxMessages returns all messages in the outbox, sorted by QueuedAt from oldest to newest.
+	GetOutboxMessages() ([]*OutboxMessage, error)
+	DeleteOutboxMessage(chat types.JID, id types.MessageID) error
+}
+
 type AllStores interface {
 	IdentityStore
 	SessionStore
@@ -133,10 +262,16 @@ type AllStores interface {
 	SenderKeyStore
 	AppStateSyncKeyStore
 	AppStateStore
+	AppStateValueStore
 	ContactStore
 	ChatSettingsStore
 	MsgSecretStore
 	PrivacyTokenStore
+	MessageStore
+	LIDStore
+	DeviceListStore
+	GroupParticipantStore
+	OutboxStore
 }
 
 type Device struct {
@@ -148,6 +283,16 @@ type Device struct {
 	RegistrationID uint32
 	AdvSecretKey   []byte
 
+	// SignedPreKeyCreatedAt is when SignedPreKey was generated. It's zero for keys that were created
+	// before signed prekey rotation was supported.
+	SignedPreKeyCreatedAt time.Time
+	// PreviousSignedPreKey is the signed prekey that was replaced by the last rotation. It's kept for a while
+	// after rotating so that messages encrypted using the old key can still be decrypted.
+	PreviousSignedPreKey *keys.PreKey
+	// signedPreKeyLock guards SignedPreKey, PreviousSignedPreKey and SignedPreKeyCreatedAt
+	// while the client is running, as they may be rotated while messages are being decrypted.
+	signedPreKeyLock sync.RWMutex
+
 	ID           *types.JID
 	Account      *waAdv.ADVSignedDeviceIdentity
 	Platform     string
@@ -156,18 +301,24 @@ type Device struct {
 
 	FacebookUUID uuid.UUID
 
-	Initialized   bool
-	Identities    IdentityStore
-	Sessions      SessionStore
-	PreKeys       PreKeyStore
-	SenderKeys    SenderKeyStore
-	AppStateKeys  AppStateSyncKeyStore
-	AppState      AppStateStore
-	Contacts      ContactStore
-	ChatSettings  ChatSettingsStore
-	MsgSecrets    MsgSecretStore
-	PrivacyTokens PrivacyTokenStore
-	Container     DeviceContainer
+	Initialized    bool
+	Identities     IdentityStore
+	Sessions       SessionStore
+	PreKeys        PreKeyStore
+	SenderKeys     SenderKeyStore
+	AppStateKeys   AppStateSyncKeyStore
+	AppState       AppStateStore
+	AppStateValues AppStateValueStore
+	Contacts       ContactStore
+	ChatSettings   ChatSettingsStore
+	MsgSecrets     MsgSecretStore
+	PrivacyTokens  PrivacyTokenStore
+	Messages       MessageStore
+	LIDs           LIDStore
+	DeviceLists    DeviceListStore
+	Groups         GroupParticipantStore
+	Outbox         OutboxStore
+	Container      DeviceContainer
 
 	DatabaseErrorHandler func(device *Device, action string, attemptIndex int, err error) (retry bool)
 }
@@ -184,6 +335,36 @@ func (device *Device) Save() error {
 	return device.Container.PutDevice(device)
 }
 
+// maxSignedPreKeyID is the largest signed prekey ID, as IDs are sent as 3-byte integers.
+const maxSignedPreKeyID = 0xFFFFFF
+
+// RotateSignedPreKey replaces the signed prekey with a newly generated one and moves the current key to
+// PreviousSignedPreKey. The changes are not saved automatically, and the new key must be uploaded
+// to the server separately.
+func (device *Device) RotateSignedPreKey() *keys.PreKey {
+	device.signedPreKeyLock.Lock()
+	defer device.signedPreKeyLock.Unlock()
+	nextID := device.SignedPreKey.KeyID%maxSignedPreKeyID + 1
+	device.PreviousSignedPreKey = device.SignedPreKey
+	device.SignedPreKey = device.IdentityKey.CreateSignedPreKey(nextID)
+	device.SignedPreKeyCreatedAt = time.Now()
+	return device.SignedPreKey
+}
+
+// GetSignedPreKeys returns the current and previous signed prekeys and when the current one was created.
+func (device *Device) GetSignedPreKeys() (current, previous *keys.PreKey, createdAt time.Time) {
+	device.signedPreKeyLock.RLock()
+	defer device.signedPreKeyLock.RUnlock()
+	return device.SignedPreKey, device.PreviousSignedPreKey, device.SignedPreKeyCreatedAt
+}
+
+// ForgetPreviousSignedPreKey removes the previous signed prekey. The change is not saved automatically.
+func (device *Device) ForgetPreviousSignedPreKey() {
+	device.signedPreKeyLock.Lock()
+	device.PreviousSignedPreKey = nil
+	device.signedPreKeyLock.Unlock()
+}
+
 func (device *Device) Delete() error {
 	err := device.Container.DeleteDevice(device)
 	if err != nil {
@@ -0,0 +1,244 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waSyncAction"
+	"github.com/shiestapoi/whatsmeow/store"
+)
+
+func testAppStateSyncKeyStore(t *testing.T, s store.AllStores) {
+	idA, idB := []byte("key-a"), []byte("key-b")
+
+	latest, err := s.GetLatestAppStateSyncKeyID()
+	noError(t, err, "get latest key ID without keys")
+	if latest != nil {
+		t.Errorf("Expected nil latest key ID without keys, got %X", latest)
+	}
+	key, err := s.GetAppStateSyncKey(idA)
+	noError(t, err, "get unknown key")
+	if key != nil {
+		t.Errorf("Expected nil for unknown key, got %+v", key)
+	}
+
+	noError(t, s.PutAppStateSyncKey(idA, store.AppStateSyncKey{Data: []byte("a1"), Fingerprint: []byte("fp-a1"), Timestamp: 100}), "put key")
+	noError(t, s.PutAppStateSyncKey(idB, store.AppStateSyncKey{Data: []byte("b1"), Fingerprint: []byte("fp-b1"), Timestamp: 200}), "put key")
+	key, err = s.GetAppStateSyncKey(idA)
+	noError(t, err, "get key")
+	if key == nil {
+		t.Fatal("Stored key not found")
+	}
+	expectBytes(t, []byte("a1"), key.Data, "key data")
+	expectBytes(t, []byte("fp-a1"), key.Fingerprint, "key fingerprint")
+	expectEqual(t, int64(100), key.Timestamp, "key timestamp")
+
+	latest, err = s.GetLatestAppStateSyncKeyID()
+	noError(t, err, "get latest key ID")
+	expectBytes(t, idB, latest, "latest key ID")
+
+	// Keys are only replaced by newer versions
+	noError(t, s.PutAppStateSyncKey(idA, store.AppStateSyncKey{Data: []byte("a0"), Fingerprint: []byte("fp-a0"), Timestamp: 50}), "put older key")
+	key, err = s.GetAppStateSyncKey(idA)
+	noError(t, err, "get key after putting older version")
+	expectBytes(t, []byte("a1"), key.Data, "key data after putting older version")
+	noError(t, s.PutAppStateSyncKey(idA, store.AppStateSyncKey{Data: []byte("a2"), Fingerprint: []byte("fp-a2"), Timestamp: 300}), "put newer key")
+	key, err = s.GetAppStateSyncKey(idA)
+	noError(t, err, "get key after putting newer version")
+	expectBytes(t, []byte("a2"), key.Data, "key data after putting newer version")
+	expectEqual(t, int64(300), key.Timestamp, "key timestamp after putting newer version")
+
+	latest, err = s.GetLatestAppStateSyncKeyID()
+	noError(t, err, "get latest key ID")
+	expectBytes(t, idA, latest, "latest key ID after update")
+}
+
+// indexMAC returns a unique 32-byte index MAC for the given number.
+func indexMAC(i int) []byte {
+	mac := filledBytes(32, 0x1)
+	binary.BigEndian.PutUint32(mac, uint32(i))
+	return mac
+}
+
+func testAppStateStore(t *testing.T, s store.AllStores) {
+	const name = "regular_high"
+	hash1, hash2 := [128]byte(filledBytes(128, 1)), [128]byte(filledBytes(128, 2))
+
+	version, hash, err := s.GetAppStateVersion(name)
+	noError(t, err, "get unknown app state version")
+	expectEqual(t, uint64(0), version, "unknown app state version")
+	expectEqual(t, [128]byte{}, hash, "unknown app state hash")
+
+	noError(t, s.PutAppStateVersion(name, 1, hash1), "put app state version")
+	version, hash, err = s.GetAppStateVersion(name)
+	noError(t, err, "get app state version")
+	expectEqual(t, uint64(1), version, "app state version")
+	expectEqual(t, hash1, hash, "app state hash")
+	noError(t, s.PutAppStateVersion(name, 2, hash2), "overwrite app state version")
+	version, hash, err = s.GetAppStateVersion(name)
+	noError(t, err, "get overwritten app state version")
+	expectEqual(t, uint64(2), version, "overwritten app state version")
+	expectEqual(t, hash2, hash, "overwritten app state hash")
+
+	valueMAC, err := s.GetAppStateMutationMAC(name, indexMAC(0))
+	noError(t, err, "get unknown mutation MAC")
+	if valueMAC != nil {
+		t.Errorf("Expected nil for unknown mutation MAC, got %X", valueMAC)
+	}
+	noError(t, s.PutAppStateMutationMACs(name, 1, []store.AppStateMutationMAC{
+		{IndexMAC: indexMAC(0), ValueMAC: filledBytes(32, 0xA)},
+		{IndexMAC: indexMAC(1), ValueMAC: filledBytes(32, 0xB)},
+	}), "put mutation MACs")
+	noError(t, s.PutAppStateMutationMACs(name, 2, []store.AppStateMutationMAC{
+		{IndexMAC: indexMAC(0), ValueMAC: filledBytes(32, 0xC)},
+	}), "put newer mutation MACs")
+	valueMAC, err = s.GetAppStateMutationMAC(name, indexMAC(0))
+	noError(t, err, "get mutation MAC")
+	expectBytes(t, filledBytes(32, 0xC), valueMAC, "value MAC of latest version")
+	valueMAC, err = s.GetAppStateMutationMAC(name, indexMAC(1))
+	noError(t, err, "get mutation MAC")
+	expectBytes(t, filledBytes(32, 0xB), valueMAC, "value MAC")
+	valueMAC, err = s.GetAppStateMutationMAC("critical_block", indexMAC(1))
+	noError(t, err, "get mutation MAC of other state")
+	if valueMAC != nil {
+		t.Errorf("Expected nil for mutation MAC in other state, got %X", valueMAC)
+	}
+
+	noError(t, s.DeleteAppStateMutationMACs(name, [][]byte{indexMAC(0)}), "delete mutation MACs")
+	valueMAC, err = s.GetAppStateMutationMAC(name, indexMAC(0))
+	noError(t, err, "get deleted mutation MAC")
+	if valueMAC != nil {
+		t.Errorf("Expected nil for deleted mutation MAC, got %X", valueMAC)
+	}
+	noError(t, s.DeleteAppStateMutationMACs(name, nil), "delete empty list of mutation MACs")
+
+	// Big batches must work too, as full syncs can contain thousands of mutations
+	const bigBatch = 1000
+	mutations := make([]store.AppStateMutationMAC, bigBatch)
+	indexMACs := make([][]byte, bigBatch)
+	for i := range mutations {
+		indexMACs[i] = indexMAC(i + 100)
+		mutations[i] = store.AppStateMutationMAC{IndexMAC: indexMACs[i], ValueMAC: filledBytes(32, byte(i))}
+	}
+	noError(t, s.PutAppStateMutationMACs(name, 3, mutations), "put big batch of mutation MACs")
+	for _, i := range []int{0, 399, 400, bigBatch - 1} {
+		valueMAC, err = s.GetAppStateMutationMAC(name, indexMACs[i])
+		noError(t, err, "get mutation MAC #%d from big batch", i)
+		expectBytes(t, filledBytes(32, byte(i)), valueMAC, "value MAC from big batch")
+	}
+	noError(t, s.DeleteAppStateMutationMACs(name, indexMACs[:bigBatch/2]), "delete many mutation MACs")
+	valueMAC, err = s.GetAppStateMutationMAC(name, indexMACs[0])
+	noError(t, err, "get deleted mutation MAC")
+	if valueMAC != nil {
+		t.Errorf("Expected nil for deleted mutation MAC, got %X", valueMAC)
+	}
+	valueMAC, err = s.GetAppStateMutationMAC(name, indexMACs[bigBatch-1])
+	noError(t, err, "get remaining mutation MAC")
+	expectBytes(t, filledBytes(32, byte((bigBatch-1)%256)), valueMAC, "value MAC after deleting other MACs")
+
+	// Deleting the version deletes all the mutation MACs of that state too
+	noError(t, s.DeleteAppStateVersion(name), "delete app state version")
+	version, _, err = s.GetAppStateVersion(name)
+	noError(t, err, "get deleted app state version")
+	expectEqual(t, uint64(0), version, "deleted app state version")
+	valueMAC, err = s.GetAppStateMutationMAC(name, indexMAC(1))
+	noError(t, err, "get mutation MAC of deleted state")
+	if valueMAC != nil {
+		t.Errorf("Expected nil for mutation MAC of deleted state, got %X", valueMAC)
+	}
+}
+
+func pinValue(pinned bool) *waSyncAction.SyncActionValue {
+	return &waSyncAction.SyncActionValue{
+		Timestamp: proto.Int64(1700000000000),
+		PinAction: &waSyncAction.PinAction{Pinned: proto.Bool(pinned)},
+	}
+}
+
+func expectIndexes(t *testing.T, expected []string, values []store.AppStateValue, what string) {
+	t.Helper()
+	actual := make([]string, len(values))
+	for i, value := range values {
+		actual[i] = strings.Join(value.Index, ",")
+	}
+	if strings.Join(expected, " ") != strings.Join(actual, " ") {
+		t.Errorf("Expected %s to have indexes %v, got %v", what, expected, actual)
+	}
+}
+
+func testAppStateValueStore(t *testing.T, s store.AllStores) {
+	const name = "regular_low"
+	aliceIndex := []string{"pin_v1", aliceJID.String()}
+	bobIndex := []string{"pin_v1", bobJID.String()}
+	archiveIndex := []string{"archive", aliceJID.String()}
+
+	value, err := s.GetAppStateValue(name, aliceIndex)
+	noError(t, err, "get unknown app state value")
+	if value != nil {
+		t.Errorf("Expected nil for unknown app state value, got %v", value)
+	}
+
+	noError(t, s.PutAppStateValues(name, []store.AppStateValue{
+		{Index: bobIndex, Value: pinValue(true)},
+		{Index: aliceIndex, Value: pinValue(true)},
+		{Index: archiveIndex, Value: &waSyncAction.SyncActionValue{ArchiveChatAction: &waSyncAction.ArchiveChatAction{Archived: proto.Bool(true)}}},
+	}), "put app state values")
+	noError(t, s.PutAppStateValues(name, []store.AppStateValue{{Index: aliceIndex, Value: pinValue(false)}}), "replace app state value")
+	value, err = s.GetAppStateValue(name, aliceIndex)
+	noError(t, err, "get app state value")
+	if value == nil {
+		t.Fatal("Stored app state value not found")
+	}
+	expectEqual(t, false, value.GetPinAction().GetPinned(), "replaced pin value")
+	expectEqual(t, int64(1700000000000), value.GetTimestamp(), "value timestamp")
+	value, err = s.GetAppStateValue("regular_high", aliceIndex)
+	noError(t, err, "get app state value of other state")
+	if value != nil {
+		t.Errorf("Expected nil for app state value in other state, got %v", value)
+	}
+
+	values, err := s.GetAppStateValuesByPrefix(name, []string{"pin_v1"})
+	noError(t, err, "get app state values by action")
+	expectIndexes(t, []string{strings.Join(aliceIndex, ","), strings.Join(bobIndex, ",")}, values, "pin values")
+	values, err = s.GetAppStateValuesByPrefix(name, bobIndex)
+	noError(t, err, "get app state values by full index")
+	expectIndexes(t, []string{strings.Join(bobIndex, ",")}, values, "values with full index prefix")
+	if len(values) == 1 {
+		expectEqual(t, true, values[0].Value.GetPinAction().GetPinned(), "pin value from prefix query")
+	}
+	values, err = s.GetAppStateValuesByPrefix(name, []string{"mute"})
+	noError(t, err, "get app state values of unknown action")
+	expectIndexes(t, nil, values, "mute values")
+
+	noError(t, s.DeleteAppStateValues(name, [][]string{bobIndex}), "delete app state values")
+	values, err = s.GetAppStateValuesByPrefix(name, []string{"pin_v1"})
+	noError(t, err, "get app state values after deleting")
+	expectIndexes(t, []string{strings.Join(aliceIndex, ",")}, values, "pin values after deleting")
+	noError(t, s.DeleteAppStateValues(name, nil), "delete empty list of app state values")
+
+	noError(t, s.DeleteAllAppStateValues(name), "delete all app state values")
+	value, err = s.GetAppStateValue(name, archiveIndex)
+	noError(t, err, "get app state value after deleting all")
+	if value != nil {
+		t.Errorf("Expected nil for app state value after deleting all, got %v", value)
+	}
+
+	// Deleting the version deletes the values of that state too
+	noError(t, s.PutAppStateVersion(name, 1, [128]byte{}), "put app state version")
+	noError(t, s.PutAppStateValues(name, []store.AppStateValue{{Index: aliceIndex, Value: pinValue(true)}}), "put app state value")
+	noError(t, s.DeleteAppStateVersion(name), "delete app state version")
+	value, err = s.GetAppStateValue(name, aliceIndex)
+	noError(t, err, "get app state value of deleted state")
+	if value != nil {
+		t.Errorf("Expected nil for app state value of deleted state, got %v", value)
+	}
+}
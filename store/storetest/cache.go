@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func expectJIDs(t *testing.T, expected, actual []types.JID, what string) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %s to be %v, got %v", what, expected, actual)
+	}
+}
+
+func testDeviceListStore(t *testing.T, s store.AllStores) {
+	devices, dhash, _, err := s.GetDeviceList(aliceJID)
+	noError(t, err, "get unknown device list")
+	if devices != nil || dhash != "" {
+		t.Errorf("Expected nil for unknown device list, got %v / %q", devices, dhash)
+	}
+
+	aliceDevices := []types.JID{types.NewADJID(aliceJID.User, 0, 0), types.NewADJID(aliceJID.User, 0, 5)}
+	noError(t, s.PutDeviceList(types.NewADJID(aliceJID.User, 0, 5), aliceDevices, "2:abcd"), "put device list")
+	devices, dhash, updatedAt, err := s.GetDeviceList(aliceJID)
+	noError(t, err, "get device list")
+	expectJIDs(t, aliceDevices, devices, "device list")
+	expectEqual(t, "2:abcd", dhash, "device list hash")
+	if age := time.Since(updatedAt); age < -time.Second || age > time.Minute {
+		t.Errorf("Expected device list update time to be close to now, got %v", updatedAt)
+	}
+
+	noError(t, s.PutDeviceList(aliceJID, aliceDevices[:1], "2:efgh"), "replace device list")
+	devices, dhash, _, err = s.GetDeviceList(aliceJID)
+	noError(t, err, "get replaced device list")
+	expectJIDs(t, aliceDevices[:1], devices, "replaced device list")
+	expectEqual(t, "2:efgh", dhash, "replaced device list hash")
+
+	// Users with no devices must be distinguishable from unknown users
+	noError(t, s.PutDeviceList(bobJID, nil, ""), "put empty device list")
+	devices, _, _, err = s.GetDeviceList(bobJID)
+	noError(t, err, "get empty device list")
+	if devices == nil || len(devices) != 0 {
+		t.Errorf("Expected empty non-nil device list, got %v", devices)
+	}
+
+	noError(t, s.DeleteDeviceList(aliceJID), "delete device list")
+	devices, _, _, err = s.GetDeviceList(aliceJID)
+	noError(t, err, "get deleted device list")
+	if devices != nil {
+		t.Errorf("Expected nil for deleted device list, got %v", devices)
+	}
+}
+
+func testGroupParticipantStore(t *testing.T, s store.AllStores) {
+	participants, err := s.GetGroupParticipants(groupJID)
+	noError(t, err, "get unknown group participants")
+	if participants != nil {
+		t.Errorf("Expected nil for unknown group participants, got %v", participants)
+	}
+
+	lid := types.NewJID("100000000000001", types.HiddenUserServer)
+	noError(t, s.PutGroupParticipants(groupJID, []types.JID{aliceJID, bobJID, lid}), "put group participants")
+	participants, err = s.GetGroupParticipants(groupJID)
+	noError(t, err, "get group participants")
+	expectJIDs(t, []types.JID{aliceJID, bobJID, lid}, participants, "group participants")
+
+	noError(t, s.PutGroupParticipants(groupJID, []types.JID{bobJID}), "replace group participants")
+	participants, err = s.GetGroupParticipants(groupJID)
+	noError(t, err, "get replaced group participants")
+	expectJIDs(t, []types.JID{bobJID}, participants, "replaced group participants")
+
+	noError(t, s.DeleteGroupParticipants(groupJID), "delete group participants")
+	participants, err = s.GetGroupParticipants(groupJID)
+	noError(t, err, "get deleted group participants")
+	if participants != nil {
+		t.Errorf("Expected nil for deleted group participants, got %v", participants)
+	}
+}
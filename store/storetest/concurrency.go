@@ -0,0 +1,102 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+const (
+	concurrentWorkers    = 8
+	concurrentIterations = 25
+)
+
+func runConcurrently(t *testing.T, fn func(worker, iteration int) error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentWorkers)
+	for worker := 0; worker < concurrentWorkers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < concurrentIterations; i++ {
+				if err := fn(worker, i); err != nil {
+					errs <- fmt.Errorf("worker %d iteration %d: %w", worker, i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func testConcurrency(t *testing.T, s store.AllStores) {
+	t.Run("DisjointKeys", func(t *testing.T) {
+		runConcurrently(t, func(worker, i int) error {
+			address := fmt.Sprintf("%d:%d", 3300000000+worker, i)
+			data := []byte(address)
+			if err := s.PutSession(address, data); err != nil {
+				return fmt.Errorf("put session: %w", err)
+			} else if session, err := s.GetSession(address); err != nil {
+				return fmt.Errorf("get session: %w", err)
+			} else if string(session) != address {
+				return fmt.Errorf("got session %q instead of %q", session, address)
+			}
+			if err := s.PutSenderKey(groupJID.String(), address, data); err != nil {
+				return fmt.Errorf("put sender key: %w", err)
+			} else if key, err := s.GetSenderKey(groupJID.String(), address); err != nil {
+				return fmt.Errorf("get sender key: %w", err)
+			} else if string(key) != address {
+				return fmt.Errorf("got sender key %q instead of %q", key, address)
+			}
+			if err := s.PutIdentity(address, filledArray32(byte(worker))); err != nil {
+				return fmt.Errorf("put identity: %w", err)
+			}
+			user := types.NewJID(fmt.Sprintf("%d", 3300000000+worker), types.DefaultUserServer)
+			if _, _, err := s.PutPushName(user, address); err != nil {
+				return fmt.Errorf("put push name: %w", err)
+			}
+			return nil
+		})
+	})
+
+	t.Run("SameKeys", func(t *testing.T) {
+		var changedCount atomic.Int32
+		runConcurrently(t, func(worker, i int) error {
+			preKeys, err := s.GetOrGenPreKeys(10)
+			if err != nil {
+				return fmt.Errorf("get prekeys: %w", err)
+			}
+			for j, key := range preKeys {
+				if key.KeyID != uint32(j+1) {
+					return fmt.Errorf("got prekey ID %d at index %d", key.KeyID, j)
+				}
+			}
+			if i == 0 {
+				changed, _, err := s.PutPushName(aliceJID, "Alice")
+				if err != nil {
+					return fmt.Errorf("put push name: %w", err)
+				} else if changed {
+					changedCount.Add(1)
+				}
+			}
+			return nil
+		})
+		// Exactly one of the workers should've seen the push name change
+		expectEqual(t, int32(1), changedCount.Load(), "number of workers that changed the push name")
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"testing"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func testLIDStore(t *testing.T, s store.AllStores) {
+	lid1 := types.NewJID("100000000000001", types.HiddenUserServer)
+	lid2 := types.NewJID("100000000000002", types.HiddenUserServer)
+
+	pn, err := s.GetPNForLID(lid1)
+	noError(t, err, "get phone number for unknown LID")
+	expectEqual(t, types.EmptyJID, pn, "phone number for unknown LID")
+	lid, err := s.GetLIDForPN(aliceJID)
+	noError(t, err, "get LID for unknown phone number")
+	expectEqual(t, types.EmptyJID, lid, "LID for unknown phone number")
+
+	// Device parts must be ignored in both directions
+	lid1Device := lid1
+	lid1Device.Device = 3
+	noError(t, s.PutLIDMappings(store.LIDMapping{LID: lid1Device, PN: aliceJID}), "put LID mapping")
+	pn, err = s.GetPNForLID(lid1)
+	noError(t, err, "get phone number for LID")
+	expectEqual(t, aliceJID, pn, "phone number for LID")
+	lid, err = s.GetLIDForPN(types.NewADJID(aliceJID.User, 0, 9))
+	noError(t, err, "get LID for phone number")
+	expectEqual(t, lid1, lid, "LID for phone number")
+
+	// Putting the same mapping again is a no-op
+	noError(t, s.PutLIDMappings(store.LIDMapping{LID: lid1, PN: aliceJID}), "put duplicate LID mapping")
+
+	// A new mapping for either side replaces the old mapping completely
+	noError(t, s.PutLIDMappings(store.LIDMapping{LID: lid2, PN: aliceJID}, store.LIDMapping{LID: lid1, PN: bobJID}), "put replacing LID mappings")
+	pn, err = s.GetPNForLID(lid1)
+	noError(t, err, "get phone number for remapped LID")
+	expectEqual(t, bobJID, pn, "phone number for remapped LID")
+	pn, err = s.GetPNForLID(lid2)
+	noError(t, err, "get phone number for new LID")
+	expectEqual(t, aliceJID, pn, "phone number for new LID")
+	lid, err = s.GetLIDForPN(aliceJID)
+	noError(t, err, "get LID for remapped phone number")
+	expectEqual(t, lid2, lid, "LID for remapped phone number")
+
+	noError(t, s.PutLIDMappings(store.LIDMapping{LID: lid2, PN: bobJID}), "put replacing LID mapping")
+	pn, err = s.GetPNForLID(lid1)
+	noError(t, err, "get phone number for LID whose mapping was replaced")
+	expectEqual(t, types.EmptyJID, pn, "phone number for LID whose mapping was replaced")
+	lid, err = s.GetLIDForPN(aliceJID)
+	noError(t, err, "get LID for phone number whose mapping was replaced")
+	expectEqual(t, types.EmptyJID, lid, "LID for phone number whose mapping was replaced")
+
+	if err = s.PutLIDMappings(store.LIDMapping{LID: aliceJID, PN: lid1}); err == nil {
+		t.Error("Expected error when putting LID mapping with swapped sides")
+	}
+	noError(t, s.PutLIDMappings(), "put empty list of LID mappings")
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func textMessage(text string) *waE2E.Message {
+	return &waE2E.Message{Conversation: proto.String(text)}
+}
+
+func checkMessageIDs(t *testing.T, msgs []*store.StoredMessage, expected ...types.MessageID) {
+	t.Helper()
+	if len(msgs) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d", len(expected), len(msgs))
+	}
+	for i, msg := range msgs {
+		expectEqual(t, expected[i], msg.ID, fmt.Sprintf("ID of message #%d", i))
+	}
+}
+
+func testMessageStore(t *testing.T, s store.AllStores) {
+	baseTS := time.Unix(1700000000, 0)
+
+	msg, err := s.GetMessage(groupJID, "MSG1")
+	noError(t, err, "get unknown message")
+	if msg != nil {
+		t.Errorf("Expected nil for unknown message, got %+v", msg)
+	}
+
+	noError(t, s.PutMessage(&store.StoredMessage{
+		Chat:      groupJID,
+		Sender:    types.NewADJID(aliceJID.User, 0, 2),
+		ID:        "MSG1",
+		Timestamp: baseTS,
+		Message:   textMessage("hello"),
+	}), "put message")
+	msg, err = s.GetMessage(groupJID, "MSG1")
+	noError(t, err, "get message")
+	if msg == nil {
+		t.Fatal("Stored message not found")
+	}
+	expectEqual(t, groupJID, msg.Chat, "message chat")
+	expectEqual(t, aliceJID, msg.Sender, "message sender (without device)")
+	expectEqual(t, types.MessageID("MSG1"), msg.ID, "message ID")
+	expectEqual(t, false, msg.IsFromMe, "message from me flag")
+	expectEqual(t, baseTS.Unix(), msg.Timestamp.Unix(), "message timestamp")
+	expectEqual(t, "hello", msg.Message.GetConversation(), "message content")
+	expectEqual(t, false, msg.Deleted, "deleted flag of new message")
+	if msg.EditedMessage != nil || !msg.EditedAt.IsZero() {
+		t.Errorf("Expected new message to not be edited, got %v at %v", msg.EditedMessage, msg.EditedAt)
+	}
+
+	// Putting the same message again overwrites it
+	noError(t, s.PutMessage(&store.StoredMessage{
+		Chat:      groupJID,
+		Sender:    ownJID,
+		ID:        "MSG1",
+		IsFromMe:  true,
+		Timestamp: baseTS,
+		Message:   textMessage("hello again"),
+	}), "overwrite message")
+	msg, err = s.GetMessage(groupJID, "MSG1")
+	noError(t, err, "get overwritten message")
+	expectEqual(t, ownJID, msg.Sender, "overwritten message sender")
+	expectEqual(t, true, msg.IsFromMe, "overwritten message from me flag")
+	expectEqual(t, "hello again", msg.Message.GetConversation(), "overwritten message content")
+
+	noError(t, s.MarkMessageEdited(groupJID, "MSG1", textMessage("edit 2"), baseTS.Add(2*time.Minute)), "mark message as edited")
+	// Edits arriving out of order must not replace newer edits
+	noError(t, s.MarkMessageEdited(groupJID, "MSG1", textMessage("edit 1"), baseTS.Add(1*time.Minute)), "mark message as edited")
+	msg, err = s.GetMessage(groupJID, "MSG1")
+	noError(t, err, "get edited message")
+	expectEqual(t, "hello again", msg.Message.GetConversation(), "original content of edited message")
+	expectEqual(t, "edit 2", msg.EditedMessage.GetConversation(), "edited content")
+	expectEqual(t, baseTS.Add(2*time.Minute).Unix(), msg.EditedAt.Unix(), "edit timestamp")
+
+	noError(t, s.MarkMessageDeleted(groupJID, "MSG1"), "mark message as deleted")
+	msg, err = s.GetMessage(groupJID, "MSG1")
+	noError(t, err, "get deleted message")
+	expectEqual(t, true, msg.Deleted, "deleted flag")
+	noError(t, s.MarkMessageDeleted(groupJID, "UNKNOWN"), "mark unknown message as deleted")
+	noError(t, s.MarkMessageEdited(groupJID, "UNKNOWN", textMessage("edit"), baseTS), "mark unknown message as edited")
+	msg, err = s.GetMessage(groupJID, "UNKNOWN")
+	noError(t, err, "get unknown message")
+	if msg != nil {
+		t.Errorf("Expected edits and deletions to not create unknown messages, got %+v", msg)
+	}
+
+	msgs := make([]*store.StoredMessage, 250)
+	for i := range msgs {
+		msgs[i] = &store.StoredMessage{
+			Chat:      aliceJID,
+			Sender:    aliceJID,
+			ID:        types.MessageID(fmt.Sprintf("BATCH%03d", i)),
+			Timestamp: baseTS.Add(time.Duration(i) * time.Second),
+			Message:   textMessage(fmt.Sprintf("message %d", i)),
+		}
+	}
+	noError(t, s.PutMessages(msgs), "put messages")
+	noError(t, s.PutMessages(nil), "put empty message list")
+
+	page, err := s.GetChatMessages(aliceJID, time.Time{}, "", 3)
+	noError(t, err, "get latest chat messages")
+	checkMessageIDs(t, page, "BATCH249", "BATCH248", "BATCH247")
+	expectEqual(t, "message 249", page[0].Message.GetConversation(), "content of latest message")
+	page, err = s.GetChatMessages(aliceJID, page[len(page)-1].Timestamp, page[len(page)-1].ID, 2)
+	noError(t, err, "get older chat messages")
+	checkMessageIDs(t, page, "BATCH246", "BATCH245")
+	page, err = s.GetChatMessages(aliceJID, baseTS.Add(2*time.Second), "", 10)
+	noError(t, err, "get oldest chat messages")
+	checkMessageIDs(t, page, "BATCH001", "BATCH000")
+	page, err = s.GetChatMessages(bobJID, time.Time{}, "", 10)
+	noError(t, err, "get messages of empty chat")
+	checkMessageIDs(t, page)
+
+	// Messages with the same timestamp must not be skipped at page boundaries
+	sameSecond := make([]*store.StoredMessage, 5)
+	for i := range sameSecond {
+		sameSecond[i] = &store.StoredMessage{
+			Chat:      bobJID,
+			Sender:    bobJID,
+			ID:        types.MessageID(fmt.Sprintf("SAME%d", i)),
+			Timestamp: baseTS,
+			Message:   textMessage("same second"),
+		}
+	}
+	noError(t, s.PutMessages(sameSecond), "put messages with the same timestamp")
+	page, err = s.GetChatMessages(bobJID, time.Time{}, "", 2)
+	noError(t, err, "get first page of messages with the same timestamp")
+	checkMessageIDs(t, page, "SAME4", "SAME3")
+	page, err = s.GetChatMessages(bobJID, page[1].Timestamp, page[1].ID, 2)
+	noError(t, err, "get second page of messages with the same timestamp")
+	checkMessageIDs(t, page, "SAME2", "SAME1")
+	page, err = s.GetChatMessages(bobJID, page[1].Timestamp, page[1].ID, 2)
+	noError(t, err, "get last page of messages with the same timestamp")
+	checkMessageIDs(t, page, "SAME0")
+}
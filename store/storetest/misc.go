@@ -0,0 +1,232 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func testContactStore(t *testing.T, s store.AllStores) {
+	contact, err := s.GetContact(aliceJID)
+	noError(t, err, "get unknown contact")
+	expectEqual(t, types.ContactInfo{}, contact, "unknown contact")
+
+	changed, prev, err := s.PutPushName(aliceJID, "Alice")
+	noError(t, err, "put push name")
+	expectEqual(t, true, changed, "changed flag of new push name")
+	expectEqual(t, "", prev, "previous push name")
+	changed, _, err = s.PutPushName(aliceJID, "Alice")
+	noError(t, err, "put same push name")
+	expectEqual(t, false, changed, "changed flag of same push name")
+	changed, prev, err = s.PutPushName(aliceJID, "Alice 2")
+	noError(t, err, "put new push name")
+	expectEqual(t, true, changed, "changed flag of new push name")
+	expectEqual(t, "Alice", prev, "previous push name")
+
+	changed, prev, err = s.PutBusinessName(aliceJID, "Alice Inc")
+	noError(t, err, "put business name")
+	expectEqual(t, true, changed, "changed flag of new business name")
+	expectEqual(t, "", prev, "previous business name")
+	changed, _, err = s.PutBusinessName(aliceJID, "Alice Inc")
+	noError(t, err, "put same business name")
+	expectEqual(t, false, changed, "changed flag of same business name")
+
+	noError(t, s.PutContactName(aliceJID, "Alice", "Alice Smith"), "put contact name")
+	contact, err = s.GetContact(aliceJID)
+	noError(t, err, "get contact")
+	expectEqual(t, types.ContactInfo{
+		Found:        true,
+		FirstName:    "Alice",
+		FullName:     "Alice Smith",
+		PushName:     "Alice 2",
+		BusinessName: "Alice Inc",
+	}, contact, "stored contact")
+
+	// Mass inserts must only replace the contact names and keep the other fields
+	contacts := make([]store.ContactEntry, 0, 701)
+	contacts = append(contacts, store.ContactEntry{JID: aliceJID, FirstName: "Ally", FullName: "Ally Smith"})
+	for i := 0; i < 700; i++ {
+		contacts = append(contacts, store.ContactEntry{
+			JID:       types.NewJID(fmt.Sprintf("4400%06d", i), types.DefaultUserServer),
+			FirstName: fmt.Sprintf("First %d", i),
+			FullName:  fmt.Sprintf("Full %d", i),
+		})
+	}
+	noError(t, s.PutAllContactNames(contacts), "put all contact names")
+	contact, err = s.GetContact(aliceJID)
+	noError(t, err, "get contact after mass insert")
+	expectEqual(t, types.ContactInfo{
+		Found:        true,
+		FirstName:    "Ally",
+		FullName:     "Ally Smith",
+		PushName:     "Alice 2",
+		BusinessName: "Alice Inc",
+	}, contact, "contact after mass insert")
+	noError(t, s.PutAllContactNames(nil), "put empty contact list")
+
+	allContacts, err := s.GetAllContacts()
+	noError(t, err, "get all contacts")
+	expectEqual(t, len(contacts), len(allContacts), "number of contacts")
+	for _, entry := range contacts[1:] {
+		info, ok := allContacts[entry.JID]
+		if !ok {
+			t.Fatalf("Contact %s missing from GetAllContacts", entry.JID)
+		}
+		expectEqual(t, types.ContactInfo{Found: true, FirstName: entry.FirstName, FullName: entry.FullName}, info, "contact from GetAllContacts")
+	}
+	expectEqual(t, contact, allContacts[aliceJID], "contact from GetAllContacts")
+}
+
+func testChatSettingsStore(t *testing.T, s store.AllStores) {
+	settings, err := s.GetChatSettings(groupJID)
+	noError(t, err, "get unknown chat settings")
+	expectEqual(t, false, settings.Found, "found flag of unknown chat settings")
+
+	mutedUntil := time.Now().Add(8 * time.Hour)
+	noError(t, s.PutMutedUntil(groupJID, mutedUntil), "put muted until")
+	noError(t, s.PutPinned(groupJID, true), "put pinned")
+	settings, err = s.GetChatSettings(groupJID)
+	noError(t, err, "get chat settings")
+	expectEqual(t, true, settings.Found, "found flag of chat settings")
+	expectEqual(t, mutedUntil.Unix(), settings.MutedUntil.Unix(), "muted until")
+	expectEqual(t, true, settings.Pinned, "pinned flag")
+	expectEqual(t, false, settings.Archived, "archived flag")
+
+	noError(t, s.PutArchived(groupJID, true), "put archived")
+	noError(t, s.PutPinned(groupJID, false), "put unpinned")
+	noError(t, s.PutMutedUntil(groupJID, time.Time{}), "put unmuted")
+	settings, err = s.GetChatSettings(groupJID)
+	noError(t, err, "get chat settings")
+	expectEqual(t, true, settings.MutedUntil.IsZero(), "zero muted until after unmuting")
+	expectEqual(t, false, settings.Pinned, "pinned flag after unpinning")
+	expectEqual(t, true, settings.Archived, "archived flag")
+
+	clearedAt := time.Now().Add(-time.Hour)
+	noError(t, s.PutMarkedAsUnread(groupJID, true), "put marked as unread")
+	noError(t, s.PutLastCleared(groupJID, clearedAt), "put last cleared")
+	noError(t, s.PutEphemeralExpiration(groupJID, 604800), "put ephemeral expiration")
+	noError(t, s.PutLocked(groupJID, true), "put locked")
+	settings, err = s.GetChatSettings(groupJID)
+	noError(t, err, "get chat settings")
+	expectEqual(t, true, settings.MarkedAsUnread, "marked as unread flag")
+	expectEqual(t, clearedAt.Unix(), settings.LastCleared.Unix(), "last cleared")
+	expectEqual(t, uint32(604800), settings.EphemeralExpiration, "ephemeral expiration")
+	expectEqual(t, true, settings.Locked, "locked flag")
+	expectEqual(t, true, settings.Archived, "archived flag after setting other fields")
+	expectEqual(t, 0, len(settings.Labels), "number of labels")
+
+	noError(t, s.PutChatLabel(groupJID, "5", true), "put chat label")
+	noError(t, s.PutChatLabel(groupJID, "2", true), "put chat label")
+	noError(t, s.PutChatLabel(groupJID, "5", true), "put duplicate chat label")
+	settings, err = s.GetChatSettings(groupJID)
+	noError(t, err, "get chat settings with labels")
+	expectEqual(t, "2,5", strings.Join(settings.Labels, ","), "labels")
+	noError(t, s.PutChatLabel(groupJID, "2", false), "remove chat label")
+	noError(t, s.PutChatLabel(groupJID, "7", false), "remove unknown chat label")
+	noError(t, s.PutLastCleared(groupJID, time.Time{}), "put zero last cleared")
+	settings, err = s.GetChatSettings(groupJID)
+	noError(t, err, "get chat settings after removing label")
+	expectEqual(t, "5", strings.Join(settings.Labels, ","), "labels after removing")
+	expectEqual(t, true, settings.LastCleared.IsZero(), "zero last cleared")
+
+	// Labels alone are enough for the settings to be found
+	noError(t, s.PutChatLabel(bobJID, "1", true), "put chat label for new chat")
+	settings, err = s.GetChatSettings(bobJID)
+	noError(t, err, "get chat settings of labeled chat")
+	expectEqual(t, true, settings.Found, "found flag of labeled chat")
+	expectEqual(t, "1", strings.Join(settings.Labels, ","), "labels of labeled chat")
+
+	settings, err = s.GetChatSettings(aliceJID)
+	noError(t, err, "get chat settings of other chat")
+	expectEqual(t, false, settings.Found, "found flag of other chat")
+}
+
+func testMsgSecretStore(t *testing.T, s store.AllStores) {
+	aliceDevice := types.NewADJID(aliceJID.User, 0, 5)
+
+	secret, err := s.GetMessageSecret(groupJID, aliceJID, "MSG1")
+	noError(t, err, "get unknown message secret")
+	if secret != nil {
+		t.Errorf("Expected nil for unknown message secret, got %X", secret)
+	}
+
+	// The device part of JIDs must be ignored
+	noError(t, s.PutMessageSecret(groupJID, aliceDevice, "MSG1", []byte("secret1")), "put message secret")
+	secret, err = s.GetMessageSecret(groupJID, aliceJID, "MSG1")
+	noError(t, err, "get message secret")
+	expectBytes(t, []byte("secret1"), secret, "message secret")
+
+	// Existing secrets are never overwritten
+	noError(t, s.PutMessageSecret(groupJID, aliceJID, "MSG1", []byte("secret2")), "put duplicate message secret")
+	secret, err = s.GetMessageSecret(groupJID, aliceJID, "MSG1")
+	noError(t, err, "get message secret")
+	expectBytes(t, []byte("secret1"), secret, "message secret after putting duplicate")
+
+	secret, err = s.GetMessageSecret(groupJID, bobJID, "MSG1")
+	noError(t, err, "get message secret of other sender")
+	if secret != nil {
+		t.Errorf("Expected nil for message secret of other sender, got %X", secret)
+	}
+
+	inserts := make([]store.MessageSecretInsert, 120)
+	for i := range inserts {
+		inserts[i] = store.MessageSecretInsert{
+			Chat:   aliceJID,
+			Sender: bobJID,
+			ID:     types.MessageID(fmt.Sprintf("BATCH%d", i)),
+			Secret: []byte(fmt.Sprintf("batch secret %d", i)),
+		}
+	}
+	inserts = append(inserts, store.MessageSecretInsert{Chat: groupJID, Sender: aliceJID, ID: "MSG1", Secret: []byte("secret3")})
+	noError(t, s.PutMessageSecrets(inserts), "put message secrets")
+	for _, i := range []int{0, 49, 50, 119} {
+		secret, err = s.GetMessageSecret(aliceJID, bobJID, inserts[i].ID)
+		noError(t, err, "get batch message secret #%d", i)
+		expectBytes(t, inserts[i].Secret, secret, "batch message secret")
+	}
+	secret, err = s.GetMessageSecret(groupJID, aliceJID, "MSG1")
+	noError(t, err, "get message secret")
+	expectBytes(t, []byte("secret1"), secret, "message secret after putting duplicate in batch")
+}
+
+func testPrivacyTokenStore(t *testing.T, s store.AllStores) {
+	token, err := s.GetPrivacyToken(aliceJID)
+	noError(t, err, "get unknown privacy token")
+	if token != nil {
+		t.Errorf("Expected nil for unknown privacy token, got %+v", token)
+	}
+
+	ts := time.Now()
+	noError(t, s.PutPrivacyTokens(
+		store.PrivacyToken{User: types.NewADJID(aliceJID.User, 0, 3), Token: []byte("alice1"), Timestamp: ts},
+		store.PrivacyToken{User: bobJID, Token: []byte("bob1"), Timestamp: ts},
+	), "put privacy tokens")
+	token, err = s.GetPrivacyToken(types.NewADJID(aliceJID.User, 0, 7))
+	noError(t, err, "get privacy token")
+	if token == nil {
+		t.Fatal("Stored privacy token not found")
+	}
+	expectEqual(t, aliceJID, token.User, "privacy token user")
+	expectBytes(t, []byte("alice1"), token.Token, "privacy token")
+	expectEqual(t, ts.Unix(), token.Timestamp.Unix(), "privacy token timestamp")
+
+	newTS := ts.Add(time.Hour)
+	noError(t, s.PutPrivacyTokens(store.PrivacyToken{User: aliceJID, Token: []byte("alice2"), Timestamp: newTS}), "overwrite privacy token")
+	token, err = s.GetPrivacyToken(aliceJID)
+	noError(t, err, "get overwritten privacy token")
+	expectBytes(t, []byte("alice2"), token.Token, "overwritten privacy token")
+	expectEqual(t, newTS.Unix(), token.Timestamp.Unix(), "overwritten privacy token timestamp")
+	token, err = s.GetPrivacyToken(bobJID)
+	noError(t, err, "get other privacy token")
+	expectBytes(t, []byte("bob1"), token.Token, "other user's privacy token")
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+func checkOutboxIDs(t *testing.T, msgs []*store.OutboxMessage, expected ...types.MessageID) {
+	t.Helper()
+	if len(msgs) != len(expected) {
+		t.Fatalf("Expected %d outbox messages, got %d", len(expected), len(msgs))
+	}
+	for i, msg := range msgs {
+		expectEqual(t, expected[i], msg.ID, fmt.Sprintf("ID of outbox message #%d", i))
+	}
+}
+
+func testOutboxStore(t *testing.T, s store.AllStores) {
+	msgs, err := s.GetOutboxMessages()
+	noError(t, err, "get empty outbox")
+	checkOutboxIDs(t, msgs)
+
+	// Nanosecond precision must be kept, as messages queued in quick succession must stay in order
+	baseTS := time.Unix(1700000000, 123456789)
+	noError(t, s.PutOutboxMessage(&store.OutboxMessage{
+		Chat: groupJID, ID: "OUT2", Message: textMessage("second"), QueuedAt: baseTS.Add(1),
+	}), "put outbox message")
+	noError(t, s.PutOutboxMessage(&store.OutboxMessage{
+		Chat: types.NewADJID(aliceJID.User, 0, 1), ID: "OUT1", Message: textMessage("first"), QueuedAt: baseTS,
+	}), "put outbox message with AD JID")
+	noError(t, s.PutOutboxMessage(&store.OutboxMessage{
+		Chat: aliceJID, ID: "OUT3", Message: textMessage("third"), QueuedAt: baseTS.Add(2),
+	}), "put outbox message")
+
+	msgs, err = s.GetOutboxMessages()
+	noError(t, err, "get outbox")
+	checkOutboxIDs(t, msgs, "OUT1", "OUT2", "OUT3")
+	expectEqual(t, aliceJID, msgs[0].Chat, "outbox message chat")
+	expectEqual(t, "first", msgs[0].Message.GetConversation(), "outbox message content")
+	expectEqual(t, baseTS.UnixNano(), msgs[0].QueuedAt.UnixNano(), "outbox message queue time")
+	expectEqual(t, 0, msgs[0].Attempts, "outbox message attempts")
+	expectEqual(t, true, msgs[0].NextAttempt.IsZero(), "outbox message next attempt is zero")
+
+	nextAttempt := baseTS.Add(time.Minute)
+	msgs[1].Attempts = 2
+	msgs[1].NextAttempt = nextAttempt
+	msgs[1].LastError = "websocket not connected"
+	noError(t, s.PutOutboxMessage(msgs[1]), "update outbox message")
+	msgs, err = s.GetOutboxMessages()
+	noError(t, err, "get updated outbox")
+	checkOutboxIDs(t, msgs, "OUT1", "OUT2", "OUT3")
+	expectEqual(t, 2, msgs[1].Attempts, "updated outbox message attempts")
+	expectEqual(t, nextAttempt.UnixNano(), msgs[1].NextAttempt.UnixNano(), "updated outbox message next attempt")
+	expectEqual(t, "websocket not connected", msgs[1].LastError, "updated outbox message error")
+
+	noError(t, s.DeleteOutboxMessage(aliceJID, "OUT1"), "delete outbox message")
+	noError(t, s.DeleteOutboxMessage(aliceJID, "UNKNOWN"), "delete unknown outbox message")
+	msgs, err = s.GetOutboxMessages()
+	noError(t, err, "get outbox after deletion")
+	checkOutboxIDs(t, msgs, "OUT2", "OUT3")
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package storetest
+
+import (
+	"testing"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/util/keys"
+)
+
+func testIdentityStore(t *testing.T, s store.AllStores) {
+	keyA, keyB := filledArray32(0xA), filledArray32(0xB)
+	address := aliceJID.User + ":1"
+
+	trusted, err := s.IsTrustedIdentity(address, keyA)
+	noError(t, err, "check unknown identity")
+	expectEqual(t, true, trusted, "trust of unknown identity")
+
+	noError(t, s.PutIdentity(address, keyA), "put identity")
+	trusted, err = s.IsTrustedIdentity(address, keyA)
+	noError(t, err, "check stored identity")
+	expectEqual(t, true, trusted, "trust of stored identity")
+	trusted, err = s.IsTrustedIdentity(address, keyB)
+	noError(t, err, "check mismatching identity")
+	expectEqual(t, false, trusted, "trust of mismatching identity")
+
+	noError(t, s.PutIdentity(address, keyB), "overwrite identity")
+	trusted, err = s.IsTrustedIdentity(address, keyA)
+	noError(t, err, "check overwritten identity")
+	expectEqual(t, false, trusted, "trust of overwritten identity")
+
+	noError(t, s.DeleteIdentity(address), "delete identity")
+	trusted, err = s.IsTrustedIdentity(address, keyA)
+	noError(t, err, "check deleted identity")
+	expectEqual(t, true, trusted, "trust of deleted identity")
+
+	noError(t, s.PutIdentity(aliceJID.User+":1", keyA), "put identity")
+	noError(t, s.PutIdentity(aliceJID.User+":2", keyA), "put identity")
+	noError(t, s.PutIdentity(bobJID.User+":1", keyA), "put identity")
+	noError(t, s.DeleteAllIdentities(aliceJID.User), "delete all identities")
+	for _, addr := range []string{aliceJID.User + ":1", aliceJID.User + ":2"} {
+		trusted, err = s.IsTrustedIdentity(addr, keyB)
+		noError(t, err, "check identity of %s", addr)
+		expectEqual(t, true, trusted, "trust of deleted identity "+addr)
+	}
+	trusted, err = s.IsTrustedIdentity(bobJID.User+":1", keyB)
+	noError(t, err, "check identity of other user")
+	expectEqual(t, false, trusted, "trust of other user's identity after deleting all of one user's identities")
+}
+
+func testSessionStore(t *testing.T, s store.AllStores) {
+	address := aliceJID.User + ":1"
+
+	session, err := s.GetSession(address)
+	noError(t, err, "get unknown session")
+	if session != nil {
+		t.Errorf("Expected nil for unknown session, got %X", session)
+	}
+	has, err := s.HasSession(address)
+	noError(t, err, "check unknown session")
+	expectEqual(t, false, has, "existence of unknown session")
+
+	noError(t, s.PutSession(address, []byte("first")), "put session")
+	has, err = s.HasSession(address)
+	noError(t, err, "check stored session")
+	expectEqual(t, true, has, "existence of stored session")
+	session, err = s.GetSession(address)
+	noError(t, err, "get stored session")
+	expectBytes(t, []byte("first"), session, "stored session")
+
+	noError(t, s.PutSession(address, []byte("second")), "overwrite session")
+	session, err = s.GetSession(address)
+	noError(t, err, "get overwritten session")
+	expectBytes(t, []byte("second"), session, "overwritten session")
+
+	noError(t, s.DeleteSession(address), "delete session")
+	has, err = s.HasSession(address)
+	noError(t, err, "check deleted session")
+	expectEqual(t, false, has, "existence of deleted session")
+
+	noError(t, s.PutSession(aliceJID.User+":1", []byte("a1")), "put session")
+	noError(t, s.PutSession(aliceJID.User+":2", []byte("a2")), "put session")
+	noError(t, s.PutSession(bobJID.User+":1", []byte("b1")), "put session")
+	noError(t, s.DeleteAllSessions(aliceJID.User), "delete all sessions")
+	for _, addr := range []string{aliceJID.User + ":1", aliceJID.User + ":2"} {
+		has, err = s.HasSession(addr)
+		noError(t, err, "check session of %s", addr)
+		expectEqual(t, false, has, "existence of deleted session "+addr)
+	}
+	session, err = s.GetSession(bobJID.User + ":1")
+	noError(t, err, "get session of other user")
+	expectBytes(t, []byte("b1"), session, "other user's session after deleting all of one user's sessions")
+}
+
+func checkPreKeyIDs(t *testing.T, preKeys []*keys.PreKey, expected []uint32) {
+	t.Helper()
+	if len(preKeys) != len(expected) {
+		t.Fatalf("Expected %d prekeys, got %d", len(expected), len(preKeys))
+	}
+	for i, key := range preKeys {
+		if key == nil {
+			t.Fatalf("Prekey #%d is nil", i)
+		}
+		expectEqual(t, expected[i], key.KeyID, "prekey ID")
+	}
+}
+
+func testPreKeyStore(t *testing.T, s store.AllStores) {
+	count, err := s.UploadedPreKeyCount()
+	noError(t, err, "count uploaded prekeys")
+	expectEqual(t, 0, count, "initial uploaded prekey count")
+
+	firstBatch, err := s.GetOrGenPreKeys(5)
+	noError(t, err, "generate prekeys")
+	checkPreKeyIDs(t, firstBatch, []uint32{1, 2, 3, 4, 5})
+	count, err = s.UploadedPreKeyCount()
+	noError(t, err, "count uploaded prekeys")
+	expectEqual(t, 0, count, "uploaded prekey count after generating")
+
+	// Keys that haven't been marked as uploaded must be returned again instead of generating new ones
+	sameBatch, err := s.GetOrGenPreKeys(5)
+	noError(t, err, "get existing prekeys")
+	checkPreKeyIDs(t, sameBatch, []uint32{1, 2, 3, 4, 5})
+	for i := range sameBatch {
+		expectEqual(t, *firstBatch[i].Pub, *sameBatch[i].Pub, "public key of returned existing prekey")
+	}
+	biggerBatch, err := s.GetOrGenPreKeys(8)
+	noError(t, err, "get and generate prekeys")
+	checkPreKeyIDs(t, biggerBatch, []uint32{1, 2, 3, 4, 5, 6, 7, 8})
+
+	noError(t, s.MarkPreKeysAsUploaded(5), "mark prekeys as uploaded")
+	count, err = s.UploadedPreKeyCount()
+	noError(t, err, "count uploaded prekeys")
+	expectEqual(t, 5, count, "uploaded prekey count after marking")
+	remaining, err := s.GetOrGenPreKeys(4)
+	noError(t, err, "get remaining prekeys")
+	checkPreKeyIDs(t, remaining, []uint32{6, 7, 8, 9})
+
+	key, err := s.GetPreKey(3)
+	noError(t, err, "get prekey")
+	if key == nil {
+		t.Fatal("Uploaded prekey 3 not found")
+	}
+	expectEqual(t, uint32(3), key.KeyID, "prekey ID")
+	expectEqual(t, *firstBatch[2].Pub, *key.Pub, "public key of stored prekey")
+	expectEqual(t, *firstBatch[2].Priv, *key.Priv, "private key of stored prekey")
+
+	noError(t, s.RemovePreKey(3), "remove prekey")
+	key, err = s.GetPreKey(3)
+	noError(t, err, "get removed prekey")
+	if key != nil {
+		t.Errorf("Expected nil for removed prekey, got %d", key.KeyID)
+	}
+	key, err = s.GetPreKey(12345)
+	noError(t, err, "get unknown prekey")
+	if key != nil {
+		t.Errorf("Expected nil for unknown prekey, got %d", key.KeyID)
+	}
+	count, err = s.UploadedPreKeyCount()
+	noError(t, err, "count uploaded prekeys")
+	expectEqual(t, 4, count, "uploaded prekey count after removing")
+
+	single, err := s.GenOnePreKey()
+	noError(t, err, "generate single prekey")
+	expectEqual(t, uint32(10), single.KeyID, "single prekey ID")
+	count, err = s.UploadedPreKeyCount()
+	noError(t, err, "count uploaded prekeys")
+	expectEqual(t, 5, count, "uploaded prekey count after generating single prekey")
+}
+
+func testSenderKeyStore(t *testing.T, s store.AllStores) {
+	group := groupJID.String()
+	alice, bob := aliceJID.User+":1", bobJID.User+":1"
+
+	key, err := s.GetSenderKey(group, alice)
+	noError(t, err, "get unknown sender key")
+	if key != nil {
+		t.Errorf("Expected nil for unknown sender key, got %X", key)
+	}
+	noError(t, s.PutSenderKey(group, alice, []byte("alice")), "put sender key")
+	noError(t, s.PutSenderKey(group, bob, []byte("bob")), "put sender key")
+	key, err = s.GetSenderKey(group, alice)
+	noError(t, err, "get sender key")
+	expectBytes(t, []byte("alice"), key, "stored sender key")
+
+	noError(t, s.PutSenderKey(group, alice, []byte("alice2")), "overwrite sender key")
+	key, err = s.GetSenderKey(group, alice)
+	noError(t, err, "get overwritten sender key")
+	expectBytes(t, []byte("alice2"), key, "overwritten sender key")
+	key, err = s.GetSenderKey(group, bob)
+	noError(t, err, "get other sender key")
+	expectBytes(t, []byte("bob"), key, "other user's sender key")
+}
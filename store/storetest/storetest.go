@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package storetest contains a conformance test suite for implementations of the interfaces in the store package.
+//
+// Custom store implementations can be checked by calling Run from a normal Go test:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.AllStores {
+//			return mystore.New(...)
+//		})
+//	}
+package storetest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/shiestapoi/whatsmeow/store"
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+// StoreFactory creates a new empty store for a single test.
+//
+// Every call must return a store that doesn't share any data with previously returned stores.
+// Cleanup should be registered with t.Cleanup.
+type StoreFactory func(t *testing.T) store.AllStores
+
+// Run runs the whole conformance suite against stores created by the given factory.
+// Each store interface is tested in its own subtest, which gets its own store instance.
+func Run(t *testing.T, factory StoreFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.AllStores)
+	}{
+		{"IdentityStore", testIdentityStore},
+		{"SessionStore", testSessionStore},
+		{"PreKeyStore", testPreKeyStore},
+		{"SenderKeyStore", testSenderKeyStore},
+		{"AppStateSyncKeyStore", testAppStateSyncKeyStore},
+		{"AppStateStore", testAppStateStore},
+		{"AppStateValueStore", testAppStateValueStore},
+		{"ContactStore", testContactStore},
+		{"ChatSettingsStore", testChatSettingsStore},
+		{"MsgSecretStore", testMsgSecretStore},
+		{"PrivacyTokenStore", testPrivacyTokenStore},
+		{"MessageStore", testMessageStore},
+		{"LIDStore", testLIDStore},
+		{"DeviceListStore", testDeviceListStore},
+		{"GroupParticipantStore", testGroupParticipantStore},
+		{"OutboxStore", testOutboxStore},
+		{"Concurrency", testConcurrency},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, factory(t))
+		})
+	}
+}
+
+var (
+	ownJID   = types.NewJID("1234567890", types.DefaultUserServer)
+	aliceJID = types.NewJID("1111111111", types.DefaultUserServer)
+	bobJID   = types.NewJID("2222222222", types.DefaultUserServer)
+	groupJID = types.NewJID("120363000000000000", types.GroupServer)
+)
+
+func noError(t *testing.T, err error, action string, args ...any) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Failed to %s: %v", fmt.Sprintf(action, args...), err)
+	}
+}
+
+func expectBytes(t *testing.T, expected, actual []byte, what string) {
+	t.Helper()
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("Unexpected %s: expected %X, got %X", what, expected, actual)
+	}
+}
+
+func expectEqual[T comparable](t *testing.T, expected, actual T, what string) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("Unexpected %s: expected %v, got %v", what, expected, actual)
+	}
+}
+
+// filledBytes returns a byte slice of the given length where every byte is the given value.
+func filledBytes(length int, value byte) []byte {
+	return bytes.Repeat([]byte{value}, length)
+}
+
+func filledArray32(value byte) [32]byte {
+	return [32]byte(filledBytes(32, value))
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+)
+
+// OverflowPolicy specifies what happens when an event is dispatched to a subscription whose queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the event dispatcher wait until there's room in the queue. This slows down handling
+	// incoming data for the whole client, but ensures that no events are lost.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards events that don't fit in the queue. The number of dropped events can be read
+	// with Subscription.Dropped.
+	OverflowDrop
+)
+
+const (
+	defaultSubscriptionQueueSize = 256
+	defaultSlowHandlerThreshold  = 5 * time.Second
+)
+
+// SubscribeOptions contains optional parameters for Subscribe.
+//
+// The Chat, Sender, FromMe and MessageTypes predicates only match events that have a message source,
+// i.e. Message, UndecryptableMessage, FBMessage, Receipt and ChatPresence. Other events never match if any of them
+// is set.
+type SubscribeOptions[T any] struct {
+	// Chat only matches events in the given chat.
+	Chat types.JID
+	// Sender only matches events from the given user. The device part is ignored, and the alternate
+	// sender address (SenderAlt) is also checked, so either a phone number or LID can be used.
+	Sender types.JID
+	// FromMe, if set, only matches events that were (true) or weren't (false) sent by the current user.
+	FromMe *bool
+	// MessageTypes only matches messages whose type (e.g. text, media or reaction) or media type
+	// (e.g. image or video) is in the list.
+	MessageTypes []string
+	// Filter is an arbitrary predicate that is checked after the other ones.
+	Filter func(T) bool
+
+	// QueueSize is the number of events that can be waiting to be handled. Defaults to 256.
+	QueueSize int
+	// Workers is the number of goroutines that call the handler. Defaults to 1, which means events are handled
+	// one at a time in the order they were dispatched. With more workers, events may be handled in any order.
+	Workers int
+	// Overflow specifies what to do when the queue is full. Defaults to OverflowBlock.
+	Overflow OverflowPolicy
+	// SlowHandlerThreshold is how long the handler can take before a warning is logged. Defaults to 5 seconds.
+	// Set to a negative value to disable the warnings.
+	SlowHandlerThreshold time.Duration
+}
+
+// Subscription is an event handler registered with Subscribe.
+type Subscription struct {
+	cli           *Client
+	match         func(evt any) bool
+	handle        func(evt any)
+	queue         chan any
+	overflow      OverflowPolicy
+	slowThreshold time.Duration
+	dropped       atomic.Uint64
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+// Subscribe registers a handler that is called with all events of type T (e.g. *events.Message)
+// that match the given options.
+//
+// Unlike handlers registered with AddEventHandler, each subscription has its own queue and worker goroutines,
+// so slow subscriptions don't delay other handlers (unless the queue fills up with OverflowBlock). If the handler
+// panics, the panic is logged and an events.HandlerPanic event is dispatched, and the subscription keeps running.
+//
+//	sub := whatsmeow.Subscribe(cli, func(evt *events.Message) {
+//		fmt.Println("Received a message in", evt.Info.Chat)
+//	}, whatsmeow.SubscribeOptions[*events.Message]{Chat: groupJID, Workers: 4})
+//	defer sub.Close()
+func Subscribe[T any](cli *Client, handler func(T), opts ...SubscribeOptions[T]) *Subscription {
+	var opt SubscribeOptions[T]
+	if len(opts) > 1 {
+		panic("only one options parameter may be provided to Subscribe")
+	} else if len(opts) == 1 {
+		opt = opts[0]
+	}
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = defaultSubscriptionQueueSize
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = 1
+	}
+	if opt.SlowHandlerThreshold == 0 {
+		opt.SlowHandlerThreshold = defaultSlowHandlerThreshold
+	}
+	sub := &Subscription{
+		cli: cli,
+		match: func(evt any) bool {
+			typedEvt, ok := evt.(T)
+			return ok && opt.matches(evt) && (opt.Filter == nil || opt.Filter(typedEvt))
+		},
+		handle: func(evt any) {
+			handler(evt.(T))
+		},
+		queue:         make(chan any, opt.QueueSize),
+		overflow:      opt.Overflow,
+		slowThreshold: opt.SlowHandlerThreshold,
+		stop:          make(chan struct{}),
+	}
+	for i := 0; i < opt.Workers; i++ {
+		go sub.worker()
+	}
+	cli.subscriptionsLock.Lock()
+	cli.subscriptions = append(slices.Clone(cli.subscriptions), sub)
+	cli.subscriptionsLock.Unlock()
+	return sub
+}
+
+func getEventSource(evt any) *types.MessageSource {
+	switch typedEvt := evt.(type) {
+	case *events.Message:
+		return &typedEvt.Info.MessageSource
+	case *events.UndecryptableMessage:
+		return &typedEvt.Info.MessageSource
+	case *events.FBMessage:
+		return &typedEvt.Info.MessageSource
+	case *events.Receipt:
+		return &typedEvt.MessageSource
+	case *events.ChatPresence:
+		return &typedEvt.MessageSource
+	default:
+		return nil
+	}
+}
+
+func getEventMessageInfo(evt any) *types.MessageInfo {
+	switch typedEvt := evt.(type) {
+	case *events.Message:
+		return &typedEvt.Info
+	case *events.UndecryptableMessage:
+		return &typedEvt.Info
+	case *events.FBMessage:
+		return &typedEvt.Info
+	default:
+		return nil
+	}
+}
+
+func (opt *SubscribeOptions[T]) matches(evt any) bool {
+	if opt.Chat.IsEmpty() && opt.Sender.IsEmpty() && opt.FromMe == nil && len(opt.MessageTypes) == 0 {
+		return true
+	}
+	source := getEventSource(evt)
+	if source == nil {
+		return false
+	}
+	if !opt.Chat.IsEmpty() && source.Chat.ToNonAD() != opt.Chat.ToNonAD() {
+		return false
+	}
+	if !opt.Sender.IsEmpty() {
+		sender := opt.Sender.ToNonAD()
+		if source.Sender.ToNonAD() != sender && (source.SenderAlt.IsEmpty() || source.SenderAlt.ToNonAD() != sender) {
+			return false
+		}
+	}
+	if opt.FromMe != nil && source.IsFromMe != *opt.FromMe {
+		return false
+	}
+	if len(opt.MessageTypes) > 0 {
+		info := getEventMessageInfo(evt)
+		if info == nil || (!slices.Contains(opt.MessageTypes, info.Type) &&
+			(info.MediaType == "" || !slices.Contains(opt.MessageTypes, info.MediaType))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Close unregisters the subscription. Events that are still in the queue are discarded,
+// but events that are already being handled are not interrupted.
+func (sub *Subscription) Close() {
+	sub.stopOnce.Do(func() {
+		close(sub.stop)
+		sub.cli.subscriptionsLock.Lock()
+		sub.cli.subscriptions = slices.DeleteFunc(slices.Clone(sub.cli.subscriptions), func(other *Subscription) bool {
+			return other == sub
+		})
+		sub.cli.subscriptionsLock.Unlock()
+	})
+}
+
+// Dropped returns the number of events that were discarded because the queue was full.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Pending returns the number of events waiting in the queue.
+func (sub *Subscription) Pending() int {
+	return len(sub.queue)
+}
+
+func (sub *Subscription) deliver(evt any) {
+	if !sub.match(evt) {
+		return
+	}
+	if sub.overflow == OverflowDrop {
+		select {
+		case sub.queue <- evt:
+		case <-sub.stop:
+		default:
+			if sub.dropped.Add(1) == 1 {
+				sub.cli.Log.Warnf("Subscription queue is full, dropping %T event", evt)
+			}
+		}
+		return
+	}
+	select {
+	case sub.queue <- evt:
+	case <-sub.stop:
+	}
+}
+
+func (sub *Subscription) worker() {
+	for {
+		select {
+		case evt := <-sub.queue:
+			sub.handleEvent(evt)
+		case <-sub.stop:
+			return
+		}
+	}
+}
+
+func (sub *Subscription) handleEvent(evt any) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			stack := debug.Stack()
+			sub.cli.Log.Errorf("Event subscription panicked while handling a %T: %v\n%s", evt, err, stack)
+			// Panics while handling panic events aren't reported again to avoid loops
+			if _, isPanicEvt := evt.(*events.HandlerPanic); !isPanicEvt {
+				go sub.cli.dispatchEvent(&events.HandlerPanic{Event: evt, Panic: err, Stack: string(stack)})
+			}
+		}
+		if duration := time.Since(start); sub.slowThreshold > 0 && duration > sub.slowThreshold {
+			sub.cli.Log.Warnf("Event subscription took %s to handle a %T", duration, evt)
+		}
+	}()
+	sub.handle(evt)
+}
+
+func (cli *Client) dispatchToSubscriptions(evt any) {
+	cli.subscriptionsLock.RLock()
+	subs := cli.subscriptions
+	cli.subscriptionsLock.RUnlock()
+	for _, sub := range subs {
+		sub.deliver(evt)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/types/events"
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+func TestSubscribeOptionsMatches(t *testing.T) {
+	chat := types.NewJID("123456789", types.GroupServer)
+	sender := types.NewJID("1111111111", types.DefaultUserServer)
+	senderLID := types.NewJID("100", types.HiddenUserServer)
+	source := types.MessageSource{
+		Chat:      chat,
+		Sender:    types.NewADJID(sender.User, 0, 5),
+		SenderAlt: types.JID{User: senderLID.User, Device: 5, Server: types.HiddenUserServer},
+		IsGroup:   true,
+	}
+	textMsg := &events.Message{Info: types.MessageInfo{MessageSource: source, Type: "text"}}
+	imageMsg := &events.Message{Info: types.MessageInfo{MessageSource: source, Type: "media", MediaType: "image"}}
+	receipt := &events.Receipt{MessageSource: source}
+	tests := []struct {
+		name     string
+		opts     SubscribeOptions[any]
+		evt      any
+		expected bool
+	}{
+		{"NoPredicates", SubscribeOptions[any]{}, &events.Connected{}, true},
+		{"NoSource", SubscribeOptions[any]{Chat: chat}, &events.Connected{}, false},
+		{"Chat", SubscribeOptions[any]{Chat: chat}, textMsg, true},
+		{"OtherChat", SubscribeOptions[any]{Chat: sender}, textMsg, false},
+		{"SenderIgnoresDevice", SubscribeOptions[any]{Sender: types.NewADJID(sender.User, 0, 1)}, receipt, true},
+		{"SenderAlt", SubscribeOptions[any]{Sender: senderLID}, textMsg, true},
+		{"OtherSender", SubscribeOptions[any]{Sender: types.NewJID("2222222222", types.DefaultUserServer)}, textMsg, false},
+		{"FromMe", SubscribeOptions[any]{FromMe: proto.Bool(true)}, textMsg, false},
+		{"NotFromMe", SubscribeOptions[any]{FromMe: proto.Bool(false)}, textMsg, true},
+		{"MessageType", SubscribeOptions[any]{MessageTypes: []string{"text"}}, textMsg, true},
+		{"MediaType", SubscribeOptions[any]{MessageTypes: []string{"image"}}, imageMsg, true},
+		{"OtherMessageType", SubscribeOptions[any]{MessageTypes: []string{"reaction"}}, imageMsg, false},
+		{"MessageTypeWithoutInfo", SubscribeOptions[any]{MessageTypes: []string{"text"}}, receipt, false},
+		{"AllPredicates", SubscribeOptions[any]{
+			Chat:         chat,
+			Sender:       sender,
+			FromMe:       proto.Bool(false),
+			MessageTypes: []string{"media"},
+		}, imageMsg, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := test.opts.matches(test.evt); matches != test.expected {
+				t.Errorf("matches(%T) = %t, expected %t", test.evt, matches, test.expected)
+			}
+		})
+	}
+}
+
+func newTestSubscription(overflow OverflowPolicy, queueSize int) *Subscription {
+	return &Subscription{
+		cli:      &Client{Log: waLog.Noop},
+		match:    func(evt any) bool { return true },
+		handle:   func(evt any) {},
+		queue:    make(chan any, queueSize),
+		overflow: overflow,
+		stop:     make(chan struct{}),
+	}
+}
+
+func TestSubscriptionOverflow(t *testing.T) {
+	sub := newTestSubscription(OverflowDrop, 2)
+	for i := 0; i < 5; i++ {
+		sub.deliver(i)
+	}
+	if sub.Pending() != 2 || sub.Dropped() != 3 {
+		t.Errorf("Expected 2 pending and 3 dropped events, got %d and %d", sub.Pending(), sub.Dropped())
+	}
+	for _, expected := range []int{0, 1} {
+		if evt := <-sub.queue; evt != expected {
+			t.Errorf("Expected event %d to be kept, got %v", expected, evt)
+		}
+	}
+
+	sub = newTestSubscription(OverflowBlock, 1)
+	sub.deliver(0)
+	delivered := make(chan struct{})
+	go func() {
+		sub.deliver(1)
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+		t.Fatalf("Delivering to a full queue didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-sub.queue
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Delivery wasn't unblocked by the queue being read")
+	}
+
+	// Closing the subscription unblocks dispatchers waiting for room in the queue
+	closed := make(chan struct{})
+	go func() {
+		sub.deliver(2)
+		close(closed)
+	}()
+	sub.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Delivery wasn't unblocked by closing the subscription")
+	}
+	if sub.Dropped() != 0 {
+		t.Errorf("Expected blocking subscription to not drop events, got %d", sub.Dropped())
+	}
+}
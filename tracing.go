@@ -0,0 +1,178 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package whatsmeow
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Tracer creates spans for tracing how long sending and handling messages takes.
+//
+// Start and end times are passed explicitly, because some spans are created after the fact from the stages measured
+// in MessageDebugTimings. Implementations that bridge to other tracing libraries should use the provided timestamps.
+type Tracer interface {
+	// StartSpan starts a span. The returned context carries the span, so spans started from it are its children.
+	StartSpan(ctx context.Context, name string, start time.Time) (context.Context, Span)
+}
+
+// Span is a single traced operation created by a Tracer.
+type Span interface {
+	// SetAttribute attaches a key-value pair to the span.
+	SetAttribute(key string, value any)
+	// End finishes the span. err is the error that the operation failed with, if any.
+	End(end time.Time, err error)
+}
+
+type tracerContextKey struct{}
+
+// ContextWithTracer returns a context that carries the given tracer. Client methods that take a context
+// will use the tracer in the context instead of Client.Tracer.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerContextKey{}, tracer)
+}
+
+type noopTracer struct{}
+type noopSpan struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, _ string, _ time.Time) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) End(time.Time, error)     {}
+
+func (cli *Client) getTracer(ctx context.Context) Tracer {
+	if tracer, ok := ctx.Value(tracerContextKey{}).(Tracer); ok && tracer != nil {
+		return tracer
+	} else if cli.Tracer != nil {
+		return cli.Tracer
+	}
+	return noopTracer{}
+}
+
+func (cli *Client) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	return cli.getTracer(ctx).StartSpan(ctx, name, time.Now())
+}
+
+// messageTrace creates child spans of a SendMessage span for the stages in MessageDebugTimings.
+type messageTrace struct {
+	ctx    context.Context
+	tracer Tracer
+}
+
+// stage records a child span for a stage that started at the given time and ended now, and returns its duration.
+func (mdt *MessageDebugTimings) stage(name string, start time.Time) time.Duration {
+	end := time.Now()
+	if mdt.trace != nil {
+		_, span := mdt.trace.tracer.StartSpan(mdt.trace.ctx, name, start)
+		span.End(end, nil)
+	}
+	return end.Sub(start)
+}
+
+// RecordedSpan is a finished span stored by a TraceRecorder.
+type RecordedSpan struct {
+	ID         int
+	ParentID   int // 0 for root spans
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]any
+	Err        error
+}
+
+// Duration returns how long the span took.
+func (rs *RecordedSpan) Duration() time.Duration {
+	return rs.End.Sub(rs.Start)
+}
+
+// TraceRecorder is a Tracer that stores finished spans in memory. It's meant for tests and debugging.
+type TraceRecorder struct {
+	spans  []RecordedSpan
+	nextID int
+	lock   sync.Mutex
+}
+
+var _ Tracer = (*TraceRecorder)(nil)
+
+type recorderSpanKey struct{}
+
+type recorderSpan struct {
+	rec  *TraceRecorder
+	data RecordedSpan
+	lock sync.Mutex
+}
+
+// StartSpan implements Tracer.
+func (tr *TraceRecorder) StartSpan(ctx context.Context, name string, start time.Time) (context.Context, Span) {
+	tr.lock.Lock()
+	tr.nextID++
+	id := tr.nextID
+	tr.lock.Unlock()
+	span := &recorderSpan{
+		rec: tr,
+		data: RecordedSpan{
+			ID:         id,
+			Name:       name,
+			Start:      start,
+			Attributes: make(map[string]any),
+		},
+	}
+	if parent, ok := ctx.Value(recorderSpanKey{}).(*recorderSpan); ok && parent.rec == tr {
+		span.data.ParentID = parent.data.ID
+	}
+	return context.WithValue(ctx, recorderSpanKey{}, span), span
+}
+
+func (rs *recorderSpan) SetAttribute(key string, value any) {
+	rs.lock.Lock()
+	rs.data.Attributes[key] = value
+	rs.lock.Unlock()
+}
+
+func (rs *recorderSpan) End(end time.Time, err error) {
+	rs.lock.Lock()
+	rs.data.End = end
+	rs.data.Err = err
+	data := rs.data
+	rs.lock.Unlock()
+	rs.rec.lock.Lock()
+	rs.rec.spans = append(rs.rec.spans, data)
+	rs.rec.lock.Unlock()
+}
+
+// Spans returns all spans that have ended so far, ordered by when they started.
+func (tr *TraceRecorder) Spans() []RecordedSpan {
+	tr.lock.Lock()
+	spans := slices.Clone(tr.spans)
+	tr.lock.Unlock()
+	slices.SortStableFunc(spans, func(a, b RecordedSpan) int {
+		return a.Start.Compare(b.Start)
+	})
+	return spans
+}
+
+// Children returns the ended spans whose parent is the given span.
+func (tr *TraceRecorder) Children(parent RecordedSpan) []RecordedSpan {
+	var children []RecordedSpan
+	for _, span := range tr.Spans() {
+		if span.ParentID == parent.ID {
+			children = append(children, span)
+		}
+	}
+	return children
+}
+
+// Reset removes all stored spans.
+func (tr *TraceRecorder) Reset() {
+	tr.lock.Lock()
+	tr.spans = nil
+	tr.lock.Unlock()
+}
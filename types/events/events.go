@@ -77,6 +77,13 @@ type KeepAliveTimeout struct {
 // Note that if the websocket disconnects before the pings start working, this event will not be emitted.
 type KeepAliveRestored struct{}
 
+// SignedPreKeyRotated is emitted after the signed prekey has been replaced with a new one and the new key was
+// uploaded to the server. The previous key is kept for decrypting old messages until the grace period ends.
+type SignedPreKeyRotated struct {
+	KeyID         uint32
+	PreviousKeyID uint32
+}
+
 // PermanentDisconnect is a class of events emitted when the client will not auto-reconnect by default.
 type PermanentDisconnect interface {
 	PermanentDisconnectDescription() string
@@ -93,6 +100,9 @@ func (tb *TemporaryBan) PermanentDisconnectDescription() string {
 func (cf *ConnectFailure) PermanentDisconnectDescription() string {
 	return fmt.Sprintf("connect failure: %s", cf.Reason.String())
 }
+func (rgu *ReconnectGaveUp) PermanentDisconnectDescription() string {
+	return fmt.Sprintf("gave up reconnecting after %d attempts", rgu.Attempts)
+}
 
 // LoggedOut is emitted when the client has been unpaired from the phone.
 //
@@ -238,6 +248,58 @@ type StreamError struct {
 // Disconnected is emitted when the websocket is closed by the server.
 type Disconnected struct{}
 
+// ConnectionState is the overall state of the client's connection, as returned by Client.State.
+type ConnectionState string
+
+const (
+	// ConnectionDisconnected means there's no connection and the client isn't trying to connect.
+	ConnectionDisconnected ConnectionState = "disconnected"
+	// ConnectionConnecting means the client is opening the socket.
+	ConnectionConnecting ConnectionState = "connecting"
+	// ConnectionHandshaking means the socket is open and the noise handshake is in progress.
+	ConnectionHandshaking ConnectionState = "handshaking"
+	// ConnectionAuthenticating means the handshake is done and the client is waiting for the server to
+	// accept the login, or for the user to pair the device if the store doesn't have an ID yet.
+	ConnectionAuthenticating ConnectionState = "authenticating"
+	// ConnectionSyncingOffline means the client is logged in and receiving messages that were sent while it was offline.
+	ConnectionSyncingOffline ConnectionState = "syncing_offline"
+	// ConnectionOnline means the client is logged in and has received all offline messages.
+	ConnectionOnline ConnectionState = "online"
+	// ConnectionLoggedOut means the device was unlinked. The client must be paired again.
+	ConnectionLoggedOut ConnectionState = "logged_out"
+	// ConnectionBanned means the server rejected the login with a temporary ban.
+	ConnectionBanned ConnectionState = "banned"
+)
+
+// ConnectionStateChanged is emitted when the value returned by Client.State changes.
+//
+// The events are dispatched in order, but asynchronously, so the state may have changed again by the time
+// the event is handled.
+type ConnectionStateChanged struct {
+	Old ConnectionState
+	New ConnectionState
+	// Cause is a short description of what caused the change, e.g. "connect success" or "stream error 503".
+	Cause string
+}
+
+// ReconnectScheduled is emitted when the client is waiting to automatically reconnect.
+// The delay is decided by the Client.ReconnectPolicy.
+type ReconnectScheduled struct {
+	// Attempt is the number of the upcoming reconnect attempt, starting from 1.
+	Attempt int
+	Delay   time.Duration
+	// Error is the error that the previous attempt failed with. It's nil before the first attempt.
+	Error error
+}
+
+// ReconnectGaveUp is emitted when automatic reconnection is stopped by the Client.ReconnectPolicy.
+type ReconnectGaveUp struct {
+	// Attempts is the number of reconnect attempts that were made.
+	Attempts int
+	// Error is the error that the last attempt failed with, if any.
+	Error error
+}
+
 // HistorySync is emitted when the phone has sent a blob of historical messages.
 type HistorySync struct {
 	Data *waHistorySync.HistorySync
@@ -598,3 +660,41 @@ type NewsletterLiveUpdate struct {
 	Time     time.Time
 	Messages []*types.NewsletterMessage
 }
+
+// OutboxState is the delivery state of a message in the client's outbox.
+type OutboxState string
+
+const (
+	OutboxQueued   OutboxState = "queued"
+	OutboxSending  OutboxState = "sending"
+	OutboxRetrying OutboxState = "retrying"
+	OutboxSent     OutboxState = "sent"
+	OutboxFailed   OutboxState = "failed"
+)
+
+// OutboxMessageState is emitted when the delivery state of a message queued with Client.EnqueueMessage changes.
+//
+// Messages in the sent and failed states have been removed from the outbox.
+type OutboxMessageState struct {
+	Chat  types.JID
+	ID    types.MessageID
+	State OutboxState
+	// Attempts is the number of failed attempts to send the message so far.
+	Attempts int
+	// NextAttempt is when the message will be sent again. Only set in the retrying state.
+	NextAttempt time.Time
+	// Error is the error that the last attempt failed with. Only set in the retrying and failed states.
+	Error error
+	// Timestamp is the server timestamp of the sent message. Only set in the sent state.
+	Timestamp time.Time
+}
+
+// HandlerPanic is emitted when a handler registered with whatsmeow.Subscribe panics.
+// The panic is recovered and the subscription keeps handling other events.
+type HandlerPanic struct {
+	// Event is the event that the handler was handling.
+	Event any
+	// Panic is the value that the handler panicked with.
+	Panic any
+	Stack string
+}
@@ -18,6 +18,10 @@ type MessageSource struct {
 	IsFromMe bool // Whether the message was sent by the current user instead of someone else.
 	IsGroup  bool // Whether the chat is a group chat or broadcast list.
 
+	// The alternate address of the sender, i.e. the phone number JID if Sender is a hidden user ID (LID) or vice versa.
+	// This is only set if the server included the alternate address or the mapping is otherwise known.
+	SenderAlt JID
+
 	// When sending a read receipt to a broadcast list message, the Chat is the broadcast list
 	// and Sender is you, so this field contains the recipient of the read receipt.
 	BroadcastListOwner JID
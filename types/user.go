@@ -24,6 +24,7 @@ type UserInfo struct {
 	Status       string
 	PictureID    string
 	Devices      []JID
+	LID          JID
 }
 
 type BotListInfo struct {
@@ -75,6 +76,12 @@ type LocalChatSettings struct {
 	MutedUntil time.Time
 	Pinned     bool
 	Archived   bool
+
+	MarkedAsUnread      bool      // Whether the chat was manually marked as unread.
+	LastCleared         time.Time // The last time the chat was cleared or deleted.
+	EphemeralExpiration uint32    // The disappearing message timer in seconds, or 0 if disappearing messages are off.
+	Locked              bool      // Whether the chat is locked.
+	Labels              []string  // The IDs of labels associated with the chat, sorted alphabetically.
 }
 
 // IsOnWhatsAppResponse contains information received in response to checking if a phone number is on WhatsApp.
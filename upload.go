@@ -189,7 +189,7 @@ func (cli *Client) UploadNewsletterReader(ctx context.Context, data io.ReadSeeke
 }
 
 func (cli *Client) rawUpload(ctx context.Context, dataToUpload io.Reader, uploadSize uint64, fileHash []byte, appInfo MediaType, newsletter bool, resp *UploadResponse) error {
-	mediaConn, err := cli.refreshMediaConn(false)
+	mediaConn, err := cli.refreshMediaConn(ctx, false)
 	if err != nil {
 		return fmt.Errorf("failed to refresh media connections: %w", err)
 	}
@@ -243,6 +243,8 @@ func (cli *Client) rawUpload(ctx context.Context, dataToUpload io.Reader, upload
 		err = fmt.Errorf("upload failed with status code %d", httpResp.StatusCode)
 	} else if err = json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
 		err = fmt.Errorf("failed to parse upload response: %w", err)
+	} else {
+		cli.getMetrics().MediaUploaded(int64(uploadSize))
 	}
 	if httpResp != nil {
 		_ = httpResp.Body.Close()
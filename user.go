@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 
@@ -35,10 +36,16 @@ const (
 // The links look like https://wa.me/message/<code> or https://api.whatsapp.com/message/<code>. You can either provide
 // the full link, or just the <code> part.
 func (cli *Client) ResolveBusinessMessageLink(code string) (*types.BusinessMessageLinkTarget, error) {
+	return cli.ResolveBusinessMessageLinkContext(context.TODO(), code)
+}
+
+// ResolveBusinessMessageLinkContext is like ResolveBusinessMessageLink, but takes a context for cancellation and deadlines.
+func (cli *Client) ResolveBusinessMessageLinkContext(ctx context.Context, code string) (*types.BusinessMessageLinkTarget, error) {
 	code = strings.TrimPrefix(code, BusinessMessageLinkPrefix)
 	code = strings.TrimPrefix(code, BusinessMessageLinkDirectPrefix)
 
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "w:qr",
 		Type:      iqGet,
 		// WhatsApp android doesn't seem to have a "to" field for this one at all, not sure why but it works
@@ -82,10 +89,16 @@ func (cli *Client) ResolveBusinessMessageLink(code string) (*types.BusinessMessa
 // The links look like https://wa.me/qr/<code> or https://api.whatsapp.com/qr/<code>. You can either provide
 // the full link, or just the <code> part.
 func (cli *Client) ResolveContactQRLink(code string) (*types.ContactQRLinkTarget, error) {
+	return cli.ResolveContactQRLinkContext(context.TODO(), code)
+}
+
+// ResolveContactQRLinkContext is like ResolveContactQRLink, but takes a context for cancellation and deadlines.
+func (cli *Client) ResolveContactQRLinkContext(ctx context.Context, code string) (*types.ContactQRLinkTarget, error) {
 	code = strings.TrimPrefix(code, ContactQRLinkPrefix)
 	code = strings.TrimPrefix(code, ContactQRLinkDirectPrefix)
 
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "w:qr",
 		Type:      iqGet,
 		Content: []waBinary.Node{{
@@ -117,11 +130,17 @@ func (cli *Client) ResolveContactQRLink(code string) (*types.ContactQRLinkTarget
 //
 // If the revoke parameter is set to true, it will ask the server to revoke the previous link and generate a new one.
 func (cli *Client) GetContactQRLink(revoke bool) (string, error) {
+	return cli.GetContactQRLinkContext(context.TODO(), revoke)
+}
+
+// GetContactQRLinkContext is like GetContactQRLink, but takes a context for cancellation and deadlines.
+func (cli *Client) GetContactQRLinkContext(ctx context.Context, revoke bool) (string, error) {
 	action := "get"
 	if revoke {
 		action = "revoke"
 	}
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "w:qr",
 		Type:      iqSet,
 		Content: []waBinary.Node{{
@@ -148,7 +167,13 @@ func (cli *Client) GetContactQRLink(revoke bool) (string, error) {
 // This is different from the ephemeral status broadcast messages. Use SendMessage to types.StatusBroadcastJID to send
 // such messages.
 func (cli *Client) SetStatusMessage(msg string) error {
+	return cli.SetStatusMessageContext(context.TODO(), msg)
+}
+
+// SetStatusMessageContext is like SetStatusMessage, but takes a context for cancellation and deadlines.
+func (cli *Client) SetStatusMessageContext(ctx context.Context, msg string) error {
 	_, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "status",
 		Type:      iqSet,
 		To:        types.ServerJID,
@@ -163,11 +188,16 @@ func (cli *Client) SetStatusMessage(msg string) error {
 // IsOnWhatsApp checks if the given phone numbers are registered on WhatsApp.
 // The phone numbers should be in international format, including the `+` prefix.
 func (cli *Client) IsOnWhatsApp(phones []string) ([]types.IsOnWhatsAppResponse, error) {
+	return cli.IsOnWhatsAppContext(context.TODO(), phones)
+}
+
+// IsOnWhatsAppContext is like IsOnWhatsApp, but takes a context for cancellation and deadlines.
+func (cli *Client) IsOnWhatsAppContext(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error) {
 	jids := make([]types.JID, len(phones))
 	for i := range jids {
 		jids[i] = types.NewJID(phones[i], types.LegacyUserServer)
 	}
-	list, err := cli.usync(context.TODO(), jids, "query", "interactive", []waBinary.Node{
+	list, err := cli.usync(ctx, jids, "query", "interactive", []waBinary.Node{
 		{Tag: "business", Content: []waBinary.Node{{Tag: "verified_name"}}},
 		{Tag: "contact"},
 	})
@@ -196,13 +226,19 @@ func (cli *Client) IsOnWhatsApp(phones []string) ([]types.IsOnWhatsAppResponse,
 	return output, nil
 }
 
-// GetUserInfo gets basic user info (avatar, status, verified business name, device list).
+// GetUserInfo gets basic user info (avatar, status, verified business name, device list, hidden user ID).
 func (cli *Client) GetUserInfo(jids []types.JID) (map[types.JID]types.UserInfo, error) {
-	list, err := cli.usync(context.TODO(), jids, "full", "background", []waBinary.Node{
+	return cli.GetUserInfoContext(context.TODO(), jids)
+}
+
+// GetUserInfoContext is like GetUserInfo, but takes a context for cancellation and deadlines.
+func (cli *Client) GetUserInfoContext(ctx context.Context, jids []types.JID) (map[types.JID]types.UserInfo, error) {
+	list, err := cli.usync(ctx, jids, "full", "background", []waBinary.Node{
 		{Tag: "business", Content: []waBinary.Node{{Tag: "verified_name"}}},
 		{Tag: "status"},
 		{Tag: "picture"},
 		{Tag: "devices", Attrs: waBinary.Attrs{"version": "2"}},
+		{Tag: "lid"},
 	})
 	if err != nil {
 		return nil, err
@@ -222,6 +258,7 @@ func (cli *Client) GetUserInfo(jids []types.JID) (map[types.JID]types.UserInfo,
 		info.Status = string(status)
 		info.PictureID, _ = child.GetChildByTag("picture").Attrs["id"].(string)
 		info.Devices = parseDeviceList(jid.User, child.GetChildByTag("devices"))
+		info.LID, _ = child.GetChildByTag("lid").Attrs["val"].(types.JID)
 		if verifiedName != nil {
 			cli.updateBusinessName(jid, nil, verifiedName.Details.GetVerifiedName())
 		}
@@ -231,7 +268,13 @@ func (cli *Client) GetUserInfo(jids []types.JID) (map[types.JID]types.UserInfo,
 }
 
 func (cli *Client) GetBotListV2() ([]types.BotListInfo, error) {
+	return cli.GetBotListV2Context(context.TODO())
+}
+
+// GetBotListV2Context is like GetBotListV2, but takes a context for cancellation and deadlines.
+func (cli *Client) GetBotListV2Context(ctx context.Context) ([]types.BotListInfo, error) {
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		To:        types.ServerJID,
 		Namespace: "bot",
 		Type:      iqGet,
@@ -265,12 +308,17 @@ func (cli *Client) GetBotListV2() ([]types.BotListInfo, error) {
 }
 
 func (cli *Client) GetBotProfiles(botInfo []types.BotListInfo) ([]types.BotProfileInfo, error) {
+	return cli.GetBotProfilesContext(context.TODO(), botInfo)
+}
+
+// GetBotProfilesContext is like GetBotProfiles, but takes a context for cancellation and deadlines.
+func (cli *Client) GetBotProfilesContext(ctx context.Context, botInfo []types.BotListInfo) ([]types.BotProfileInfo, error) {
 	jids := make([]types.JID, len(botInfo))
 	for i, bot := range botInfo {
 		jids[i] = bot.BotJID
 	}
 
-	list, err := cli.usync(context.TODO(), jids, "query", "interactive", []waBinary.Node{
+	list, err := cli.usync(ctx, jids, "query", "interactive", []waBinary.Node{
 		{Tag: "bot", Content: []waBinary.Node{{Tag: "profile", Attrs: waBinary.Attrs{"v": "1"}}}},
 	}, UsyncQueryExtras{
 		BotListInfo: botInfo,
@@ -389,7 +437,13 @@ func (cli *Client) parseBusinessProfile(node *waBinary.Node) (*types.BusinessPro
 
 // GetBusinessProfile gets the profile info of a WhatsApp business account
 func (cli *Client) GetBusinessProfile(jid types.JID) (*types.BusinessProfile, error) {
+	return cli.GetBusinessProfileContext(context.TODO(), jid)
+}
+
+// GetBusinessProfileContext is like GetBusinessProfile, but takes a context for cancellation and deadlines.
+func (cli *Client) GetBusinessProfileContext(ctx context.Context, jid types.JID) (*types.BusinessProfile, error) {
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Type:      iqGet,
 		To:        types.ServerJID,
 		Namespace: "w:biz",
@@ -432,7 +486,7 @@ func (cli *Client) GetUserDevicesContext(ctx context.Context, jids []types.JID)
 
 	var devices, jidsToSync, fbJIDsToSync []types.JID
 	for _, jid := range jids {
-		cached, ok := cli.userDevicesCache[jid]
+		cached, ok := cli.getCachedDevices(jid)
 		if ok && len(cached.devices) > 0 {
 			devices = append(devices, cached.devices...)
 		} else if jid.Server == types.MessengerServer {
@@ -447,6 +501,7 @@ func (cli *Client) GetUserDevicesContext(ctx context.Context, jids []types.JID)
 	if len(jidsToSync) > 0 {
 		list, err := cli.usync(ctx, jidsToSync, "query", "message", []waBinary.Node{
 			{Tag: "devices", Attrs: waBinary.Attrs{"version": "2"}},
+			{Tag: "lid"},
 		})
 		if err != nil {
 			return nil, err
@@ -458,7 +513,7 @@ func (cli *Client) GetUserDevicesContext(ctx context.Context, jids []types.JID)
 				continue
 			}
 			userDevices := parseDeviceList(jid.User, user.GetChildByTag("devices"))
-			cli.userDevicesCache[jid] = deviceCache{devices: userDevices, dhash: participantListHashV2(userDevices)}
+			cli.putCachedDevices(jid, deviceCache{devices: userDevices, dhash: participantListHashV2(userDevices)})
 			devices = append(devices, userDevices...)
 		}
 	}
@@ -474,7 +529,7 @@ func (cli *Client) GetUserDevicesContext(ctx context.Context, jids []types.JID)
 				continue
 			}
 			userDevices := parseFBDeviceList(jid, user.GetChildByTag("devices"))
-			cli.userDevicesCache[jid] = userDevices
+			cli.putCachedDevices(jid, userDevices)
 			devices = append(devices, userDevices.devices...)
 		}
 	}
@@ -482,6 +537,69 @@ func (cli *Client) GetUserDevicesContext(ctx context.Context, jids []types.JID)
 	return devices, nil
 }
 
+// storedDeviceListMaxAge is how long device lists loaded from the store are trusted. Lists in memory are kept
+// up to date with device notifications, but stored lists may have missed changes while the client wasn't running.
+const storedDeviceListMaxAge = 24 * time.Hour
+
+// getCachedDevices returns the cached device list of the given user, reading it from the store
+// if it's not cached in memory. The caller must hold userDevicesCacheLock.
+func (cli *Client) getCachedDevices(jid types.JID) (deviceCache, bool) {
+	cached, ok := cli.userDevicesCache[jid]
+	if ok || cli.Store.DeviceLists == nil {
+		return cached, ok
+	}
+	devices, dhash, updatedAt, err := cli.Store.DeviceLists.GetDeviceList(jid)
+	if err != nil {
+		cli.Log.Warnf("Failed to get device list of %s from store: %v", jid, err)
+		return cached, false
+	} else if devices == nil || time.Since(updatedAt) > storedDeviceListMaxAge {
+		return cached, false
+	}
+	cached = deviceCache{devices: devices, dhash: dhash}
+	cli.userDevicesCache[jid] = cached
+	return cached, true
+}
+
+// putCachedDevices caches the device list of the given user in memory and in the store.
+// The caller must hold userDevicesCacheLock.
+func (cli *Client) putCachedDevices(jid types.JID, cache deviceCache) {
+	cli.userDevicesCache[jid] = cache
+	if cli.Store.DeviceLists != nil {
+		err := cli.Store.DeviceLists.PutDeviceList(jid, cache.devices, cache.dhash)
+		if err != nil {
+			cli.Log.Warnf("Failed to store device list of %s: %v", jid, err)
+		}
+	}
+}
+
+// deleteCachedDevices removes the device list of the given user from the memory and store caches.
+// The caller must hold userDevicesCacheLock.
+func (cli *Client) deleteCachedDevices(jid types.JID) {
+	delete(cli.userDevicesCache, jid)
+	if cli.Store.DeviceLists != nil {
+		err := cli.Store.DeviceLists.DeleteDeviceList(jid)
+		if err != nil {
+			cli.Log.Warnf("Failed to delete device list of %s from store: %v", jid, err)
+		}
+	}
+}
+
+// invalidateParticipantCaches removes the cached participant list of the given chat and the cached device lists
+// of the given participants. This is used when the server says the participant list hash of a sent message
+// was wrong, so that the lists are fetched again for the next message.
+func (cli *Client) invalidateParticipantCaches(chat types.JID, participants []types.JID) {
+	if chat.Server == types.GroupServer {
+		cli.groupParticipantsCacheLock.Lock()
+		cli.deleteCachedGroupParticipants(chat)
+		cli.groupParticipantsCacheLock.Unlock()
+	}
+	cli.userDevicesCacheLock.Lock()
+	for _, participant := range participants {
+		cli.deleteCachedDevices(participant)
+	}
+	cli.userDevicesCacheLock.Unlock()
+}
+
 type GetProfilePictureParams struct {
 	Preview     bool
 	ExistingID  string
@@ -495,6 +613,11 @@ type GetProfilePictureParams struct {
 //
 // To get a community photo, you should pass `IsCommunity: true`, as otherwise you may get a 401 error.
 func (cli *Client) GetProfilePictureInfo(jid types.JID, params *GetProfilePictureParams) (*types.ProfilePictureInfo, error) {
+	return cli.GetProfilePictureInfoContext(context.TODO(), jid, params)
+}
+
+// GetProfilePictureInfoContext is like GetProfilePictureInfo, but takes a context for cancellation and deadlines.
+func (cli *Client) GetProfilePictureInfoContext(ctx context.Context, jid types.JID, params *GetProfilePictureParams) (*types.ProfilePictureInfo, error) {
 	attrs := waBinary.Attrs{
 		"query": "url",
 	}
@@ -535,6 +658,7 @@ func (cli *Client) GetProfilePictureInfo(jid types.JID, params *GetProfilePictur
 		}}
 	}
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: namespace,
 		Type:      "get",
 		To:        to,
@@ -801,6 +925,7 @@ func (cli *Client) usync(ctx context.Context, jids []types.JID, mode, context st
 	} else if list, ok := resp.GetOptionalChildByTag("usync", "list"); !ok {
 		return nil, &ElementMissingError{Tag: "list", In: "response to usync query"}
 	} else {
+		cli.storeLIDMappingsFromUsync(&list)
 		return &list, err
 	}
 }
@@ -824,7 +949,13 @@ func (cli *Client) parseBlocklist(node *waBinary.Node) *types.Blocklist {
 
 // GetBlocklist gets the list of users that this user has blocked.
 func (cli *Client) GetBlocklist() (*types.Blocklist, error) {
+	return cli.GetBlocklistContext(context.TODO())
+}
+
+// GetBlocklistContext is like GetBlocklist, but takes a context for cancellation and deadlines.
+func (cli *Client) GetBlocklistContext(ctx context.Context) (*types.Blocklist, error) {
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "blocklist",
 		Type:      iqGet,
 		To:        types.ServerJID,
@@ -841,7 +972,13 @@ func (cli *Client) GetBlocklist() (*types.Blocklist, error) {
 
 // UpdateBlocklist updates the user's block list and returns the updated list.
 func (cli *Client) UpdateBlocklist(jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error) {
+	return cli.UpdateBlocklistContext(context.TODO(), jid, action)
+}
+
+// UpdateBlocklistContext is like UpdateBlocklist, but takes a context for cancellation and deadlines.
+func (cli *Client) UpdateBlocklistContext(ctx context.Context, jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error) {
 	resp, err := cli.sendIQ(infoQuery{
+		Context:   ctx,
 		Namespace: "blocklist",
 		Type:      iqSet,
 		To:        types.ServerJID,
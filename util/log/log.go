@@ -9,6 +9,8 @@ package waLog
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"time"
 )
@@ -22,6 +24,33 @@ type Logger interface {
 	Sub(module string) Logger
 }
 
+// FieldLogger is an optional extension of Logger for loggers that support structured key-value fields.
+type FieldLogger interface {
+	Logger
+	// With returns a logger that includes the given fields in all log lines.
+	// The fields are alternating keys and values, like in [log/slog.Logger.With].
+	With(fields ...any) Logger
+}
+
+// Common field keys used by whatsmeow.
+const (
+	FieldChat      = "chat"
+	FieldSender    = "sender"
+	FieldMessageID = "message_id"
+	FieldIQID      = "iq_id"
+	FieldDevice    = "device"
+	FieldAppState  = "app_state"
+)
+
+// With adds the given fields to the logger if it implements FieldLogger.
+// Loggers that don't support fields are returned as-is.
+func With(log Logger, fields ...any) Logger {
+	if fieldLog, ok := log.(FieldLogger); ok {
+		return fieldLog.With(fields...)
+	}
+	return log
+}
+
 type noopLogger struct{}
 
 func (n *noopLogger) Errorf(_ string, _ ...interface{}) {}
@@ -29,14 +58,17 @@ func (n *noopLogger) Warnf(_ string, _ ...interface{})  {}
 func (n *noopLogger) Infof(_ string, _ ...interface{})  {}
 func (n *noopLogger) Debugf(_ string, _ ...interface{}) {}
 func (n *noopLogger) Sub(_ string) Logger               { return n }
+func (n *noopLogger) With(_ ...any) Logger              { return n }
 
 // Noop is a no-op Logger implementation that silently drops everything.
 var Noop Logger = &noopLogger{}
 
 type stdoutLogger struct {
-	mod   string
-	color bool
-	min   int
+	out    io.Writer
+	mod    string
+	color  bool
+	min    int
+	fields string
 }
 
 var colors = map[string]string{
@@ -62,7 +94,7 @@ func (s *stdoutLogger) outputf(level, msg string, args ...interface{}) {
 		colorStart = colors[level]
 		colorReset = "\033[0m"
 	}
-	fmt.Printf("%s%s [%s %s] %s%s\n", time.Now().Format("15:04:05.000"), colorStart, s.mod, level, fmt.Sprintf(msg, args...), colorReset)
+	_, _ = fmt.Fprintf(s.out, "%s%s [%s %s] %s%s%s\n", time.Now().Format("15:04:05.000"), colorStart, s.mod, level, fmt.Sprintf(msg, args...), s.fields, colorReset)
 }
 
 func (s *stdoutLogger) Errorf(msg string, args ...interface{}) { s.outputf("ERROR", msg, args...) }
@@ -70,7 +102,19 @@ func (s *stdoutLogger) Warnf(msg string, args ...interface{})  { s.outputf("WARN
 func (s *stdoutLogger) Infof(msg string, args ...interface{})  { s.outputf("INFO", msg, args...) }
 func (s *stdoutLogger) Debugf(msg string, args ...interface{}) { s.outputf("DEBUG", msg, args...) }
 func (s *stdoutLogger) Sub(mod string) Logger {
-	return &stdoutLogger{mod: fmt.Sprintf("%s/%s", s.mod, mod), color: s.color, min: s.min}
+	return &stdoutLogger{out: s.out, mod: fmt.Sprintf("%s/%s", s.mod, mod), color: s.color, min: s.min, fields: s.fields}
+}
+func (s *stdoutLogger) With(fields ...any) Logger {
+	var buf strings.Builder
+	buf.WriteString(s.fields)
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 < len(fields) {
+			_, _ = fmt.Fprintf(&buf, " %v=%v", fields[i], fields[i+1])
+		} else {
+			_, _ = fmt.Fprintf(&buf, " !BADKEY=%v", fields[i])
+		}
+	}
+	return &stdoutLogger{out: s.out, mod: s.mod, color: s.color, min: s.min, fields: buf.String()}
 }
 
 // Stdout is a simple Logger implementation that outputs to stdout. The module name given is included in log lines.
@@ -79,5 +123,5 @@ func (s *stdoutLogger) Sub(mod string) Logger {
 //
 // If color is true, then info, warn and error logs will be colored cyan, yellow and red respectively using ANSI color escape codes.
 func Stdout(module string, minLevel string, color bool) Logger {
-	return &stdoutLogger{mod: module, color: color, min: levelToInt[strings.ToUpper(minLevel)]}
+	return &stdoutLogger{out: os.Stdout, mod: module, color: color, min: levelToInt[strings.ToUpper(minLevel)]}
 }
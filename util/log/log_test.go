@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package waLog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func parseJSONLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var parsed map[string]any
+		if err := json.Unmarshal(line, &parsed); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", line, err)
+		}
+		lines = append(lines, parsed)
+	}
+	return lines
+}
+
+func expectFields(t *testing.T, line map[string]any, expected map[string]any) {
+	t.Helper()
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("Expected %s=%v in log line, got %v (line: %v)", key, value, line[key], line)
+		}
+	}
+}
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	log := Slog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	log.Debugf("hidden %d", 1)
+	log.Infof("hello %s", "world")
+	sub := With(log.Sub("Client"), FieldChat, "123@s.whatsapp.net").Sub("Send")
+	sub.Warnf("sending %d", 2)
+	With(sub, FieldMessageID, "ABCD", "dangling").Errorf("failed")
+
+	lines := parseJSONLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 log lines, got %d: %s", len(lines), buf.String())
+	}
+	expectFields(t, lines[0], map[string]any{"level": "INFO", "msg": "hello world"})
+	if _, ok := lines[0]["sublogger"]; ok {
+		t.Errorf("Root logger line has sublogger field: %v", lines[0])
+	}
+	// Each Sub call adds another sublogger attribute, so the last one (which wins when parsing) has the full path
+	expectFields(t, lines[1], map[string]any{
+		"level":     "WARN",
+		"msg":       "sending 2",
+		"sublogger": "Client/Send",
+		FieldChat:   "123@s.whatsapp.net",
+	})
+	expectFields(t, lines[2], map[string]any{
+		"level":        "ERROR",
+		"msg":          "failed",
+		FieldChat:      "123@s.whatsapp.net",
+		FieldMessageID: "ABCD",
+		"!BADKEY":      "dangling",
+	})
+}
+
+func TestZerologWith(t *testing.T) {
+	var buf bytes.Buffer
+	log := Zerolog(zerolog.New(&buf))
+	sub := With(log.Sub("Client"), FieldChat, "123@s.whatsapp.net", FieldDevice, 5).Sub("Send")
+	sub.Infof("sending %s", "message")
+
+	lines := parseJSONLines(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 log line, got %d: %s", len(lines), buf.String())
+	}
+	expectFields(t, lines[0], map[string]any{
+		"level":     "info",
+		"message":   "sending message",
+		"sublogger": "Client/Send",
+		FieldChat:   "123@s.whatsapp.net",
+		FieldDevice: float64(5),
+	})
+}
+
+func TestStdoutWith(t *testing.T) {
+	var buf bytes.Buffer
+	log := Stdout("Main", "INFO", false).(*stdoutLogger)
+	log.out = &buf
+	log.Debugf("hidden")
+	sub := With(log, FieldChat, "123@s.whatsapp.net").Sub("Send")
+	sub.Infof("sending %d", 1)
+	With(sub, FieldMessageID, "ABCD", "dangling").Warnf("failed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d: %s", len(lines), buf.String())
+	}
+	if expected := "[Main/Send INFO] sending 1 chat=123@s.whatsapp.net"; !strings.HasSuffix(lines[0], expected) {
+		t.Errorf("Unexpected log line %q, expected suffix %q", lines[0], expected)
+	}
+	if expected := "[Main/Send WARN] failed chat=123@s.whatsapp.net message_id=ABCD !BADKEY=dangling"; !strings.HasSuffix(lines[1], expected) {
+		t.Errorf("Unexpected log line %q, expected suffix %q", lines[1], expected)
+	}
+}
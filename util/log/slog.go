@@ -0,0 +1,49 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package waLog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+type slogLogger struct {
+	mod string
+	log *slog.Logger
+}
+
+// Slog wraps a [slog.Logger] to implement the [Logger] and [FieldLogger] interfaces.
+//
+// Subloggers will be created by setting the `sublogger` attribute, like with [Zerolog].
+func Slog(log *slog.Logger) Logger {
+	return &slogLogger{log: log}
+}
+
+func (s *slogLogger) logf(level slog.Level, msg string, args []any) {
+	ctx := context.Background()
+	if !s.log.Enabled(ctx, level) {
+		return
+	}
+	s.log.Log(ctx, level, fmt.Sprintf(msg, args...))
+}
+
+func (s *slogLogger) Warnf(msg string, args ...any)  { s.logf(slog.LevelWarn, msg, args) }
+func (s *slogLogger) Errorf(msg string, args ...any) { s.logf(slog.LevelError, msg, args) }
+func (s *slogLogger) Infof(msg string, args ...any)  { s.logf(slog.LevelInfo, msg, args) }
+func (s *slogLogger) Debugf(msg string, args ...any) { s.logf(slog.LevelDebug, msg, args) }
+func (s *slogLogger) Sub(module string) Logger {
+	if s.mod != "" {
+		module = fmt.Sprintf("%s/%s", s.mod, module)
+	}
+	return &slogLogger{mod: module, log: s.log.With("sublogger", module)}
+}
+func (s *slogLogger) With(fields ...any) Logger {
+	return &slogLogger{mod: s.mod, log: s.log.With(fields...)}
+}
+
+var _ FieldLogger = &slogLogger{}
@@ -34,5 +34,8 @@ func (z *zeroLogger) Sub(module string) Logger {
 	}
 	return &zeroLogger{mod: module, Logger: z.Logger.With().Str("sublogger", module).Logger()}
 }
+func (z *zeroLogger) With(fields ...any) Logger {
+	return &zeroLogger{mod: z.mod, Logger: z.Logger.With().Fields(fields).Logger()}
+}
 
-var _ Logger = &zeroLogger{}
+var _ FieldLogger = &zeroLogger{}
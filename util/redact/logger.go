@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package redact
+
+import (
+	waLog "github.com/shiestapoi/whatsmeow/util/log"
+)
+
+type redactLogger struct {
+	log waLog.Logger
+	cfg *Config
+}
+
+// Logger wraps a logger so that all log lines and structured fields are redacted with the given config.
+// Subloggers inherit the redaction, so wrapping the logger passed to whatsmeow.NewClient covers the
+// client's send and receive logs too.
+//
+// Log lines are formatted before being passed to the wrapped logger, even if the level is disabled.
+func Logger(log waLog.Logger, cfg *Config) waLog.Logger {
+	if cfg == nil {
+		return log
+	}
+	return &redactLogger{log: log, cfg: cfg}
+}
+
+var _ waLog.FieldLogger = (*redactLogger)(nil)
+
+func (rl *redactLogger) Warnf(msg string, args ...interface{}) {
+	rl.log.Warnf("%s", rl.cfg.Sprintf(msg, args...))
+}
+
+func (rl *redactLogger) Errorf(msg string, args ...interface{}) {
+	rl.log.Errorf("%s", rl.cfg.Sprintf(msg, args...))
+}
+
+func (rl *redactLogger) Infof(msg string, args ...interface{}) {
+	rl.log.Infof("%s", rl.cfg.Sprintf(msg, args...))
+}
+
+func (rl *redactLogger) Debugf(msg string, args ...interface{}) {
+	rl.log.Debugf("%s", rl.cfg.Sprintf(msg, args...))
+}
+
+func (rl *redactLogger) Sub(module string) waLog.Logger {
+	return &redactLogger{log: rl.log.Sub(module), cfg: rl.cfg}
+}
+
+func (rl *redactLogger) With(fields ...any) waLog.Logger {
+	redacted := make([]any, len(fields))
+	for i, field := range fields {
+		if i%2 == 1 {
+			field = rl.cfg.Field(field)
+		}
+		redacted[i] = field
+	}
+	return &redactLogger{log: waLog.With(rl.log, redacted...), cfg: rl.cfg}
+}
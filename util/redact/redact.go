@@ -0,0 +1,202 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package redact contains helpers for removing phone numbers, message contents and key material from logs.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/shiestapoi/whatsmeow/types"
+)
+
+// JIDMode controls how Config redacts user JIDs.
+type JIDMode int
+
+const (
+	// JIDKeep leaves JIDs as-is.
+	JIDKeep JIDMode = iota
+	// JIDMask replaces all but the last two digits of the user part with asterisks.
+	JIDMask
+	// JIDHash replaces the user part with a truncated HMAC-SHA256, so the same user can still be followed across
+	// log lines without revealing the phone number.
+	JIDHash
+)
+
+// Config contains the per-category switches for redaction. A nil Config doesn't redact anything.
+type Config struct {
+	// JIDs controls how the user part of user JIDs is written. The phone number of the creator in old-style
+	// group JIDs is redacted too. Other JIDs, like new-style groups and newsletters, are kept as-is.
+	JIDs JIDMode
+	// HashKey is the HMAC key used with JIDHash. Phone numbers are easy to brute force, so this should be
+	// a secret value if the hashes must not be reversible.
+	HashKey []byte
+	// Plaintext removes message contents: protobuf messages passed to loggers and the content of plaintext nodes.
+	Plaintext bool
+	// Keys removes key material: byte slices passed to loggers and the content of key nodes.
+	Keys bool
+}
+
+// KeyTags contains the tags of nodes whose content is key material.
+var KeyTags = map[string]struct{}{
+	"identity":        {},
+	"value":           {},
+	"signature":       {},
+	"device-identity": {},
+	"ref":             {},
+
+	"link_code_pairing_wrapped_companion_ephemeral_pub": {},
+	"link_code_pairing_wrapped_primary_ephemeral_pub":   {},
+	"link_code_pairing_wrapped_key_bundle":              {},
+	"link_code_pairing_ref":                             {},
+	"companion_server_auth_key_pub":                     {},
+	"companion_identity_public":                         {},
+	"primary_identity_pub":                              {},
+}
+
+// PlaintextTags contains the tags of nodes whose content is an unencrypted message.
+var PlaintextTags = map[string]struct{}{
+	"plaintext": {},
+	"body":      {},
+}
+
+// NodeContent returns a placeholder to show instead of the content of a node with the given tag,
+// or an empty string if the content doesn't need to be redacted.
+func (cfg *Config) NodeContent(tag string, length int) string {
+	if cfg == nil {
+		return ""
+	}
+	_, isKey := KeyTags[tag]
+	_, isPlaintext := PlaintextTags[tag]
+	if (isKey && cfg.Keys) || (isPlaintext && cfg.Plaintext) {
+		return fmt.Sprintf("<!-- %d bytes redacted -->", length)
+	}
+	return ""
+}
+
+// User redacts the user part of a JID according to the JIDs setting.
+func (cfg *Config) User(user string) string {
+	if cfg == nil || user == "" {
+		return user
+	}
+	switch cfg.JIDs {
+	case JIDMask:
+		if len(user) <= 2 {
+			return strings.Repeat("*", len(user))
+		}
+		return strings.Repeat("*", len(user)-2) + user[len(user)-2:]
+	case JIDHash:
+		h := hmac.New(sha256.New, cfg.HashKey)
+		h.Write([]byte(user))
+		return "h" + hex.EncodeToString(h.Sum(nil)[:6])
+	default:
+		return user
+	}
+}
+
+var userServers = map[string]struct{}{
+	types.DefaultUserServer: {},
+	types.LegacyUserServer:  {},
+	types.HiddenUserServer:  {},
+	types.HostedServer:      {},
+	types.MessengerServer:   {},
+}
+
+// JID redacts a parsed JID according to the JIDs setting.
+func (cfg *Config) JID(jid types.JID) string {
+	if cfg == nil || cfg.JIDs == JIDKeep {
+		return jid.String()
+	}
+	if _, ok := userServers[jid.Server]; ok {
+		jid.User = cfg.User(jid.User)
+	} else if creator, timestamp, ok := strings.Cut(jid.User, "-"); ok && jid.Server == types.GroupServer {
+		jid.User = cfg.User(creator) + "-" + timestamp
+	}
+	return jid.String()
+}
+
+var jidRegex = regexp.MustCompile(`\b([0-9]+)(-[0-9]+)?((?:[.:][0-9]+)*)@(s\.whatsapp\.net|c\.us|hosted|lid|msgr|g\.us)\b`)
+
+// Text redacts all JIDs found in the given text according to the JIDs setting.
+func (cfg *Config) Text(text string) string {
+	if cfg == nil || cfg.JIDs == JIDKeep || !strings.ContainsRune(text, '@') {
+		return text
+	}
+	return jidRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := jidRegex.FindStringSubmatch(match)
+		user, groupSuffix, deviceSuffix, server := parts[1], parts[2], parts[3], parts[4]
+		if server == types.GroupServer && groupSuffix == "" {
+			return match
+		}
+		return cfg.User(user) + groupSuffix + deviceSuffix + "@" + server
+	})
+}
+
+// placeholder is printed as-is regardless of the formatting verb, so that e.g. %x doesn't hex-encode it.
+type placeholder string
+
+func (p placeholder) Format(f fmt.State, _ rune) {
+	_, _ = f.Write([]byte(p))
+}
+
+// Arg redacts a single log argument. Protobuf messages are replaced if Plaintext is set and byte slices
+// are replaced if Keys is set. JIDs are redacted from the formatted log line by Text, so they're left as-is here.
+func (cfg *Config) Arg(arg any) any {
+	if cfg == nil {
+		return arg
+	}
+	switch value := arg.(type) {
+	case proto.Message:
+		if cfg.Plaintext && value != nil {
+			return placeholder(fmt.Sprintf("<redacted %s>", value.ProtoReflect().Descriptor().FullName()))
+		}
+	case []byte:
+		if cfg.Keys {
+			return placeholder(fmt.Sprintf("<%d bytes redacted>", len(value)))
+		}
+	}
+	return arg
+}
+
+// Sprintf formats a log line like fmt.Sprintf and redacts the arguments and the result.
+func (cfg *Config) Sprintf(msg string, args ...any) string {
+	if cfg == nil {
+		return fmt.Sprintf(msg, args...)
+	}
+	redactedArgs := make([]any, len(args))
+	for i, arg := range args {
+		redactedArgs[i] = cfg.Arg(arg)
+	}
+	return cfg.Text(fmt.Sprintf(msg, redactedArgs...))
+}
+
+// Field redacts the value of a structured logging field.
+func (cfg *Config) Field(value any) any {
+	value = cfg.Arg(value)
+	if p, ok := value.(placeholder); ok {
+		return string(p)
+	} else if cfg == nil || cfg.JIDs == JIDKeep {
+		return value
+	}
+	switch typedValue := value.(type) {
+	case types.JID:
+		return cfg.JID(typedValue)
+	case string:
+		return cfg.Text(typedValue)
+	case error:
+		return cfg.Text(typedValue.Error())
+	case fmt.Stringer:
+		return cfg.Text(typedValue.String())
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025 Tulir Asokan
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package redact_test
+
+import (
+	"strings"
+	"testing"
+
+	waBinary "github.com/shiestapoi/whatsmeow/binary"
+	"github.com/shiestapoi/whatsmeow/proto/waE2E"
+	"github.com/shiestapoi/whatsmeow/types"
+	"github.com/shiestapoi/whatsmeow/util/redact"
+)
+
+func TestText(t *testing.T) {
+	cfg := &redact.Config{JIDs: redact.JIDMask}
+	input := "Failed to decrypt message from 1234567890:12@s.whatsapp.net in 15551234567-1600000000@g.us and 120363000000000000@g.us"
+	expected := "Failed to decrypt message from ********90:12@s.whatsapp.net in *********67-1600000000@g.us and 120363000000000000@g.us"
+	if output := cfg.Text(input); output != expected {
+		t.Errorf("Unexpected masked text:\n%s\n%s", output, expected)
+	}
+
+	hashCfg := &redact.Config{JIDs: redact.JIDHash, HashKey: []byte("secret")}
+	first := hashCfg.Text("1234567890@s.whatsapp.net")
+	second := hashCfg.JID(types.NewADJID("1234567890", 0, 3))
+	if strings.Contains(first, "1234567890") {
+		t.Errorf("Hashed text still contains phone number: %s", first)
+	} else if user, _, _ := strings.Cut(first, "@"); !strings.HasPrefix(second, user+":3@") {
+		t.Errorf("Hashes of the same user don't match: %s and %s", first, second)
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	cfg := &redact.Config{JIDs: redact.JIDMask, Plaintext: true, Keys: true}
+	msg := &waE2E.Message{Conversation: ptr("secret message")}
+	output := cfg.Sprintf("Got %v from %s with key %x", msg, types.NewJID("1234567890", types.DefaultUserServer), []byte{1, 2, 3})
+	expected := "Got <redacted WAWebProtobufsE2E.Message> from ********90@s.whatsapp.net with key <3 bytes redacted>"
+	if output != expected {
+		t.Errorf("Unexpected log line:\n%s\n%s", output, expected)
+	}
+}
+
+func TestXMLString(t *testing.T) {
+	node := waBinary.Node{
+		Tag:   "message",
+		Attrs: waBinary.Attrs{"from": types.NewJID("1234567890", types.DefaultUserServer), "id": "ABCD"},
+		Content: []waBinary.Node{
+			{Tag: "plaintext", Content: []byte("secret message")},
+			{Tag: "identity", Content: []byte{1, 2, 3}},
+		},
+	}
+	output := node.RedactedXMLString(&redact.Config{JIDs: redact.JIDMask, Plaintext: true, Keys: true})
+	expected := `<message from="********90@s.whatsapp.net" id="ABCD">` +
+		`<plaintext><!-- 14 bytes redacted --></plaintext><identity><!-- 3 bytes redacted --></identity></message>`
+	if output != expected {
+		t.Errorf("Unexpected XML:\n%s\n%s", output, expected)
+	}
+	if unredacted := node.RedactedXMLString(nil); unredacted != node.XMLString() || !strings.Contains(unredacted, "secret message") {
+		t.Errorf("Nil config redacted something: %s", unredacted)
+	}
+}
+
+func ptr[T any](val T) *T {
+	return &val
+}